@@ -0,0 +1,241 @@
+package astisub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default anchor correction options
+const anchorDefaultConstantOffsetTolerance = 100 * time.Millisecond
+
+// Anchor represents a moment of the subtitles, its actual time, that must be moved to its desired time
+type Anchor struct {
+	Actual  time.Duration
+	Desired time.Duration
+}
+
+func (a Anchor) offset() time.Duration {
+	return a.Desired - a.Actual
+}
+
+// AnchorCorrectionOptions represents anchor correction options
+type AnchorCorrectionOptions struct {
+	// If true, consecutive anchors with the same offset, within the tolerance, are considered part of a segment
+	// between two cuts (e.g. removed ads or trimmed scenes) and items of that segment are shifted by the segment's
+	// offset instead of being interpolated between anchors. Items between two segments are shifted like the
+	// closest one while items next to anchors that don't share their offset (e.g. drift) are still interpolated.
+	ConstantOffsets bool
+	// Defaults to 100ms
+	ConstantOffsetTolerance time.Duration
+}
+
+// ApplyAnchorCorrection moves items so that anchors' actual times match their desired times
+// Items are mapped linearly between consecutive anchors and, outside of them, like by the closest pair of anchors.
+// With 2 anchors, it is the same as ApplyLinearCorrection.
+func (s *Subtitles) ApplyAnchorCorrection(as []Anchor) error {
+	return s.ApplyAnchorCorrectionWithOptions(as, AnchorCorrectionOptions{})
+}
+
+// ApplyAnchorCorrectionWithOptions moves items so that anchors' actual times match their desired times with options
+func (s *Subtitles) ApplyAnchorCorrectionWithOptions(as []Anchor, opts AnchorCorrectionOptions) (err error) {
+	// No anchors
+	if len(as) == 0 {
+		err = errors.New("astisub: no anchors")
+		return
+	}
+
+	// Sort anchors
+	as = append([]Anchor{}, as...)
+	sort.SliceStable(as, func(i, j int) bool { return as[i].Actual < as[j].Actual })
+
+	// Validate anchors
+	for idx := 1; idx < len(as); idx++ {
+		if as[idx].Actual == as[idx-1].Actual {
+			err = fmt.Errorf("astisub: several anchors have the same actual time %s", as[idx].Actual)
+			return
+		}
+		if !opts.ConstantOffsets && as[idx].Desired < as[idx-1].Desired {
+			err = fmt.Errorf("astisub: anchor desired time %s is before the previous anchor's %s", as[idx].Desired, as[idx-1].Desired)
+			return
+		}
+	}
+
+	// Get mapping
+	fn := anchorsLinearMapping(as)
+	if opts.ConstantOffsets {
+		if opts.ConstantOffsetTolerance <= 0 {
+			opts.ConstantOffsetTolerance = anchorDefaultConstantOffsetTolerance
+		}
+		fn = anchorsConstantOffsetsMapping(as, opts.ConstantOffsetTolerance)
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		startAt := fn(i.StartAt)
+		endAt := fn(i.EndAt)
+
+		// Items spanning a cut keep their duration
+		if endAt <= startAt {
+			endAt = startAt + i.EndAt - i.StartAt
+		}
+		i.EndAt = endAt
+		i.StartAt = startAt
+	}
+
+	// Cuts may have changed items order
+	s.Order()
+	return
+}
+
+// anchorsLinearMapping interpolates linearly between consecutive sorted anchors
+func anchorsLinearMapping(as []Anchor) func(d time.Duration) time.Duration {
+	return func(d time.Duration) time.Duration {
+		// Only one anchor
+		if len(as) == 1 {
+			return d + as[0].offset()
+		}
+
+		// Get the pair of anchors, the first and last ones being used outside of the anchors
+		idx := sort.Search(len(as), func(idx int) bool { return as[idx].Actual > d }) - 1
+		if idx < 0 {
+			idx = 0
+		} else if idx > len(as)-2 {
+			idx = len(as) - 2
+		}
+		a1, a2 := as[idx], as[idx+1]
+
+		// Interpolate
+		return a1.Desired + time.Duration(math.Round(float64(d-a1.Actual)*float64(a2.Desired-a1.Desired)/float64(a2.Actual-a1.Actual)))
+	}
+}
+
+// anchorsConstantOffsetsMapping shifts durations by the offset of the segment of anchors they belong to
+// Segments are made of at least 2 consecutive anchors sharing the same offset. Durations between anchors that don't
+// belong to a segment are interpolated linearly.
+func anchorsConstantOffsetsMapping(as []Anchor, tolerance time.Duration) func(d time.Duration) time.Duration {
+	// Group consecutive anchors sharing the same offset
+	var gs [][]Anchor
+	for idx, a := range as {
+		if idx == 0 || (a.offset()-as[idx-1].offset() > tolerance || as[idx-1].offset()-a.offset() > tolerance) {
+			gs = append(gs, []Anchor{})
+		}
+		gs[len(gs)-1] = append(gs[len(gs)-1], a)
+	}
+
+	// Anchors of a segment are moved by the segment's average offset so that durations between them are shifted
+	// by the same offset
+	var adjusted []Anchor
+	var segments []int
+	for idx, g := range gs {
+		// Not a segment
+		if len(g) == 1 {
+			adjusted = append(adjusted, g[0])
+			segments = append(segments, -1)
+			continue
+		}
+
+		// Get average offset
+		var sum time.Duration
+		for _, a := range g {
+			sum += a.offset()
+		}
+		offset := sum / time.Duration(len(g))
+
+		// Adjust anchors
+		for _, a := range g {
+			adjusted = append(adjusted, Anchor{Actual: a.Actual, Desired: a.Actual + offset})
+			segments = append(segments, idx)
+		}
+	}
+	linear := anchorsLinearMapping(adjusted)
+
+	return func(d time.Duration) time.Duration {
+		// Get the previous anchor
+		idx := sort.Search(len(adjusted), func(idx int) bool { return adjusted[idx].Actual > d }) - 1
+
+		// Outside of the anchors, segments are extended
+		if idx < 0 {
+			if segments[0] >= 0 {
+				return d + adjusted[0].offset()
+			}
+		} else if idx == len(adjusted)-1 {
+			if segments[idx] >= 0 {
+				return d + adjusted[idx].offset()
+			}
+		} else if segments[idx] >= 0 && segments[idx+1] >= 0 && segments[idx] != segments[idx+1] {
+			// Cut between two segments, halfway between their anchors
+			if d < adjusted[idx].Actual+(adjusted[idx+1].Actual-adjusted[idx].Actual)/2 {
+				return d + adjusted[idx].offset()
+			}
+			return d + adjusted[idx+1].offset()
+		}
+		return linear(d)
+	}
+}
+
+// ReadAnchors parses anchors, one "<actual> <desired>" pair per line
+// Times are either seconds such as "62.5" or clock times such as "00:01:02.500" or "00:01:02,500". Empty lines and
+// lines starting with "#" are ignored.
+func ReadAnchors(i io.Reader) (as []Anchor, err error) {
+	// Scan
+	var scanner = bufio.NewScanner(i)
+	var lineNum int
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+
+		// Empty lines and comments
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Split
+		fs := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ';' })
+		if len(fs) != 2 {
+			err = fmt.Errorf("astisub: line %d: invalid anchor %s", lineNum, line)
+			return
+		}
+
+		// Parse times
+		var a Anchor
+		if a.Actual, err = parseDurationAnchor(fs[0]); err != nil {
+			err = fmt.Errorf("astisub: line %d: parsing actual time %s failed: %w", lineNum, fs[0], err)
+			return
+		}
+		if a.Desired, err = parseDurationAnchor(fs[1]); err != nil {
+			err = fmt.Errorf("astisub: line %d: parsing desired time %s failed: %w", lineNum, fs[1], err)
+			return
+		}
+		as = append(as, a)
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("astisub: scanning failed: %w", err)
+		return
+	}
+	return
+}
+
+// parseDurationAnchor parses an anchor time
+func parseDurationAnchor(i string) (d time.Duration, err error) {
+	// Clock time
+	if strings.Contains(i, ":") {
+		return parseDuration(strings.Replace(i, ",", ".", 1), ".", 3)
+	}
+
+	// Seconds
+	var f float64
+	if f, err = strconv.ParseFloat(i, 64); err != nil {
+		err = fmt.Errorf("astisub: parsing float %s failed: %w", i, err)
+		return
+	}
+	d = time.Duration(math.Round(f * float64(time.Second)))
+	return
+}
@@ -0,0 +1,101 @@
+package astisub_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtitles_ApplyAnchorCorrection(t *testing.T) {
+	// Errors
+	s := mockSubtitlesAt(time.Second, 2*time.Second)
+	assert.Error(t, s.ApplyAnchorCorrection(nil))
+	assert.Error(t, s.ApplyAnchorCorrection([]astisub.Anchor{{Actual: time.Second}, {Actual: time.Second, Desired: time.Second}}))
+	assert.Error(t, s.ApplyAnchorCorrection([]astisub.Anchor{{Actual: time.Second, Desired: 2 * time.Second}, {Actual: 2 * time.Second, Desired: time.Second}}))
+
+	// Single anchor
+	require.NoError(t, s.ApplyAnchorCorrection([]astisub.Anchor{{Actual: 10 * time.Second, Desired: 12 * time.Second}}))
+	assert.Equal(t, 3*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 4*time.Second, s.Items[0].EndAt)
+
+	// Two anchors behave like a linear correction
+	s1 := mockSubtitlesAt(time.Second, 3*time.Second, 30*time.Second, 31*time.Second)
+	s2 := mockSubtitlesAt(time.Second, 3*time.Second, 30*time.Second, 31*time.Second)
+	s1.ApplyLinearCorrection(2*time.Second, 3*time.Second, 20*time.Second, 25*time.Second)
+	require.NoError(t, s2.ApplyAnchorCorrection([]astisub.Anchor{{Actual: 20 * time.Second, Desired: 25 * time.Second}, {Actual: 2 * time.Second, Desired: 3 * time.Second}}))
+	for idx := range s1.Items {
+		assert.InDelta(t, s1.Items[idx].StartAt, s2.Items[idx].StartAt, 1)
+		assert.InDelta(t, s1.Items[idx].EndAt, s2.Items[idx].EndAt, 1)
+	}
+
+	// Piecewise linear
+	s = mockSubtitlesAt(5*time.Second, 15*time.Second, 25*time.Second, 26*time.Second)
+	require.NoError(t, s.ApplyAnchorCorrection([]astisub.Anchor{
+		{},
+		{Actual: 10 * time.Second, Desired: 10 * time.Second},
+		{Actual: 20 * time.Second, Desired: 30 * time.Second},
+	}))
+	assert.Equal(t, 5*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 20*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 40*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 42*time.Second, s.Items[1].EndAt)
+
+	// Constant offsets between cuts
+	s = mockSubtitlesAt(50*time.Second, 51*time.Second, 58*time.Second, 62*time.Second, 65*time.Second, 66*time.Second)
+	require.NoError(t, s.ApplyAnchorCorrectionWithOptions([]astisub.Anchor{
+		{Actual: 10 * time.Second, Desired: 10 * time.Second},
+		{Actual: 20 * time.Second, Desired: 20050 * time.Millisecond},
+		{Actual: 100 * time.Second, Desired: 70 * time.Second},
+		{Actual: 110 * time.Second, Desired: 80 * time.Second},
+	}, astisub.AnchorCorrectionOptions{ConstantOffsets: true}))
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, 35*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 36*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 50025*time.Millisecond, s.Items[1].StartAt)
+	assert.Equal(t, 51025*time.Millisecond, s.Items[1].EndAt)
+	assert.Equal(t, 58025*time.Millisecond, s.Items[2].StartAt)
+	assert.Equal(t, 62025*time.Millisecond, s.Items[2].EndAt)
+
+	// Drift followed by constant offsets
+	s = mockSubtitlesAt(50*time.Second, 60*time.Second, 150*time.Second, 160*time.Second, 250*time.Second, 260*time.Second, 350*time.Second, 360*time.Second, 450*time.Second, 460*time.Second)
+	require.NoError(t, s.ApplyAnchorCorrectionWithOptions([]astisub.Anchor{
+		{Actual: 0, Desired: 0},
+		{Actual: 100 * time.Second, Desired: 100500 * time.Millisecond},
+		{Actual: 200 * time.Second, Desired: 201 * time.Second},
+		{Actual: 300 * time.Second, Desired: 250 * time.Second},
+		{Actual: 400 * time.Second, Desired: 350 * time.Second},
+	}, astisub.AnchorCorrectionOptions{ConstantOffsets: true}))
+	require.Len(t, s.Items, 5)
+	assert.Equal(t, 50250*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 60300*time.Millisecond, s.Items[0].EndAt)
+	assert.Equal(t, 150750*time.Millisecond, s.Items[1].StartAt)
+	assert.Equal(t, 160800*time.Millisecond, s.Items[1].EndAt)
+	assert.Equal(t, 225500*time.Millisecond, s.Items[2].StartAt)
+	assert.Equal(t, 230400*time.Millisecond, s.Items[2].EndAt)
+	assert.Equal(t, 300*time.Second, s.Items[3].StartAt)
+	assert.Equal(t, 310*time.Second, s.Items[3].EndAt)
+	assert.Equal(t, 400*time.Second, s.Items[4].StartAt)
+	assert.Equal(t, 410*time.Second, s.Items[4].EndAt)
+}
+
+func TestReadAnchors(t *testing.T) {
+	as, err := astisub.ReadAnchors(strings.NewReader(`# actual desired
+00:01:02.500 00:01:00,000
+
+120	130.25
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []astisub.Anchor{
+		{Actual: 62500 * time.Millisecond, Desired: time.Minute},
+		{Actual: 2 * time.Minute, Desired: 130250 * time.Millisecond},
+	}, as)
+
+	_, err = astisub.ReadAnchors(strings.NewReader("1 2 3"))
+	assert.Error(t, err)
+	_, err = astisub.ReadAnchors(strings.NewReader("1 a"))
+	assert.Error(t, err)
+}
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"github.com/asticode/go-astisub"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asticode/go-astikit"
 )
 
 // Flags
 var (
+	anchorsPath      = flag.String("af", "", "the anchors file, one \"<actual> <desired>\" pair per line")
+	anchorsConstant  = flag.Bool("ac", false, "whether items between cuts are shifted by constant offsets instead of being interpolated between anchors")
+	anchorsTolerance = flag.Duration("at", 0, "the tolerance within which anchors offsets are considered constant, defaults to 100ms")
 	actual1          = flag.Duration("a1", 0, "the first actual duration")
 	actual2          = flag.Duration("a2", 0, "the second actual duration")
 	desired1         = flag.Duration("d1", 0, "the first desired duration")
@@ -21,13 +30,35 @@ var (
 	inputPath        = astikit.NewFlagStrings()
 	teletextPage     = flag.Int("p", 0, "the teletext page")
 	outputPath       = flag.String("o", "", "the output path")
-	syncDuration     = flag.Duration("s", 0, "the sync duration")
+	syncDuration     = flag.String("s", "", "the sync duration such as -2s, 1.5 (seconds) or 00:00:02:00 (timecode)")
 	segmentationType = flag.String("st", "UNIFIED", "the segmentation type UNIFIED/SPECIFIED. In unified"+
 		" segmentation all segment have same duration whereas specified have user given duration for each segment.")
 	segmentDuration  = flag.Float64("sd", 5, "segmentation duration for unified segmentation type")
 	segmentDurations = flag.String("sds", "", "segment durations for all segments seperated by comma")
-	webvttOffset     = flag.Float64("wo", 0, "webvtt offset for synchronization of segment in hls")
-	timecodeOffset   = flag.Float64("to", 0, "timecode offset to modify start timecode")
+	webvttOffset     = flag.String("wo", "", "webvtt offset for synchronization of segment in hls such as 10 (seconds) or 10:00:00:00 (timecode)")
+	segmentTimeline  = flag.String("tl", "", "the .m3u8 media playlist or .mpd whose segment boundaries are used for segmentation")
+	edlPath          = flag.String("e", "", "the cmx3600 edl file whose timecodes are expressed in the -tr framerate")
+	edlMinDuration   = flag.Duration("em", 0, "the min duration of conformed items, shorter ones are dropped")
+	edlRecordStart   = flag.String("er", "", "the edl record time matching 0 in the output such as 01:00:00:00 (timecode)")
+	edlSourceStart   = flag.String("es", "", "the edl source time matching 0 in the input such as 10:00:00:00 (timecode)")
+	dashType         = flag.String("dt", "webvtt", "the dash text track type webvtt/ttml/stpp/wvtt")
+	dashLanguages    = flag.String("dl", "", "the dash text track languages matching input paths, seperated by comma")
+	dashFragment     = flag.Bool("df", false, "whether only adaptation sets are written instead of a whole mpd")
+	hlsSegmentURI    = flag.String("hu", "seg-%03d.vtt", "the hls segment uri format, segments are written next to the media playlist")
+	hlsPlaylistType  = flag.String("ht", "VOD", "the hls playlist type VOD/EVENT")
+	hlsDuration      = flag.Duration("hdur", 0, "the hls rendition duration, defaults to the end of the last subtitle")
+	hlsMultivariant  = flag.String("hm", "", "the hls multivariant playlist to add the EXT-X-MEDIA tag to")
+	hlsGroupID       = flag.String("hg", "subs", "the hls EXT-X-MEDIA group id")
+	hlsName          = flag.String("hn", "", "the hls EXT-X-MEDIA name")
+	hlsLanguage      = flag.String("hl", "", "the hls EXT-X-MEDIA language")
+	hlsDefault       = flag.Bool("hd", false, "whether the hls EXT-X-MEDIA is the default one")
+	hlsForced        = flag.Bool("hf", false, "whether the hls EXT-X-MEDIA is forced")
+	timecodeOffset   = flag.String("to", "", "timecode offset to modify start timecode such as 3600 (seconds) or 01:00:00:00 (timecode)")
+	timecodeRate     = flag.String("tr", "25", "the framerate of timecodes provided to offset flags such as 25 or 29.97")
+	framerateFrom    = flag.String("ff", "", "the framerate subtitles are converted from such as 25, 29.97 or 30000/1001")
+	framerateTo      = flag.String("ft", "", "the framerate subtitles are converted or snapped to such as 25, 29.97 or 30000/1001")
+	framerateMode    = flag.String("fm", "speed", "the framerate conversion mode speed/timecode")
+	basePTS          = flag.Int64("bp", -1, "the 90kHz pts webvtt X-TIMESTAMP-MAP values are read relative to, ignored if < 0")
 )
 
 func main() {
@@ -46,15 +77,41 @@ func main() {
 		log.Fatal("Use -o to provide an output path")
 	}
 
-	// Open first input path
+	// Open first input path, hls media playlists being read by the merge-segments subcommand
 	var sub *astisub.Subtitles
 	var err error
-	if sub, err = astisub.Open(astisub.Options{Filename: (*inputPath.Slice)[0], Teletext: astisub.TeletextOptions{Page: *teletextPage}}); err != nil {
-		log.Fatalf("%s while opening %s", err, (*inputPath.Slice)[0])
+	if cmd != "merge-segments" {
+		if sub, err = astisub.Open(openOptions((*inputPath.Slice)[0])); err != nil {
+			log.Fatalf("%s while opening %s", err, (*inputPath.Slice)[0])
+		}
 	}
 
 	// Switch on subcommand
 	switch cmd {
+	case "apply-anchor-correction":
+		// Validate anchors path
+		if *anchorsPath == "" {
+			log.Fatal("Use -af to provide an anchors file")
+		}
+
+		// Read anchors
+		var as []astisub.Anchor
+		if as, err = readAnchors(*anchorsPath); err != nil {
+			log.Fatalf("%s while reading anchors %s", err, *anchorsPath)
+		}
+
+		// Apply anchor correction
+		if err = sub.ApplyAnchorCorrectionWithOptions(as, astisub.AnchorCorrectionOptions{
+			ConstantOffsets:         *anchorsConstant,
+			ConstantOffsetTolerance: *anchorsTolerance,
+		}); err != nil {
+			log.Fatalf("%s while applying anchor correction", err)
+		}
+
+		// Write
+		if err = sub.Write(*outputPath); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
 	case "apply-linear-correction":
 		// Validate actual and desired durations
 		if *actual1 <= 0 {
@@ -73,6 +130,50 @@ func main() {
 		// Apply linear correction
 		sub.ApplyLinearCorrection(*actual1, *desired1, *actual2, *desired2)
 
+		// Write
+		if err = sub.Write(*outputPath); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+	case "convert-framerate":
+		// Parse framerates
+		var from, to astisub.Framerate
+		if from, err = astisub.ParseFramerate(*framerateFrom); err != nil {
+			log.Fatalf("%s while parsing framerate %s", err, *framerateFrom)
+		}
+		if to, err = astisub.ParseFramerate(*framerateTo); err != nil {
+			log.Fatalf("%s while parsing framerate %s", err, *framerateTo)
+		}
+
+		// Convert framerate
+		if err = sub.ConvertFramerate(from, to, astisub.FramerateConversionMode(*framerateMode)); err != nil {
+			log.Fatalf("%s while converting framerate", err)
+		}
+
+		// Write
+		if err = sub.Write(*outputPath); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+	case "conform":
+		// Validate edl path
+		if *edlPath == "" {
+			log.Fatal("Use -e to provide an edl file")
+		}
+
+		// Read edl
+		var e *astisub.EDL
+		if e, err = readEDL(*edlPath); err != nil {
+			log.Fatalf("%s while reading edl %s", err, *edlPath)
+		}
+
+		// Conform
+		if err = sub.ConformWithOptions(*e, astisub.ConformOptions{
+			MinDuration: *edlMinDuration,
+			RecordStart: mustParseOffset(*edlRecordStart),
+			SourceStart: mustParseOffset(*edlSourceStart),
+		}); err != nil {
+			log.Fatalf("%s while conforming", err)
+		}
+
 		// Write
 		if err = sub.Write(*outputPath); err != nil {
 			log.Fatalf("%s while writing to %s", err, *outputPath)
@@ -95,6 +196,175 @@ func main() {
 		if err = sub.Write(*outputPath); err != nil {
 			log.Fatalf("%s while writing to %s", err, *outputPath)
 		}
+	case "dash":
+		// go run main.go dash -i en.srt -i fr.srt -dl en,fr -dt stpp -sd 4 -o "out/manifest.mpd"
+		// Get languages
+		var languages []string
+		if *dashLanguages != "" {
+			languages = strings.Split(*dashLanguages, ",")
+		}
+
+		// Get timeline
+		var tl *astisub.SegmentTimeline
+		if *segmentTimeline != "" {
+			if tl, err = astisub.OpenSegmentTimeline(*segmentTimeline); err != nil {
+				log.Fatalf("%s while opening %s", err, *segmentTimeline)
+			}
+		}
+
+		// Loop through input paths
+		var ts []astisub.DASHTextTrack
+		for idx, path := range *inputPath.Slice {
+			// Open
+			s := sub
+			if idx > 0 {
+				if s, err = astisub.Open(openOptions(path)); err != nil {
+					log.Fatalf("%s while opening %s", err, path)
+				}
+			}
+
+			// Create track
+			t := astisub.DASHTextTrack{
+				SegmentDuration: time.Duration(*segmentDuration * float64(time.Second)),
+				Subtitles:       s,
+				Timeline:        tl,
+				Type:            *dashType,
+			}
+			if idx < len(languages) {
+				t.Language = languages[idx]
+			}
+			ts = append(ts, t)
+		}
+
+		// Loop through tracks
+		dir := filepath.Dir(*outputPath)
+		ids := astisub.DASHRepresentationIDs(ts)
+		for idx := range ts {
+			t, id, path, s := &ts[idx], ids[idx], (*inputPath.Slice)[idx], ts[idx].Subtitles
+
+			// Write files
+			switch *dashType {
+			case astisub.DASHTextTrackTypeTTML, astisub.DASHTextTrackTypeWebVTT:
+				t.URL = id + ".vtt"
+				if *dashType == astisub.DASHTextTrackTypeTTML {
+					t.URL = id + ".ttml"
+				}
+				if err = s.Write(filepath.Join(dir, t.URL)); err != nil {
+					log.Fatalf("%s while writing %s", err, t.URL)
+				}
+			case astisub.DASHTextTrackTypeSTPP, astisub.DASHTextTrackTypeWVTT:
+				// Get timeline
+				var stl *astisub.SegmentTimeline
+				if stl, err = t.SegmentTimeline(); err != nil {
+					log.Fatalf("%s while segmenting %s", err, path)
+				}
+
+				// Create directory
+				if err = os.MkdirAll(filepath.Join(dir, id), 0755); err != nil {
+					log.Fatalf("%s while creating directory for %s", err, path)
+				}
+
+				// Write init
+				opts := astisub.MP4Options{SampleEntryType: astisub.MP4SampleEntryTypeWebVTT}
+				if *dashType == astisub.DASHTextTrackTypeSTPP {
+					opts.SampleEntryType = astisub.MP4SampleEntryTypeTTML
+				}
+				if err = writeFile(filepath.Join(dir, id, "init.mp4"), func(w io.Writer) error { return s.WriteToMP4Init(w, opts) }); err != nil {
+					log.Fatalf("%s while writing init of %s", err, path)
+				}
+
+				// Write segments
+				for idxSegment, seg := range stl.Segments {
+					opts.BaseMediaDecodeTime = seg.StartAt
+					opts.Duration = seg.Duration
+					opts.SequenceNumber = uint32(stl.MediaSequence + idxSegment)
+					p := filepath.Join(dir, id, strconv.Itoa(int(opts.SequenceNumber))+".m4s")
+					if err = writeFile(p, func(w io.Writer) error { return s.WriteToMP4Segment(w, opts) }); err != nil {
+						log.Fatalf("%s while writing to %s", err, p)
+					}
+				}
+			}
+		}
+
+		// Write mpd
+		if err = writeFile(*outputPath, func(w io.Writer) error {
+			return astisub.WriteDASHMPD(w, ts, astisub.DASHOptions{Fragment: *dashFragment})
+		}); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+	case "hls":
+		// go run main.go hls -i <input_path> -sd 6 -o "out/playlist.m3u8" -wo 10 -hm "out/master.m3u8" -hn English -hl en
+		// Get segment durations
+		var opts = astisub.HLSOptions{
+			Duration:        *hlsDuration,
+			MPEGTSOffset:    mustParseOffset(*webvttOffset),
+			PlaylistType:    *hlsPlaylistType,
+			SegmentDuration: time.Duration(*segmentDuration * float64(time.Second)),
+			SegmentURI:      *hlsSegmentURI,
+		}
+		if *segmentTimeline != "" {
+			if opts.Timeline, err = astisub.OpenSegmentTimeline(*segmentTimeline); err != nil {
+				log.Fatalf("%s while opening %s", err, *segmentTimeline)
+			}
+		} else if *segmentationType == "SPECIFIED" {
+			for _, segDuration := range strings.Split(*segmentDurations, ",") {
+				segDur, err := strconv.ParseFloat(segDuration, 64)
+				if err != nil {
+					log.Fatalf("%s unable to parse seg duration %s", err, segDuration)
+				}
+				opts.SegmentDurations = append(opts.SegmentDurations, time.Duration(segDur*float64(time.Second)))
+			}
+		}
+
+		// Segment
+		var r *astisub.HLSRendition
+		if r, err = sub.HLSRendition(opts); err != nil {
+			log.Fatalf("%s while segmenting", err)
+		}
+
+		// Write segments
+		for _, s := range r.Segments {
+			p := filepath.Join(filepath.Dir(*outputPath), s.URI)
+			if err = writeFile(p, func(w io.Writer) error { return r.WriteSegment(w, s) }); err != nil {
+				log.Fatalf("%s while writing to %s", err, p)
+			}
+		}
+
+		// Write media playlist
+		if err = writeFile(*outputPath, r.WriteMediaPlaylist); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+
+		// Add media to multivariant playlist
+		if *hlsMultivariant != "" {
+			// Media uri is relative to the multivariant playlist
+			var uri string
+			if uri, err = filepath.Rel(filepath.Dir(*hlsMultivariant), *outputPath); err != nil {
+				log.Fatalf("%s while getting uri of %s", err, *outputPath)
+			}
+			m := astisub.HLSMedia{
+				Default:  *hlsDefault,
+				Forced:   *hlsForced,
+				GroupID:  *hlsGroupID,
+				Language: *hlsLanguage,
+				Name:     *hlsName,
+				URI:      filepath.ToSlash(uri),
+			}
+			if m.Name == "" {
+				m.Name = m.Language
+			}
+
+			// Read existing playlist
+			var b []byte
+			if b, err = ioutil.ReadFile(*hlsMultivariant); err != nil && !os.IsNotExist(err) {
+				log.Fatalf("%s while reading %s", err, *hlsMultivariant)
+			}
+
+			// Write
+			if err = writeFile(*hlsMultivariant, func(w io.Writer) error { return astisub.AddHLSMedia(bytes.NewReader(b), w, m) }); err != nil {
+				log.Fatalf("%s while writing to %s", err, *hlsMultivariant)
+			}
+		}
 	case "merge":
 		// Validate second input path
 		if len(*inputPath.Slice) == 1 {
@@ -103,13 +373,29 @@ func main() {
 
 		// Open second input path
 		var sub2 *astisub.Subtitles
-		if sub2, err = astisub.Open(astisub.Options{Filename: (*inputPath.Slice)[1], Teletext: astisub.TeletextOptions{Page: *teletextPage}}); err != nil {
+		if sub2, err = astisub.Open(openOptions((*inputPath.Slice)[1])); err != nil {
 			log.Fatalf("%s while opening %s", err, (*inputPath.Slice)[1])
 		}
 
 		// Merge
 		sub.Merge(sub2)
 
+		// Write
+		if err = sub.Write(*outputPath); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+	case "merge-segments":
+		// Validate input path
+		p := (*inputPath.Slice)[0]
+		if strings.ToLower(filepath.Ext(p)) != ".m3u8" {
+			log.Fatal("Use -i to provide a .m3u8 media playlist")
+		}
+
+		// Merge segments
+		if sub, err = astisub.ReadFromHLSPlaylistWithOptions(p, openOptions(p).WebVTT); err != nil {
+			log.Fatalf("%s while merging segments of %s", err, p)
+		}
+
 		// Write
 		if err = sub.Write(*outputPath); err != nil {
 			log.Fatalf("%s while writing to %s", err, *outputPath)
@@ -118,18 +404,35 @@ func main() {
 		// Optimize
 		sub.Optimize()
 
+		// Write
+		if err = sub.Write(*outputPath); err != nil {
+			log.Fatalf("%s while writing to %s", err, *outputPath)
+		}
+	case "snap-to-frames":
+		// Parse framerate
+		var f astisub.Framerate
+		if f, err = astisub.ParseFramerate(*framerateTo); err != nil {
+			log.Fatalf("%s while parsing framerate %s", err, *framerateTo)
+		}
+
+		// Snap to frames
+		if err = sub.SnapToFrames(f); err != nil {
+			log.Fatalf("%s while snapping to frames", err)
+		}
+
 		// Write
 		if err = sub.Write(*outputPath); err != nil {
 			log.Fatalf("%s while writing to %s", err, *outputPath)
 		}
 	case "sync":
 		// Validate sync duration
-		if *syncDuration == 0 {
+		d := mustParseOffset(*syncDuration)
+		if d == 0 {
 			log.Fatal("Use -s to provide a sync duration")
 		}
 
 		// Fragment
-		sub.Add(*syncDuration)
+		sub.Add(d)
 
 		// Write
 		if err = sub.Write(*outputPath); err != nil {
@@ -158,14 +461,25 @@ func main() {
 				sds = append(sds, segDur)
 			}
 		}
-		segmentedSubs := sub.Segment(*segmentationType, *segmentDuration, sds)
+		var segmentedSubs []*astisub.Subtitles
+		if *segmentTimeline != "" {
+			// Segments line up with the ones of an existing rendition
+			var t *astisub.SegmentTimeline
+			if t, err = astisub.OpenSegmentTimeline(*segmentTimeline); err != nil {
+				log.Fatalf("%s while opening %s", err, *segmentTimeline)
+			}
+			segmentedSubs = sub.SegmentWithTimeline(*t)
+		} else {
+			segmentedSubs = sub.Segment(*segmentationType, *segmentDuration, sds)
+		}
+		offset := mustParseOffset(*webvttOffset).Seconds()
 		for idx, segmentedSub := range segmentedSubs {
-			if err = segmentedSub.WriteToWebVTTFile(fmt.Sprintf(*outputPath, idx), *webvttOffset); err != nil {
+			if err = segmentedSub.WriteToWebVTTFile(fmt.Sprintf(*outputPath, idx), offset); err != nil {
 				log.Fatalf("%s while writing to %s", err, *outputPath)
 			}
 		}
 	case "modify-start-timecode":
-		if err = sub.ModifyStartTimeCode(*timecodeOffset); err != nil {
+		if err = sub.ModifyStartTimeCode(mustParseOffset(*timecodeOffset).Seconds()); err != nil {
 			log.Fatalf("%s while modify start time code to %s", err, *outputPath)
 		}
 		if err = sub.Write(*outputPath); err != nil {
@@ -175,3 +489,92 @@ func main() {
 		log.Fatalf("Invalid subcommand %s", cmd)
 	}
 }
+
+// writeFile creates the file and writes to it
+func writeFile(path string, fn func(w io.Writer) error) (err error) {
+	var f *os.File
+	if f, err = os.Create(path); err != nil {
+		return
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// readAnchors reads the anchors file
+func readAnchors(path string) (as []astisub.Anchor, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	return astisub.ReadAnchors(f)
+}
+
+// readEDL reads the edl file
+func readEDL(path string) (e *astisub.EDL, err error) {
+	// Parse framerate
+	var fr astisub.Framerate
+	if fr, err = astisub.ParseFramerate(*timecodeRate); err != nil {
+		return
+	}
+
+	// Open
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	return astisub.ReadEDL(f, fr)
+}
+
+// openOptions returns the options used to open input paths
+func openOptions(path string) (o astisub.Options) {
+	o = astisub.Options{Filename: path, Teletext: astisub.TeletextOptions{Page: *teletextPage}}
+	if *basePTS >= 0 {
+		p := astisub.PTS(*basePTS)
+		o.WebVTT.BasePTS = &p
+	}
+	return
+}
+
+// mustParseOffset parses an offset expressed as a duration (-2s), seconds (1.5) or a timecode (10:00:00:00)
+func mustParseOffset(i string) (d time.Duration) {
+	// Empty
+	i = strings.TrimSpace(i)
+	if i == "" {
+		return
+	}
+
+	// Get sign
+	sign := time.Duration(1)
+	v := i
+	if strings.HasPrefix(v, "-") {
+		sign = -1
+		v = v[1:]
+	}
+
+	// Timecode
+	var err error
+	if strings.ContainsAny(v, ":;") {
+		var f astisub.Framerate
+		if f, err = astisub.ParseFramerate(*timecodeRate); err != nil {
+			log.Fatalf("%s while parsing framerate %s", err, *timecodeRate)
+		}
+		var t astisub.Timecode
+		if t, err = astisub.ParseTimecode(v, f); err != nil {
+			log.Fatalf("%s while parsing timecode %s", err, i)
+		}
+		return sign * t.Duration()
+	}
+
+	// Seconds
+	if f, errParse := strconv.ParseFloat(v, 64); errParse == nil {
+		return sign * time.Duration(f*float64(time.Second))
+	}
+
+	// Duration
+	if d, err = time.ParseDuration(v); err != nil {
+		log.Fatalf("%s while parsing offset %s", err, i)
+	}
+	return sign * d
+}
@@ -0,0 +1,340 @@
+package astisub
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chapter represents a chapter
+type Chapter struct {
+	EndAt   time.Duration // Optional
+	StartAt time.Duration
+	Title   string
+}
+
+// NewSubtitlesFromChapters creates a chapters track out of chapters
+// Chapters without end are ended by the start of the next chapter. The duration, if > 0, ends the last chapter
+// when it has no end, otherwise it ends at its start.
+func NewSubtitlesFromChapters(cs []Chapter, duration time.Duration) (s *Subtitles) {
+	// Sort chapters
+	cs = append([]Chapter{}, cs...)
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].StartAt < cs[j].StartAt })
+
+	// Init
+	s = NewSubtitles()
+	s.Metadata = &Metadata{WebVTTKind: WebVTTKindChapters}
+
+	// Loop through chapters
+	for idx, c := range cs {
+		// Get end
+		endAt := c.EndAt
+		if endAt <= 0 {
+			if idx < len(cs)-1 {
+				endAt = cs[idx+1].StartAt
+			} else if duration > 0 {
+				endAt = duration
+			} else {
+				endAt = c.StartAt
+			}
+		}
+
+		// Append item
+		s.Items = append(s.Items, &Item{
+			EndAt:   endAt,
+			Lines:   []Line{{Items: []LineItem{{Text: c.Title}}}},
+			StartAt: c.StartAt,
+		})
+	}
+	return
+}
+
+// Chapters returns the items as chapters
+func (s Subtitles) Chapters() (cs []Chapter) {
+	for _, i := range s.Items {
+		cs = append(cs, Chapter{
+			EndAt:   i.EndAt,
+			StartAt: i.StartAt,
+			Title:   i.String(),
+		})
+	}
+	return
+}
+
+// https://ffmpeg.org/ffmpeg-formats.html#Metadata-1
+const ffmetadataHeader = ";FFMETADATA1"
+
+// ReadChaptersFromFFMetadata parses chapters out of an FFmetadata content
+func ReadChaptersFromFFMetadata(i io.Reader) (cs []Chapter, err error) {
+	// Scan
+	var scanner = bufio.NewScanner(i)
+	var lineNum int
+	var header bool
+	var c *ffmetadataChapter
+	var fcs []*ffmetadataChapter
+	for scanner.Scan() {
+		// Fetch line
+		line := scanner.Text()
+		lineNum++
+
+		// Header
+		if !header {
+			if strings.TrimPrefix(line, string(BytesBOM)) != ffmetadataHeader {
+				err = fmt.Errorf("astisub: line %d: invalid ffmetadata header %s", lineNum, line)
+				return
+			}
+			header = true
+			continue
+		}
+
+		// Newlines are escaped with a backslash
+		for ffmetadataIsEscaped(line, len(line)) && scanner.Scan() {
+			line = line[:len(line)-1] + "\n" + scanner.Text()
+			lineNum++
+		}
+
+		// Empty lines and comments
+		if len(line) == 0 || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		// Section
+		if strings.HasPrefix(line, "[") {
+			c = nil
+			if line == "[CHAPTER]" {
+				c = &ffmetadataChapter{timebaseNum: 1, timebaseDen: 1000000000}
+				fcs = append(fcs, c)
+			}
+			continue
+		}
+
+		// Only chapters are relevant
+		if c == nil {
+			continue
+		}
+
+		// Split key and value
+		key, value, ok := ffmetadataSplit(line)
+		if !ok {
+			err = fmt.Errorf("astisub: line %d: no separator found in %s", lineNum, line)
+			return
+		}
+
+		// Switch on key
+		switch key {
+		case "END":
+			if c.end, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing end %s failed: %w", lineNum, value, err)
+				return
+			}
+		case "START":
+			if c.start, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing start %s failed: %w", lineNum, value, err)
+				return
+			}
+		case "TIMEBASE":
+			split := strings.Split(value, "/")
+			if len(split) != 2 {
+				err = fmt.Errorf("astisub: line %d: invalid timebase %s", lineNum, value)
+				return
+			}
+			if c.timebaseNum, err = strconv.ParseInt(split[0], 10, 64); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing timebase numerator %s failed: %w", lineNum, split[0], err)
+				return
+			}
+			if c.timebaseDen, err = strconv.ParseInt(split[1], 10, 64); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing timebase denominator %s failed: %w", lineNum, split[1], err)
+				return
+			}
+			if c.timebaseNum <= 0 || c.timebaseDen <= 0 {
+				err = fmt.Errorf("astisub: line %d: invalid timebase %s", lineNum, value)
+				return
+			}
+		case "title":
+			c.title = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("astisub: scanning failed: %w", err)
+		return
+	}
+
+	// No header
+	if !header {
+		err = errors.New("astisub: no ffmetadata header found")
+		return
+	}
+
+	// Convert chapters
+	for _, c := range fcs {
+		cs = append(cs, Chapter{
+			EndAt:   c.duration(c.end),
+			StartAt: c.duration(c.start),
+			Title:   c.title,
+		})
+	}
+	return
+}
+
+type ffmetadataChapter struct {
+	end, start               int64
+	timebaseDen, timebaseNum int64
+	title                    string
+}
+
+func (c ffmetadataChapter) duration(i int64) time.Duration {
+	return time.Duration(math.Round(float64(i) * float64(c.timebaseNum) / float64(c.timebaseDen) * float64(time.Second)))
+}
+
+// ffmetadataIsEscaped checks whether the character at the given index follows an odd number of backslashes
+func ffmetadataIsEscaped(i string, idx int) bool {
+	var n int
+	for idx--; idx >= 0 && i[idx] == '\\'; idx-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// ffmetadataSplit splits the line on the first unescaped "=" and unescapes both key and value
+func ffmetadataSplit(i string) (key, value string, ok bool) {
+	for idx := 0; idx < len(i); idx++ {
+		if i[idx] == '=' && !ffmetadataIsEscaped(i, idx) {
+			return ffmetadataUnescape(i[:idx]), ffmetadataUnescape(i[idx+1:]), true
+		}
+	}
+	return
+}
+
+func ffmetadataUnescape(i string) string {
+	var b strings.Builder
+	for idx := 0; idx < len(i); idx++ {
+		if i[idx] == '\\' && idx < len(i)-1 {
+			idx++
+		}
+		b.WriteByte(i[idx])
+	}
+	return b.String()
+}
+
+// https://www.matroska.org/technical/chapters.html
+type matroskaChaptersXML struct {
+	Editions []matroskaChaptersXMLEdition `xml:"EditionEntry"`
+}
+
+type matroskaChaptersXMLEdition struct {
+	Atoms       []matroskaChaptersXMLAtom `xml:"ChapterAtom"`
+	FlagDefault int                       `xml:"EditionFlagDefault"`
+	FlagHidden  int                       `xml:"EditionFlagHidden"`
+}
+
+type matroskaChaptersXMLAtom struct {
+	Displays   []matroskaChaptersXMLDisplay `xml:"ChapterDisplay"`
+	FlagHidden int                          `xml:"ChapterFlagHidden"`
+	TimeEnd    string                       `xml:"ChapterTimeEnd"`
+	TimeStart  string                       `xml:"ChapterTimeStart"`
+}
+
+type matroskaChaptersXMLDisplay struct {
+	String string `xml:"ChapterString"`
+}
+
+// ReadChaptersFromMatroskaXML parses chapters out of a Matroska chapters XML content as produced by mkvextract
+// Only top level chapters of the default edition, or the first visible one, are returned. Hidden chapters are
+// skipped.
+func ReadChaptersFromMatroskaXML(i io.Reader) (cs []Chapter, err error) {
+	// Unmarshal
+	var x matroskaChaptersXML
+	if err = xml.NewDecoder(i).Decode(&x); err != nil {
+		err = fmt.Errorf("astisub: xml decoding failed: %w", err)
+		return
+	}
+
+	// Get edition
+	var e *matroskaChaptersXMLEdition
+	for idx := range x.Editions {
+		if x.Editions[idx].FlagHidden == 1 {
+			continue
+		}
+		if e == nil || x.Editions[idx].FlagDefault == 1 {
+			e = &x.Editions[idx]
+		}
+		if e.FlagDefault == 1 {
+			break
+		}
+	}
+	if e == nil {
+		return
+	}
+
+	// Loop through atoms
+	for _, a := range e.Atoms {
+		// Hidden
+		if a.FlagHidden == 1 {
+			continue
+		}
+
+		// Create chapter
+		var c Chapter
+		if c.StartAt, err = parseDurationMatroskaChapter(a.TimeStart); err != nil {
+			err = fmt.Errorf("astisub: parsing chapter start %s failed: %w", a.TimeStart, err)
+			return
+		}
+		if a.TimeEnd != "" {
+			if c.EndAt, err = parseDurationMatroskaChapter(a.TimeEnd); err != nil {
+				err = fmt.Errorf("astisub: parsing chapter end %s failed: %w", a.TimeEnd, err)
+				return
+			}
+		}
+		if len(a.Displays) > 0 {
+			c.Title = strings.TrimSpace(a.Displays[0].String)
+		}
+		cs = append(cs, c)
+	}
+	return
+}
+
+// parseDurationMatroskaChapter parses a matroska chapter duration such as "00:01:02.123456789"
+func parseDurationMatroskaChapter(i string) (d time.Duration, err error) {
+	// Split fraction
+	i = strings.TrimSpace(i)
+	var fraction string
+	if idx := strings.Index(i, "."); idx >= 0 {
+		i, fraction = i[:idx], i[idx+1:]
+	}
+	if len(fraction) > 9 {
+		fraction = fraction[:9]
+	}
+
+	// Parse fraction
+	if fraction != "" {
+		var n int
+		if n, err = strconv.Atoi(fraction); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", fraction, err)
+			return
+		}
+		d = time.Duration(n * int(math.Pow10(9-len(fraction))))
+	}
+
+	// Parse hours, minutes and seconds
+	parts := strings.Split(i, ":")
+	if len(parts) != 3 {
+		err = fmt.Errorf("astisub: no hours, minutes or seconds detected in %s", i)
+		return
+	}
+	for idx, u := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		var n int
+		if n, err = strconv.Atoi(parts[idx]); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", parts[idx], err)
+			return
+		}
+		d += time.Duration(n) * u
+	}
+	return
+}
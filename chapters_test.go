@@ -0,0 +1,112 @@
+package astisub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChapters(t *testing.T) {
+	s := astisub.NewSubtitlesFromChapters([]astisub.Chapter{
+		{StartAt: 90 * time.Second, Title: "Act 2"},
+		{StartAt: 0, Title: "Act 1"},
+		{EndAt: 4 * time.Minute, StartAt: 3 * time.Minute, Title: "Credits"},
+	}, 5*time.Minute)
+	assert.Equal(t, []astisub.Chapter{
+		{EndAt: 90 * time.Second, Title: "Act 1"},
+		{EndAt: 3 * time.Minute, StartAt: 90 * time.Second, Title: "Act 2"},
+		{EndAt: 4 * time.Minute, StartAt: 3 * time.Minute, Title: "Credits"},
+	}, s.Chapters())
+
+	b := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Equal(t, `WEBVTT
+
+1
+00:00:00.000 --> 00:01:30.000
+Act 1
+
+2
+00:01:30.000 --> 00:03:00.000
+Act 2
+
+3
+00:03:00.000 --> 00:04:00.000
+Credits
+`, b.String())
+}
+
+func TestReadChaptersFromFFMetadata(t *testing.T) {
+	cs, err := astisub.ReadChaptersFromFFMetadata(strings.NewReader(`;FFMETADATA1
+title=Movie
+; comment
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=90000
+title=Act 1\=2 \; \\
+
+[STREAM]
+title=not a chapter
+
+[CHAPTER]
+TIMEBASE=1/90000
+START=8100000
+END=16200000
+title=Multi\
+line
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []astisub.Chapter{
+		{EndAt: 90 * time.Second, Title: `Act 1=2 ; \`},
+		{EndAt: 3 * time.Minute, StartAt: 90 * time.Second, Title: "Multi\nline"},
+	}, cs)
+
+	_, err = astisub.ReadChaptersFromFFMetadata(strings.NewReader("[CHAPTER]\n"))
+	assert.Error(t, err)
+}
+
+func TestReadChaptersFromMatroskaXML(t *testing.T) {
+	cs, err := astisub.ReadChaptersFromMatroskaXML(strings.NewReader(`<?xml version="1.0"?>
+<!DOCTYPE Chapters SYSTEM "matroskachapters.dtd">
+<Chapters>
+  <EditionEntry>
+    <EditionFlagHidden>1</EditionFlagHidden>
+    <ChapterAtom>
+      <ChapterTimeStart>00:00:00.000000000</ChapterTimeStart>
+      <ChapterDisplay><ChapterString>Hidden edition</ChapterString></ChapterDisplay>
+    </ChapterAtom>
+  </EditionEntry>
+  <EditionEntry>
+    <EditionFlagDefault>1</EditionFlagDefault>
+    <ChapterAtom>
+      <ChapterTimeStart>00:00:00.000000000</ChapterTimeStart>
+      <ChapterDisplay>
+        <ChapterString>Intro</ChapterString>
+        <ChapterLanguage>eng</ChapterLanguage>
+      </ChapterDisplay>
+    </ChapterAtom>
+    <ChapterAtom>
+      <ChapterTimeStart>00:00:30.5</ChapterTimeStart>
+      <ChapterFlagHidden>1</ChapterFlagHidden>
+      <ChapterDisplay><ChapterString>Hidden</ChapterString></ChapterDisplay>
+    </ChapterAtom>
+    <ChapterAtom>
+      <ChapterTimeStart>00:01:02.123456789</ChapterTimeStart>
+      <ChapterTimeEnd>01:00:00.000000000</ChapterTimeEnd>
+      <ChapterDisplay><ChapterString>Main</ChapterString></ChapterDisplay>
+    </ChapterAtom>
+  </EditionEntry>
+</Chapters>`))
+	require.NoError(t, err)
+	assert.Equal(t, []astisub.Chapter{
+		{Title: "Intro"},
+		{EndAt: time.Hour, StartAt: time.Minute + 2*time.Second + 123456789, Title: "Main"},
+	}, cs)
+}
@@ -0,0 +1,603 @@
+package astisub
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://www.iso.org/standard/83314.html
+
+// Vars
+var dashRegexpDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+type dashInMPD struct {
+	Periods []dashInPeriod `xml:"Period"`
+}
+
+type dashInPeriod struct {
+	AdaptationSets  []dashInAdaptationSet  `xml:"AdaptationSet"`
+	Start           string                 `xml:"start,attr"`
+	SegmentTemplate *dashInSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type dashInAdaptationSet struct {
+	ContentType     string                 `xml:"contentType,attr"`
+	MimeType        string                 `xml:"mimeType,attr"`
+	Representations []dashInRepresentation `xml:"Representation"`
+	SegmentTemplate *dashInSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+func (a dashInAdaptationSet) isVideo() bool {
+	if a.ContentType == "video" || strings.HasPrefix(a.MimeType, "video/") {
+		return true
+	}
+	for _, r := range a.Representations {
+		if strings.HasPrefix(r.MimeType, "video/") {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentTemplate returns the first segment template with a timeline, segment templates of representations
+// inheriting from the adaptation set's and the period's
+func (a dashInAdaptationSet) segmentTemplate(p dashInPeriod) *dashInSegmentTemplate {
+	parent := a.SegmentTemplate.inherit(p.SegmentTemplate)
+	for _, r := range a.Representations {
+		if t := r.SegmentTemplate.inherit(parent); t != nil && len(t.Timeline) > 0 {
+			return t
+		}
+	}
+	if parent != nil && len(parent.Timeline) > 0 {
+		return parent
+	}
+	return nil
+}
+
+type dashInRepresentation struct {
+	MimeType        string                 `xml:"mimeType,attr"`
+	SegmentTemplate *dashInSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type dashInSegmentTemplate struct {
+	PresentationTimeOffset *int64    `xml:"presentationTimeOffset,attr"`
+	StartNumber            *int      `xml:"startNumber,attr"`
+	Timeline               []dashInS `xml:"SegmentTimeline>S"`
+	Timescale              *int64    `xml:"timescale,attr"`
+}
+
+// inherit fills attributes missing in the segment template with the parent's
+func (t *dashInSegmentTemplate) inherit(parent *dashInSegmentTemplate) *dashInSegmentTemplate {
+	if t == nil {
+		return parent
+	} else if parent == nil {
+		return t
+	}
+	o := *t
+	if o.PresentationTimeOffset == nil {
+		o.PresentationTimeOffset = parent.PresentationTimeOffset
+	}
+	if o.StartNumber == nil {
+		o.StartNumber = parent.StartNumber
+	}
+	if len(o.Timeline) == 0 {
+		o.Timeline = parent.Timeline
+	}
+	if o.Timescale == nil {
+		o.Timescale = parent.Timescale
+	}
+	return &o
+}
+
+type dashInS struct {
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr"`
+	T *int64 `xml:"t,attr"`
+}
+
+// ReadSegmentTimelineFromMPD parses segment boundaries out of the SegmentTimeline of a DASH MPD
+// The video adaptation set is used if any, the first adaptation set with a SegmentTimeline otherwise. Periods are
+// concatenated.
+func ReadSegmentTimelineFromMPD(i io.Reader) (t *SegmentTimeline, err error) {
+	// Unmarshal
+	var m dashInMPD
+	if err = xml.NewDecoder(i).Decode(&m); err != nil {
+		err = fmt.Errorf("astisub: xml decoding failed: %w", err)
+		return
+	}
+
+	// Loop through periods
+	t = &SegmentTimeline{}
+	var periodStart time.Duration
+	for idxPeriod, p := range m.Periods {
+		// Get period start
+		if p.Start != "" {
+			if periodStart, err = parseDASHDuration(p.Start); err != nil {
+				err = fmt.Errorf("astisub: parsing start of period %d failed: %w", idxPeriod, err)
+				return
+			}
+		} else if n := len(t.Segments); n > 0 {
+			periodStart = t.Segments[n-1].EndAt()
+		}
+
+		// Get segment template
+		var st *dashInSegmentTemplate
+		for _, a := range p.AdaptationSets {
+			if v := a.segmentTemplate(p); v != nil && (st == nil || a.isVideo()) {
+				st = v
+				if a.isVideo() {
+					break
+				}
+			}
+		}
+		if st == nil {
+			continue
+		}
+
+		// Get timescale
+		var timescale, pto int64 = 1, 0
+		if st.Timescale != nil {
+			timescale = *st.Timescale
+		}
+		if timescale <= 0 {
+			err = fmt.Errorf("astisub: invalid timescale %d in period %d", timescale, idxPeriod)
+			return
+		}
+		if st.PresentationTimeOffset != nil {
+			pto = *st.PresentationTimeOffset
+		}
+		if len(t.Segments) == 0 {
+			t.MediaSequence = 1
+			if st.StartNumber != nil {
+				t.MediaSequence = *st.StartNumber
+			}
+		}
+		toDuration := func(i int64) time.Duration {
+			return periodStart + time.Duration(math.Round(float64(i-pto)/float64(timescale)*float64(time.Second)))
+		}
+
+		// Loop through segments
+		var ts int64
+		for idx, s := range st.Timeline {
+			// Get start
+			if s.T != nil {
+				ts = *s.T
+			}
+
+			// Get repeat count. A negative repeat count means until the next segment.
+			repeat := s.R
+			if repeat < 0 {
+				if idx == len(st.Timeline)-1 || st.Timeline[idx+1].T == nil || s.D <= 0 {
+					err = fmt.Errorf("astisub: open ended repeat count of segment %d in period %d is not supported", idx, idxPeriod)
+					return
+				}
+				repeat = int((*st.Timeline[idx+1].T-ts)/s.D) - 1
+			}
+
+			// Append segments
+			for r := 0; r <= repeat; r++ {
+				seg := TimelineSegment{
+					Duration: toDuration(ts+s.D) - toDuration(ts),
+					StartAt:  toDuration(ts),
+				}
+				seg.Discontinuity = idxPeriod > 0 && idx == 0 && r == 0 && len(t.Segments) > 0
+				t.Segments = append(t.Segments, seg)
+				ts += s.D
+			}
+		}
+	}
+
+	// No segments
+	if len(t.Segments) == 0 {
+		err = errors.New("astisub: no SegmentTimeline found")
+		return
+	}
+	return
+}
+
+// parseDASHDuration parses an xs:duration such as "PT1M30.5S"
+func parseDASHDuration(i string) (d time.Duration, err error) {
+	matches := dashRegexpDuration.FindStringSubmatch(strings.TrimSpace(i))
+	if matches == nil {
+		err = fmt.Errorf("astisub: invalid duration %s", i)
+		return
+	}
+	for idx, u := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if matches[idx+1] == "" {
+			continue
+		}
+		var n int
+		if n, err = strconv.Atoi(matches[idx+1]); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", matches[idx+1], err)
+			return
+		}
+		d += time.Duration(n) * u
+	}
+	if matches[4] != "" {
+		var f float64
+		if f, err = strconv.ParseFloat(matches[4], 64); err != nil {
+			err = fmt.Errorf("astisub: parsing float %s failed: %w", matches[4], err)
+			return
+		}
+		d += time.Duration(math.Round(f * float64(time.Second)))
+	}
+	return
+}
+
+// DASH text track types
+const (
+	// Sidecar TTML file
+	DASHTextTrackTypeTTML = "ttml"
+	// Sidecar WebVTT file
+	DASHTextTrackTypeWebVTT = "webvtt"
+	// Segmented TTML in fragmented MP4
+	DASHTextTrackTypeSTPP = "stpp"
+	// Segmented WebVTT in fragmented MP4
+	DASHTextTrackTypeWVTT = "wvtt"
+)
+
+// DASH defaults
+const (
+	dashDefaultBandwidth      = 1000
+	dashDefaultInitialization = "$RepresentationID$/init.mp4"
+	dashDefaultMedia          = "$RepresentationID$/$Number$.m4s"
+	dashDefaultRole           = "subtitle"
+	dashNamespace             = "urn:mpeg:dash:schema:mpd:2011"
+	dashProfileLive           = "urn:mpeg:dash:profile:isoff-live:2011"
+	dashProfileOnDemand       = "urn:mpeg:dash:profile:isoff-on-demand:2011"
+	dashRoleSchemeIDURI       = "urn:mpeg:dash:role:2011"
+	dashTimescale             = 1000
+)
+
+// DASHTextTrack represents a text track of an MPD
+type DASHTextTrack struct {
+	// Defaults to 1000 bits/s
+	Bandwidth int
+	// Representation id. Defaults to the language, or to "text<index>" if there's none. See DASHRepresentationIDs.
+	ID    string
+	Label string
+	// BCP 47 language. Defaults to the subtitles language.
+	Language string
+	// Roles such as "subtitle", "caption" or "forced-subtitle". Defaults to "subtitle".
+	Roles     []string
+	Subtitles *Subtitles
+	Type      string
+	// Url of sidecar files
+	URL string
+
+	// Segmented tracks only
+	// Segment template urls. Default to "$RepresentationID$/init.mp4" and "$RepresentationID$/$Number$.m4s".
+	Initialization string
+	Media          string
+	// Segments end every SegmentDuration unless SegmentDurations is provided, as Subtitles.Segment does
+	SegmentDuration  time.Duration
+	SegmentDurations []time.Duration
+	// Defaults to 1
+	StartNumber int
+	// Segments match the timeline's if provided, in which case segment durations and the start number are
+	// ignored
+	Timeline *SegmentTimeline
+}
+
+func (t DASHTextTrack) segmented() bool {
+	return t.Type == DASHTextTrackTypeSTPP || t.Type == DASHTextTrackTypeWVTT
+}
+
+// language returns the BCP 47 language of the track
+func (t DASHTextTrack) language() string {
+	if t.Language != "" {
+		return t.Language
+	}
+	if t.Subtitles != nil && t.Subtitles.Metadata != nil && t.Subtitles.Metadata.Language != "" {
+		if v, ok := ttmlLanguageMapping.GetInverse(t.Subtitles.Metadata.Language); ok {
+			return v.(string)
+		}
+		return t.Subtitles.Metadata.Language
+	}
+	return ""
+}
+
+// roles returns the roles of the track
+func (t DASHTextTrack) roles() []string {
+	if len(t.Roles) == 0 {
+		return []string{dashDefaultRole}
+	}
+	return t.Roles
+}
+
+// DASHRepresentationIDs returns the representation ids of the tracks in the MPD, in the same order.
+// Tracks without an id default to their language, to which their roles, or their index if that's not enough, are
+// added when several tracks share the same language.
+func DASHRepresentationIDs(ts []DASHTextTrack) (ids []string) {
+	// Default ids
+	ids = make([]string, len(ts))
+	for idx, t := range ts {
+		if ids[idx] = t.ID; ids[idx] == "" {
+			if ids[idx] = t.language(); ids[idx] == "" {
+				ids[idx] = "text" + strconv.Itoa(idx)
+			}
+		}
+	}
+
+	// Make default ids unique
+	for _, fn := range []func(idx int, t DASHTextTrack) string{
+		func(idx int, t DASHTextTrack) string { return t.language() + "-" + strings.Join(t.roles(), "-") },
+		func(idx int, t DASHTextTrack) string { return t.language() + "-" + strconv.Itoa(idx) },
+	} {
+		counts := make(map[string]int)
+		for _, id := range ids {
+			counts[id]++
+		}
+		for idx, t := range ts {
+			if t.ID == "" && counts[ids[idx]] > 1 {
+				ids[idx] = fn(idx, t)
+			}
+		}
+	}
+	return
+}
+
+// SegmentTimeline returns the segment boundaries of a segmented track
+func (t DASHTextTrack) SegmentTimeline() (tl *SegmentTimeline, err error) {
+	// Timeline is provided
+	if t.Timeline != nil {
+		tl = t.Timeline
+		return
+	}
+
+	// Get segment ends
+	var d time.Duration
+	if t.Subtitles != nil {
+		t.Subtitles.Order()
+		d = t.Subtitles.Duration()
+	}
+	ends := segmentEnds(t.SegmentDuration, t.SegmentDurations, d)
+	if len(ends) == 0 {
+		err = errors.New("astisub: no dash segments, segment duration must be > 0")
+		return
+	}
+
+	// Create timeline
+	tl = newSegmentTimeline(ends)
+	tl.MediaSequence = t.StartNumber
+	if tl.MediaSequence == 0 {
+		tl.MediaSequence = 1
+	}
+	return
+}
+
+// DASHOptions represents DASH options
+type DASHOptions struct {
+	// Only adaptation sets are written so that they can be added to the period of an existing MPD
+	Fragment bool
+	// Defaults to the end of the longest track
+	MediaPresentationDuration time.Duration
+}
+
+type dashOutMPD struct {
+	MediaPresentationDuration string        `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string        `xml:"minBufferTime,attr"`
+	Period                    dashOutPeriod `xml:"Period"`
+	Profiles                  string        `xml:"profiles,attr"`
+	Type                      string        `xml:"type,attr"`
+	XMLName                   xml.Name      `xml:"MPD"`
+	XMLNamespace              string        `xml:"xmlns,attr"`
+}
+
+type dashOutPeriod struct {
+	AdaptationSets []dashOutAdaptationSet `xml:"AdaptationSet"`
+	ID             string                 `xml:"id,attr"`
+	Start          string                 `xml:"start,attr"`
+}
+
+type dashOutAdaptationSet struct {
+	Codecs      string `xml:"codecs,attr,omitempty"`
+	ContentType string `xml:"contentType,attr"`
+	ID          int    `xml:"id,attr"`
+	Lang        string `xml:"lang,attr,omitempty"`
+	MimeType    string `xml:"mimeType,attr"`
+	// Order of elements matters
+	Label           string                  `xml:"Label,omitempty"`
+	Roles           []dashOutDescriptor     `xml:"Role"`
+	Representations []dashOutRepresentation `xml:"Representation"`
+	XMLName         xml.Name                `xml:"AdaptationSet"`
+}
+
+type dashOutDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type dashOutRepresentation struct {
+	Bandwidth       int                     `xml:"bandwidth,attr"`
+	BaseURL         string                  `xml:"BaseURL,omitempty"`
+	ID              string                  `xml:"id,attr"`
+	SegmentTemplate *dashOutSegmentTemplate `xml:"SegmentTemplate,omitempty"`
+}
+
+type dashOutSegmentTemplate struct {
+	Initialization string     `xml:"initialization,attr"`
+	Media          string     `xml:"media,attr"`
+	StartNumber    int        `xml:"startNumber,attr"`
+	Timeline       []dashOutS `xml:"SegmentTimeline>S"`
+	Timescale      int        `xml:"timescale,attr"`
+}
+
+type dashOutS struct {
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+	T *uint64 `xml:"t,attr"`
+}
+
+// newDASHOutTimeline builds a SegmentTimeline, repeating contiguous segments of the same duration
+func newDASHOutTimeline(tl SegmentTimeline) (ss []dashOutS) {
+	var next uint64
+	for idx, seg := range tl.Segments {
+		t := mp4DurationToTicks(seg.StartAt, dashTimescale)
+		d := mp4DurationToTicks(seg.EndAt(), dashTimescale) - t
+		if n := len(ss); n > 0 && t == next && ss[n-1].D == d {
+			ss[n-1].R++
+		} else {
+			s := dashOutS{D: d}
+			if idx == 0 || t != next {
+				s.T = &t
+			}
+			ss = append(ss, s)
+		}
+		next = t + d
+	}
+	return
+}
+
+// WriteDASHMPD writes an MPD, or an MPD fragment, describing text tracks
+func WriteDASHMPD(o io.Writer, ts []DASHTextTrack, opts DASHOptions) (err error) {
+	// Loop through tracks
+	var p = dashOutPeriod{ID: "0", Start: formatDASHDuration(0)}
+	var d = opts.MediaPresentationDuration
+	var segmented bool
+	ids := DASHRepresentationIDs(ts)
+	for idx, t := range ts {
+		// Create adaptation set
+		a := dashOutAdaptationSet{
+			ContentType: "text",
+			ID:          idx + 1,
+			Label:       t.Label,
+			Lang:        t.language(),
+		}
+
+		// Add roles
+		for _, r := range t.roles() {
+			a.Roles = append(a.Roles, dashOutDescriptor{SchemeIDURI: dashRoleSchemeIDURI, Value: r})
+		}
+
+		// Create representation
+		r := dashOutRepresentation{
+			Bandwidth: t.Bandwidth,
+			ID:        ids[idx],
+		}
+		if r.Bandwidth <= 0 {
+			r.Bandwidth = dashDefaultBandwidth
+		}
+
+		// Switch on type
+		switch t.Type {
+		case DASHTextTrackTypeTTML, DASHTextTrackTypeWebVTT:
+			// Get mime type
+			a.MimeType = "text/vtt"
+			if t.Type == DASHTextTrackTypeTTML {
+				a.MimeType = "application/ttml+xml"
+			}
+
+			// Sidecar files need an url
+			if t.URL == "" {
+				err = fmt.Errorf("astisub: no url provided for dash text track %d", idx)
+				return
+			}
+			r.BaseURL = t.URL
+		case DASHTextTrackTypeSTPP, DASHTextTrackTypeWVTT:
+			a.Codecs = t.Type
+			a.MimeType = "application/mp4"
+			segmented = true
+
+			// Get timeline
+			var tl *SegmentTimeline
+			if tl, err = t.SegmentTimeline(); err != nil {
+				err = fmt.Errorf("astisub: getting segment timeline of dash text track %d failed: %w", idx, err)
+				return
+			}
+
+			// Create segment template
+			st := &dashOutSegmentTemplate{
+				Initialization: t.Initialization,
+				Media:          t.Media,
+				StartNumber:    tl.MediaSequence,
+				Timeline:       newDASHOutTimeline(*tl),
+				Timescale:      dashTimescale,
+			}
+			if st.Initialization == "" {
+				st.Initialization = dashDefaultInitialization
+			}
+			if st.Media == "" {
+				st.Media = dashDefaultMedia
+			}
+			r.SegmentTemplate = st
+
+			// Update duration
+			if n := len(tl.Segments); opts.MediaPresentationDuration <= 0 && n > 0 && tl.Segments[n-1].EndAt() > d {
+				d = tl.Segments[n-1].EndAt()
+			}
+		default:
+			err = fmt.Errorf("astisub: invalid dash text track type %s", t.Type)
+			return
+		}
+
+		// Update duration
+		if opts.MediaPresentationDuration <= 0 && t.Subtitles != nil && t.Subtitles.Duration() > d {
+			d = t.Subtitles.Duration()
+		}
+
+		// Append adaptation set
+		a.Representations = append(a.Representations, r)
+		p.AdaptationSets = append(p.AdaptationSets, a)
+	}
+
+	// Create encoder
+	var e = xml.NewEncoder(o)
+	e.Indent("", "    ")
+
+	// Fragment
+	if opts.Fragment {
+		for _, a := range p.AdaptationSets {
+			if err = e.Encode(a); err != nil {
+				err = fmt.Errorf("astisub: xml encoding failed: %w", err)
+				return
+			}
+		}
+		return
+	}
+
+	// Create mpd
+	m := dashOutMPD{
+		MediaPresentationDuration: formatDASHDuration(d),
+		MinBufferTime:             formatDASHDuration(2 * time.Second),
+		Period:                    p,
+		Profiles:                  dashProfileOnDemand,
+		Type:                      "static",
+		XMLNamespace:              dashNamespace,
+	}
+	if segmented {
+		m.Profiles = dashProfileLive
+	}
+
+	// Marshal XML
+	if _, err = o.Write([]byte(xml.Header)); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	if err = e.Encode(m); err != nil {
+		err = fmt.Errorf("astisub: xml encoding failed: %w", err)
+		return
+	}
+	return
+}
+
+// formatDASHDuration formats an xs:duration such as "PT1M30.5S"
+func formatDASHDuration(d time.Duration) string {
+	s := "PT"
+	if h := d / time.Hour; h > 0 {
+		s += strconv.Itoa(int(h)) + "H"
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		s += strconv.Itoa(int(m)) + "M"
+		d -= m * time.Minute
+	}
+	return s + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+}
@@ -0,0 +1,112 @@
+package astisub_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDASHMPD(t *testing.T) {
+	en := astisub.NewSubtitles()
+	en.Metadata = &astisub.Metadata{Language: astisub.LanguageEnglish}
+	en.Items = []*astisub.Item{{EndAt: 13 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "en"}}}}, StartAt: time.Second}}
+	fr := astisub.NewSubtitles()
+	fr.Metadata = &astisub.Metadata{Language: astisub.LanguageFrench}
+	fr.Items = []*astisub.Item{{EndAt: 20 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "fr"}}}}, StartAt: time.Second}}
+
+	// Invalid
+	b := &bytes.Buffer{}
+	assert.Error(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{{Subtitles: en, Type: "invalid"}}, astisub.DASHOptions{}))
+	assert.Error(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{{Subtitles: en, Type: astisub.DASHTextTrackTypeWebVTT}}, astisub.DASHOptions{}))
+	assert.Error(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{{Subtitles: en, Type: astisub.DASHTextTrackTypeSTPP}}, astisub.DASHOptions{}))
+
+	// Standalone
+	b.Reset()
+	require.NoError(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{
+		{Label: "English", Subtitles: en, Type: astisub.DASHTextTrackTypeWebVTT, URL: "en.vtt"},
+		{Roles: []string{"caption"}, SegmentDuration: 4 * time.Second, Subtitles: fr, Type: astisub.DASHTextTrackTypeSTPP},
+	}, astisub.DASHOptions{}))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<MPD mediaPresentationDuration="PT20S" minBufferTime="PT2S" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" xmlns="urn:mpeg:dash:schema:mpd:2011">
+    <Period id="0" start="PT0S">
+        <AdaptationSet contentType="text" id="1" lang="en" mimeType="text/vtt">
+            <Label>English</Label>
+            <Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"></Role>
+            <Representation bandwidth="1000" id="en">
+                <BaseURL>en.vtt</BaseURL>
+            </Representation>
+        </AdaptationSet>
+        <AdaptationSet codecs="stpp" contentType="text" id="2" lang="fr" mimeType="application/mp4">
+            <Role schemeIdUri="urn:mpeg:dash:role:2011" value="caption"></Role>
+            <Representation bandwidth="1000" id="fr">
+                <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number$.m4s" startNumber="1" timescale="1000">
+                    <SegmentTimeline>
+                        <S d="4000" r="4" t="0"></S>
+                    </SegmentTimeline>
+                </SegmentTemplate>
+            </Representation>
+        </AdaptationSet>
+    </Period>
+</MPD>`, b.String())
+
+	// Fragment with a timeline
+	b.Reset()
+	require.NoError(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{{
+		ID:        "subs",
+		Subtitles: en,
+		Timeline: &astisub.SegmentTimeline{MediaSequence: 3, Segments: []astisub.TimelineSegment{
+			{Duration: 2 * time.Second},
+			{Duration: 2 * time.Second, StartAt: 2 * time.Second},
+			{Duration: time.Second, StartAt: 4 * time.Second},
+			{Duration: time.Second, StartAt: 10 * time.Second},
+		}},
+		Type: astisub.DASHTextTrackTypeWVTT,
+	}}, astisub.DASHOptions{Fragment: true}))
+	assert.Equal(t, `<AdaptationSet codecs="wvtt" contentType="text" id="1" lang="en" mimeType="application/mp4">
+    <Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"></Role>
+    <Representation bandwidth="1000" id="subs">
+        <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number$.m4s" startNumber="3" timescale="1000">
+            <SegmentTimeline>
+                <S d="2000" r="1" t="0"></S>
+                <S d="1000"></S>
+                <S d="1000" t="10000"></S>
+            </SegmentTimeline>
+        </SegmentTemplate>
+    </Representation>
+</AdaptationSet>`, b.String())
+
+	// Written timelines can be read back
+	b.Reset()
+	require.NoError(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{{SegmentDuration: 4 * time.Second, Subtitles: fr, Type: astisub.DASHTextTrackTypeSTPP}}, astisub.DASHOptions{}))
+	tl, err := astisub.ReadSegmentTimelineFromMPD(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	assert.Len(t, tl.Segments, 5)
+	assert.Equal(t, 16*time.Second, tl.Segments[4].StartAt)
+}
+
+func TestDASHRepresentationIDs(t *testing.T) {
+	en := astisub.NewSubtitles()
+	en.Metadata = &astisub.Metadata{Language: astisub.LanguageEnglish}
+	assert.Equal(t, []string{"en-subtitle", "en-caption", "fr", "text3", "custom"}, astisub.DASHRepresentationIDs([]astisub.DASHTextTrack{
+		{Subtitles: en},
+		{Roles: []string{"caption"}, Subtitles: en},
+		{Language: "fr"},
+		{},
+		{ID: "custom", Subtitles: en},
+	}))
+	assert.Equal(t, []string{"en-0", "en-1"}, astisub.DASHRepresentationIDs([]astisub.DASHTextTrack{{Subtitles: en}, {Subtitles: en}}))
+
+	// Ids are unique in the MPD
+	en.Items = []*astisub.Item{{EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "en"}}}}, StartAt: time.Second}}
+	b := &bytes.Buffer{}
+	require.NoError(t, astisub.WriteDASHMPD(b, []astisub.DASHTextTrack{
+		{SegmentDuration: time.Second, Subtitles: en, Type: astisub.DASHTextTrackTypeWVTT},
+		{SegmentDuration: time.Second, Subtitles: en, Type: astisub.DASHTextTrackTypeWVTT},
+	}, astisub.DASHOptions{}))
+	assert.Contains(t, b.String(), `<Representation bandwidth="1000" id="en-0">`)
+	assert.Contains(t, b.String(), `<Representation bandwidth="1000" id="en-1">`)
+}
@@ -0,0 +1,243 @@
+package astisub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EDL transitions
+const (
+	EDLTransitionCut           = "C"
+	EDLTransitionDissolve      = "D"
+	EDLTransitionKey           = "K"
+	EDLTransitionKeyBackground = "KB"
+	EDLTransitionKeyOut        = "KO"
+	EDLTransitionWipe          = "W"
+)
+
+// EDL reels that carry no source content
+var edlReelsWithoutSource = map[string]bool{
+	"BL":    true,
+	"BLACK": true,
+}
+
+// EDL represents a CMX3600 edit decision list
+type EDL struct {
+	DropFrame bool // Whether FCM is DROP FRAME
+	Events    []EDLEvent
+	Title     string
+}
+
+// EDLEvent represents an EDL event, recording a source range at a record range
+type EDLEvent struct {
+	Comments  []string // Lines starting with "*" such as "* FROM CLIP NAME: ..."
+	Number    int
+	RecordIn  Timecode
+	RecordOut Timecode
+	Reel      string
+	SourceIn  Timecode
+	SourceOut Timecode
+	// Tracks such as "V", "A", "A2" or "AA/V"
+	Track string
+	// Transition code such as "C", "D", "W001", "K", "KB" or "KO". Keys written "K B" or "K O" are read as "KB"
+	// or "KO".
+	Transition string
+	// Duration of dissolves, wipes and keys in frames
+	// Conforming treats transitions as cuts at the record in point, therefore it is not used there.
+	TransitionDuration int
+}
+
+// hasVideo checks whether the event records the video track
+func (e EDLEvent) hasVideo() bool {
+	return strings.Contains(e.Track, "V")
+}
+
+// ReadEDL parses a CMX3600 edit decision list whose timecodes are expressed in the framerate
+// Unsupported lines such as motion effects (M2) are ignored.
+func ReadEDL(i io.Reader, framerate Framerate) (e *EDL, err error) {
+	// Scan
+	e = &EDL{}
+	var scanner = bufio.NewScanner(i)
+	var lineNum int
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), string(BytesBOM)))
+		lineNum++
+
+		switch {
+		case len(line) == 0:
+			continue
+		case strings.HasPrefix(line, "TITLE:"):
+			e.Title = strings.TrimSpace(strings.TrimPrefix(line, "TITLE:"))
+		case strings.HasPrefix(line, "FCM:"):
+			e.DropFrame = strings.TrimSpace(strings.TrimPrefix(line, "FCM:")) == "DROP FRAME"
+		case strings.HasPrefix(line, "*"):
+			if len(e.Events) > 0 {
+				e.Events[len(e.Events)-1].Comments = append(e.Events[len(e.Events)-1].Comments, strings.TrimSpace(strings.TrimPrefix(line, "*")))
+			}
+		case line[0] >= '0' && line[0] <= '9':
+			var ev EDLEvent
+			if ev, err = parseEDLEvent(line, framerate, e.DropFrame); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing edl event failed: %w", lineNum, err)
+				return
+			}
+			e.Events = append(e.Events, ev)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("astisub: scanning failed: %w", err)
+		return
+	}
+	return
+}
+
+// parseEDLEvent parses an event line such as "002  AX  V  D  025 01:00:20:00 01:00:30:00 10:00:10:00 10:00:20:00"
+func parseEDLEvent(line string, framerate Framerate, dropFrame bool) (e EDLEvent, err error) {
+	// Split
+	fs := strings.Fields(line)
+	if len(fs) < 8 {
+		err = fmt.Errorf("astisub: invalid number of fields in %s", line)
+		return
+	}
+
+	// Parse number
+	if e.Number, err = strconv.Atoi(fs[0]); err != nil {
+		err = fmt.Errorf("astisub: atoi of %s failed: %w", fs[0], err)
+		return
+	}
+	e.Reel = fs[1]
+	e.Track = fs[2]
+	e.Transition = fs[3]
+	fs = fs[4:]
+
+	// Keys may be followed by their type in a separate field, e.g. "K B" for a key background
+	if e.Transition == EDLTransitionKey && (fs[0] == "B" || fs[0] == "O") {
+		e.Transition += fs[0]
+		fs = fs[1:]
+	}
+	if len(fs) != 4 && len(fs) != 5 {
+		err = fmt.Errorf("astisub: invalid number of fields in %s", line)
+		return
+	}
+
+	// Parse transition duration
+	if len(fs) == 5 {
+		if e.TransitionDuration, err = strconv.Atoi(fs[0]); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", fs[0], err)
+			return
+		}
+	}
+
+	// Parse timecodes
+	for idx, t := range []*Timecode{&e.SourceIn, &e.SourceOut, &e.RecordIn, &e.RecordOut} {
+		v := fs[len(fs)-4+idx]
+		if *t, err = parseTimecodeEDL(v, framerate, dropFrame); err != nil {
+			err = fmt.Errorf("astisub: parsing timecode %s failed: %w", v, err)
+			return
+		}
+	}
+	return
+}
+
+// parseTimecodeEDL parses an EDL timecode, which is drop frame if its separator or the FCM says so
+func parseTimecodeEDL(i string, framerate Framerate, dropFrame bool) (Timecode, error) {
+	if idx := strings.LastIndex(i, ":"); dropFrame && idx >= 0 && framerate.dropFrames() > 0 {
+		i = i[:idx] + ";" + i[idx+1:]
+	}
+	return ParseTimecode(i, framerate)
+}
+
+// ConformOptions represents conform options
+type ConformOptions struct {
+	// Items shorter than this duration once conformed, e.g. because they are trimmed by an edit point, are
+	// dropped
+	MinDuration time.Duration
+	// Record time matching 0 in the conformed subtitles, e.g. 10:00:00:00
+	RecordStart time.Duration
+	// Source time matching 0 in the subtitles, e.g. 10:00:00:00
+	SourceStart time.Duration
+}
+
+// Conform conforms subtitles timed against the EDL's source to its record, i.e. the new cut
+// Items in ranges that are not recorded are dropped, items in moved ranges are shifted and items straddling edit
+// points are split or trimmed. Video events are used if any, all events otherwise, and events recording black are
+// ignored. Dissolves, wipes and keys are treated as cuts.
+func (s *Subtitles) Conform(e EDL) error {
+	return s.ConformWithOptions(e, ConformOptions{})
+}
+
+// ConformWithOptions conforms subtitles timed against the EDL's source to its record with options
+func (s *Subtitles) ConformWithOptions(e EDL, opts ConformOptions) (err error) {
+	// Get events
+	var hasVideo bool
+	for _, ev := range e.Events {
+		if ev.hasVideo() {
+			hasVideo = true
+			break
+		}
+	}
+	var evs []EDLEvent
+	for _, ev := range e.Events {
+		if (!hasVideo || ev.hasVideo()) && !edlReelsWithoutSource[strings.ToUpper(ev.Reel)] && ev.SourceOut.Frames > ev.SourceIn.Frames {
+			evs = append(evs, ev)
+		}
+	}
+	if len(evs) == 0 {
+		err = errors.New("astisub: no edl events with source found")
+		return
+	}
+
+	// Loop through items
+	var is []*Item
+	for _, i := range s.Items {
+		// Loop through events
+		var previous *Item
+		for _, ev := range evs {
+			// Get source range
+			sourceStartAt := ev.SourceIn.Duration() - opts.SourceStart
+			sourceEndAt := ev.SourceOut.Duration() - opts.SourceStart
+
+			// Item is not in the source range
+			if i.EndAt <= sourceStartAt || i.StartAt >= sourceEndAt {
+				continue
+			}
+
+			// Clip and shift item
+			n := i.clone()
+			offset := ev.RecordIn.Duration() - opts.RecordStart - sourceStartAt
+			if n.StartAt < sourceStartAt {
+				n.StartAt = sourceStartAt
+			}
+			if n.EndAt > sourceEndAt {
+				n.EndAt = sourceEndAt
+			}
+			n.EndAt += offset
+			n.StartAt += offset
+
+			// Parts of the item that are contiguous once conformed are merged back
+			if previous != nil && previous.EndAt == n.StartAt {
+				previous.EndAt = n.EndAt
+				continue
+			}
+			is = append(is, n)
+			previous = n
+		}
+	}
+
+	// Drop items that are too short
+	s.Items = []*Item{}
+	for _, i := range is {
+		if i.EndAt-i.StartAt > 0 && i.EndAt-i.StartAt >= opts.MinDuration {
+			s.Items = append(s.Items, i)
+		}
+	}
+
+	// Order
+	s.Order()
+	return
+}
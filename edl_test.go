@@ -0,0 +1,148 @@
+package astisub_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const edl = `TITLE: New cut
+FCM: NON-DROP FRAME
+
+001  AX       V     C        00:00:00:00 00:00:10:00 01:00:00:00 01:00:10:00
+* FROM CLIP NAME: a.mov
+002  AX       V     C        00:00:20:00 00:00:30:00 01:00:10:00 01:00:20:00
+003  AX       A     C        00:00:40:00 00:00:50:00 01:00:20:00 01:00:30:00
+004  BL       V     C        00:00:00:00 00:00:02:00 01:00:20:00 01:00:22:00
+005  AX       V     D    025 00:00:30:00 00:00:40:00 01:00:22:00 01:00:32:00
+`
+
+func TestReadEDL(t *testing.T) {
+	e, err := astisub.ReadEDL(strings.NewReader(edl), astisub.Framerate25)
+	require.NoError(t, err)
+	assert.Equal(t, "New cut", e.Title)
+	assert.False(t, e.DropFrame)
+	require.Len(t, e.Events, 5)
+	assert.Equal(t, astisub.EDLEvent{
+		Comments:   []string{"FROM CLIP NAME: a.mov"},
+		Number:     1,
+		RecordIn:   astisub.Timecode{Framerate: astisub.Framerate25, Frames: 90000},
+		RecordOut:  astisub.Timecode{Framerate: astisub.Framerate25, Frames: 90250},
+		Reel:       "AX",
+		SourceIn:   astisub.Timecode{Framerate: astisub.Framerate25},
+		SourceOut:  astisub.Timecode{Framerate: astisub.Framerate25, Frames: 250},
+		Track:      "V",
+		Transition: astisub.EDLTransitionCut,
+	}, e.Events[0])
+	assert.Equal(t, astisub.EDLTransitionDissolve, e.Events[4].Transition)
+	assert.Equal(t, 25, e.Events[4].TransitionDuration)
+	assert.Equal(t, "00:00:30:00", e.Events[4].SourceIn.String())
+
+	// Drop frame
+	e, err = astisub.ReadEDL(strings.NewReader("FCM: DROP FRAME\n001  AX  V  C  00:01:00:02 00:01:00:04 00:00:00:00 00:00:00:02"), astisub.Framerate2997)
+	require.NoError(t, err)
+	assert.True(t, e.DropFrame)
+	assert.True(t, e.Events[0].SourceIn.DropFrame)
+	assert.Equal(t, int64(1800), e.Events[0].SourceIn.Frames)
+
+	// Keys
+	e, err = astisub.ReadEDL(strings.NewReader(`001  AX  V  C        00:00:00:00 00:00:10:00 01:00:00:00 01:00:10:00
+002  BL  V  K B      00:00:00:00 00:00:05:00 01:00:10:00 01:00:15:00
+002  AY  V  K    000 00:00:10:00 00:00:15:00 01:00:10:00 01:00:15:00
+003  BL  V  KB   010 00:00:00:00 00:00:05:00 01:00:15:00 01:00:20:00
+003  AY  V  KO   010 00:00:15:00 00:00:20:00 01:00:15:00 01:00:20:00
+004  AY  V  K O      00:00:20:00 00:00:25:00 01:00:20:00 01:00:25:00
+`), astisub.Framerate25)
+	require.NoError(t, err)
+	require.Len(t, e.Events, 6)
+	for idx, v := range []struct {
+		duration   int
+		reel       string
+		transition string
+	}{
+		{reel: "AX", transition: astisub.EDLTransitionCut},
+		{reel: "BL", transition: astisub.EDLTransitionKeyBackground},
+		{reel: "AY", transition: astisub.EDLTransitionKey},
+		{duration: 10, reel: "BL", transition: astisub.EDLTransitionKeyBackground},
+		{duration: 10, reel: "AY", transition: astisub.EDLTransitionKeyOut},
+		{reel: "AY", transition: astisub.EDLTransitionKeyOut},
+	} {
+		assert.Equal(t, v.reel, e.Events[idx].Reel)
+		assert.Equal(t, v.transition, e.Events[idx].Transition)
+		assert.Equal(t, v.duration, e.Events[idx].TransitionDuration)
+	}
+	assert.Equal(t, "00:00:00:00", e.Events[1].SourceIn.String())
+	assert.Equal(t, "01:00:15:00", e.Events[1].RecordOut.String())
+	s := &astisub.Subtitles{Items: []*astisub.Item{{EndAt: 12 * time.Second, StartAt: 11 * time.Second}}}
+	require.NoError(t, s.Conform(*e))
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Hour+11*time.Second, s.Items[0].StartAt)
+
+	// Errors
+	_, err = astisub.ReadEDL(strings.NewReader("001  AX  V  C  00:00:00:00 00:00:10:00"), astisub.Framerate25)
+	assert.Error(t, err)
+	_, err = astisub.ReadEDL(strings.NewReader("001  AX  V  C  00:00:00:00 00:00:10:00 01:00:00:00 01:00:10:30"), astisub.Framerate25)
+	assert.Error(t, err)
+}
+
+func TestSubtitles_Conform(t *testing.T) {
+	e, err := astisub.ReadEDL(strings.NewReader(edl), astisub.Framerate25)
+	require.NoError(t, err)
+	newSubtitles := func(ds ...time.Duration) *astisub.Subtitles {
+		s := astisub.NewSubtitles()
+		for idx := 0; idx < len(ds); idx += 2 {
+			s.Items = append(s.Items, &astisub.Item{EndAt: ds[idx+1], Index: idx/2 + 1, StartAt: ds[idx]})
+		}
+		return s
+	}
+
+	// Errors
+	s := newSubtitles(time.Second, 2*time.Second)
+	assert.Error(t, s.Conform(astisub.EDL{}))
+
+	// Conform
+	s = newSubtitles(
+		2*time.Second, 4*time.Second, // Kept
+		8*time.Second, 22*time.Second, // Straddles a removed range, its pieces are contiguous once conformed
+		12*time.Second, 15*time.Second, // Removed
+		28*time.Second, 32*time.Second, // Straddles an edit point, its pieces are not contiguous once conformed
+		45*time.Second, 46*time.Second, // Only recorded on an audio track
+		39900*time.Millisecond, 41*time.Second, // Trimmed under the min duration
+	)
+	s.Items[3].Lines = []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Text: "split"}}}}
+	require.NoError(t, s.ConformWithOptions(*e, astisub.ConformOptions{
+		MinDuration: 200 * time.Millisecond,
+		RecordStart: time.Hour,
+	}))
+	require.Len(t, s.Items, 4)
+	for idx, v := range []struct {
+		endAt, startAt time.Duration
+		index          int
+	}{
+		{endAt: 4 * time.Second, index: 1, startAt: 2 * time.Second},
+		{endAt: 12 * time.Second, index: 2, startAt: 8 * time.Second},
+		{endAt: 20 * time.Second, index: 4, startAt: 18 * time.Second},
+		{endAt: 24 * time.Second, index: 4, startAt: 22 * time.Second},
+	} {
+		assert.Equal(t, v.startAt, s.Items[idx].StartAt)
+		assert.Equal(t, v.endAt, s.Items[idx].EndAt)
+		assert.Equal(t, v.index, s.Items[idx].Index)
+	}
+
+	// Split items don't share their lines
+	s.Items[2].Lines[0].Items[0].Text = "modified"
+	s.Items[2].Lines[0].Items[0].InlineStyle.TTMLFontWeight = astikit.StrPtr("bold")
+	assert.Equal(t, "split", s.Items[3].Lines[0].Items[0].Text)
+	assert.Nil(t, s.Items[3].Lines[0].Items[0].InlineStyle.TTMLFontWeight)
+
+	// Source start
+	s = newSubtitles(15*time.Second, 16*time.Second)
+	require.NoError(t, s.ConformWithOptions(astisub.EDL{Events: e.Events[1:2]}, astisub.ConformOptions{SourceStart: 10 * time.Second}))
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Hour+15*time.Second, s.Items[0].StartAt)
+}
@@ -0,0 +1,206 @@
+package astisub
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Framerate represents a rational framerate expressed in frames per Den seconds
+// NTSC framerates such as 23.976, 29.97 and 59.94 are represented exactly (e.g. 30000/1001).
+type Framerate struct {
+	Den int
+	Num int
+}
+
+// Framerates
+var (
+	Framerate23976 = Framerate{Den: 1001, Num: 24000}
+	Framerate24    = Framerate{Den: 1, Num: 24}
+	Framerate25    = Framerate{Den: 1, Num: 25}
+	Framerate2997  = Framerate{Den: 1001, Num: 30000}
+	Framerate30    = Framerate{Den: 1, Num: 30}
+	Framerate50    = Framerate{Den: 1, Num: 50}
+	Framerate5994  = Framerate{Den: 1001, Num: 60000}
+	Framerate60    = Framerate{Den: 1, Num: 60}
+)
+
+// NewFramerate creates a framerate out of frames per second
+// Values close to an NTSC framerate (e.g. 29.97) are mapped to its exact rational value.
+func NewFramerate(f float64) Framerate {
+	// NTSC framerate
+	if n := math.Round(f * 1.001); n > 0 && math.Abs(f-n/1.001) < 0.005 && math.Abs(f-n) > 0.005 {
+		return Framerate{Den: 1001, Num: int(n) * 1000}
+	}
+
+	// Integer framerate
+	if n := math.Round(f); math.Abs(f-n) < 1e-9 {
+		return Framerate{Den: 1, Num: int(n)}
+	}
+	return Framerate{Den: 1000, Num: int(math.Round(f * 1000))}
+}
+
+// ParseFramerate parses a framerate such as "25", "29.97" or "30000/1001"
+func ParseFramerate(i string) (f Framerate, err error) {
+	// Rational
+	i = strings.TrimSpace(i)
+	if idx := strings.Index(i, "/"); idx >= 0 {
+		if f.Num, err = strconv.Atoi(strings.TrimSpace(i[:idx])); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", i[:idx], err)
+			return
+		}
+		if f.Den, err = strconv.Atoi(strings.TrimSpace(i[idx+1:])); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", i[idx+1:], err)
+			return
+		}
+	} else {
+		var v float64
+		if v, err = strconv.ParseFloat(i, 64); err != nil {
+			err = fmt.Errorf("astisub: parsing float %s failed: %w", i, err)
+			return
+		}
+		f = NewFramerate(v)
+	}
+
+	// Validate
+	if !f.valid() {
+		err = fmt.Errorf("astisub: invalid framerate %s", i)
+		return
+	}
+	return
+}
+
+// valid checks whether the framerate can be used in computations
+func (f Framerate) valid() bool {
+	return f.Den > 0 && f.Num > 0
+}
+
+// Float64 returns the framerate in frames per second
+func (f Framerate) Float64() float64 {
+	if f.Den == 0 {
+		return 0
+	}
+	return float64(f.Num) / float64(f.Den)
+}
+
+// String implements the Stringer interface
+func (f Framerate) String() string {
+	if f.Den == 1 {
+		return strconv.Itoa(f.Num)
+	}
+	return strconv.Itoa(f.Num) + "/" + strconv.Itoa(f.Den)
+}
+
+// nominal returns the number of frames labelled in a timecode second, e.g. 30 for 29.97
+func (f Framerate) nominal() int {
+	if !f.valid() {
+		return 0
+	}
+	return (f.Num + f.Den - 1) / f.Den
+}
+
+// Duration returns the duration of a number of frames, rounded to the nanosecond
+func (f Framerate) Duration(frames int64) time.Duration {
+	// Split seconds to prevent overflows
+	n := frames * int64(f.Den)
+	s, r := n/int64(f.Num), n%int64(f.Num)
+	if r < 0 {
+		s, r = s-1, r+int64(f.Num)
+	}
+	return time.Duration(s)*time.Second + time.Duration((2*r*1e9+int64(f.Num))/(2*int64(f.Num)))
+}
+
+// Frames returns the number of frames that have fully elapsed in a duration, negative durations being rounded
+// towards minus infinity
+// Durations returned by Duration are converted back to their number of frames despite their rounding.
+func (f Framerate) Frames(d time.Duration) int64 {
+	// Split seconds to prevent overflows
+	u := int64(f.Den) * 1e9
+	q, r := int64(d)/u, int64(d)%u
+	if r < 0 {
+		q, r = q-1, r+u
+	}
+	return q*int64(f.Num) + (2*r+1)*int64(f.Num)/(2*u)
+}
+
+// Round returns the frame boundary closest to the duration
+func (f Framerate) Round(d time.Duration) time.Duration {
+	n := f.Frames(d)
+	if d-f.Duration(n) > f.Duration(n+1)-d {
+		n++
+	}
+	return f.Duration(n)
+}
+
+// FramerateConversionMode represents a framerate conversion mode
+type FramerateConversionMode string
+
+// Framerate conversion modes
+const (
+	// Every frame is kept and the media is played faster or slower, e.g. 25 fps PAL speed-up of 23.976 fps
+	// material: timestamps are scaled by from/to
+	FramerateConversionModeSpeed = FramerateConversionMode("speed")
+	// Timecodes are relabelled: their hh:mm:ss is kept while their frames are scaled to the new framerate
+	FramerateConversionModeTimecode = FramerateConversionMode("timecode")
+)
+
+// ConvertFramerate converts subtitles timed against a framerate to another framerate
+func (s *Subtitles) ConvertFramerate(from, to Framerate, mode FramerateConversionMode) (err error) {
+	// Validate framerates
+	if !from.valid() || !to.valid() {
+		err = fmt.Errorf("astisub: invalid framerates %s and %s", from, to)
+		return
+	}
+
+	// Get conversion
+	var fn func(d time.Duration) time.Duration
+	switch mode {
+	case FramerateConversionModeSpeed:
+		fn = func(d time.Duration) time.Duration {
+			return time.Duration(math.Round(float64(d) * float64(from.Num) * float64(to.Den) / float64(from.Den) / float64(to.Num)))
+		}
+	case FramerateConversionModeTimecode:
+		fn = func(d time.Duration) time.Duration {
+			hours, minutes, seconds, frames := NewTimecodeFromDuration(from.Round(d), from, false).Components()
+			frames = int(math.Round(float64(frames) * float64(to.nominal()) / float64(from.nominal())))
+			return Timecode{Framerate: to, Frames: to.timecodeFrames(hours, minutes, seconds, frames, false)}.Duration()
+		}
+	default:
+		err = errors.New("astisub: invalid framerate conversion mode " + string(mode))
+		return
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		i.EndAt = fn(i.EndAt)
+		i.StartAt = fn(i.StartAt)
+	}
+
+	// Update metadata
+	if s.Metadata != nil && s.Metadata.Framerate.valid() {
+		s.Metadata.Framerate = to
+	}
+	return
+}
+
+// SnapToFrames moves items boundaries to their closest frame boundary
+// Items are kept at least one frame long.
+func (s *Subtitles) SnapToFrames(f Framerate) (err error) {
+	// Validate framerate
+	if !f.valid() {
+		err = fmt.Errorf("astisub: invalid framerate %s", f)
+		return
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		i.StartAt = f.Round(i.StartAt)
+		if i.EndAt = f.Round(i.EndAt); i.EndAt <= i.StartAt {
+			i.EndAt = f.Duration(f.Frames(i.StartAt) + 1)
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package astisub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFramerate(t *testing.T) {
+	for _, v := range []struct {
+		i string
+		o astisub.Framerate
+	}{
+		{i: "23.976", o: astisub.Framerate23976},
+		{i: "23.98", o: astisub.Framerate23976},
+		{i: "25", o: astisub.Framerate25},
+		{i: "29.97", o: astisub.Framerate2997},
+		{i: "30000/1001", o: astisub.Framerate2997},
+		{i: "59.94", o: astisub.Framerate5994},
+		{i: "12.5", o: astisub.Framerate{Den: 1000, Num: 12500}},
+	} {
+		f, err := astisub.ParseFramerate(v.i)
+		require.NoError(t, err)
+		assert.Equal(t, v.o, f, v.i)
+	}
+	_, err := astisub.ParseFramerate("0")
+	assert.Error(t, err)
+	_, err = astisub.ParseFramerate("30000/0")
+	assert.Error(t, err)
+
+	assert.Equal(t, "30000/1001", astisub.Framerate2997.String())
+	assert.Equal(t, 1001*time.Millisecond, astisub.Framerate2997.Duration(30))
+	assert.Equal(t, 33366667*time.Nanosecond, astisub.Framerate2997.Duration(1))
+	for n := int64(-100000); n < 100000; n += 997 {
+		assert.Equal(t, n, astisub.Framerate2997.Frames(astisub.Framerate2997.Duration(n)))
+		assert.Equal(t, n, astisub.Framerate30.Frames(astisub.Framerate30.Duration(n)))
+	}
+	assert.Equal(t, int64(-1), astisub.Framerate25.Frames(-time.Millisecond))
+	assert.Equal(t, int64(-2), astisub.Framerate25.Frames(-41*time.Millisecond))
+	assert.Equal(t, -33366667*time.Nanosecond, astisub.Framerate2997.Duration(-1))
+	assert.Equal(t, 40*time.Millisecond, astisub.Framerate25.Round(35*time.Millisecond))
+}
+
+func TestSubtitles_ConvertFramerate(t *testing.T) {
+	newSubtitles := func() *astisub.Subtitles {
+		s := astisub.NewSubtitles()
+		s.Items = []*astisub.Item{{EndAt: 10480 * time.Millisecond, StartAt: 10 * time.Second}}
+		return s
+	}
+
+	// Speed
+	s := newSubtitles()
+	require.NoError(t, s.ConvertFramerate(astisub.Framerate25, astisub.Framerate23976, astisub.FramerateConversionModeSpeed))
+	assert.Equal(t, 10427083333*time.Nanosecond, s.Items[0].StartAt)
+	assert.Equal(t, 10927583333*time.Nanosecond, s.Items[0].EndAt)
+
+	// Timecode
+	s = newSubtitles()
+	require.NoError(t, s.ConvertFramerate(astisub.Framerate25, astisub.Framerate2997, astisub.FramerateConversionModeTimecode))
+	assert.Equal(t, astisub.Framerate2997.Duration(300), s.Items[0].StartAt)
+	assert.Equal(t, astisub.Framerate2997.Duration(314), s.Items[0].EndAt)
+
+	// Invalid
+	assert.Error(t, s.ConvertFramerate(astisub.Framerate{}, astisub.Framerate25, astisub.FramerateConversionModeSpeed))
+	assert.Error(t, s.ConvertFramerate(astisub.Framerate25, astisub.Framerate30, "invalid"))
+}
+
+func TestSubtitles_SnapToFrames(t *testing.T) {
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{
+		{EndAt: 1030 * time.Millisecond, StartAt: 1010 * time.Millisecond},
+		{EndAt: 2002 * time.Millisecond, StartAt: 2001 * time.Millisecond},
+	}
+	require.NoError(t, s.SnapToFrames(astisub.Framerate25))
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 1040*time.Millisecond, s.Items[0].EndAt)
+	assert.Equal(t, 2*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 2040*time.Millisecond, s.Items[1].EndAt)
+}
@@ -0,0 +1,473 @@
+package astisub
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc8216
+
+// HLS playlist types
+const (
+	HLSPlaylistTypeEvent = "EVENT"
+	HLSPlaylistTypeVOD   = "VOD"
+)
+
+// Default HLS segment URI format
+const hlsDefaultSegmentURI = "seg-%03d.vtt"
+
+// HLS date layouts
+const (
+	hlsProgramDateTimeLayout         = "2006-01-02T15:04:05.000Z07:00"
+	hlsProgramDateTimeLayoutNoColons = "2006-01-02T15:04:05.999999999Z0700"
+)
+
+// HLSOptions represents HLS options
+type HLSOptions struct {
+	// Total duration of the rendition which should match the video's. Defaults to the end of the last item.
+	Duration      time.Duration
+	MediaSequence int
+	// MPEG-TS timestamp of the media segments matching 0 in the subtitles timeline, usually the video's first
+	// PTS. It is used to build each segment's X-TIMESTAMP-MAP.
+	MPEGTSOffset time.Duration
+	PlaylistType string
+	// Segments end every SegmentDuration unless SegmentDurations is provided
+	SegmentDuration  time.Duration
+	SegmentDurations []time.Duration
+	// fmt format receiving the segment index. Defaults to "seg-%03d.vtt".
+	SegmentURI string
+	// Segments match the timeline's if provided, in which case segment durations, the duration and the media
+	// sequence are ignored
+	Timeline *SegmentTimeline
+}
+
+// HLSRendition represents a subtitles rendition segmented for HLS
+type HLSRendition struct {
+	// Whether segments are still being appended to a sliding window, in which case no EXT-X-ENDLIST is written
+	Live            bool
+	MediaSequence   int
+	MPEGTSOffset    time.Duration
+	PlaylistType    string
+	ProgramDateTime *time.Time // Wall clock time of the rendition start, if known
+	Segments        []*HLSSegment
+}
+
+// HLSSegment represents an HLS media segment
+type HLSSegment struct {
+	Discontinuity bool
+	Duration      time.Duration
+	StartAt       time.Duration
+	Subtitles     *Subtitles
+	URI           string
+}
+
+// HLSRendition segments subtitles for HLS
+// Items overlapping several segments are added to each of them, as expected by HLS players.
+func (s Subtitles) HLSRendition(opts HLSOptions) (r *HLSRendition, err error) {
+	// Get timeline
+	s.Order()
+	t := opts.Timeline
+	if t == nil {
+		// Get total duration
+		total := opts.Duration
+		if total <= 0 {
+			total = s.Duration()
+		}
+
+		// Get segment ends
+		ends := segmentEnds(opts.SegmentDuration, opts.SegmentDurations, total)
+		if len(ends) == 0 {
+			err = errors.New("astisub: no hls segments, segment duration must be > 0")
+			return
+		}
+		t = newSegmentTimeline(ends)
+		t.MediaSequence = opts.MediaSequence
+	}
+
+	// Get segment uri
+	uri := opts.SegmentURI
+	if uri == "" {
+		uri = hlsDefaultSegmentURI
+	}
+
+	// Create rendition
+	r = &HLSRendition{
+		MediaSequence:   t.MediaSequence,
+		MPEGTSOffset:    opts.MPEGTSOffset,
+		PlaylistType:    opts.PlaylistType,
+		ProgramDateTime: t.ProgramDateTime,
+	}
+
+	// Loop through segments
+	for idx, ts := range t.Segments {
+		// Segments must not be empty
+		if ts.Duration <= 0 {
+			err = fmt.Errorf("astisub: hls segment %d has an invalid duration %s", idx, ts.Duration)
+			return
+		}
+
+		// Create subtitles
+		sub := s.between(ts.StartAt, ts.EndAt())
+
+		// Append segment
+		r.Segments = append(r.Segments, &HLSSegment{
+			Discontinuity: ts.Discontinuity,
+			Duration:      ts.Duration,
+			StartAt:       ts.StartAt,
+			Subtitles:     sub,
+			URI:           fmt.Sprintf(uri, t.MediaSequence+idx),
+		})
+	}
+	return
+}
+
+// TargetDuration returns the EXT-X-TARGETDURATION value in seconds
+func (r HLSRendition) TargetDuration() (d int) {
+	for _, s := range r.Segments {
+		if v := int(math.Round(s.Duration.Seconds())); v > d {
+			d = v
+		}
+	}
+	return
+}
+
+// WriteMediaPlaylist writes the media playlist
+func (r HLSRendition) WriteMediaPlaylist(o io.Writer) (err error) {
+	// Add header
+	var c = []byte("#EXTM3U\n#EXT-X-VERSION:3\n")
+	c = append(c, []byte(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", r.TargetDuration()))...)
+	c = append(c, []byte(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", r.MediaSequence))...)
+	if r.PlaylistType != "" {
+		c = append(c, []byte("#EXT-X-PLAYLIST-TYPE:"+r.PlaylistType+"\n")...)
+	}
+
+	// Add segments
+	for _, s := range r.Segments {
+		if s.Discontinuity {
+			c = append(c, []byte("#EXT-X-DISCONTINUITY\n")...)
+		}
+		if r.ProgramDateTime != nil {
+			c = append(c, []byte("#EXT-X-PROGRAM-DATE-TIME:"+r.ProgramDateTime.Add(s.StartAt).Format(hlsProgramDateTimeLayout)+"\n")...)
+		}
+		c = append(c, []byte(fmt.Sprintf("#EXTINF:%s,\n%s\n", formatHLSDuration(s.Duration), s.URI))...)
+	}
+
+	// Event playlists may still be appended to
+	if !r.Live && r.PlaylistType != HLSPlaylistTypeEvent {
+		c = append(c, []byte("#EXT-X-ENDLIST\n")...)
+	}
+
+	// Write
+	if _, err = o.Write(c); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
+
+// WriteSegment writes the segment in .vtt format
+// X-TIMESTAMP-MAP maps the segment start to its MPEG-TS timestamp
+func (r HLSRendition) WriteSegment(o io.Writer, s *HLSSegment) error {
+	return s.Subtitles.writeToWebVTT(o, fmt.Sprintf("MPEGTS:%d,LOCAL:%s", NewPTS(s.StartAt+r.MPEGTSOffset), formatDurationWebVTT(s.StartAt)))
+}
+
+func formatHLSDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// HLSMedia represents the EXT-X-MEDIA tag of a subtitles rendition in a multivariant playlist
+type HLSMedia struct {
+	Autoselect      bool
+	Characteristics string
+	Default         bool
+	Forced          bool
+	GroupID         string
+	Language        string
+	Name            string
+	URI             string
+}
+
+// String implements the Stringer interface
+func (m HLSMedia) String() string {
+	attrs := []string{"TYPE=SUBTITLES", "GROUP-ID=" + strconv.Quote(m.GroupID)}
+	if m.Language != "" {
+		attrs = append(attrs, "LANGUAGE="+strconv.Quote(m.Language))
+	}
+	attrs = append(attrs, "NAME="+strconv.Quote(m.Name))
+	attrs = append(attrs, "DEFAULT="+formatHLSBool(m.Default))
+	attrs = append(attrs, "AUTOSELECT="+formatHLSBool(m.Autoselect || m.Default))
+	attrs = append(attrs, "FORCED="+formatHLSBool(m.Forced))
+	if m.Characteristics != "" {
+		attrs = append(attrs, "CHARACTERISTICS="+strconv.Quote(m.Characteristics))
+	}
+	attrs = append(attrs, "URI="+strconv.Quote(m.URI))
+	return "#EXT-X-MEDIA:" + strings.Join(attrs, ",")
+}
+
+func formatHLSBool(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// AddHLSMedia adds the EXT-X-MEDIA tag to a multivariant playlist
+// The tag is added before the first variant and replaces any subtitles media with the same group id and name.
+// Variants without subtitles group are updated to reference the media group.
+func AddHLSMedia(i io.Reader, o io.Writer, m HLSMedia) (err error) {
+	// Scan
+	var scanner = bufio.NewScanner(i)
+	var c []byte
+	var added bool
+	var lineNum int
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+
+		// Header
+		if lineNum == 1 && strings.TrimPrefix(line, string(BytesBOM)) != "#EXTM3U" {
+			err = fmt.Errorf("astisub: invalid m3u8 header %s", line)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			// Same media is replaced
+			attrs := parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attrs["TYPE"] == "SUBTITLES" && attrs["GROUP-ID"] == m.GroupID && attrs["NAME"] == m.Name {
+				continue
+			}
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			// Add media before the first variant
+			if !added {
+				c = append(c, []byte(m.String()+"\n")...)
+				added = true
+			}
+
+			// Reference media group
+			if _, ok := parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))["SUBTITLES"]; !ok {
+				line += ",SUBTITLES=" + strconv.Quote(m.GroupID)
+			}
+		}
+		c = append(c, []byte(line+"\n")...)
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("astisub: scanning failed: %w", err)
+		return
+	}
+
+	// Empty playlist
+	if lineNum == 0 {
+		c = append(c, []byte("#EXTM3U\n")...)
+	}
+
+	// No variant
+	if !added {
+		c = append(c, []byte(m.String()+"\n")...)
+	}
+
+	// Write
+	if _, err = io.Copy(o, bytes.NewReader(c)); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
+
+// parseHLSAttributes parses an attribute list such as `TYPE=SUBTITLES,NAME="a,b"`
+func parseHLSAttributes(i string) (o map[string]string) {
+	o = make(map[string]string)
+	for len(i) > 0 {
+		// Get key
+		idx := strings.Index(i, "=")
+		if idx < 0 {
+			return
+		}
+		key := strings.TrimSpace(i[:idx])
+		i = i[idx+1:]
+
+		// Get value
+		var value string
+		if strings.HasPrefix(i, `"`) {
+			if idx = strings.Index(i[1:], `"`); idx < 0 {
+				o[key] = i[1:]
+				return
+			}
+			value, i = i[1:idx+1], i[idx+2:]
+			i = strings.TrimPrefix(i, ",")
+		} else if idx = strings.Index(i, ","); idx >= 0 {
+			value, i = i[:idx], i[idx+1:]
+		} else {
+			value, i = i, ""
+		}
+		o[key] = value
+	}
+	return
+}
+
+// ReadSegmentTimelineFromHLS parses segment boundaries out of an HLS media playlist
+// Segment starts are based on EXT-X-PROGRAM-DATE-TIME when available, which preserves gaps, and on the previous
+// segments' EXTINF otherwise.
+func ReadSegmentTimelineFromHLS(i io.Reader) (t *SegmentTimeline, err error) {
+	// Scan
+	t = &SegmentTimeline{}
+	var scanner = bufio.NewScanner(i)
+	var lineNum int
+	var seg TimelineSegment
+	var inf bool
+	var pdt *time.Time
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+
+		// Header
+		if lineNum == 1 && strings.TrimPrefix(line, string(BytesBOM)) != "#EXTM3U" {
+			err = fmt.Errorf("astisub: line %d: invalid m3u8 header %s", lineNum, line)
+			return
+		}
+
+		switch {
+		case len(line) == 0:
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			err = fmt.Errorf("astisub: line %d: multivariant playlist found whereas a media playlist is expected", lineNum)
+			return
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			v := strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:")
+			if t.MediaSequence, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("astisub: line %d: atoi of %s failed: %w", lineNum, v, err)
+				return
+			}
+		case line == "#EXT-X-DISCONTINUITY":
+			seg.Discontinuity = true
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			v := strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")
+			var d time.Time
+			if d, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				if d, err = time.Parse(hlsProgramDateTimeLayoutNoColons, v); err != nil {
+					err = fmt.Errorf("astisub: line %d: parsing program date time %s failed: %w", lineNum, v, err)
+					return
+				}
+			}
+			pdt = &d
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v := strings.TrimPrefix(line, "#EXTINF:")
+			if idx := strings.Index(v, ","); idx >= 0 {
+				v = v[:idx]
+			}
+			var f float64
+			if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				err = fmt.Errorf("astisub: line %d: parsing duration %s failed: %w", lineNum, v, err)
+				return
+			}
+			seg.Duration = time.Duration(math.Round(f * float64(time.Second)))
+			inf = true
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			// URI lines end segments
+			if !inf {
+				err = fmt.Errorf("astisub: line %d: no EXTINF found for segment %s", lineNum, line)
+				return
+			}
+
+			// Get start
+			if n := len(t.Segments); n > 0 {
+				seg.StartAt = t.Segments[n-1].EndAt()
+			}
+			if pdt != nil {
+				if t.ProgramDateTime == nil {
+					d := pdt.Add(-seg.StartAt)
+					t.ProgramDateTime = &d
+				} else {
+					seg.StartAt = pdt.Sub(*t.ProgramDateTime)
+				}
+			}
+
+			// Append segment
+			seg.URI = line
+			t.Segments = append(t.Segments, seg)
+			seg = TimelineSegment{}
+			inf = false
+			pdt = nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("astisub: scanning failed: %w", err)
+		return
+	}
+	return
+}
+
+// ReadFromHLSPlaylist reads the WebVTT segments of a local HLS media playlist back into a single track
+func ReadFromHLSPlaylist(filename string) (*Subtitles, error) {
+	return ReadFromHLSPlaylistWithOptions(filename, WebVTTOptions{})
+}
+
+// ReadFromHLSPlaylistWithOptions reads the WebVTT segments of a local HLS media playlist back into a single track
+// with options
+// Each segment is parsed with its X-TIMESTAMP-MAP offset and items repeated across segments are merged back.
+func ReadFromHLSPlaylistWithOptions(filename string, opts WebVTTOptions) (s *Subtitles, err error) {
+	// Open playlist
+	var t *SegmentTimeline
+	if t, err = OpenSegmentTimeline(filename); err != nil {
+		err = fmt.Errorf("astisub: opening segment timeline failed: %w", err)
+		return
+	}
+
+	// Loop through segments
+	s = NewSubtitles()
+	for idx, seg := range t.Segments {
+		// Remote segments are not supported
+		if u, errParse := url.Parse(seg.URI); errParse == nil && u.Scheme != "" {
+			err = fmt.Errorf("astisub: hls segment %s is not local", seg.URI)
+			return
+		}
+
+		// Read segment
+		p := seg.URI
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(filename), filepath.FromSlash(p))
+		}
+		var sub *Subtitles
+		if sub, err = readHLSSegment(p, opts); err != nil {
+			err = fmt.Errorf("astisub: reading hls segment %s failed: %w", p, err)
+			return
+		}
+
+		// Merge
+		if idx == 0 {
+			s.Metadata = sub.Metadata
+		}
+		s.Merge(sub)
+	}
+
+	// Merge items repeated across segments
+	s.Unfragment()
+	return
+}
+
+func readHLSSegment(filename string, opts WebVTTOptions) (s *Subtitles, err error) {
+	// Open the file
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		err = fmt.Errorf("astisub: opening %s failed: %w", filename, err)
+		return
+	}
+	defer f.Close()
+
+	// Parse the content
+	return ReadFromWebVTTWithOptions(f, opts)
+}
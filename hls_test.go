@@ -0,0 +1,153 @@
+package astisub_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHLS(t *testing.T) {
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{
+		{EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: time.Second},
+		{EndAt: 9 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: 5 * time.Second},
+		{EndAt: 6 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "3"}}}}, StartAt: 5500 * time.Millisecond},
+	}
+
+	// No segment duration
+	_, err := s.HLSRendition(astisub.HLSOptions{})
+	assert.Error(t, err)
+
+	r, err := s.HLSRendition(astisub.HLSOptions{
+		Duration:        10 * time.Second,
+		MPEGTSOffset:    10 * time.Second,
+		PlaylistType:    astisub.HLSPlaylistTypeVOD,
+		SegmentDuration: 4 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Len(t, r.Segments, 3)
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, r.Segments[0].Subtitles.Items)
+	assert.Equal(t, []*astisub.Item{s.Items[1], s.Items[2]}, r.Segments[1].Subtitles.Items)
+	assert.Equal(t, []*astisub.Item{s.Items[1]}, r.Segments[2].Subtitles.Items)
+	assert.Equal(t, "seg-002.vtt", r.Segments[2].URI)
+	assert.Equal(t, 2*time.Second, r.Segments[2].Duration)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, r.WriteMediaPlaylist(b))
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:4.000,
+seg-000.vtt
+#EXTINF:4.000,
+seg-001.vtt
+#EXTINF:2.000,
+seg-002.vtt
+#EXT-X-ENDLIST
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, r.WriteSegment(b, r.Segments[2]))
+	assert.Equal(t, `WEBVTT
+X-TIMESTAMP-MAP=MPEGTS:1620000,LOCAL:00:00:08.000
+
+1
+00:00:05.000 --> 00:00:09.000
+2
+`, b.String())
+
+	// Segments map back to the same timeline
+	s2, err := astisub.ReadFromWebVTT(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, s2.Items[0].StartAt)
+
+	// Specified segment durations
+	r, err = s.HLSRendition(astisub.HLSOptions{SegmentDurations: []time.Duration{5 * time.Second, 5 * time.Second}, SegmentURI: "sub_%d.vtt"})
+	require.NoError(t, err)
+	require.Len(t, r.Segments, 2)
+	assert.Equal(t, "sub_1.vtt", r.Segments[1].URI)
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, r.Segments[0].Subtitles.Items)
+}
+
+func TestAddHLSMedia(t *testing.T) {
+	m := astisub.HLSMedia{Default: true, GroupID: "subs", Language: "en", Name: "English", URI: "en/playlist.m3u8"}
+	assert.Equal(t, `#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",LANGUAGE="en",NAME="English",DEFAULT=YES,AUTOSELECT=YES,FORCED=NO,URI="en/playlist.m3u8"`, m.String())
+
+	b := &bytes.Buffer{}
+	require.NoError(t, astisub.AddHLSMedia(strings.NewReader(`#EXTM3U
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="old.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="audio.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,SUBTITLES="other"
+high.m3u8
+`), b, m))
+	assert.Equal(t, `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="audio.m3u8"
+`+m.String()+`
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,SUBTITLES="other"
+high.m3u8
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, astisub.AddHLSMedia(strings.NewReader(""), b, m))
+	assert.Equal(t, "#EXTM3U\n"+m.String()+"\n", b.String())
+
+	assert.Error(t, astisub.AddHLSMedia(strings.NewReader("WEBVTT"), b, m))
+}
+
+func TestReadFromHLSPlaylist(t *testing.T) {
+	// Write rendition
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{
+		{EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: time.Second},
+		{EndAt: 9 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: 5 * time.Second},
+	}
+	r, err := s.HLSRendition(astisub.HLSOptions{
+		MPEGTSOffset:    10 * time.Second,
+		SegmentDuration: 2 * time.Second,
+	})
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "astisub")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	b := &bytes.Buffer{}
+	require.NoError(t, r.WriteMediaPlaylist(b))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), b.Bytes(), 0644))
+	for _, seg := range r.Segments {
+		b.Reset()
+		require.NoError(t, r.WriteSegment(b, seg))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, seg.URI), b.Bytes(), 0644))
+	}
+
+	// Items are relative to PTS 0 by default
+	o, err := astisub.ReadFromHLSPlaylist(filepath.Join(dir, "index.m3u8"))
+	require.NoError(t, err)
+	require.Len(t, o.Items, 2)
+	assert.Equal(t, 11*time.Second, o.Items[0].StartAt)
+	assert.Equal(t, 19*time.Second, o.Items[1].EndAt)
+
+	// Items are relative to the base PTS and repeated items are merged back
+	base := astisub.NewPTS(10 * time.Second)
+	o, err = astisub.ReadFromHLSPlaylistWithOptions(filepath.Join(dir, "index.m3u8"), astisub.WebVTTOptions{BasePTS: &base})
+	require.NoError(t, err)
+	require.Len(t, o.Items, 2)
+	assert.Equal(t, time.Second, o.Items[0].StartAt)
+	assert.Equal(t, 3*time.Second, o.Items[0].EndAt)
+	assert.Equal(t, "1", o.Items[0].String())
+	assert.Equal(t, 5*time.Second, o.Items[1].StartAt)
+	assert.Equal(t, 9*time.Second, o.Items[1].EndAt)
+	assert.Equal(t, "2", o.Items[1].String())
+}
@@ -1,10 +1,38 @@
 package astisub
 
+import "github.com/asticode/go-astikit"
+
 // Languages
 const (
-	LanguageChinese   = "chinese"
-	LanguageEnglish   = "english"
-	LanguageFrench    = "french"
-	LanguageJapanese  = "japanese"
-	LanguageNorwegian = "norwegian"
+	LanguageChinese    = "chinese"
+	LanguageCzech      = "czech"
+	LanguageEnglish    = "english"
+	LanguageFinnish    = "finnish"
+	LanguageFrench     = "french"
+	LanguageGerman     = "german"
+	LanguageHungarian  = "hungarian"
+	LanguageItalian    = "italian"
+	LanguageJapanese   = "japanese"
+	LanguageNorwegian  = "norwegian"
+	LanguagePortuguese = "portuguese"
+	LanguageSlovak     = "slovak"
+	LanguageSpanish    = "spanish"
+	LanguageSwedish    = "swedish"
 )
+
+// ISO 639-2 language mapping
+var languageISO6392Mapping = astikit.NewBiMap().
+	Set("chi", LanguageChinese).
+	Set("cze", LanguageCzech).
+	Set("eng", LanguageEnglish).
+	Set("fin", LanguageFinnish).
+	Set("fre", LanguageFrench).
+	Set("ger", LanguageGerman).
+	Set("hun", LanguageHungarian).
+	Set("ita", LanguageItalian).
+	Set("jpn", LanguageJapanese).
+	Set("nor", LanguageNorwegian).
+	Set("por", LanguagePortuguese).
+	Set("slo", LanguageSlovak).
+	Set("spa", LanguageSpanish).
+	Set("swe", LanguageSwedish)
@@ -0,0 +1,216 @@
+package astisub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default live options
+const (
+	liveDefaultWindowSize = 5
+)
+
+// Live errors
+var (
+	ErrLiveItemTooLate            = errors.New("astisub: live item ends before the next segment")
+	ErrLiveSegmenterClosed        = errors.New("astisub: live segmenter is closed")
+	ErrLiveInvalidSegmentDuration = errors.New("astisub: live segment duration must be > 0")
+)
+
+// LiveClock returns the current wall clock time. It allows injecting a fake clock.
+type LiveClock func() time.Time
+
+// LiveSegmenterOptions represents live segmenter options
+type LiveSegmenterOptions struct {
+	// Defaults to time.Now
+	Clock         LiveClock
+	MediaSequence int
+	// MPEG-TS timestamp of the media segments matching 0 in the subtitles timeline. See HLSOptions.
+	MPEGTSOffset    time.Duration
+	SegmentDuration time.Duration
+	// fmt format receiving the segment media sequence. Defaults to "seg-%03d.vtt".
+	SegmentURI string
+	// Wall clock time matching 0 in the subtitles timeline. Defaults to the clock's time when the segmenter is
+	// created.
+	StartAt time.Time
+	// Number of segments kept in the playlist. Defaults to 5.
+	WindowSize int
+}
+
+// LiveSegmenter segments subtitles for HLS as they are received, e.g. from a teletext or 608 decoder
+// Items are pushed with timestamps relative to the segmenter start and segments are cut every segment duration
+// as the clock advances. Items overlapping several segments are added to each of them, as Segment does.
+type LiveSegmenter struct {
+	closed   bool
+	items    []*Item
+	m        *sync.Mutex
+	o        LiveSegmenterOptions
+	r        *HLSRendition
+	sequence int // Media sequence of the next segment
+	start    time.Duration
+}
+
+// NewLiveSegmenter creates a new live segmenter
+func NewLiveSegmenter(o LiveSegmenterOptions) (s *LiveSegmenter, err error) {
+	// Check options
+	if o.SegmentDuration <= 0 {
+		err = ErrLiveInvalidSegmentDuration
+		return
+	}
+
+	// Default options
+	if o.Clock == nil {
+		o.Clock = time.Now
+	}
+	if o.SegmentURI == "" {
+		o.SegmentURI = hlsDefaultSegmentURI
+	}
+	if o.StartAt.IsZero() {
+		o.StartAt = o.Clock()
+	}
+	if o.WindowSize <= 0 {
+		o.WindowSize = liveDefaultWindowSize
+	}
+
+	// Create segmenter
+	pdt := o.StartAt
+	s = &LiveSegmenter{
+		m: &sync.Mutex{},
+		o: o,
+		r: &HLSRendition{
+			Live:            true,
+			MediaSequence:   o.MediaSequence,
+			MPEGTSOffset:    o.MPEGTSOffset,
+			ProgramDateTime: &pdt,
+		},
+		sequence: o.MediaSequence,
+	}
+	return
+}
+
+// Push adds an item to the segmenter
+// Items may be pushed in any order, as long as they end after the start of the next segment.
+func (s *LiveSegmenter) Push(i *Item) error {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Closed
+	if s.closed {
+		return ErrLiveSegmenterClosed
+	}
+
+	// Item ends in a segment that has already been flushed
+	if i.EndAt <= s.start {
+		return fmt.Errorf("%w: item ends at %s, next segment starts at %s", ErrLiveItemTooLate, i.EndAt, s.start)
+	}
+
+	// Insert item while keeping items ordered
+	idx := sort.Search(len(s.items), func(idx int) bool { return s.items[idx].StartAt > i.StartAt })
+	s.items = append(s.items, nil)
+	copy(s.items[idx+1:], s.items[idx:])
+	s.items[idx] = i
+	return nil
+}
+
+// Flush cuts every segment that has fully elapsed according to the clock and returns them
+// The playlist is updated accordingly.
+func (s *LiveSegmenter) Flush() (segs []*HLSSegment, err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Closed
+	if s.closed {
+		err = ErrLiveSegmenterClosed
+		return
+	}
+
+	// Loop through elapsed segments
+	now := s.o.Clock().Sub(s.o.StartAt)
+	for s.start+s.o.SegmentDuration <= now {
+		segs = append(segs, s.cut(s.o.SegmentDuration))
+	}
+	return
+}
+
+// Close cuts a last segment with the remaining items, ending either now or at the end of the last item, and
+// ends the playlist
+func (s *LiveSegmenter) Close() (segs []*HLSSegment, err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Closed
+	if s.closed {
+		err = ErrLiveSegmenterClosed
+		return
+	}
+	s.closed = true
+	s.r.Live = false
+
+	// Get end
+	end := s.o.Clock().Sub(s.o.StartAt)
+	for _, i := range s.items {
+		if i.EndAt > end {
+			end = i.EndAt
+		}
+	}
+
+	// Loop through remaining segments
+	for s.start < end {
+		d := s.o.SegmentDuration
+		if s.start+d > end {
+			d = end - s.start
+		}
+		segs = append(segs, s.cut(d))
+	}
+	return
+}
+
+// cut creates the next segment, drops items that can't be part of later segments and slides the playlist window
+// It assumes the lock is held.
+func (s *LiveSegmenter) cut(d time.Duration) (seg *HLSSegment) {
+	// Create subtitles
+	sub := NewSubtitles()
+	sub.Items = Subtitles{Items: s.items}.itemsBetween(s.start, s.start+d)
+
+	// Create segment
+	seg = &HLSSegment{
+		Duration:  d,
+		StartAt:   s.start,
+		Subtitles: sub,
+		URI:       fmt.Sprintf(s.o.SegmentURI, s.sequence),
+	}
+	s.sequence++
+	s.start += d
+
+	// Drop items that have ended
+	var items []*Item
+	for _, i := range s.items {
+		if i.EndAt > s.start {
+			items = append(items, i)
+		}
+	}
+	s.items = items
+
+	// Update playlist
+	s.r.Segments = append(s.r.Segments, seg)
+	if len(s.r.Segments) > s.o.WindowSize {
+		s.r.MediaSequence += len(s.r.Segments) - s.o.WindowSize
+		s.r.Segments = append([]*HLSSegment{}, s.r.Segments[len(s.r.Segments)-s.o.WindowSize:]...)
+	}
+	return
+}
+
+// Rendition returns a snapshot of the sliding window playlist
+func (s *LiveSegmenter) Rendition() HLSRendition {
+	s.m.Lock()
+	defer s.m.Unlock()
+	r := *s.r
+	r.Segments = append([]*HLSSegment{}, s.r.Segments...)
+	return r
+}
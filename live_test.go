@@ -0,0 +1,80 @@
+package astisub_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveSegmenter(t *testing.T) {
+	// Fake clock
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	s, err := astisub.NewLiveSegmenter(astisub.LiveSegmenterOptions{
+		Clock:           func() time.Time { return now },
+		SegmentDuration: 4 * time.Second,
+		WindowSize:      2,
+	})
+	require.NoError(t, err)
+
+	// Nothing has elapsed yet
+	segs, err := s.Flush()
+	require.NoError(t, err)
+	require.Len(t, segs, 0)
+
+	// Items are pushed out of order and one spans a segment boundary
+	newItem := func(start, end time.Duration, text string) *astisub.Item {
+		return &astisub.Item{EndAt: end, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: text}}}}, StartAt: start}
+	}
+	require.NoError(t, s.Push(newItem(3*time.Second, 6*time.Second, "2")))
+	require.NoError(t, s.Push(newItem(time.Second, 2*time.Second, "1")))
+	now = start.Add(5 * time.Second)
+	segs, err = s.Flush()
+	require.NoError(t, err)
+	require.Len(t, segs, 1)
+	assert.Equal(t, "seg-000.vtt", segs[0].URI)
+	assert.Equal(t, time.Duration(0), segs[0].StartAt)
+	require.Len(t, segs[0].Subtitles.Items, 2)
+	assert.Equal(t, "1", segs[0].Subtitles.Items[0].String())
+	assert.Equal(t, "2", segs[0].Subtitles.Items[1].String())
+
+	// Items ending in flushed segments are rejected
+	assert.True(t, errors.Is(s.Push(newItem(time.Second, 3*time.Second, "late")), astisub.ErrLiveItemTooLate))
+
+	// Several segments may elapse at once and the window slides
+	require.NoError(t, s.Push(newItem(9*time.Second, 10*time.Second, "3")))
+	now = start.Add(12 * time.Second)
+	segs, err = s.Flush()
+	require.NoError(t, err)
+	require.Len(t, segs, 2)
+	require.Len(t, segs[0].Subtitles.Items, 1)
+	assert.Equal(t, "2", segs[0].Subtitles.Items[0].String())
+	require.Len(t, segs[1].Subtitles.Items, 1)
+	assert.Equal(t, "3", segs[1].Subtitles.Items[0].String())
+	r := s.Rendition()
+	w := &bytes.Buffer{}
+	require.NoError(t, r.WriteMediaPlaylist(w))
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:1\n#EXT-X-PROGRAM-DATE-TIME:2023-01-02T03:04:09.000Z\n#EXTINF:4.000,\nseg-001.vtt\n#EXT-X-PROGRAM-DATE-TIME:2023-01-02T03:04:13.000Z\n#EXTINF:4.000,\nseg-002.vtt\n", w.String())
+	w.Reset()
+	require.NoError(t, r.WriteSegment(w, segs[1]))
+	assert.Equal(t, "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:720000,LOCAL:00:00:08.000\n\n1\n00:00:09.000 --> 00:00:10.000\n3\n", w.String())
+
+	// Closing flushes the remaining items and ends the playlist
+	require.NoError(t, s.Push(newItem(13*time.Second, 14*time.Second, "4")))
+	segs, err = s.Close()
+	require.NoError(t, err)
+	require.Len(t, segs, 1)
+	assert.Equal(t, 2*time.Second, segs[0].Duration)
+	require.Len(t, segs[0].Subtitles.Items, 1)
+	w.Reset()
+	r = s.Rendition()
+	require.NoError(t, r.WriteMediaPlaylist(w))
+	assert.Contains(t, w.String(), "seg-003.vtt\n#EXT-X-ENDLIST\n")
+	_, err = s.Flush()
+	assert.Equal(t, astisub.ErrLiveSegmenterClosed, err)
+}
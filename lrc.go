@@ -0,0 +1,324 @@
+package astisub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants
+const (
+	// LRC doesn't have end times: lines end when the next line starts. The last line ends after the
+	// duration provided in the "length" tag or, if there's none, after this duration.
+	lrcLastItemDuration = 5 * time.Second
+)
+
+// Vars
+var (
+	lrcRegexpTag            = regexp.MustCompile(`^\[([^\]]*)\]`)
+	lrcRegexpTimestamp      = regexp.MustCompile(`^(\d+):(\d{1,2})(?:[.:](\d{1,3}))?$`)
+	lrcRegexpWordTimestamp  = regexp.MustCompile(`<(\d+:\d{1,2}(?:[.:]\d{1,3})?)>`)
+	lrcRegexpMetadataTagKey = regexp.MustCompile(`^[a-zA-Z#]+$`)
+)
+
+// parseDurationLRC parses an .lrc duration in "mm:ss", "mm:ss.xx" or "mm:ss.xxx" format
+func parseDurationLRC(i string) (d time.Duration, err error) {
+	// Match
+	ms := lrcRegexpTimestamp.FindStringSubmatch(strings.TrimSpace(i))
+	if len(ms) == 0 {
+		err = fmt.Errorf("astisub: %s is not a valid lrc duration", i)
+		return
+	}
+
+	// Parse minutes and seconds
+	var minutes, seconds int
+	if minutes, err = strconv.Atoi(ms[1]); err != nil {
+		err = fmt.Errorf("astisub: atoi of %s failed: %w", ms[1], err)
+		return
+	}
+	if seconds, err = strconv.Atoi(ms[2]); err != nil {
+		err = fmt.Errorf("astisub: atoi of %s failed: %w", ms[2], err)
+		return
+	}
+	d = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+
+	// Parse fraction
+	if ms[3] != "" {
+		var f int
+		if f, err = strconv.Atoi(ms[3]); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", ms[3], err)
+			return
+		}
+		d += time.Duration(f) * time.Duration(math.Pow10(3-len(ms[3]))) * time.Millisecond
+	}
+	return
+}
+
+// formatDurationLRC formats an .lrc duration in "mm:ss.xx" format
+func formatDurationLRC(i time.Duration) string {
+	if i < 0 {
+		i = 0
+	}
+	cs := int64(i.Round(10*time.Millisecond) / (10 * time.Millisecond))
+	return fmt.Sprintf("%02d:%02d.%02d", cs/6000, cs/100%60, cs%100)
+}
+
+// lrcLine represents a timed .lrc line
+type lrcLine struct {
+	l       Line
+	startAt time.Duration
+}
+
+// ReadFromLRC parses an .lrc content
+// Word timestamps of the enhanced format are stored in line items start times.
+func ReadFromLRC(i io.Reader) (o *Subtitles, err error) {
+	// Init
+	o = NewSubtitles()
+	var scanner = bufio.NewScanner(i)
+
+	// Scan
+	var length, offset time.Duration
+	var lineNum int
+	var ls []lrcLine
+	metadata := func() *Metadata {
+		if o.Metadata == nil {
+			o.Metadata = &Metadata{}
+		}
+		return o.Metadata
+	}
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+
+		// Remove BOM header
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, string(BytesBOM))
+		}
+
+		// Loop through tags
+		var startAts []time.Duration
+		for {
+			ms := lrcRegexpTag.FindStringSubmatch(line)
+			if len(ms) == 0 {
+				break
+			}
+
+			// Timestamp
+			if d, errD := parseDurationLRC(ms[1]); errD == nil {
+				startAts = append(startAts, d)
+				line = line[len(ms[0]):]
+				continue
+			}
+
+			// Metadata tags are alone on their line
+			if len(startAts) > 0 {
+				break
+			}
+			ps := strings.SplitN(ms[1], ":", 2)
+			if len(ps) != 2 || !lrcRegexpMetadataTagKey.MatchString(ps[0]) {
+				break
+			}
+			k, v := strings.ToLower(strings.TrimSpace(ps[0])), strings.TrimSpace(ps[1])
+			switch k {
+			case "al":
+				metadata().LRCAlbum = v
+			case "ar":
+				metadata().LRCArtist = v
+			case "au":
+				metadata().LRCAuthor = v
+			case "by":
+				metadata().LRCCreator = v
+			case "length":
+				if length, err = parseDurationLRC(v); err != nil {
+					err = fmt.Errorf("astisub: line %d: parsing lrc length %s failed: %w", lineNum, v, err)
+					return
+				}
+			case "offset":
+				var ms int
+				if ms, err = strconv.Atoi(strings.TrimPrefix(v, "+")); err != nil {
+					err = fmt.Errorf("astisub: line %d: atoi of lrc offset %s failed: %w", lineNum, v, err)
+					return
+				}
+				offset = time.Duration(ms) * time.Millisecond
+			case "ti":
+				metadata().Title = v
+			}
+			break
+		}
+
+		// No timestamp
+		if len(startAts) == 0 {
+			continue
+		}
+
+		// Parse text
+		var l Line
+		if l, err = parseTextLRC(line); err != nil {
+			err = fmt.Errorf("astisub: line %d: parsing lrc text failed: %w", lineNum, err)
+			return
+		}
+
+		// Lines with several timestamps are repeated
+		for _, startAt := range startAts {
+			ls = append(ls, lrcLine{l: l, startAt: startAt})
+		}
+	}
+
+	// Sort lines
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].startAt < ls[j].startAt })
+
+	// Loop through lines
+	// Empty lines end the previous item and consecutive lines with the same timestamp belong to the same item
+	var it *Item
+	for _, l := range ls {
+		// Same timestamp
+		if it != nil && it.EndAt == 0 && it.StartAt == l.startAt {
+			if len(l.l.Items) > 0 {
+				it.Lines = append(it.Lines, l.l)
+			}
+			continue
+		}
+
+		// End previous item
+		if it != nil && it.EndAt == 0 {
+			it.EndAt = l.startAt
+		}
+
+		// Empty line
+		if len(l.l.Items) == 0 {
+			continue
+		}
+
+		// Create item
+		it = &Item{Lines: []Line{l.l}, StartAt: l.startAt}
+		o.Items = append(o.Items, it)
+	}
+
+	// End last item
+	if it != nil && it.EndAt == 0 {
+		if length > it.StartAt {
+			it.EndAt = length
+		} else {
+			it.EndAt = it.StartAt + lrcLastItemDuration
+		}
+	}
+
+	// Apply offset
+	// A positive offset makes lines appear sooner
+	if offset != 0 {
+		o.Add(-offset)
+		for _, it := range o.Items {
+			for idxLine := range it.Lines {
+				for idxItem := range it.Lines[idxLine].Items {
+					if li := &it.Lines[idxLine].Items[idxItem]; li.StartAt > 0 {
+						li.StartAt -= offset
+					}
+				}
+			}
+		}
+	}
+
+	// Word timestamps matching the start of the item are not needed
+	for _, it := range o.Items {
+		for idxLine := range it.Lines {
+			for idxItem := range it.Lines[idxLine].Items {
+				if li := &it.Lines[idxLine].Items[idxItem]; li.StartAt <= it.StartAt {
+					li.StartAt = 0
+				}
+			}
+		}
+	}
+	return
+}
+
+// parseTextLRC parses an .lrc text, splitting it into line items on word timestamps
+func parseTextLRC(i string) (o Line, err error) {
+	// Loop through word timestamps
+	var startAt time.Duration
+	var start int
+	for _, idxs := range lrcRegexpWordTimestamp.FindAllStringSubmatchIndex(i, -1) {
+		// Add previous text
+		if t := i[start:idxs[0]]; t != "" {
+			o.Items = append(o.Items, LineItem{StartAt: startAt, Text: t})
+		}
+
+		// Parse timestamp
+		if startAt, err = parseDurationLRC(i[idxs[2]:idxs[3]]); err != nil {
+			err = fmt.Errorf("astisub: parsing lrc duration %s failed: %w", i[idxs[2]:idxs[3]], err)
+			return
+		}
+		start = idxs[1]
+	}
+
+	// Add last text
+	// A timestamp at the end of the line only marks the end of the last word
+	if t := i[start:]; t != "" {
+		o.Items = append(o.Items, LineItem{StartAt: startAt, Text: t})
+	}
+	return
+}
+
+// WriteToLRC writes subtitles in .lrc format
+// Line items start times are written as word timestamps of the enhanced format.
+func (s Subtitles) WriteToLRC(o io.Writer) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
+
+	// Add metadata
+	var c []byte
+	if s.Metadata != nil {
+		for _, v := range []struct {
+			k, v string
+		}{
+			{k: "ti", v: s.Metadata.Title},
+			{k: "ar", v: s.Metadata.LRCArtist},
+			{k: "al", v: s.Metadata.LRCAlbum},
+			{k: "au", v: s.Metadata.LRCAuthor},
+			{k: "by", v: s.Metadata.LRCCreator},
+		} {
+			if v.v != "" {
+				c = append(c, []byte("["+v.k+":"+v.v+"]")...)
+				c = append(c, bytesLineSeparator...)
+			}
+		}
+	}
+
+	// Loop through subtitles
+	for idx, v := range s.Items {
+		// Loop through lines
+		// Every line of an item gets the item start time
+		for _, l := range v.Lines {
+			c = append(c, []byte("["+formatDurationLRC(v.StartAt)+"]")...)
+			for _, li := range l.Items {
+				if li.StartAt > 0 {
+					c = append(c, []byte("<"+formatDurationLRC(li.StartAt)+">")...)
+				}
+				c = append(c, []byte(li.Text)...)
+			}
+			c = append(c, bytesLineSeparator...)
+		}
+
+		// Add an empty line when the item doesn't end when the next one starts
+		if idx == len(s.Items)-1 || s.Items[idx+1].StartAt > v.EndAt {
+			c = append(c, []byte("["+formatDurationLRC(v.EndAt)+"]")...)
+			c = append(c, bytesLineSeparator...)
+		}
+	}
+
+	// Write
+	if _, err = o.Write(c); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package astisub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRC(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromLRC(strings.NewReader(`[ti:Twinkle]
+[ar:Traditional]
+[offset:+500]
+[length:00:20]
+
+[00:01.50]<00:01.50>Twin<00:02.00>kle <00:02.50>twin<00:03.00>kle<00:03.50>
+[00:04.00]Little star
+[00:04.00]How I wonder
+[00:08.00]
+[00:10.00][00:15.000]Chorus`))
+	require.NoError(t, err)
+	assert.Equal(t, "Twinkle", s.Metadata.Title)
+	assert.Equal(t, "Traditional", s.Metadata.LRCArtist)
+	require.Len(t, s.Items, 4)
+	for idx, v := range []struct {
+		endAt, startAt time.Duration
+		lines          int
+	}{
+		{endAt: 3500 * time.Millisecond, lines: 1, startAt: time.Second},
+		{endAt: 7500 * time.Millisecond, lines: 2, startAt: 3500 * time.Millisecond},
+		{endAt: 14500 * time.Millisecond, lines: 1, startAt: 9500 * time.Millisecond},
+		{endAt: 19500 * time.Millisecond, lines: 1, startAt: 14500 * time.Millisecond},
+	} {
+		assert.Equal(t, v.startAt, s.Items[idx].StartAt)
+		assert.Equal(t, v.endAt, s.Items[idx].EndAt)
+		assert.Len(t, s.Items[idx].Lines, v.lines)
+	}
+	require.Len(t, s.Items[0].Lines[0].Items, 4)
+	assert.Equal(t, "Twinkle twinkle", s.Items[0].Lines[0].String())
+	assert.Equal(t, time.Duration(0), s.Items[0].Lines[0].Items[0].StartAt)
+	assert.Equal(t, "kle ", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, 1500*time.Millisecond, s.Items[0].Lines[0].Items[1].StartAt)
+	assert.Equal(t, "How I wonder", s.Items[1].Lines[1].String())
+
+	// Write
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToLRC(w))
+	assert.Equal(t, `[ti:Twinkle]
+[ar:Traditional]
+[00:01.00]Twin<00:01.50>kle <00:02.00>twin<00:02.50>kle
+[00:03.50]Little star
+[00:03.50]How I wonder
+[00:07.50]
+[00:09.50]Chorus
+[00:14.50]Chorus
+[00:19.50]
+`, w.String())
+
+	// Errors
+	_, err = astisub.ReadFromLRC(strings.NewReader("[offset:foo]"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,779 @@
+package astisub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://www.matroska.org/technical/elements.html
+// https://www.matroska.org/technical/subtitles.html
+
+// Matroska codec IDs
+const (
+	MatroskaCodecIDASS        = "S_TEXT/ASS"
+	MatroskaCodecIDSSA        = "S_TEXT/SSA"
+	MatroskaCodecIDUTF8       = "S_TEXT/UTF8"
+	MatroskaCodecIDWebMWebVTT = "D_WEBVTT/SUBTITLES"
+	MatroskaCodecIDWebVTT     = "S_TEXT/WEBVTT"
+)
+
+// Matroska defaults
+const (
+	matroskaDefaultTimestampScale = 1000000
+	matroskaTrackTypeSubtitle     = 0x11
+)
+
+// Matroska element IDs
+const (
+	matroskaIDBlock           = 0xa1
+	matroskaIDBlockDuration   = 0x9b
+	matroskaIDBlockGroup      = 0xa0
+	matroskaIDCluster         = 0x1f43b675
+	matroskaIDCodecID         = 0x86
+	matroskaIDCodecPrivate    = 0x63a2
+	matroskaIDDocType         = 0x4282
+	matroskaIDDocTypeRead     = 0x4285
+	matroskaIDDocTypeVersion  = 0x4287
+	matroskaIDDuration        = 0x4489
+	matroskaIDEBML            = 0x1a45dfa3
+	matroskaIDEBMLMaxID       = 0x42f2
+	matroskaIDEBMLMaxSize     = 0x42f3
+	matroskaIDEBMLReadVersion = 0x42f7
+	matroskaIDEBMLVersion     = 0x4286
+	matroskaIDFlagDefault     = 0x88
+	matroskaIDFlagForced      = 0x55aa
+	matroskaIDFlagLacing      = 0x9c
+	matroskaIDInfo            = 0x1549a966
+	matroskaIDLanguage        = 0x22b59c
+	matroskaIDLanguageBCP47   = 0x22b59d
+	matroskaIDMuxingApp       = 0x4d80
+	matroskaIDName            = 0x536e
+	matroskaIDSegment         = 0x18538067
+	matroskaIDSimpleBlock     = 0xa3
+	matroskaIDTimestamp       = 0xe7
+	matroskaIDTimestampScale  = 0x2ad7b1
+	matroskaIDTitle           = 0x7ba9
+	matroskaIDTrackEntry      = 0xae
+	matroskaIDTrackNumber     = 0xd7
+	matroskaIDTrackType       = 0x83
+	matroskaIDTrackUID        = 0x73c5
+	matroskaIDTracks          = 0x1654ae6b
+	matroskaIDWritingApp      = 0x5741
+)
+
+// Matroska errors
+var (
+	ErrMatroskaNoSubtitleTrack = errors.New("astisub: no matroska subtitle track found")
+)
+
+// matroskaUnknownSize is the size of elements whose size is unknown
+const matroskaUnknownSize = math.MaxUint64
+
+// MatroskaTrack represents a Matroska subtitle track
+type MatroskaTrack struct {
+	CodecID      string
+	CodecPrivate []byte
+	Default      bool
+	Forced       bool
+	// ISO 639-2 language, or BCP 47 language when available
+	Language string
+	Name     string
+	Number   uint64
+}
+
+// MatroskaOptions represents Matroska options
+type MatroskaOptions struct {
+	// Number of the track to read. Defaults to the first subtitle track.
+	TrackNumber uint64
+}
+
+// ebmlReader reads EBML elements from a stream
+type ebmlReader struct {
+	// Size of the parent element, 0 when reading a stream whose size is unknown
+	max uint64
+	r   *bufio.Reader
+}
+
+// readVint reads a variable size integer and returns it with or without its length marker
+func (r *ebmlReader) readVint(keepMarker bool) (v uint64, n int, err error) {
+	// Read first byte
+	var b byte
+	if b, err = r.r.ReadByte(); err != nil {
+		return
+	}
+
+	// Get length
+	for n = 1; n <= 8; n++ {
+		if b&(0x80>>uint(n-1)) > 0 {
+			break
+		}
+	}
+	if n > 8 {
+		err = errors.New("astisub: invalid ebml vint")
+		return
+	}
+
+	// Get value
+	var allOnes = b&(0xff>>uint(n)) == 0xff>>uint(n)
+	v = uint64(b)
+	if !keepMarker {
+		v = uint64(b & (0xff >> uint(n)))
+	}
+	for idx := 1; idx < n; idx++ {
+		if b, err = r.r.ReadByte(); err != nil {
+			return
+		}
+		allOnes = allOnes && b == 0xff
+		v = v<<8 | uint64(b)
+	}
+
+	// Unknown size
+	if !keepMarker && allOnes {
+		v = matroskaUnknownSize
+	}
+	return
+}
+
+// readHeader reads an element header
+func (r *ebmlReader) readHeader() (id, size uint64, err error) {
+	if id, _, err = r.readVint(true); err != nil {
+		return
+	}
+	if size, _, err = r.readVint(false); err != nil {
+		err = fmt.Errorf("astisub: reading size of ebml element %x failed: %w", id, err)
+		return
+	}
+	return
+}
+
+// checkSize checks that an element payload size is known and fits in its parent
+func (r *ebmlReader) checkSize(size uint64) error {
+	if size == matroskaUnknownSize {
+		return errors.New("astisub: unknown size is not allowed")
+	} else if r.max > 0 && size > r.max {
+		return fmt.Errorf("astisub: size %d exceeds parent size %d", size, r.max)
+	} else if size > math.MaxInt64 {
+		return fmt.Errorf("astisub: size %d is too big", size)
+	}
+	return nil
+}
+
+// readPayload reads an element payload
+// The payload is read progressively so that an invalid size doesn't allocate more than the available data.
+func (r *ebmlReader) readPayload(size uint64) (b []byte, err error) {
+	if err = r.checkSize(size); err != nil {
+		return
+	}
+	var buf = &bytes.Buffer{}
+	if _, err = io.CopyN(buf, r.r, int64(size)); err != nil {
+		err = fmt.Errorf("astisub: reading %d bytes failed: %w", size, err)
+		return
+	}
+	b = buf.Bytes()
+	return
+}
+
+// skip skips an element payload
+func (r *ebmlReader) skip(size uint64) (err error) {
+	if err = r.checkSize(size); err != nil {
+		return
+	}
+	if _, err = io.CopyN(ioutil.Discard, r.r, int64(size)); err != nil {
+		err = fmt.Errorf("astisub: skipping %d bytes failed: %w", size, err)
+		return
+	}
+	return
+}
+
+// ebmlElement represents an EBML element whose payload has been read
+type ebmlElement struct {
+	id      uint64
+	payload []byte
+}
+
+// ebmlChildren parses the children of a master element
+func ebmlChildren(b []byte) (es []ebmlElement, err error) {
+	var r = &ebmlReader{
+		max: uint64(len(b)),
+		r:   bufio.NewReader(bytes.NewReader(b)),
+	}
+	for {
+		// Read header
+		var id, size uint64
+		if id, size, err = r.readHeader(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		// Read payload
+		var e = ebmlElement{id: id}
+		if e.payload, err = r.readPayload(size); err != nil {
+			return
+		}
+		es = append(es, e)
+	}
+}
+
+// ebmlUint parses an unsigned integer payload
+func ebmlUint(b []byte) (v uint64) {
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return
+}
+
+// ebmlString parses a string payload
+func ebmlString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// parseMatroskaTracks parses a Tracks element
+func parseMatroskaTracks(b []byte) (ts []MatroskaTrack, err error) {
+	// Loop through track entries
+	var es []ebmlElement
+	if es, err = ebmlChildren(b); err != nil {
+		err = fmt.Errorf("astisub: parsing tracks failed: %w", err)
+		return
+	}
+	for _, e := range es {
+		if e.id != matroskaIDTrackEntry {
+			continue
+		}
+
+		// Loop through track entry children
+		var cs []ebmlElement
+		if cs, err = ebmlChildren(e.payload); err != nil {
+			err = fmt.Errorf("astisub: parsing track entry failed: %w", err)
+			return
+		}
+		var t = MatroskaTrack{Default: true, Language: "eng"}
+		var trackType uint64
+		var bcp47 string
+		for _, c := range cs {
+			switch c.id {
+			case matroskaIDCodecID:
+				t.CodecID = ebmlString(c.payload)
+			case matroskaIDCodecPrivate:
+				t.CodecPrivate = c.payload
+			case matroskaIDFlagDefault:
+				t.Default = ebmlUint(c.payload) > 0
+			case matroskaIDFlagForced:
+				t.Forced = ebmlUint(c.payload) > 0
+			case matroskaIDLanguage:
+				t.Language = ebmlString(c.payload)
+			case matroskaIDLanguageBCP47:
+				bcp47 = ebmlString(c.payload)
+			case matroskaIDName:
+				t.Name = ebmlString(c.payload)
+			case matroskaIDTrackNumber:
+				t.Number = ebmlUint(c.payload)
+			case matroskaIDTrackType:
+				trackType = ebmlUint(c.payload)
+			}
+		}
+		if bcp47 != "" {
+			t.Language = bcp47
+		}
+
+		// Only keep subtitle tracks
+		if trackType == matroskaTrackTypeSubtitle {
+			ts = append(ts, t)
+		}
+	}
+	return
+}
+
+// matroskaBlock represents a subtitle block
+type matroskaBlock struct {
+	data     []byte
+	duration *uint64
+	startAt  time.Duration
+}
+
+// matroskaReader reads a Matroska stream
+type matroskaReader struct {
+	blocks           []*matroskaBlock
+	clusterTimestamp uint64
+	r                *ebmlReader
+	timestampScale   uint64
+	trackNumber      uint64
+	tracks           []MatroskaTrack
+}
+
+// read reads the stream until tracks have been parsed or until the end if blocks are needed
+func (r *matroskaReader) read(blocks bool) (err error) {
+	var block *matroskaBlock
+	for {
+		// Read header
+		var id, size uint64
+		if id, size, err = r.r.readHeader(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		// Switch on id
+		switch id {
+		case matroskaIDSegment, matroskaIDCluster, matroskaIDBlockGroup:
+			// Master elements whose children are read in the flow, which handles unknown sizes as well
+			continue
+		case matroskaIDInfo:
+			var b []byte
+			if b, err = r.r.readPayload(size); err != nil {
+				return
+			}
+			var es []ebmlElement
+			if es, err = ebmlChildren(b); err != nil {
+				err = fmt.Errorf("astisub: parsing info failed: %w", err)
+				return
+			}
+			for _, e := range es {
+				if e.id == matroskaIDTimestampScale {
+					r.timestampScale = ebmlUint(e.payload)
+				}
+			}
+		case matroskaIDTracks:
+			var b []byte
+			if b, err = r.r.readPayload(size); err != nil {
+				return
+			}
+			if r.tracks, err = parseMatroskaTracks(b); err != nil {
+				return
+			}
+
+			// Get track number
+			if !blocks {
+				return
+			} else if len(r.tracks) == 0 {
+				return ErrMatroskaNoSubtitleTrack
+			} else if r.trackNumber == 0 {
+				r.trackNumber = r.tracks[0].Number
+			}
+		case matroskaIDTimestamp:
+			var b []byte
+			if b, err = r.r.readPayload(size); err != nil {
+				return
+			}
+			r.clusterTimestamp = ebmlUint(b)
+		case matroskaIDBlock, matroskaIDSimpleBlock:
+			// Read track number first so that other tracks' blocks are skipped without being read
+			block = nil
+			var trackNumber uint64
+			var n int
+			if trackNumber, n, err = r.r.readVint(false); err != nil {
+				err = fmt.Errorf("astisub: reading block track number failed: %w", err)
+				return
+			}
+			if size < uint64(n) {
+				return errors.New("astisub: block is too short")
+			}
+			if trackNumber != r.trackNumber || !blocks {
+				if err = r.r.skip(size - uint64(n)); err != nil {
+					return
+				}
+				continue
+			}
+
+			// Read block
+			var b []byte
+			if b, err = r.r.readPayload(size - uint64(n)); err != nil {
+				return
+			}
+			if len(b) < 3 {
+				return errors.New("astisub: block is too short")
+			}
+			if b[2]&0x06 > 0 {
+				return errors.New("astisub: laced subtitle blocks are not supported")
+			}
+			var ts = int64(r.clusterTimestamp) + int64(int16(binary.BigEndian.Uint16(b)))
+			block = &matroskaBlock{
+				data:    b[3:],
+				startAt: time.Duration(ts * int64(r.timestampScale)),
+			}
+			r.blocks = append(r.blocks, block)
+		case matroskaIDBlockDuration:
+			var b []byte
+			if b, err = r.r.readPayload(size); err != nil {
+				return
+			}
+			if block != nil {
+				var d = ebmlUint(b)
+				block.duration = &d
+			}
+		default:
+			if err = r.r.skip(size); err != nil {
+				err = fmt.Errorf("astisub: skipping ebml element %x failed: %w", id, err)
+				return
+			}
+		}
+	}
+}
+
+// newMatroskaReader creates a new Matroska reader
+func newMatroskaReader(i io.Reader, trackNumber uint64) *matroskaReader {
+	return &matroskaReader{
+		r:              &ebmlReader{r: bufio.NewReader(i)},
+		timestampScale: matroskaDefaultTimestampScale,
+		trackNumber:    trackNumber,
+	}
+}
+
+// ReadMatroskaTracks lists the subtitle tracks of a Matroska/WebM content
+func ReadMatroskaTracks(i io.Reader) (ts []MatroskaTrack, err error) {
+	var r = newMatroskaReader(i, 0)
+	if err = r.read(false); err != nil {
+		err = fmt.Errorf("astisub: reading matroska failed: %w", err)
+		return
+	}
+	ts = r.tracks
+	return
+}
+
+// ReadFromMatroska parses a subtitle track of a Matroska/WebM content
+func ReadFromMatroska(i io.Reader, opts MatroskaOptions) (o *Subtitles, err error) {
+	// Read
+	var r = newMatroskaReader(i, opts.TrackNumber)
+	if err = r.read(true); err != nil {
+		err = fmt.Errorf("astisub: reading matroska failed: %w", err)
+		return
+	}
+
+	// Get track
+	var t *MatroskaTrack
+	for idx := range r.tracks {
+		if r.tracks[idx].Number == r.trackNumber {
+			t = &r.tracks[idx]
+			break
+		}
+	}
+	if t == nil {
+		err = ErrMatroskaNoSubtitleTrack
+		return
+	}
+
+	// Get end times: blocks without duration end when the next one starts
+	var ends = make([]time.Duration, len(r.blocks))
+	for idx, b := range r.blocks {
+		if b.duration != nil {
+			ends[idx] = b.startAt + time.Duration(*b.duration*r.timestampScale)
+		} else if idx+1 < len(r.blocks) {
+			ends[idx] = r.blocks[idx+1].startAt
+		} else {
+			ends[idx] = b.startAt
+		}
+	}
+
+	// Switch on codec
+	switch t.CodecID {
+	case MatroskaCodecIDASS, MatroskaCodecIDSSA:
+		if o, err = matroskaSSA(*t, r.blocks, ends); err != nil {
+			return
+		}
+	case MatroskaCodecIDUTF8:
+		o = NewSubtitles()
+		for idx, b := range r.blocks {
+			var item = &Item{EndAt: ends[idx], StartAt: b.startAt}
+			for _, line := range strings.Split(strings.Replace(string(b.data), "\r\n", "\n", -1), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					item.Lines = append(item.Lines, Line{Items: []LineItem{{Text: line}}})
+				}
+			}
+			o.Items = append(o.Items, item)
+		}
+	case MatroskaCodecIDWebVTT, MatroskaCodecIDWebMWebVTT:
+		// CodecPrivate holds the WebVTT header
+		o = NewSubtitles()
+		if len(t.CodecPrivate) > 0 {
+			if o, err = ReadFromWebVTT(bytes.NewReader(t.CodecPrivate)); err != nil {
+				err = fmt.Errorf("astisub: parsing webvtt codec private failed: %w", err)
+				return
+			}
+		}
+		for idx, b := range r.blocks {
+			var item = &Item{EndAt: ends[idx], InlineStyle: &StyleAttributes{}, StartAt: b.startAt}
+			for _, line := range strings.Split(string(b.data), "\n") {
+				if l := parseTextWebVTT(line); len(l.Items) > 0 {
+					item.Lines = append(item.Lines, l)
+				}
+			}
+			o.Items = append(o.Items, item)
+		}
+		o.registerSpeakers()
+	default:
+		err = fmt.Errorf("astisub: unsupported matroska codec id %s", t.CodecID)
+		return
+	}
+
+	// Add language
+	if v, ok := languageISO6392Mapping.Get(t.Language); ok {
+		if o.Metadata == nil {
+			o.Metadata = &Metadata{}
+		}
+		o.Metadata.Language = v.(string)
+	}
+	o.Order()
+	return
+}
+
+// matroskaSSA rebuilds an SSA content out of the CodecPrivate header and the blocks, and parses it
+// Blocks are "ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV, Effect, Text" (ASS) or
+// "ReadOrder, Marked, Style, Name, MarginL, MarginR, MarginV, Effect, Text" (SSA)
+func matroskaSSA(t MatroskaTrack, blocks []*matroskaBlock, ends []time.Duration) (*Subtitles, error) {
+	// Header without events
+	var header = string(t.CodecPrivate)
+	if idx := strings.Index(strings.ToLower(header), "[events]"); idx >= 0 {
+		header = header[:idx]
+	}
+	var first = ssaEventFormatNameLayer
+	if t.CodecID == MatroskaCodecIDSSA {
+		first = ssaEventFormatNameMarked
+	}
+	var buf = bytes.NewBufferString(header)
+	buf.WriteString("\n[Events]\nFormat: " + strings.Join([]string{
+		first,
+		ssaEventFormatNameStart,
+		ssaEventFormatNameEnd,
+		ssaEventFormatNameStyle,
+		ssaEventFormatNameName,
+		ssaEventFormatNameMarginL,
+		ssaEventFormatNameMarginR,
+		ssaEventFormatNameMarginV,
+		ssaEventFormatNameEffect,
+		ssaEventFormatNameText,
+	}, ", ") + "\n")
+
+	// Events
+	for idx, b := range blocks {
+		var split = strings.SplitN(string(b.data), ",", 3)
+		if len(split) < 3 {
+			return nil, fmt.Errorf("astisub: invalid ssa block %q", b.data)
+		}
+		buf.WriteString(ssaEventCategoryDialogue + ": " + split[1] + "," + formatDurationSSA(b.startAt) + "," + formatDurationSSA(ends[idx]) + "," + split[2] + "\n")
+	}
+
+	// Parse
+	s, err := ReadFromSSA(buf)
+	if err != nil {
+		return nil, fmt.Errorf("astisub: parsing ssa failed: %w", err)
+	}
+	return s, nil
+}
+
+// ebmlVint encodes a size
+func ebmlVint(v uint64) []byte {
+	var n = 1
+	for n < 8 && v >= 1<<uint(7*n)-1 {
+		n++
+	}
+	var b = make([]byte, n)
+	for idx := n - 1; idx >= 0; idx-- {
+		b[idx] = byte(v)
+		v >>= 8
+	}
+	b[0] |= 0x80 >> uint(n-1)
+	return b
+}
+
+// ebmlElementBytes encodes an element
+func ebmlElementBytes(id uint64, payloads ...[]byte) []byte {
+	// ID already contains its length marker
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if c := byte(id >> uint(shift)); c > 0 || len(b) > 0 {
+			b = append(b, c)
+		}
+	}
+
+	// Size
+	var p = bytes.Join(payloads, nil)
+	b = append(b, ebmlVint(uint64(len(p)))...)
+	return append(b, p...)
+}
+
+// ebmlUintBytes encodes an unsigned integer element
+func ebmlUintBytes(id, v uint64) []byte {
+	var b = []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return ebmlElementBytes(id, b)
+}
+
+// WriteToMatroska writes subtitles as a subtitles-only Matroska content holding one track described by t
+// Supported codec IDs are S_TEXT/UTF8 (default), S_TEXT/ASS and S_TEXT/WEBVTT
+func (s Subtitles) WriteToMatroska(o io.Writer, t MatroskaTrack) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
+
+	// Blocks are written as srt, ssa or webvtt text depending on the codec, whose specific style attributes
+	// are derived from the generic ones when missing
+	s = s.withGenericAttributes()
+
+	// Default values
+	if t.CodecID == "" {
+		t.CodecID = MatroskaCodecIDUTF8
+	}
+	if t.Number == 0 {
+		t.Number = 1
+	}
+	if t.Language == "" {
+		t.Language = "und"
+		if s.Metadata != nil {
+			if v, ok := languageISO6392Mapping.GetInverse(s.Metadata.Language); ok {
+				t.Language = v.(string)
+			}
+		}
+	}
+
+	// Build codec private and block payloads
+	var docType = "matroska"
+	var blocks [][]byte
+	switch t.CodecID {
+	case MatroskaCodecIDASS:
+		// Script info and styles
+		var m = &Metadata{}
+		if s.Metadata != nil {
+			*m = *s.Metadata
+		}
+		m.SSAScriptType = "v4.00+"
+		var format = []string{
+			ssaEventFormatNameLayer,
+			ssaEventFormatNameStyle,
+			ssaEventFormatNameName,
+			ssaEventFormatNameMarginL,
+			ssaEventFormatNameMarginR,
+			ssaEventFormatNameMarginV,
+			ssaEventFormatNameEffect,
+			ssaEventFormatNameText,
+		}
+		if len(t.CodecPrivate) == 0 {
+			t.CodecPrivate = newSSAScriptInfo(m).bytes()
+			if len(s.Styles) > 0 {
+				t.CodecPrivate = append(t.CodecPrivate, s.ssaStylesBytes(true)...)
+			}
+			t.CodecPrivate = append(t.CodecPrivate, []byte("\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")...)
+		}
+
+		// Events
+		for idx, i := range s.Items {
+			blocks = append(blocks, []byte(strconv.Itoa(idx)+","+newSSAEventFromItem(*i, true).string(format)))
+		}
+	case MatroskaCodecIDUTF8:
+		for _, i := range s.Items {
+			var ls []string
+			for _, l := range i.Lines {
+				ls = append(ls, l.String())
+			}
+			blocks = append(blocks, []byte(strings.Join(ls, "\n")))
+		}
+	case MatroskaCodecIDWebVTT, MatroskaCodecIDWebMWebVTT:
+		if t.CodecID == MatroskaCodecIDWebMWebVTT {
+			docType = "webm"
+		}
+		if len(t.CodecPrivate) == 0 {
+			t.CodecPrivate = bytes.TrimSpace(s.webVTTHeaderBytes(""))
+		}
+		classes := s.webVTTStyleClasses()
+		for _, i := range s.Items {
+			blocks = append(blocks, bytes.TrimSuffix(s.webVTTPayloadBytes(*i, classes), bytesLineSeparator))
+		}
+	default:
+		err = fmt.Errorf("astisub: unsupported matroska codec id %s", t.CodecID)
+		return
+	}
+
+	// Build track entry
+	var flag = func(v bool) uint64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	var entry = [][]byte{
+		ebmlUintBytes(matroskaIDTrackNumber, t.Number),
+		ebmlUintBytes(matroskaIDTrackUID, t.Number),
+		ebmlUintBytes(matroskaIDTrackType, matroskaTrackTypeSubtitle),
+		ebmlUintBytes(matroskaIDFlagDefault, flag(t.Default)),
+		ebmlUintBytes(matroskaIDFlagForced, flag(t.Forced)),
+		ebmlUintBytes(matroskaIDFlagLacing, 0),
+		ebmlElementBytes(matroskaIDCodecID, []byte(t.CodecID)),
+		ebmlElementBytes(matroskaIDLanguage, []byte(t.Language)),
+	}
+	if t.Name != "" {
+		entry = append(entry, ebmlElementBytes(matroskaIDName, []byte(t.Name)))
+	}
+	if len(t.CodecPrivate) > 0 {
+		entry = append(entry, ebmlElementBytes(matroskaIDCodecPrivate, t.CodecPrivate))
+	}
+
+	// Build info
+	var duration = make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(float64(s.Duration()/time.Millisecond)))
+	var info = [][]byte{
+		ebmlUintBytes(matroskaIDTimestampScale, matroskaDefaultTimestampScale),
+		ebmlElementBytes(matroskaIDDuration, duration),
+		ebmlElementBytes(matroskaIDMuxingApp, []byte("astisub")),
+		ebmlElementBytes(matroskaIDWritingApp, []byte("astisub")),
+	}
+	if s.Metadata != nil && s.Metadata.Title != "" {
+		info = append(info, ebmlElementBytes(matroskaIDTitle, []byte(s.Metadata.Title)))
+	}
+
+	// Matroska timestamps are unsigned
+	for idx, i := range s.Items {
+		if i.StartAt < 0 {
+			err = fmt.Errorf("astisub: item #%d starts at negative time %s", idx+1, i.StartAt)
+			return
+		} else if i.EndAt < i.StartAt {
+			err = fmt.Errorf("astisub: item #%d ends before it starts", idx+1)
+			return
+		}
+	}
+
+	// Build clusters: one cluster per item so that relative block timestamps never overflow
+	var segment = [][]byte{
+		ebmlElementBytes(matroskaIDInfo, info...),
+		ebmlElementBytes(matroskaIDTracks, ebmlElementBytes(matroskaIDTrackEntry, entry...)),
+	}
+	for idx, i := range s.Items {
+		segment = append(segment, ebmlElementBytes(matroskaIDCluster,
+			ebmlUintBytes(matroskaIDTimestamp, uint64(i.StartAt/time.Millisecond)),
+			ebmlElementBytes(matroskaIDBlockGroup,
+				ebmlElementBytes(matroskaIDBlock, ebmlVint(t.Number), []byte{0, 0, 0}, blocks[idx]),
+				ebmlUintBytes(matroskaIDBlockDuration, uint64((i.EndAt-i.StartAt)/time.Millisecond)),
+			),
+		))
+	}
+
+	// Write
+	var b = ebmlElementBytes(matroskaIDEBML,
+		ebmlUintBytes(matroskaIDEBMLVersion, 1),
+		ebmlUintBytes(matroskaIDEBMLReadVersion, 1),
+		ebmlUintBytes(matroskaIDEBMLMaxID, 4),
+		ebmlUintBytes(matroskaIDEBMLMaxSize, 8),
+		ebmlElementBytes(matroskaIDDocType, []byte(docType)),
+		ebmlUintBytes(matroskaIDDocTypeVersion, 4),
+		ebmlUintBytes(matroskaIDDocTypeRead, 2),
+	)
+	b = append(b, ebmlElementBytes(matroskaIDSegment, segment...)...)
+	if _, err = o.Write(b); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package astisub_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatroska(t *testing.T) {
+	for _, v := range []struct {
+		codecID string
+		path    string
+	}{
+		{codecID: astisub.MatroskaCodecIDUTF8, path: "./testdata/example-in.srt"},
+		{codecID: astisub.MatroskaCodecIDASS, path: "./testdata/example-in.ssa"},
+		{codecID: astisub.MatroskaCodecIDWebVTT, path: "./testdata/example-in.vtt"},
+	} {
+		t.Run(v.codecID, func(t *testing.T) {
+			// Open
+			s, err := astisub.OpenFile(v.path)
+			require.NoError(t, err)
+
+			// Write
+			w := &bytes.Buffer{}
+			err = s.WriteToMatroska(w, astisub.MatroskaTrack{CodecID: v.codecID, Forced: true, Language: "fre", Name: "French"})
+			require.NoError(t, err)
+
+			// List tracks
+			ts, err := astisub.ReadMatroskaTracks(bytes.NewReader(w.Bytes()))
+			require.NoError(t, err)
+			require.Len(t, ts, 1)
+			assert.Equal(t, v.codecID, ts[0].CodecID)
+			assert.False(t, ts[0].Default)
+			assert.True(t, ts[0].Forced)
+			assert.Equal(t, "fre", ts[0].Language)
+			assert.Equal(t, "French", ts[0].Name)
+			assert.Equal(t, uint64(1), ts[0].Number)
+
+			// Read
+			s2, err := astisub.ReadFromMatroska(bytes.NewReader(w.Bytes()), astisub.MatroskaOptions{})
+			require.NoError(t, err)
+			assertSubtitleItems(t, s2)
+			assert.Equal(t, astisub.LanguageFrench, s2.Metadata.Language)
+			assert.Equal(t, len(s.Styles), len(s2.Styles))
+			assert.Equal(t, len(s.Regions), len(s2.Regions))
+
+			// Invalid track
+			_, err = astisub.ReadFromMatroska(bytes.NewReader(w.Bytes()), astisub.MatroskaOptions{TrackNumber: 2})
+			assert.EqualError(t, err, astisub.ErrMatroskaNoSubtitleTrack.Error())
+		})
+	}
+}
+
+func TestMatroskaFiles(t *testing.T) {
+	s, err := astisub.OpenFile("./testdata/example-in.srt")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "astisub")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, v := range []struct {
+		codecID string
+		ext     string
+	}{
+		{codecID: astisub.MatroskaCodecIDUTF8, ext: ".mks"},
+		{codecID: astisub.MatroskaCodecIDUTF8, ext: ".mkv"},
+		{codecID: astisub.MatroskaCodecIDWebMWebVTT, ext: ".webm"},
+	} {
+		t.Run(v.ext, func(t *testing.T) {
+			p := filepath.Join(dir, "example"+v.ext)
+			require.NoError(t, s.Write(p))
+			f, err := os.Open(p)
+			require.NoError(t, err)
+			defer f.Close()
+			ts, err := astisub.ReadMatroskaTracks(f)
+			require.NoError(t, err)
+			require.Len(t, ts, 1)
+			assert.Equal(t, v.codecID, ts[0].CodecID)
+			s2, err := astisub.OpenFile(p)
+			require.NoError(t, err)
+			assertSubtitleItems(t, s2)
+		})
+	}
+}
+
+func TestMatroskaErrors(t *testing.T) {
+	// Child size exceeds its parent size
+	_, err := astisub.ReadMatroskaTracks(bytes.NewReader([]byte{0x16, 0x54, 0xae, 0x6b, 0x82, 0xae, 0x90}))
+	assert.Error(t, err)
+
+	// Size exceeds the available data
+	_, err = astisub.ReadFromMatroska(bytes.NewReader([]byte{0x15, 0x49, 0xa9, 0x66, 0x01, 0x0, 0x0, 0xff, 0xff, 0xff, 0xff, 0xff}), astisub.MatroskaOptions{})
+	assert.Error(t, err)
+
+	// Negative time
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{{EndAt: time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: -time.Second}}
+	assert.Error(t, s.WriteToMatroska(&bytes.Buffer{}, astisub.MatroskaTrack{}))
+}
@@ -0,0 +1,834 @@
+package astisub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://www.iso.org/standard/83102.html (ISO/IEC 14496-12)
+// https://www.iso.org/standard/75394.html (ISO/IEC 14496-30)
+
+// MP4 sample entry types
+const (
+	MP4SampleEntryTypeTTML   = "stpp"
+	MP4SampleEntryTypeWebVTT = "wvtt"
+)
+
+// MP4 defaults
+const (
+	mp4DefaultTimescale = 1000
+	mp4DefaultTrackID   = 1
+	mp4TTMLNamespace    = "http://www.w3.org/ns/ttml"
+)
+
+// MP4 box flags
+const (
+	mp4TfhdFlagBaseDataOffset         = 0x000001
+	mp4TfhdFlagSampleDescriptionIndex = 0x000002
+	mp4TfhdFlagDefaultSampleDuration  = 0x000008
+	mp4TfhdFlagDefaultSampleSize      = 0x000010
+	mp4TfhdFlagDefaultSampleFlags     = 0x000020
+	mp4TfhdFlagDefaultBaseIsMoof      = 0x020000
+	mp4TrunFlagDataOffset             = 0x000001
+	mp4TrunFlagFirstSampleFlags       = 0x000004
+	mp4TrunFlagSampleDuration         = 0x000100
+	mp4TrunFlagSampleSize             = 0x000200
+	mp4TrunFlagSampleFlags            = 0x000400
+	mp4TrunFlagSampleCompositionTime  = 0x000800
+)
+
+// MP4 errors
+var (
+	ErrMP4NoSubtitleTrack = errors.New("astisub: no wvtt or stpp track found")
+)
+
+// MP4Options represents MP4 options
+type MP4Options struct {
+	// Start of the segment on the track timeline. Items are clipped to it.
+	BaseMediaDecodeTime time.Duration
+	// Duration of the segment. If 0, the segment ends with the last item.
+	Duration time.Duration
+	// Either MP4SampleEntryTypeWebVTT (default) or MP4SampleEntryTypeTTML
+	SampleEntryType string
+	SequenceNumber  uint32
+	// Defaults to 1000
+	Timescale uint32
+	// Defaults to 1
+	TrackID uint32
+}
+
+func (o *MP4Options) adapt() {
+	if o.SampleEntryType == "" {
+		o.SampleEntryType = MP4SampleEntryTypeWebVTT
+	}
+	if o.Timescale == 0 {
+		o.Timescale = mp4DefaultTimescale
+	}
+	if o.TrackID == 0 {
+		o.TrackID = mp4DefaultTrackID
+	}
+}
+
+func (o MP4Options) validate() error {
+	if o.SampleEntryType != MP4SampleEntryTypeWebVTT && o.SampleEntryType != MP4SampleEntryTypeTTML {
+		return fmt.Errorf("astisub: invalid mp4 sample entry type %s", o.SampleEntryType)
+	}
+	return nil
+}
+
+// mp4DurationToTicks converts a duration into timescale ticks
+func mp4DurationToTicks(d time.Duration, timescale uint32) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d/time.Second)*uint64(timescale) + uint64(d%time.Second)*uint64(timescale)/uint64(time.Second)
+}
+
+// mp4TicksToDuration converts timescale ticks into a duration
+func mp4TicksToDuration(t uint64, timescale uint32) time.Duration {
+	return time.Duration(t/uint64(timescale))*time.Second + time.Duration(t%uint64(timescale))*time.Second/time.Duration(timescale)
+}
+
+// mp4Box builds a box
+func mp4Box(typ string, payloads ...[]byte) []byte {
+	var size = 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	var b = make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// mp4FullBox builds a full box
+func mp4FullBox(typ string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	return mp4Box(typ, append([][]byte{mp4Uint32(uint32(version)<<24 | flags&0xffffff)}, payloads...)...)
+}
+
+func mp4Uint16(i uint16) []byte {
+	var b = make([]byte, 2)
+	binary.BigEndian.PutUint16(b, i)
+	return b
+}
+
+func mp4Uint32(i uint32) []byte {
+	var b = make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
+
+func mp4Uint64(i uint64) []byte {
+	var b = make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
+
+// mp4Matrix is the unity matrix
+var mp4Matrix = bytes.Join([][]byte{
+	mp4Uint32(0x00010000), mp4Uint32(0), mp4Uint32(0),
+	mp4Uint32(0), mp4Uint32(0x00010000), mp4Uint32(0),
+	mp4Uint32(0), mp4Uint32(0), mp4Uint32(0x40000000),
+}, nil)
+
+// mp4Language packs a language into its ISO 639-2 mdhd representation
+func (s Subtitles) mp4Language() []byte {
+	var l = "und"
+	if s.Metadata != nil {
+		if v, ok := languageISO6392Mapping.GetInverse(s.Metadata.Language); ok {
+			l = v.(string)
+		}
+	}
+	return mp4Uint16(uint16(l[0]-0x60)<<10 | uint16(l[1]-0x60)<<5 | uint16(l[2]-0x60))
+}
+
+// WriteToMP4Init writes the fragmented MP4 initialization segment (ftyp + moov) of a wvtt or stpp track
+func (s Subtitles) WriteToMP4Init(o io.Writer, opts MP4Options) (err error) {
+	// Options
+	opts.adapt()
+	if err = opts.validate(); err != nil {
+		return
+	}
+
+	// Sample entry
+	var brand, handler, mediaHeader string
+	var sampleEntry []byte
+	var reserved = append(make([]byte, 6), mp4Uint16(1)...)
+	switch opts.SampleEntryType {
+	case MP4SampleEntryTypeTTML:
+		brand, handler, mediaHeader = "im1t", "subt", "sthd"
+		sampleEntry = mp4Box(MP4SampleEntryTypeTTML, reserved, []byte(mp4TTMLNamespace+"\x00\x00\x00"))
+	default:
+		// The configuration holds the WebVTT header without cues
+		brand, handler, mediaHeader = "cwvt", "text", "nmhd"
+		sampleEntry = mp4Box(MP4SampleEntryTypeWebVTT, reserved, mp4Box("vttC", bytes.TrimSpace(s.webVTTHeaderBytes(""))))
+	}
+
+	// Build boxes
+	var ftyp = mp4Box("ftyp", []byte("iso6"), mp4Uint32(0), []byte("iso6cmfc"+brand))
+	var moov = mp4Box("moov",
+		mp4FullBox("mvhd", 0, 0,
+			mp4Uint32(0), mp4Uint32(0), mp4Uint32(opts.Timescale), mp4Uint32(0),
+			mp4Uint32(0x00010000), mp4Uint16(0x0100), make([]byte, 10),
+			mp4Matrix, make([]byte, 24), mp4Uint32(opts.TrackID+1),
+		),
+		mp4Box("trak",
+			mp4FullBox("tkhd", 0, 0x3,
+				mp4Uint32(0), mp4Uint32(0), mp4Uint32(opts.TrackID), mp4Uint32(0), mp4Uint32(0),
+				make([]byte, 8), mp4Uint16(0), mp4Uint16(0), mp4Uint16(0), mp4Uint16(0),
+				mp4Matrix, mp4Uint32(0), mp4Uint32(0),
+			),
+			mp4Box("mdia",
+				mp4FullBox("mdhd", 0, 0,
+					mp4Uint32(0), mp4Uint32(0), mp4Uint32(opts.Timescale), mp4Uint32(0),
+					s.mp4Language(), mp4Uint16(0),
+				),
+				mp4FullBox("hdlr", 0, 0, mp4Uint32(0), []byte(handler), make([]byte, 12), []byte("astisub\x00")),
+				mp4Box("minf",
+					mp4FullBox(mediaHeader, 0, 0),
+					mp4Box("dinf", mp4FullBox("dref", 0, 0, mp4Uint32(1), mp4FullBox("url ", 0, 1))),
+					mp4Box("stbl",
+						mp4FullBox("stsd", 0, 0, mp4Uint32(1), sampleEntry),
+						mp4FullBox("stts", 0, 0, mp4Uint32(0)),
+						mp4FullBox("stsc", 0, 0, mp4Uint32(0)),
+						mp4FullBox("stsz", 0, 0, mp4Uint32(0), mp4Uint32(0)),
+						mp4FullBox("stco", 0, 0, mp4Uint32(0)),
+					),
+				),
+			),
+		),
+		mp4Box("mvex", mp4FullBox("trex", 0, 0, mp4Uint32(opts.TrackID), mp4Uint32(1), mp4Uint32(0), mp4Uint32(0), mp4Uint32(0))),
+	)
+
+	// Write
+	if _, err = o.Write(append(ftyp, moov...)); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
+
+// mp4Sample represents an MP4 sample
+type mp4Sample struct {
+	data     []byte
+	duration uint32
+}
+
+// WriteToMP4Segment writes a fragmented MP4 media segment (styp + moof + mdat) of a wvtt or stpp track
+// Items are clipped to the segment boundaries so that the output of Segment() can be used as is.
+func (s Subtitles) WriteToMP4Segment(o io.Writer, opts MP4Options) (err error) {
+	// Options
+	opts.adapt()
+	if err = opts.validate(); err != nil {
+		return
+	}
+
+	// Cues are written in webvtt, which may lack webvtt specific style attributes
+	s = s.withGenericAttributes()
+	var classes = s.webVTTStyleClasses()
+
+	// Get segment boundaries
+	var start, end = opts.BaseMediaDecodeTime, opts.BaseMediaDecodeTime + opts.Duration
+	if opts.Duration == 0 {
+		for _, i := range s.Items {
+			if i.EndAt > end {
+				end = i.EndAt
+			}
+		}
+	}
+
+	// Clip items
+	var items []*Item
+	for _, i := range s.Items {
+		if i.EndAt <= start || i.StartAt >= end {
+			continue
+		}
+		var c = *i
+		if c.StartAt < start {
+			c.StartAt = start
+		}
+		if c.EndAt > end {
+			c.EndAt = end
+		}
+		items = append(items, &c)
+	}
+
+	// Build samples
+	var samples []mp4Sample
+	switch opts.SampleEntryType {
+	case MP4SampleEntryTypeTTML:
+		// A single sample holds the TTML document of the whole segment
+		var buf = &bytes.Buffer{}
+		var ss = s
+		ss.Items = items
+		if err = ss.writeToTTML(buf); err != nil {
+			err = fmt.Errorf("astisub: writing ttml failed: %w", err)
+			return
+		}
+		samples = append(samples, mp4Sample{
+			data:     buf.Bytes(),
+			duration: uint32(mp4DurationToTicks(end, opts.Timescale) - mp4DurationToTicks(start, opts.Timescale)),
+		})
+	default:
+		samples = s.mp4WebVTTSamples(items, classes, start, end, opts.Timescale)
+	}
+
+	// Build moof
+	var moof = func(dataOffset uint32) []byte {
+		var entries [][]byte
+		for _, smp := range samples {
+			entries = append(entries, mp4Uint32(smp.duration), mp4Uint32(uint32(len(smp.data))))
+		}
+		return mp4Box("moof",
+			mp4FullBox("mfhd", 0, 0, mp4Uint32(opts.SequenceNumber)),
+			mp4Box("traf",
+				mp4FullBox("tfhd", 0, mp4TfhdFlagDefaultBaseIsMoof, mp4Uint32(opts.TrackID)),
+				mp4FullBox("tfdt", 1, 0, mp4Uint64(mp4DurationToTicks(start, opts.Timescale))),
+				mp4FullBox("trun", 0, mp4TrunFlagDataOffset|mp4TrunFlagSampleDuration|mp4TrunFlagSampleSize,
+					mp4Uint32(uint32(len(samples))), mp4Uint32(dataOffset), bytes.Join(entries, nil),
+				),
+			),
+		)
+	}
+
+	// Data offset is relative to the start of the moof and points to the mdat payload
+	var c = moof(0)
+	c = moof(uint32(len(c) + 8))
+
+	// Build mdat
+	var data [][]byte
+	for _, smp := range samples {
+		data = append(data, smp.data)
+	}
+	c = append(c, mp4Box("mdat", data...)...)
+
+	// Write
+	if _, err = o.Write(append(mp4Box("styp", []byte("msdh"), mp4Uint32(0), []byte("msdhmsix")), c...)); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
+
+// mp4WebVTTSamples splits items into contiguous wvtt samples: each time a cue starts or ends a new sample
+// begins, gaps being filled with empty vtte samples
+func (s Subtitles) mp4WebVTTSamples(items []*Item, classes map[*Style]string, start, end time.Duration, timescale uint32) (samples []mp4Sample) {
+	// Get boundaries
+	var boundaries = []time.Duration{start, end}
+	for _, i := range items {
+		boundaries = append(boundaries, i.StartAt, i.EndAt)
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+
+	// Loop through boundaries
+	for idx := 1; idx < len(boundaries); idx++ {
+		// Same boundary
+		var from, to = boundaries[idx-1], boundaries[idx]
+		if from == to {
+			continue
+		}
+
+		// Loop through active items
+		var data []byte
+		for _, i := range items {
+			if i.StartAt > from || i.EndAt < to {
+				continue
+			}
+
+			// Build cue
+			var boxes [][]byte
+			if i.WebVTTID != "" {
+				boxes = append(boxes, mp4Box("iden", []byte(i.WebVTTID)))
+			} else if i.Index > 0 {
+				boxes = append(boxes, mp4Box("iden", []byte(strconv.Itoa(i.Index))))
+			}
+			if settings := bytes.TrimSpace(i.webVTTCueSettingsBytes()); len(settings) > 0 {
+				boxes = append(boxes, mp4Box("sttg", settings))
+			}
+			boxes = append(boxes, mp4Box("payl", bytes.TrimSuffix(s.webVTTPayloadBytes(*i, classes), bytesLineSeparator)))
+			data = append(data, mp4Box("vttc", boxes...)...)
+		}
+
+		// No active item
+		if len(data) == 0 {
+			data = mp4Box("vtte")
+		}
+
+		// Append sample
+		samples = append(samples, mp4Sample{
+			data:     data,
+			duration: uint32(mp4DurationToTicks(to, timescale) - mp4DurationToTicks(from, timescale)),
+		})
+	}
+	return
+}
+
+// mp4BoxReader reads boxes from a byte slice
+type mp4BoxReader struct {
+	b      []byte
+	offset int
+}
+
+// mp4ParsedBox represents a parsed box
+type mp4ParsedBox struct {
+	offset  int // Offset of the box start in the parent slice
+	payload []byte
+	typ     string
+}
+
+// next returns the next box or nil if there is none left
+func (r *mp4BoxReader) next() (b *mp4ParsedBox, err error) {
+	// No box left
+	if len(r.b)-r.offset < 8 {
+		return
+	}
+
+	// Parse header
+	var size = uint64(binary.BigEndian.Uint32(r.b[r.offset:]))
+	var typ = string(r.b[r.offset+4 : r.offset+8])
+	var headerSize uint64 = 8
+	switch size {
+	case 0:
+		size = uint64(len(r.b) - r.offset)
+	case 1:
+		if len(r.b)-r.offset < 16 {
+			err = fmt.Errorf("astisub: box %s at offset %d is truncated", typ, r.offset)
+			return
+		}
+		size = binary.BigEndian.Uint64(r.b[r.offset+8:])
+		headerSize = 16
+	}
+	if size < headerSize || size > uint64(len(r.b)-r.offset) {
+		err = fmt.Errorf("astisub: box %s at offset %d has an invalid size %d", typ, r.offset, size)
+		return
+	}
+
+	// Create box
+	b = &mp4ParsedBox{
+		offset:  r.offset,
+		payload: r.b[r.offset+int(headerSize) : r.offset+int(size)],
+		typ:     typ,
+	}
+	r.offset += int(size)
+	return
+}
+
+// mp4Track represents a parsed subtitle track
+type mp4Track struct {
+	config                string
+	defaultSampleDuration uint32
+	defaultSampleSize     uint32
+	sampleEntryType       string
+	timescale             uint32
+}
+
+// mp4Reader reads subtitles from fragmented MP4 boxes
+type mp4Reader struct {
+	cues    map[string]*Item
+	o       *Subtitles
+	track   *mp4Track
+	trackID uint32
+	tracks  map[uint32]*mp4Track
+}
+
+// ReadFromMP4 parses a fragmented MP4 content holding a wvtt or stpp track. The initialization segment
+// must come first, which means separate segments can be read using io.MultiReader(init, segment1, ...)
+func ReadFromMP4(i io.Reader) (o *Subtitles, err error) {
+	// Read all
+	var b []byte
+	if b, err = ioutil.ReadAll(i); err != nil {
+		err = fmt.Errorf("astisub: reading failed: %w", err)
+		return
+	}
+
+	// Init
+	var r = &mp4Reader{
+		cues:   make(map[string]*Item),
+		o:      NewSubtitles(),
+		tracks: make(map[uint32]*mp4Track),
+	}
+
+	// Loop through top level boxes
+	var br = &mp4BoxReader{b: b}
+	for {
+		// Next box
+		var box *mp4ParsedBox
+		if box, err = br.next(); err != nil {
+			err = fmt.Errorf("astisub: reading box failed: %w", err)
+			return
+		} else if box == nil {
+			break
+		}
+
+		// Switch on type
+		switch box.typ {
+		case "moov":
+			if err = r.parseMoov(box.payload); err != nil {
+				err = fmt.Errorf("astisub: parsing moov failed: %w", err)
+				return
+			}
+		case "moof":
+			if err = r.parseMoof(b, box.offset, box.payload); err != nil {
+				err = fmt.Errorf("astisub: parsing moof failed: %w", err)
+				return
+			}
+		}
+	}
+
+	// No track
+	if r.track == nil {
+		err = ErrMP4NoSubtitleTrack
+		return
+	}
+	o = r.o
+	o.Order()
+	o.registerSpeakers()
+
+	// TTML items spanning several segments are split
+	if r.track.sampleEntryType == MP4SampleEntryTypeTTML {
+		o.Unfragment()
+	}
+	return
+}
+
+// children returns the children of a container box
+func mp4Children(b []byte) (bs []*mp4ParsedBox, err error) {
+	var r = &mp4BoxReader{b: b}
+	for {
+		var box *mp4ParsedBox
+		if box, err = r.next(); err != nil || box == nil {
+			return
+		}
+		bs = append(bs, box)
+	}
+}
+
+// mp4Path returns the payloads of the descendant boxes matching the path
+func mp4Path(b []byte, path ...string) (ps [][]byte, err error) {
+	var bs []*mp4ParsedBox
+	if bs, err = mp4Children(b); err != nil {
+		return
+	}
+	for _, box := range bs {
+		if box.typ != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			ps = append(ps, box.payload)
+			continue
+		}
+		var cps [][]byte
+		if cps, err = mp4Path(box.payload, path[1:]...); err != nil {
+			return
+		}
+		ps = append(ps, cps...)
+	}
+	return
+}
+
+func (r *mp4Reader) parseMoov(b []byte) (err error) {
+	// Loop through tracks
+	var traks [][]byte
+	if traks, err = mp4Path(b, "trak"); err != nil {
+		return
+	}
+	for _, trak := range traks {
+		// Get track id
+		var ps [][]byte
+		if ps, err = mp4Path(trak, "tkhd"); err != nil {
+			return
+		} else if len(ps) == 0 || len(ps[0]) < 24 {
+			continue
+		}
+		var trackID uint32
+		if ps[0][0] == 1 {
+			trackID = binary.BigEndian.Uint32(ps[0][20:])
+		} else {
+			trackID = binary.BigEndian.Uint32(ps[0][12:])
+		}
+
+		// Get timescale
+		var t = &mp4Track{timescale: mp4DefaultTimescale}
+		if ps, err = mp4Path(trak, "mdia", "mdhd"); err != nil {
+			return
+		} else if len(ps) > 0 && len(ps[0]) >= 24 {
+			if ps[0][0] == 1 {
+				t.timescale = binary.BigEndian.Uint32(ps[0][20:])
+			} else {
+				t.timescale = binary.BigEndian.Uint32(ps[0][12:])
+			}
+		}
+
+		// Get sample entry
+		if ps, err = mp4Path(trak, "mdia", "minf", "stbl", "stsd"); err != nil {
+			return
+		} else if len(ps) == 0 || len(ps[0]) < 8 {
+			continue
+		}
+		var entries []*mp4ParsedBox
+		if entries, err = mp4Children(ps[0][8:]); err != nil || len(entries) == 0 {
+			return
+		}
+		t.sampleEntryType = entries[0].typ
+		switch t.sampleEntryType {
+		case MP4SampleEntryTypeWebVTT:
+			if len(entries[0].payload) < 8 {
+				continue
+			}
+			var cs [][]byte
+			if cs, err = mp4Path(entries[0].payload[8:], "vttC"); err != nil {
+				return
+			} else if len(cs) > 0 {
+				t.config = string(cs[0])
+			}
+		case MP4SampleEntryTypeTTML:
+		default:
+			continue
+		}
+		r.tracks[trackID] = t
+
+		// First subtitle track is the one being read
+		if r.track == nil {
+			r.track = t
+			r.trackID = trackID
+		}
+	}
+
+	// Get track defaults
+	var trexs [][]byte
+	if trexs, err = mp4Path(b, "mvex", "trex"); err != nil {
+		return
+	}
+	for _, trex := range trexs {
+		if len(trex) < 24 {
+			continue
+		}
+		if t, ok := r.tracks[binary.BigEndian.Uint32(trex[4:])]; ok {
+			t.defaultSampleDuration = binary.BigEndian.Uint32(trex[12:])
+			t.defaultSampleSize = binary.BigEndian.Uint32(trex[16:])
+		}
+	}
+
+	// Parse WebVTT configuration
+	if r.track != nil && r.track.sampleEntryType == MP4SampleEntryTypeWebVTT && r.track.config != "" {
+		var s *Subtitles
+		if s, err = ReadFromWebVTT(strings.NewReader(r.track.config)); err != nil {
+			err = fmt.Errorf("astisub: parsing vttC failed: %w", err)
+			return
+		}
+		r.o.Regions = s.Regions
+		r.o.Styles = s.Styles
+	}
+	return
+}
+
+func (r *mp4Reader) parseMoof(b []byte, moofOffset int, moof []byte) (err error) {
+	// No track
+	if r.track == nil {
+		return ErrMP4NoSubtitleTrack
+	}
+
+	// Loop through track fragments
+	var trafs [][]byte
+	if trafs, err = mp4Path(moof, "traf"); err != nil {
+		return
+	}
+	for _, traf := range trafs {
+		// Parse tfhd
+		var ps [][]byte
+		if ps, err = mp4Path(traf, "tfhd"); err != nil {
+			return
+		} else if len(ps) == 0 || len(ps[0]) < 8 {
+			continue
+		}
+		var tfhd = ps[0]
+		var flags = binary.BigEndian.Uint32(tfhd) & 0xffffff
+		if binary.BigEndian.Uint32(tfhd[4:]) != r.trackID {
+			continue
+		}
+		var baseOffset = moofOffset
+		var defaultDuration, defaultSize = r.track.defaultSampleDuration, r.track.defaultSampleSize
+		var pos = 8
+		var read = func(n int) (v uint64) {
+			if pos+n > len(tfhd) {
+				return
+			}
+			switch n {
+			case 4:
+				v = uint64(binary.BigEndian.Uint32(tfhd[pos:]))
+			case 8:
+				v = binary.BigEndian.Uint64(tfhd[pos:])
+			}
+			pos += n
+			return
+		}
+		if flags&mp4TfhdFlagBaseDataOffset > 0 {
+			baseOffset = int(read(8))
+		}
+		if flags&mp4TfhdFlagSampleDescriptionIndex > 0 {
+			read(4)
+		}
+		if flags&mp4TfhdFlagDefaultSampleDuration > 0 {
+			defaultDuration = uint32(read(4))
+		}
+		if flags&mp4TfhdFlagDefaultSampleSize > 0 {
+			defaultSize = uint32(read(4))
+		}
+
+		// Parse tfdt
+		var decodeTime uint64
+		if ps, err = mp4Path(traf, "tfdt"); err != nil {
+			return
+		} else if len(ps) > 0 && len(ps[0]) >= 8 {
+			if ps[0][0] == 1 && len(ps[0]) >= 12 {
+				decodeTime = binary.BigEndian.Uint64(ps[0][4:])
+			} else {
+				decodeTime = uint64(binary.BigEndian.Uint32(ps[0][4:]))
+			}
+		}
+
+		// Loop through runs
+		var truns [][]byte
+		if truns, err = mp4Path(traf, "trun"); err != nil {
+			return
+		}
+		var dataOffset = baseOffset
+		for _, trun := range truns {
+			if len(trun) < 8 {
+				continue
+			}
+			var flags = binary.BigEndian.Uint32(trun) & 0xffffff
+			var count = binary.BigEndian.Uint32(trun[4:])
+			var pos = 8
+			if flags&mp4TrunFlagDataOffset > 0 && len(trun) >= pos+4 {
+				dataOffset = baseOffset + int(int32(binary.BigEndian.Uint32(trun[pos:])))
+				pos += 4
+			}
+			if flags&mp4TrunFlagFirstSampleFlags > 0 {
+				pos += 4
+			}
+
+			// Loop through samples
+			for idx := uint32(0); idx < count; idx++ {
+				var duration, size = defaultDuration, defaultSize
+				for _, f := range []uint32{mp4TrunFlagSampleDuration, mp4TrunFlagSampleSize, mp4TrunFlagSampleFlags, mp4TrunFlagSampleCompositionTime} {
+					if flags&f == 0 {
+						continue
+					}
+					if len(trun) < pos+4 {
+						return fmt.Errorf("astisub: trun is truncated")
+					}
+					switch f {
+					case mp4TrunFlagSampleDuration:
+						duration = binary.BigEndian.Uint32(trun[pos:])
+					case mp4TrunFlagSampleSize:
+						size = binary.BigEndian.Uint32(trun[pos:])
+					}
+					pos += 4
+				}
+
+				// Get data
+				if dataOffset < 0 || dataOffset+int(size) > len(b) {
+					return fmt.Errorf("astisub: sample data at offset %d is out of bounds", dataOffset)
+				}
+				var data = b[dataOffset : dataOffset+int(size)]
+				dataOffset += int(size)
+
+				// Parse sample
+				var startAt = mp4TicksToDuration(decodeTime, r.track.timescale)
+				decodeTime += uint64(duration)
+				if err = r.parseSample(data, startAt, mp4TicksToDuration(decodeTime, r.track.timescale)); err != nil {
+					return fmt.Errorf("astisub: parsing sample failed: %w", err)
+				}
+			}
+		}
+	}
+	return
+}
+
+func (r *mp4Reader) parseSample(data []byte, startAt, endAt time.Duration) (err error) {
+	switch r.track.sampleEntryType {
+	case MP4SampleEntryTypeTTML:
+		// Parse TTML
+		var s *Subtitles
+		if s, err = ReadFromTTML(bytes.NewReader(data)); err != nil {
+			err = fmt.Errorf("astisub: parsing ttml failed: %w", err)
+			return
+		}
+
+		// Merge
+		if r.o.Metadata == nil {
+			r.o.Metadata = s.Metadata
+		}
+		r.o.Merge(s)
+	default:
+		// Loop through cues
+		var cues []*mp4ParsedBox
+		if cues, err = mp4Children(data); err != nil {
+			return
+		}
+		var open = make(map[string]*Item)
+		for _, cue := range cues {
+			// Not a cue
+			if cue.typ != "vttc" {
+				continue
+			}
+
+			// Same cue as in the previous sample
+			if i, ok := r.cues[string(cue.payload)]; ok && i.EndAt == startAt {
+				i.EndAt = endAt
+				open[string(cue.payload)] = i
+				continue
+			}
+
+			// Create item
+			var i = &Item{
+				EndAt:       endAt,
+				InlineStyle: &StyleAttributes{},
+				StartAt:     startAt,
+			}
+
+			// Loop through boxes
+			var bs []*mp4ParsedBox
+			if bs, err = mp4Children(cue.payload); err != nil {
+				return
+			}
+			for _, b := range bs {
+				switch b.typ {
+				case "iden":
+					i.WebVTTID = string(b.payload)
+					i.Index, _ = strconv.Atoi(i.WebVTTID)
+				case "payl":
+					for _, line := range strings.Split(string(b.payload), "\n") {
+						if l := parseTextWebVTT(line); len(l.Items) > 0 {
+							i.Lines = append(i.Lines, l)
+						}
+					}
+				case "sttg":
+					if err = parseWebVTTCueSettings(i, strings.Fields(string(b.payload)), r.o.Regions); err != nil {
+						err = fmt.Errorf("astisub: parsing cue settings failed: %w", err)
+						return
+					}
+				}
+			}
+			i.InlineStyle.propagateWebVTTAttributes()
+
+			// Append item
+			open[string(cue.payload)] = i
+			r.o.Items = append(r.o.Items, i)
+		}
+		r.cues = open
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package astisub_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMP4WebVTT(t *testing.T) {
+	// Open
+	s, err := astisub.OpenFile("./testdata/example-in.vtt")
+	require.NoError(t, err)
+
+	// Write init and 2 segments
+	init := &bytes.Buffer{}
+	err = s.WriteToMP4Init(init, astisub.MP4Options{})
+	require.NoError(t, err)
+	seg1, seg2 := &bytes.Buffer{}, &bytes.Buffer{}
+	err = s.WriteToMP4Segment(seg1, astisub.MP4Options{Duration: 2 * time.Minute, SequenceNumber: 1})
+	require.NoError(t, err)
+	err = s.WriteToMP4Segment(seg2, astisub.MP4Options{BaseMediaDecodeTime: 2 * time.Minute, SequenceNumber: 2})
+	require.NoError(t, err)
+
+	// Read
+	s2, err := astisub.ReadFromMP4(io.MultiReader(init, seg1, seg2))
+	require.NoError(t, err)
+	assertSubtitleItems(t, s2)
+	assert.Equal(t, len(s.Regions), len(s2.Regions))
+	assert.Equal(t, s.Items[0].Region.ID, s2.Items[0].Region.ID)
+	assert.Equal(t, s.Items[1].InlineStyle.WebVTTAlign, s2.Items[1].InlineStyle.WebVTTAlign)
+
+	// Invalid sample entry type
+	err = s.WriteToMP4Init(&bytes.Buffer{}, astisub.MP4Options{SampleEntryType: "invalid"})
+	assert.Error(t, err)
+
+	// No subtitle track
+	_, err = astisub.ReadFromMP4(seg1)
+	assert.Error(t, err)
+}
+
+func TestMP4TTML(t *testing.T) {
+	// Open
+	s, err := astisub.OpenFile("./testdata/example-in.ttml")
+	require.NoError(t, err)
+
+	// Write init and 2 segments, the second item spanning both of them
+	o := astisub.MP4Options{SampleEntryType: astisub.MP4SampleEntryTypeTTML, Timescale: 90000}
+	init := &bytes.Buffer{}
+	err = s.WriteToMP4Init(init, o)
+	require.NoError(t, err)
+	seg1, seg2 := &bytes.Buffer{}, &bytes.Buffer{}
+	o.Duration = time.Minute + 41*time.Second
+	err = s.WriteToMP4Segment(seg1, o)
+	require.NoError(t, err)
+	o.BaseMediaDecodeTime, o.Duration = o.Duration, 0
+	err = s.WriteToMP4Segment(seg2, o)
+	require.NoError(t, err)
+
+	// Read
+	s2, err := astisub.ReadFromMP4(io.MultiReader(init, seg1, seg2))
+	require.NoError(t, err)
+	assertSubtitleItems(t, s2)
+}
@@ -0,0 +1,55 @@
+package astisub
+
+import (
+	"math"
+	"time"
+)
+
+// MPEG-TS clock
+const (
+	ptsClockRate = 90000
+	// PTSRollover is the number of 90kHz ticks after which a PTS wraps (2^33, ~26.5 hours)
+	PTSRollover PTS = 1 << 33
+)
+
+// PTS represents a 33-bit MPEG-TS presentation timestamp expressed in 90kHz ticks
+// Arithmetic is performed modulo 2^33 so that timestamps around a wrap compare and subtract correctly.
+type PTS int64
+
+// NewPTS creates a PTS out of a duration, wrapping it into [0, 2^33)
+func NewPTS(d time.Duration) PTS {
+	return PTS(math.Round(d.Seconds() * ptsClockRate)).wrap()
+}
+
+// wrap brings the PTS back into [0, 2^33)
+func (p PTS) wrap() PTS {
+	p %= PTSRollover
+	if p < 0 {
+		p += PTSRollover
+	}
+	return p
+}
+
+// Add adds a duration to the PTS, wrapping if needed
+func (p PTS) Add(d time.Duration) PTS {
+	return (p + NewPTS(d)).wrap()
+}
+
+// Duration returns the duration since PTS 0 in the current wrap
+func (p PTS) Duration() time.Duration {
+	return ptsTicksToDuration(int64(p.wrap()))
+}
+
+// Sub returns the shortest duration between both PTS, i.e. assuming they are less than half a wrap (~13.25
+// hours) apart. It is positive when p is after q, even if p has wrapped and q has not.
+func (p PTS) Sub(q PTS) time.Duration {
+	d := (p - q).wrap()
+	if d >= PTSRollover/2 {
+		d -= PTSRollover
+	}
+	return ptsTicksToDuration(int64(d))
+}
+
+func ptsTicksToDuration(i int64) time.Duration {
+	return time.Duration(i) * time.Second / ptsClockRate
+}
@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/asticode/go-astikit"
+	"golang.org/x/net/html"
 )
 
 // Constants
@@ -17,8 +21,32 @@ const (
 // Vars
 var (
 	bytesSRTTimeBoundariesSeparator = []byte(srtTimeBoundariesSeparator)
+	srtRegexpPosition               = regexp.MustCompile(`\{\\an([1-9])\}`)
 )
 
+// SRT named colors
+var srtColors = map[string]*Color{
+	"aqua":    ColorCyan,
+	"black":   ColorBlack,
+	"blue":    ColorBlue,
+	"cyan":    ColorCyan,
+	"fuchsia": ColorMagenta,
+	"gray":    ColorGray,
+	"green":   ColorGreen,
+	"grey":    ColorGray,
+	"lime":    ColorLime,
+	"magenta": ColorMagenta,
+	"maroon":  ColorMaroon,
+	"navy":    ColorNavy,
+	"olive":   ColorOlive,
+	"purple":  ColorPurple,
+	"red":     ColorRed,
+	"silver":  ColorSilver,
+	"teal":    ColorTeal,
+	"white":   ColorWhite,
+	"yellow":  ColorYellow,
+}
+
 // parseDurationSRT parses an .srt duration
 func parseDurationSRT(i string) (d time.Duration, err error) {
 	for _, s := range []string{",", "."} {
@@ -39,6 +67,7 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 	var line string
 	var lineNum int
 	var s = &Item{}
+	var tags []srtTag
 	for scanner.Scan() {
 		// Fetch line
 		line = strings.TrimSpace(scanner.Text())
@@ -82,6 +111,7 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 
 			// Init subtitle
 			s = &Item{}
+			tags = []srtTag{}
 
 			// Fetch Index
 			if index != "" {
@@ -94,8 +124,20 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 				err = fmt.Errorf("astisub: line %d: time boundaries has only %d element(s)", lineNum, l)
 				return
 			}
-			// We do this to eliminate extra stuff like positions which are not documented anywhere
-			s2 := strings.Split(s1[1], " ")
+			// Positions are not documented anywhere but are commonly written as X1:... X2:... Y1:... Y2:...
+			s2 := strings.Fields(s1[1])
+			if len(s2) == 0 {
+				err = fmt.Errorf("astisub: line %d: no end time boundary", lineNum)
+				return
+			}
+			for _, v := range s2[1:] {
+				if sa := parseSRTCoordinate(v); sa != nil {
+					if s.InlineStyle == nil {
+						s.InlineStyle = &StyleAttributes{}
+					}
+					sa(s.InlineStyle)
+				}
+			}
 
 			// Parse time boundaries
 			if s.StartAt, err = parseDurationSRT(s1[0]); err != nil {
@@ -109,14 +151,202 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 
 			// Append subtitle
 			o.Items = append(o.Items, s)
+		} else if line == "" {
+			// Add empty line
+			s.Lines = append(s.Lines, Line{Items: []LineItem{{}}})
 		} else {
+			// Parse position
+			if ms := srtRegexpPosition.FindStringSubmatch(line); len(ms) > 1 {
+				if s.InlineStyle == nil {
+					s.InlineStyle = &StyleAttributes{}
+				}
+				p, _ := strconv.Atoi(ms[1])
+				s.InlineStyle.SRTPosition = astikit.IntPtr(p)
+				s.InlineStyle.propagateSRTAttributes()
+				line = srtRegexpPosition.ReplaceAllString(line, "")
+			}
+
 			// Add text
-			s.Lines = append(s.Lines, Line{Items: []LineItem{{Text: strings.TrimSpace(line)}}})
+			if l := parseTextSRT(line, &tags); len(l.Items) > 0 {
+				s.Lines = append(s.Lines, l)
+			}
+		}
+	}
+	return
+}
+
+// parseSRTCoordinate returns a function setting the coordinate found in the input, if any
+func parseSRTCoordinate(i string) func(sa *StyleAttributes) {
+	// Split
+	ps := strings.Split(i, ":")
+	if len(ps) != 2 {
+		return nil
+	}
+
+	// Parse value
+	v, err := strconv.Atoi(ps[1])
+	if err != nil {
+		return nil
+	}
+
+	// Switch on name
+	switch strings.ToUpper(ps[0]) {
+	case "X1":
+		return func(sa *StyleAttributes) { sa.SRTX1 = astikit.IntPtr(v) }
+	case "X2":
+		return func(sa *StyleAttributes) { sa.SRTX2 = astikit.IntPtr(v) }
+	case "Y1":
+		return func(sa *StyleAttributes) { sa.SRTY1 = astikit.IntPtr(v) }
+	case "Y2":
+		return func(sa *StyleAttributes) { sa.SRTY2 = astikit.IntPtr(v) }
+	}
+	return nil
+}
+
+// srtTag represents an opened srt tag
+type srtTag struct {
+	color *Color
+	face  string
+	name  string
+}
+
+// parseTextSRT parses the srt text. Tags may be opened and closed on different lines, therefore opened tags are
+// kept between calls. Unsupported tags (e.g. <Music>) are kept as text and whitespace is kept as written.
+func parseTextSRT(i string, tags *[]srtTag) (o Line) {
+	// Create tokenizer
+	tr := html.NewTokenizer(strings.NewReader(i))
+
+	// Text is buffered until supported tags change
+	var text string
+	appendItem := func() {
+		// Nothing to append
+		if text == "" {
+			return
+		}
+
+		// Get style attributes
+		var sa *StyleAttributes
+		if len(*tags) > 0 {
+			sa = &StyleAttributes{}
+			for _, tag := range *tags {
+				switch tag.name {
+				case "b":
+					sa.SRTBold = astikit.BoolPtr(true)
+				case "i":
+					sa.SRTItalics = astikit.BoolPtr(true)
+				case "u":
+					sa.SRTUnderline = astikit.BoolPtr(true)
+				case "font":
+					if tag.color != nil {
+						sa.SRTColor = tag.color
+					}
+					if tag.face != "" {
+						sa.SRTFontFace = tag.face
+					}
+				}
+			}
+			sa.propagateSRTAttributes()
+		}
+
+		// Append item
+		o.Items = append(o.Items, LineItem{InlineStyle: sa, Text: text})
+		text = ""
+	}
+
+	// Loop
+	for {
+		// Get next tag
+		t := tr.Next()
+		if err := tr.Err(); err != nil {
+			break
+		}
+
+		// Get raw token before the tag name is lowercased
+		raw := string(tr.Raw())
+
+		switch t {
+		case html.EndTagToken:
+			// Unsupported tags are kept as text
+			n, _ := tr.TagName()
+			if !srtTagSupported(string(n)) {
+				text += raw
+				continue
+			}
+
+			// Pop the last tag with the same name
+			appendItem()
+			for idx := len(*tags) - 1; idx >= 0; idx-- {
+				if (*tags)[idx].name == string(n) {
+					*tags = append((*tags)[:idx], (*tags)[idx+1:]...)
+					break
+				}
+			}
+		case html.StartTagToken:
+			// Unsupported tags are kept as text
+			n, hasAttr := tr.TagName()
+			if !srtTagSupported(string(n)) {
+				text += raw
+				continue
+			}
+
+			// Push tag
+			appendItem()
+			tag := srtTag{name: string(n)}
+			for tag.name == "font" && hasAttr {
+				var k, v []byte
+				k, v, hasAttr = tr.TagAttr()
+				switch string(k) {
+				case "color":
+					tag.color = parseSRTColor(string(v))
+				case "face":
+					tag.face = string(v)
+				}
+			}
+			*tags = append(*tags, tag)
+		default:
+			// Text, comments and self closing tags are kept as written
+			text += raw
 		}
 	}
+	appendItem()
 	return
 }
 
+// srtTagSupported checks whether the tag is converted to style attributes
+func srtTagSupported(name string) bool {
+	switch name {
+	case "b", "font", "i", "u":
+		return true
+	}
+	return false
+}
+
+func parseSRTColor(i string) *Color {
+	// Named color
+	i = strings.ToLower(strings.TrimSpace(i))
+	if c, ok := srtColors[i]; ok {
+		return c
+	}
+
+	// Hexadecimal color
+	i = strings.TrimPrefix(i, "#")
+	if len(i) == 3 {
+		i = string([]byte{i[0], i[0], i[1], i[1], i[2], i[2]})
+	}
+	if len(i) != 6 {
+		return nil
+	}
+	v, err := strconv.ParseUint(i, 16, 32)
+	if err != nil {
+		return nil
+	}
+	return &Color{
+		Blue:  uint8(v & 0xff),
+		Green: uint8(v >> 8 & 0xff),
+		Red:   uint8(v >> 16 & 0xff),
+	}
+}
+
 // formatDurationSRT formats an .srt duration
 func formatDurationSRT(i time.Duration) string {
 	return formatDuration(i, ",", 3)
@@ -130,6 +360,9 @@ func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
 		return
 	}
 
+	// Tags and positions are derived from the generic style attributes when srt ones are missing
+	s = s.withGenericAttributes()
+
 	// Add BOM header
 	var c []byte
 	c = append(c, BytesBOM...)
@@ -142,11 +375,17 @@ func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
 		c = append(c, []byte(formatDurationSRT(v.StartAt))...)
 		c = append(c, bytesSRTTimeBoundariesSeparator...)
 		c = append(c, []byte(formatDurationSRT(v.EndAt))...)
+		if v.InlineStyle != nil {
+			c = append(c, v.InlineStyle.srtCoordinatesBytes()...)
+		}
 		c = append(c, bytesLineSeparator...)
 
 		// Loop through lines
-		for _, l := range v.Lines {
-			c = append(c, []byte(l.String())...)
+		for idx, l := range v.Lines {
+			if idx == 0 && v.InlineStyle != nil && v.InlineStyle.SRTPosition != nil {
+				c = append(c, []byte(fmt.Sprintf("{\\an%d}", *v.InlineStyle.SRTPosition))...)
+			}
+			c = append(c, l.srtBytes()...)
 			c = append(c, bytesLineSeparator...)
 		}
 
@@ -164,3 +403,120 @@ func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
 	}
 	return
 }
+
+// WriteToSDH writes subtitles in .srt format for the deaf and hard of hearing: the name of the speaker is
+// written in uppercase followed by a colon each time the speaker changes within an item
+func (s Subtitles) WriteToSDH(o io.Writer) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
+	return s.withSpeakerPrefixes().WriteToSRT(o)
+}
+
+// withSpeakerPrefixes returns a copy of the subtitles where an unstyled line item containing the speaker name is
+// added each time the speaker changes within an item. Lines without speakers fall back to their voice name.
+func (s Subtitles) withSpeakerPrefixes() Subtitles {
+	o := s
+	o.Items = make([]*Item, 0, len(s.Items))
+	for _, i := range s.Items {
+		c := *i
+		c.Lines = make([]Line, 0, len(i.Lines))
+		var previous string
+		for _, l := range i.Lines {
+			var hasSpeakers bool
+			for _, li := range l.Items {
+				if li.Speaker != nil {
+					hasSpeakers = true
+					break
+				}
+			}
+			nl := l
+			nl.Items = make([]LineItem, 0, len(l.Items))
+			for _, li := range l.Items {
+				name := l.VoiceName
+				if hasSpeakers {
+					name = ""
+					if li.Speaker != nil {
+						name = li.Speaker.Name
+					}
+				}
+				if name != "" && name != previous {
+					nl.Items = append(nl.Items, LineItem{Text: strings.ToUpper(name) + ":"})
+				}
+				previous = name
+				nl.Items = append(nl.Items, li)
+			}
+			c.Lines = append(c.Lines, nl)
+		}
+		o.Items = append(o.Items, &c)
+	}
+	return o
+}
+
+func (sa StyleAttributes) srtCoordinatesBytes() (c []byte) {
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{
+		{name: "X1", value: sa.SRTX1},
+		{name: "X2", value: sa.SRTX2},
+		{name: "Y1", value: sa.SRTY1},
+		{name: "Y2", value: sa.SRTY2},
+	} {
+		if v.value != nil {
+			c = append(c, []byte(" "+v.name+":"+strconv.Itoa(*v.value))...)
+		}
+	}
+	return
+}
+
+func (l Line) srtBytes() (c []byte) {
+	for idx, li := range l.Items {
+		if l.needsSpaceBefore(idx) {
+			c = append(c, bytesSpace...)
+		}
+		c = append(c, li.srtBytes()...)
+	}
+	return
+}
+
+func (li LineItem) srtBytes() (c []byte) {
+	// Get tags
+	var tags []string
+	if sa := li.InlineStyle; sa != nil {
+		if sa.SRTBold != nil && *sa.SRTBold {
+			tags = append(tags, "b")
+		}
+		if sa.SRTItalics != nil && *sa.SRTItalics {
+			tags = append(tags, "i")
+		}
+		if sa.SRTUnderline != nil && *sa.SRTUnderline {
+			tags = append(tags, "u")
+		}
+		if sa.SRTColor != nil || sa.SRTFontFace != "" {
+			tags = append(tags, "font")
+		}
+	}
+
+	// Append
+	for _, tag := range tags {
+		c = append(c, '<')
+		c = append(c, []byte(tag)...)
+		if tag == "font" {
+			if li.InlineStyle.SRTColor != nil {
+				c = append(c, []byte(` color="#`+li.InlineStyle.SRTColor.TTMLString()+`"`)...)
+			}
+			if li.InlineStyle.SRTFontFace != "" {
+				c = append(c, []byte(` face="`+li.InlineStyle.SRTFontFace+`"`)...)
+			}
+		}
+		c = append(c, '>')
+	}
+	c = append(c, []byte(li.Text)...)
+	for idx := len(tags) - 1; idx >= 0; idx-- {
+		c = append(c, []byte("</"+tags[idx]+">")...)
+	}
+	return
+}
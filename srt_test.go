@@ -3,10 +3,13 @@ package astisub_test
 import (
 	"bytes"
 	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSRT(t *testing.T) {
@@ -46,3 +49,66 @@ func TestSRTMissingSequence(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, string(c), w.String())
 }
+
+func TestSRTStyled(t *testing.T) {
+	// Open
+	s, err := astisub.ReadFromSRT(strings.NewReader(`1
+00:00:01,000 --> 00:00:02,000
+{\an8}<i>italic
+<b>still</b> italic</i> <u>underline</u>
+<font color="#ff0000" face="Arial">red</font> <font color=yellow>yellow</font>
+`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.NotNil(t, s.Items[0].InlineStyle)
+	assert.Equal(t, astikit.IntPtr(8), s.Items[0].InlineStyle.SRTPosition)
+	assert.Equal(t, &astisub.JustificationCentered, s.Items[0].InlineStyle.TextAlign)
+	assert.Equal(t, &astisub.VerticalAlignmentTop, s.Items[0].InlineStyle.VerticalAlign)
+	require.Len(t, s.Items[0].Lines, 3)
+	assert.Equal(t, "italic", s.Items[0].Lines[0].String())
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[0].Items[0].InlineStyle.SRTItalics)
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[0].Items[0].InlineStyle.Italic)
+	require.Len(t, s.Items[0].Lines[1].Items, 4)
+	assert.Equal(t, "still italic underline", s.Items[0].Lines[1].String())
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[1].Items[0].InlineStyle.SRTBold)
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[1].Items[0].InlineStyle.SRTItalics)
+	assert.Nil(t, s.Items[0].Lines[1].Items[1].InlineStyle.SRTBold)
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[1].Items[1].InlineStyle.SRTItalics)
+	assert.Nil(t, s.Items[0].Lines[1].Items[2].InlineStyle)
+	assert.Nil(t, s.Items[0].Lines[1].Items[3].InlineStyle.SRTItalics)
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[1].Items[3].InlineStyle.SRTUnderline)
+	require.Len(t, s.Items[0].Lines[2].Items, 3)
+	assert.Equal(t, astisub.ColorRed, s.Items[0].Lines[2].Items[0].InlineStyle.SRTColor)
+	assert.Equal(t, "Arial", s.Items[0].Lines[2].Items[0].InlineStyle.SRTFontFace)
+	assert.Equal(t, astisub.ColorYellow, s.Items[0].Lines[2].Items[2].InlineStyle.SRTColor)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSRT(w)
+	require.NoError(t, err)
+	assert.Equal(t, string(astisub.BytesBOM)+"1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<i>italic</i>\n<b><i>still</i></b><i> italic</i> <u>underline</u>\n<font color=\"#ff0000\" face=\"Arial\">red</font> <font color=\"#ffff00\">yellow</font>\n", w.String())
+}
+
+func TestSRTText(t *testing.T) {
+	// Unsupported tags are kept as text and whitespace is kept as written
+	s, err := astisub.ReadFromSRT(strings.NewReader(`1
+00:00:01,000 --> 00:00:02,000
+<Music>  la la <br/>la</Music>
+<i>Hel</i>lo, <i>world</i>!
+`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 2)
+	require.Len(t, s.Items[0].Lines[0].Items, 1)
+	assert.Equal(t, "<Music>  la la <br/>la</Music>", s.Items[0].Lines[0].String())
+	require.Len(t, s.Items[0].Lines[1].Items, 4)
+	assert.Equal(t, "Hel", s.Items[0].Lines[1].Items[0].Text)
+	assert.Equal(t, "lo, ", s.Items[0].Lines[1].Items[1].Text)
+	assert.Equal(t, "world", s.Items[0].Lines[1].Items[2].Text)
+	assert.Equal(t, "!", s.Items[0].Lines[1].Items[3].Text)
+
+	// Write
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSRT(w))
+	assert.Contains(t, w.String(), "\n<Music>  la la <br/>la</Music>\n")
+}
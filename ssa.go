@@ -2,14 +2,20 @@ package astisub
 
 import (
 	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
 
 	"github.com/asticode/go-astikit"
 )
@@ -87,11 +93,33 @@ const (
 // SSA section names
 const (
 	ssaSectionNameEvents     = "events"
+	ssaSectionNameFonts      = "fonts"
+	ssaSectionNameGraphics   = "graphics"
 	ssaSectionNameScriptInfo = "script.info"
 	ssaSectionNameStyles     = "styles"
 	ssaSectionNameUnknown    = "unknown"
 )
 
+// SSA attachment headers
+const (
+	ssaAttachmentHeaderFontName = "fontname"
+	ssaAttachmentHeaderFileName = "filename"
+)
+
+// SSA section names
+var ssaSectionNames = map[string]string{
+	"events":      ssaSectionNameEvents,
+	"fonts":       ssaSectionNameFonts,
+	"graphics":    ssaSectionNameGraphics,
+	"script info": ssaSectionNameScriptInfo,
+	"v4 styles":   ssaSectionNameStyles,
+	"v4 styles+":  ssaSectionNameStyles,
+	"v4+ styles":  ssaSectionNameStyles,
+}
+
+// SSA attachments are encoded on lines of 80 characters
+const ssaAttachmentLineLength = 80
+
 // SSA style format names
 const (
 	ssaStyleFormatNameAlignment       = "Alignment"
@@ -122,7 +150,16 @@ const (
 )
 
 // SSA regexp
-var ssaRegexpEffect = regexp.MustCompile(`\{[^\{]+\}`)
+var (
+	ssaRegexpEffect    = regexp.MustCompile(`\{[^\{]+\}`)
+	ssaRegexpLineBreak = regexp.MustCompile(`\\[Nn]`)
+)
+
+// SSA default play resolution
+const (
+	ssaDefaultPlayResX = 384
+	ssaDefaultPlayResY = 288
+)
 
 // ReadFromSSA parses an .ssa content
 func ReadFromSSA(i io.Reader) (o *Subtitles, err error) {
@@ -138,6 +175,7 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 	var si = &ssaScriptInfo{}
 	var ss = []*ssaStyle{}
 	var es = []*ssaEvent{}
+	var as = []*ssaAttachment{}
 
 	// Scan
 	var line, sectionName string
@@ -159,24 +197,21 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 		}
 
 		// Section name
+		// Encoded attachment data may look like a section name, therefore only known section names and names that
+		// can't be encoded data end attachment sections
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			switch strings.ToLower(line[1 : len(line)-1]) {
-			case "events":
-				sectionName = ssaSectionNameEvents
-				format = make(map[int]string)
-				continue
-			case "script info":
-				sectionName = ssaSectionNameScriptInfo
-				continue
-			case "v4 styles", "v4+ styles", "v4 styles+":
-				sectionName = ssaSectionNameStyles
-				format = make(map[int]string)
-				continue
-			default:
-				if opts.OnUnknownSectionName != nil {
-					opts.OnUnknownSectionName(line)
+			n, ok := ssaSectionNames[strings.ToLower(line[1:len(line)-1])]
+			if ok || (sectionName != ssaSectionNameFonts && sectionName != ssaSectionNameGraphics) || !isSSAAttachmentData(line) {
+				if !ok {
+					if opts.OnUnknownSectionName != nil {
+						opts.OnUnknownSectionName(line)
+					}
+					n = ssaSectionNameUnknown
+				}
+				sectionName = n
+				if n == ssaSectionNameEvents || n == ssaSectionNameStyles {
+					format = make(map[int]string)
 				}
-				sectionName = ssaSectionNameUnknown
 				continue
 			}
 		}
@@ -186,6 +221,19 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 			continue
 		}
 
+		// Attachments
+		// This needs to be done before checking comments since encoded data may start with ";"
+		if sectionName == ssaSectionNameFonts || sectionName == ssaSectionNameGraphics {
+			if a := newSSAAttachmentFromHeader(line, sectionName); a != nil {
+				as = append(as, a)
+			} else if len(as) > 0 {
+				as[len(as)-1].data.WriteString(line)
+			} else if opts.OnInvalidLine != nil {
+				opts.OnInvalidLine(line)
+			}
+			continue
+		}
+
 		// Comment
 		if len(line) > 0 && line[0] == ';' {
 			si.comments = append(si.comments, strings.TrimSpace(line[1:]))
@@ -253,13 +301,23 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 		o.Styles[st.ID] = st
 	}
 
+	// Loop through attachments
+	for _, a := range as {
+		var at *Attachment
+		if at, err = a.attachment(); err != nil {
+			err = fmt.Errorf("astisub: building attachment %s failed: %w", a.name, err)
+			return
+		}
+		o.Attachments = append(o.Attachments, at)
+	}
+
 	// Loop through events
 	for _, e := range es {
 		// Only process dialogues
 		if e.category == ssaEventCategoryDialogue {
 			// Build item
 			var item *Item
-			if item, err = e.item(o.Styles); err != nil {
+			if item, err = e.item(o.Styles, o.Metadata); err != nil {
 				return
 			}
 
@@ -267,6 +325,17 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 			o.Items = append(o.Items, item)
 		}
 	}
+
+	// Add speakers
+	o.registerSpeakers()
+
+	// Font sizes depend on the play resolution
+	_, y := ssaPlayRes(o.Metadata)
+	for _, sa := range o.styleAttributes() {
+		if sa.SSAFontSize != nil {
+			sa.FontSize = astikit.Float64Ptr(*sa.SSAFontSize * 100 / float64(y))
+		}
+	}
 	return
 }
 
@@ -891,7 +960,7 @@ type ssaEvent struct {
 }
 
 // newSSAEventFromItem returns an SSA Event based on an input item
-func newSSAEventFromItem(i Item) (e *ssaEvent) {
+func newSSAEventFromItem(i Item, v4plus bool) (e *ssaEvent) {
 	// Init
 	e = &ssaEvent{
 		category: ssaEventCategoryDialogue,
@@ -905,6 +974,7 @@ func newSSAEventFromItem(i Item) (e *ssaEvent) {
 	}
 
 	// Inline style
+	var itemTags string
 	if i.InlineStyle != nil {
 		e.effect = i.InlineStyle.SSAEffect
 		e.layer = i.InlineStyle.SSALayer
@@ -912,26 +982,186 @@ func newSSAEventFromItem(i Item) (e *ssaEvent) {
 		e.marginRight = i.InlineStyle.SSAMarginRight
 		e.marginVertical = i.InlineStyle.SSAMarginVertical
 		e.marked = i.InlineStyle.SSAMarked
+		itemTags = i.InlineStyle.ssaItemOverrideTags(v4plus)
 	}
 
 	// Text
+	// Override tags remain active until the end of the event, therefore only changes are written
+	var karaoke = i.ssaKaraokeDurations()
 	var lines []string
-	for _, l := range i.Lines {
-		var items []string
-		for _, item := range l.Items {
+	var previous map[string]string
+	for idx, l := range i.Lines {
+		var line string
+		for idxItem, item := range l.Items {
+			// Get tags
+			var tags string
+			if idx == 0 && idxItem == 0 {
+				tags = itemTags
+			}
+			var current map[string]string
+			var inlineTags string
+			current, inlineTags = item.InlineStyle.ssaInlineOverrideTags(previous)
+			tags += inlineTags
+			previous = current
+			if item.InlineStyle != nil && item.InlineStyle.SSAKaraoke != nil {
+				tags += fmt.Sprintf("\\%s%d", item.InlineStyle.SSAKaraoke.Effect, item.InlineStyle.SSAKaraoke.Duration.Milliseconds()/10)
+			} else if d, ok := karaoke[[2]int{idx, idxItem}]; ok {
+				tags += fmt.Sprintf("\\k%d", d)
+			}
+
+			// Build string
 			var s string
+			if tags != "" {
+				s += "{" + tags + "}"
+			}
 			if item.InlineStyle != nil && len(item.InlineStyle.SSAEffect) > 0 {
 				s += item.InlineStyle.SSAEffect
 			}
-			s += item.Text
-			items = append(items, s)
+			s += strings.ReplaceAll(item.Text, "\u00a0", "\\h")
+
+			// SSA has no ruby, therefore the annotation is added between parentheses after the base text
+			if item.RubyText != "" {
+				s += "(" + strings.ReplaceAll(item.RubyText, "\u00a0", "\\h") + ")"
+			}
+
+			// Add space between items unless there's one already or the item is a karaoke syllable
+			if l.needsSpaceBefore(idxItem) {
+				line += " "
+			}
+			line += s
 		}
 		if len(l.VoiceName) > 0 {
 			e.name = l.VoiceName
 		}
-		lines = append(lines, strings.Join(items, " "))
+		lines = append(lines, line)
 	}
 	e.text = strings.Join(lines, "\\n")
+
+	// Events have only one name, therefore the first speaker wins
+	if sp := i.firstSpeaker(); sp != nil {
+		e.name = sp.Name
+	}
+	return
+}
+
+// ssaKaraokeDurations converts line items start times (e.g. webvtt timestamps) into karaoke durations in
+// centiseconds indexed by line and line item indexes. Items without start time belong to the previous syllable.
+// Nothing is returned if there are no start times or if the item already contains karaoke tags.
+func (i Item) ssaKaraokeDurations() (ds map[[2]int]int) {
+	// Get syllables
+	type syllable struct {
+		idx     [2]int
+		startAt time.Duration
+	}
+	var ss []syllable
+	var timed bool
+	for idxLine, l := range i.Lines {
+		for idxItem, li := range l.Items {
+			if li.InlineStyle != nil && li.InlineStyle.SSAKaraoke != nil {
+				return
+			}
+			switch {
+			case li.StartAt > 0:
+				timed = true
+				ss = append(ss, syllable{idx: [2]int{idxLine, idxItem}, startAt: li.StartAt})
+			case len(ss) == 0:
+				ss = append(ss, syllable{idx: [2]int{idxLine, idxItem}, startAt: i.StartAt})
+			}
+		}
+	}
+	if !timed {
+		return
+	}
+
+	// Compute durations
+	// Durations are computed on rounded positions so that rounding errors don't add up
+	ds = make(map[[2]int]int)
+	for idx, s := range ss {
+		end := i.EndAt
+		if idx+1 < len(ss) {
+			end = ss[idx+1].startAt
+		}
+		d := int(math.Round(float64(end-i.StartAt)/float64(10*time.Millisecond))) - int(math.Round(float64(s.startAt-i.StartAt)/float64(10*time.Millisecond)))
+		if d < 0 {
+			d = 0
+		}
+		ds[s.idx] = d
+	}
+	return
+}
+
+// ssaItemOverrideTags returns the override tags applying to the whole item
+func (sa *StyleAttributes) ssaItemOverrideTags(v4plus bool) (tags string) {
+	for _, t := range ssaItemOverrideTags {
+		v, ok := t.format(sa)
+		if !ok {
+			continue
+		}
+
+		// Legacy alignment
+		if t.name == "an" && !v4plus {
+			n := *sa.SSAAlignment
+			a := (n-1)%3 + 1
+			switch (n - 1) / 3 {
+			case 1:
+				a += 8
+			case 2:
+				a += 4
+			}
+			tags += "\\a" + strconv.Itoa(a)
+			continue
+		}
+		tags += "\\" + t.name + v
+	}
+	return
+}
+
+// ssaInlineOverrideTags returns the inline override tags values as well as the tags that need to be written
+// considering the previous values
+func (sa *StyleAttributes) ssaInlineOverrideTags(previous map[string]string) (current map[string]string, tags string) {
+	// Get values
+	current = make(map[string]string)
+	if sa != nil {
+		for _, t := range ssaInlineOverrideTags {
+			if v, ok := t.format(sa); ok {
+				current[t.name] = v
+			}
+		}
+	}
+
+	// Check whether previous values need to be reset
+	var reset bool
+	for _, t := range ssaInlineOverrideTags {
+		if _, ok := previous[t.name]; !ok {
+			continue
+		}
+		if _, ok := current[t.name]; ok {
+			continue
+		}
+		if t.reset == "" {
+			reset = true
+			break
+		}
+	}
+	if reset {
+		tags = "\\r"
+		previous = nil
+	}
+
+	// Loop through tags
+	for _, t := range ssaInlineOverrideTags {
+		v, ok := current[t.name]
+		if !ok {
+			// Reset bool tags
+			if _, ok := previous[t.name]; ok && t.reset != "" && previous[t.name] != t.reset {
+				tags += "\\" + t.name + t.reset
+			}
+			continue
+		}
+		if pv, ok := previous[t.name]; !ok || pv != v {
+			tags += "\\" + t.name + v
+		}
+	}
 	return
 }
 
@@ -1031,7 +1261,7 @@ func newSSAEventFromString(header, content string, format map[int]string) (e *ss
 }
 
 // item converts an SSA event to an Item
-func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
+func (e *ssaEvent) item(styles map[string]*Style, m *Metadata) (i *Item, err error) {
 	// Init item
 	i = &Item{
 		EndAt: e.end,
@@ -1058,39 +1288,537 @@ func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
 	}
 
 	// Loop through lines
-	for _, s := range strings.Split(e.text, "\\n") {
+	// Override tags remain active until the end of the event, therefore the state is shared between lines
+	var st = &ssaOverrideState{}
+	for _, s := range ssaRegexpLineBreak.Split(e.text, -1) {
 		// Init
 		s = strings.TrimSpace(s)
 		var l = Line{VoiceName: e.name}
 
-		// Extract effects
-		var matches = ssaRegexpEffect.FindAllStringIndex(s, -1)
-		if len(matches) > 0 {
-			// Loop through matches
-			var lineItem *LineItem
-			var previousEffectEndOffset int
-			for _, idxs := range matches {
-				if lineItem != nil {
-					lineItem.Text = s[previousEffectEndOffset:idxs[0]]
-					l.Items = append(l.Items, *lineItem)
-				} else if idxs[0] > 0 {
-					l.Items = append(l.Items, LineItem{Text: s[previousEffectEndOffset:idxs[0]]})
-				}
-				previousEffectEndOffset = idxs[1]
-				lineItem = &LineItem{InlineStyle: &StyleAttributes{SSAEffect: s[idxs[0]:idxs[1]]}}
+		// Loop through override blocks
+		var offset int
+		for _, idxs := range ssaRegexpEffect.FindAllStringIndex(s, -1) {
+			st.appendLineItem(&l, s[offset:idxs[0]], false)
+			st.parseBlock(s[idxs[0]+1:idxs[1]-1], i.InlineStyle)
+			offset = idxs[1]
+		}
+		st.appendLineItem(&l, s[offset:], true)
+
+		// Make sure there's at least one line item
+		if len(l.Items) == 0 {
+			l.Items = append(l.Items, LineItem{})
+		}
+
+		// Add speaker
+		if len(e.name) > 0 {
+			for idx := range l.Items {
+				l.Items[idx].Speaker = &Speaker{ID: e.name, Name: e.name}
 			}
-			lineItem.Text = s[previousEffectEndOffset:]
-			l.Items = append(l.Items, *lineItem)
-		} else {
-			l.Items = append(l.Items, LineItem{Text: s})
 		}
 
 		// Add line
 		i.Lines = append(i.Lines, l)
 	}
+
+	// Karaoke durations are converted to cumulative start times so that other formats (e.g. webvtt timestamps)
+	// can use them. The first syllable starts with the item and therefore doesn't need a start time.
+	var offset time.Duration
+	for idxLine := range i.Lines {
+		for idxItem := range i.Lines[idxLine].Items {
+			li := &i.Lines[idxLine].Items[idxItem]
+			if li.InlineStyle == nil || li.InlineStyle.SSAKaraoke == nil {
+				continue
+			}
+			if offset > 0 {
+				li.StartAt = i.StartAt + offset
+			}
+			offset += li.InlineStyle.SSAKaraoke.Duration
+		}
+	}
+
+	// Propagate item override tags
+	if i.InlineStyle.SSAAlignment != nil {
+		i.InlineStyle.propagateNumpadAlignment(*i.InlineStyle.SSAAlignment)
+	}
+	if i.InlineStyle.SSAPosition != nil {
+		x, y := ssaPlayRes(m)
+		i.InlineStyle.Origin = &Percentages{Horizontal: i.InlineStyle.SSAPosition.X * 100 / float64(x), Vertical: i.InlineStyle.SSAPosition.Y * 100 / float64(y)}
+	}
+	return
+}
+
+// ssaPlayRes returns the play resolution, missing values are deduced using a 4:3 aspect ratio
+func ssaPlayRes(m *Metadata) (x, y int) {
+	if m != nil && m.SSAPlayResX != nil {
+		x = *m.SSAPlayResX
+	}
+	if m != nil && m.SSAPlayResY != nil {
+		y = *m.SSAPlayResY
+	}
+	switch {
+	case x <= 0 && y <= 0:
+		x, y = ssaDefaultPlayResX, ssaDefaultPlayResY
+	case x <= 0:
+		x = y * 4 / 3
+	case y <= 0:
+		y = x * 3 / 4
+	}
+	return
+}
+
+// SSAFade represents an SSA \fad override tag
+type SSAFade struct {
+	In, Out time.Duration
+}
+
+// SSAKaraoke represents an SSA karaoke override tag
+type SSAKaraoke struct {
+	Duration time.Duration
+	Effect   string // "k", "kf" or "ko"
+}
+
+// SSAMove represents an SSA \move override tag. Times are relative to the start of the item.
+type SSAMove struct {
+	End, Start     time.Duration
+	X1, X2, Y1, Y2 float64 // pixels
+}
+
+// SSAPosition represents an SSA \pos override tag
+type SSAPosition struct {
+	X, Y float64 // pixels
+}
+
+// ssaOverrideTag represents an SSA override tag that can be parsed from and formatted to a tag argument
+type ssaOverrideTag struct {
+	format func(sa *StyleAttributes) (string, bool)
+	name   string
+	parse  func(sa *StyleAttributes, v string) error
+	reset  string
+}
+
+func newSSABoolOverrideTag(name string, f func(sa *StyleAttributes) **bool) ssaOverrideTag {
+	return ssaOverrideTag{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if v := *f(sa); v != nil {
+				if *v {
+					return "1", true
+				}
+				return "0", true
+			}
+			return "", false
+		},
+		name: name,
+		parse: func(sa *StyleAttributes, v string) error {
+			switch v {
+			case "0":
+				*f(sa) = astikit.BoolPtr(false)
+			case "1":
+				*f(sa) = astikit.BoolPtr(true)
+			default:
+				return fmt.Errorf("astisub: invalid bool %s", v)
+			}
+			return nil
+		},
+		reset: "0",
+	}
+}
+
+func newSSAColorOverrideTag(name string, f func(sa *StyleAttributes) **Color) ssaOverrideTag {
+	return ssaOverrideTag{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if v := *f(sa); v != nil {
+				return fmt.Sprintf("&H%.2X%.2X%.2X&", v.Blue, v.Green, v.Red), true
+			}
+			return "", false
+		},
+		name: name,
+		parse: func(sa *StyleAttributes, v string) error {
+			// Colors are written as &HBBGGRR&
+			v = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(v, "&H"), "&h"), "&")
+			i, err := strconv.ParseUint(v, 16, 32)
+			if err != nil || len(v) > 6 {
+				return fmt.Errorf("astisub: invalid color %s", v)
+			}
+			*f(sa) = &Color{Blue: uint8(i >> 16), Green: uint8(i >> 8), Red: uint8(i)}
+			return nil
+		},
+	}
+}
+
+func newSSAFloatOverrideTag(name string, f func(sa *StyleAttributes) **float64) ssaOverrideTag {
+	return ssaOverrideTag{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if v := *f(sa); v != nil {
+				return strconv.FormatFloat(*v, 'f', -1, 64), true
+			}
+			return "", false
+		},
+		name: name,
+		parse: func(sa *StyleAttributes, v string) error {
+			i, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("astisub: parsing float %s failed: %w", v, err)
+			}
+			*f(sa) = astikit.Float64Ptr(i)
+			return nil
+		},
+	}
+}
+
+// parseSSAOverrideTagArguments parses arguments such as (1,2,3)
+func parseSSAOverrideTagArguments(v string, counts ...int) (fs []float64, err error) {
+	// Check parenthesis
+	if !strings.HasPrefix(v, "(") || !strings.HasSuffix(v, ")") {
+		err = fmt.Errorf("astisub: invalid arguments %s", v)
+		return
+	}
+
+	// Loop through arguments
+	for _, a := range strings.Split(v[1:len(v)-1], ",") {
+		var f float64
+		if f, err = strconv.ParseFloat(strings.TrimSpace(a), 64); err != nil {
+			err = fmt.Errorf("astisub: parsing float %s failed: %w", a, err)
+			return
+		}
+		fs = append(fs, f)
+	}
+
+	// Check count
+	for _, c := range counts {
+		if len(fs) == c {
+			return
+		}
+	}
+	err = fmt.Errorf("astisub: invalid number of arguments in %s", v)
+	return
+}
+
+func formatSSAOverrideTagArguments(fs ...float64) string {
+	var ss []string
+	for _, f := range fs {
+		ss = append(ss, strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return "(" + strings.Join(ss, ",") + ")"
+}
+
+// SSA inline override tags, in the order they're written
+var ssaInlineOverrideTags = []ssaOverrideTag{
+	{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if sa.SSABold != nil {
+				if *sa.SSABold {
+					return "1", true
+				}
+				return "0", true
+			}
+			return "", false
+		},
+		name: "b",
+		parse: func(sa *StyleAttributes, v string) error {
+			// Bold may also be a font weight
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("astisub: atoi of %s failed: %w", v, err)
+			}
+			sa.SSABold = astikit.BoolPtr(i == 1 || i >= 700)
+			return nil
+		},
+		reset: "0",
+	},
+	newSSABoolOverrideTag("i", func(sa *StyleAttributes) **bool { return &sa.SSAItalic }),
+	newSSABoolOverrideTag("u", func(sa *StyleAttributes) **bool { return &sa.SSAUnderline }),
+	newSSABoolOverrideTag("s", func(sa *StyleAttributes) **bool { return &sa.SSAStrikeout }),
+	{
+		format: func(sa *StyleAttributes) (string, bool) { return sa.SSAFontName, sa.SSAFontName != "" },
+		name:   "fn",
+		parse: func(sa *StyleAttributes, v string) error {
+			if v == "" {
+				return errors.New("astisub: empty font name")
+			}
+			sa.SSAFontName = v
+			return nil
+		},
+	},
+	newSSAFloatOverrideTag("fs", func(sa *StyleAttributes) **float64 { return &sa.SSAFontSize }),
+	newSSAFloatOverrideTag("fscx", func(sa *StyleAttributes) **float64 { return &sa.SSAScaleX }),
+	newSSAFloatOverrideTag("fscy", func(sa *StyleAttributes) **float64 { return &sa.SSAScaleY }),
+	newSSAFloatOverrideTag("fsp", func(sa *StyleAttributes) **float64 { return &sa.SSASpacing }),
+	newSSAFloatOverrideTag("frz", func(sa *StyleAttributes) **float64 { return &sa.SSAAngle }),
+	newSSAFloatOverrideTag("bord", func(sa *StyleAttributes) **float64 { return &sa.SSAOutline }),
+	newSSAFloatOverrideTag("shad", func(sa *StyleAttributes) **float64 { return &sa.SSAShadow }),
+	newSSAColorOverrideTag("c", func(sa *StyleAttributes) **Color { return &sa.SSAPrimaryColour }),
+	newSSAColorOverrideTag("2c", func(sa *StyleAttributes) **Color { return &sa.SSASecondaryColour }),
+	newSSAColorOverrideTag("3c", func(sa *StyleAttributes) **Color { return &sa.SSAOutlineColour }),
+	newSSAColorOverrideTag("4c", func(sa *StyleAttributes) **Color { return &sa.SSABackColour }),
+}
+
+// SSA override tags applying to the whole item, in the order they're written
+var ssaItemOverrideTags = []ssaOverrideTag{
+	{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if sa.SSAAlignment != nil {
+				return strconv.Itoa(*sa.SSAAlignment), true
+			}
+			return "", false
+		},
+		name: "an",
+		parse: func(sa *StyleAttributes, v string) error {
+			i, err := strconv.Atoi(v)
+			if err != nil || i < 1 || i > 9 {
+				return fmt.Errorf("astisub: invalid alignment %s", v)
+			}
+			sa.SSAAlignment = astikit.IntPtr(i)
+			return nil
+		},
+	},
+	{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if sa.SSAPosition != nil {
+				return formatSSAOverrideTagArguments(sa.SSAPosition.X, sa.SSAPosition.Y), true
+			}
+			return "", false
+		},
+		name: "pos",
+		parse: func(sa *StyleAttributes, v string) error {
+			fs, err := parseSSAOverrideTagArguments(v, 2)
+			if err != nil {
+				return err
+			}
+			sa.SSAPosition = &SSAPosition{X: fs[0], Y: fs[1]}
+			return nil
+		},
+	},
+	{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if m := sa.SSAMove; m != nil {
+				if m.Start == 0 && m.End == 0 {
+					return formatSSAOverrideTagArguments(m.X1, m.Y1, m.X2, m.Y2), true
+				}
+				return formatSSAOverrideTagArguments(m.X1, m.Y1, m.X2, m.Y2, float64(m.Start.Milliseconds()), float64(m.End.Milliseconds())), true
+			}
+			return "", false
+		},
+		name: "move",
+		parse: func(sa *StyleAttributes, v string) error {
+			fs, err := parseSSAOverrideTagArguments(v, 4, 6)
+			if err != nil {
+				return err
+			}
+			sa.SSAMove = &SSAMove{X1: fs[0], X2: fs[2], Y1: fs[1], Y2: fs[3]}
+			if len(fs) == 6 {
+				sa.SSAMove.Start = time.Duration(fs[4]) * time.Millisecond
+				sa.SSAMove.End = time.Duration(fs[5]) * time.Millisecond
+			}
+			return nil
+		},
+	},
+	{
+		format: func(sa *StyleAttributes) (string, bool) {
+			if sa.SSAFade != nil {
+				return formatSSAOverrideTagArguments(float64(sa.SSAFade.In.Milliseconds()), float64(sa.SSAFade.Out.Milliseconds())), true
+			}
+			return "", false
+		},
+		name: "fad",
+		parse: func(sa *StyleAttributes, v string) error {
+			fs, err := parseSSAOverrideTagArguments(v, 2)
+			if err != nil {
+				return err
+			}
+			sa.SSAFade = &SSAFade{In: time.Duration(fs[0]) * time.Millisecond, Out: time.Duration(fs[1]) * time.Millisecond}
+			return nil
+		},
+	},
+}
+
+// SSA karaoke effects
+var ssaKaraokeEffects = map[string]string{
+	"K":  "kf",
+	"k":  "k",
+	"kf": "kf",
+	"ko": "ko",
+}
+
+// ssaOverrideTagAliases maps override tag aliases to their canonical name
+var ssaOverrideTagAliases = map[string]string{
+	"1c": "c",
+	"fr": "frz",
+}
+
+// ssaOverrideTagNames lists override tag names, longest first so that the tag name can be matched by prefix
+var ssaOverrideTagNames = func() (ns []string) {
+	for _, ts := range [][]ssaOverrideTag{ssaInlineOverrideTags, ssaItemOverrideTags} {
+		for _, t := range ts {
+			ns = append(ns, t.name)
+		}
+	}
+	for n := range ssaKaraokeEffects {
+		ns = append(ns, n)
+	}
+	for n := range ssaOverrideTagAliases {
+		ns = append(ns, n)
+	}
+	ns = append(ns, "a", "r")
+	sort.Slice(ns, func(i, j int) bool {
+		if len(ns[i]) == len(ns[j]) {
+			return ns[i] < ns[j]
+		}
+		return len(ns[i]) > len(ns[j])
+	})
+	return
+}()
+
+// splitSSAOverrideBlock splits an override block content into a prefix that is not a tag (e.g. a comment) and
+// tags without their leading backslash. Backslashes between parenthesis (e.g. in \t(...)) don't start a new tag.
+func splitSSAOverrideBlock(i string) (prefix string, tags []string) {
+	var depth int
+	var current *strings.Builder
+	for _, c := range i {
+		switch {
+		case c == '\\' && depth == 0:
+			if current != nil {
+				tags = append(tags, current.String())
+			}
+			current = &strings.Builder{}
+			continue
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		}
+		if current != nil {
+			current.WriteRune(c)
+		} else {
+			prefix += string(c)
+		}
+	}
+	if current != nil {
+		tags = append(tags, current.String())
+	}
 	return
 }
 
+// ssaOverrideState represents the override tags state of an SSA event
+type ssaOverrideState struct {
+	effect  string
+	inline  StyleAttributes
+	karaoke *SSAKaraoke
+	set     bool
+}
+
+// parseBlock parses an override block content. Item override tags are set in the item style attributes.
+func (s *ssaOverrideState) parseBlock(i string, item *StyleAttributes) {
+	// Split block
+	prefix, tags := splitSSAOverrideBlock(i)
+	unknown := prefix
+
+	// Loop through tags
+	for _, t := range tags {
+		if !s.parseTag(t, item) {
+			unknown += "\\" + t
+		}
+	}
+
+	// Keep unknown content
+	if unknown != "" {
+		s.effect += "{" + unknown + "}"
+	}
+}
+
+// parseTag parses an override tag and returns whether it has been understood
+func (s *ssaOverrideState) parseTag(t string, item *StyleAttributes) bool {
+	// Get name
+	var name string
+	for _, n := range ssaOverrideTagNames {
+		if strings.HasPrefix(t, n) {
+			name = n
+			break
+		}
+	}
+	v := strings.TrimSpace(t[len(name):])
+	if a, ok := ssaOverrideTagAliases[name]; ok {
+		name = a
+	}
+
+	// Switch on name
+	switch name {
+	case "":
+		return false
+	case "a":
+		// Legacy alignment: 1-3 at the bottom, 5-7 at the top and 9-11 in the middle
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 || i > 11 || i%4 == 0 {
+			return false
+		}
+		n := (i-1)%4 + 1
+		if i > 8 {
+			n += 3
+		} else if i > 4 {
+			n += 6
+		}
+		item.SSAAlignment = astikit.IntPtr(n)
+		return true
+	case "r":
+		// Reset to the style. Resetting to another style is not supported, therefore the tag is kept as well.
+		s.inline = StyleAttributes{}
+		s.set = false
+		return v == ""
+	}
+
+	// Karaoke
+	if e, ok := ssaKaraokeEffects[name]; ok {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return false
+		}
+		s.karaoke = &SSAKaraoke{Duration: time.Duration(i) * 10 * time.Millisecond, Effect: e}
+		return true
+	}
+
+	// Inline tags
+	for _, ot := range ssaInlineOverrideTags {
+		if ot.name == name {
+			if err := ot.parse(&s.inline, v); err != nil {
+				return false
+			}
+			s.set = true
+			return true
+		}
+	}
+
+	// Item tags
+	for _, ot := range ssaItemOverrideTags {
+		if ot.name == name {
+			return ot.parse(item, v) == nil
+		}
+	}
+	return false
+}
+
+// appendLineItem appends the text with the current state to the line. Empty text is only appended at the end of
+// the line and if there are pending unknown tags or karaoke.
+func (s *ssaOverrideState) appendLineItem(l *Line, text string, end bool) {
+	// Nothing to append
+	if text == "" && (!end || (s.effect == "" && s.karaoke == nil)) {
+		return
+	}
+
+	// Create line item
+	li := LineItem{Text: strings.ReplaceAll(text, "\\h", "\u00a0")}
+	if s.set || s.effect != "" || s.karaoke != nil {
+		sa := s.inline
+		sa.SSAEffect = s.effect
+		sa.SSAKaraoke = s.karaoke
+		sa.propagateSSAAttributes()
+		li.InlineStyle = &sa
+	}
+	l.Items = append(l.Items, li)
+
+	// Reset non stateful attributes
+	s.effect = ""
+	s.karaoke = nil
+}
+
 // formatDurationSSA formats an .ssa duration
 func formatDurationSSA(i time.Duration) string {
 	return formatDuration(i, ".", 2)
@@ -1171,6 +1899,16 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		return
 	}
 
+	// SSA styles are derived from the generic style attributes when ssa ones are missing
+	// Font sizes depend on the play resolution
+	s = s.withGenericAttributes()
+	_, y := ssaPlayRes(s.Metadata)
+	for _, sa := range s.styleAttributes() {
+		if sa.SSAFontSize == nil && sa.FontSize != nil {
+			sa.SSAFontSize = astikit.Float64Ptr(math.Round(*sa.FontSize * float64(y) / 100))
+		}
+	}
+
 	// Write Script Info block
 	var si = newSSAScriptInfo(s.Metadata)
 	if _, err = o.Write(si.bytes()); err != nil {
@@ -1178,39 +1916,37 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		return
 	}
 
-	var v4plus = s.Metadata.SSAScriptType == "v4.00+"
+	var v4plus = s.Metadata != nil && s.Metadata.SSAScriptType == "v4.00+"
 
 	// Write Styles block
 	if len(s.Styles) > 0 {
-		// Header
-		var b = []byte("\n[V4 Styles]\n")
-		if v4plus {
-			b = []byte("\n[V4+ Styles]\n")
-		}
-
-		// Format
-		var formatMap = make(map[string]bool)
-		var format = []string{ssaStyleFormatNameName}
-		var styles = make(map[string]*ssaStyle)
-		var styleNames []string
-		for _, s := range s.Styles {
-			var ss = newSSAStyleFromStyle(*s)
-			format = ss.updateFormat(formatMap, format)
-			styles[ss.name] = ss
-			styleNames = append(styleNames, ss.name)
+		if _, err = o.Write(s.ssaStylesBytes(v4plus)); err != nil {
+			err = fmt.Errorf("astisub: writing styles block failed: %w", err)
+			return
 		}
-		b = append(b, []byte("Format: "+strings.Join(format, ", ")+"\n")...)
+	}
 
-		// Styles
-		sort.Strings(styleNames)
-		for _, n := range styleNames {
-			b = append(b, []byte("Style: "+styles[n].string(format)+"\n")...)
+	// Write Fonts and Graphics blocks
+	for _, v := range []struct {
+		header      string
+		sectionName string
+		t           string
+	}{
+		{header: ssaAttachmentHeaderFontName, sectionName: "Fonts", t: AttachmentTypeFont},
+		{header: ssaAttachmentHeaderFileName, sectionName: "Graphics", t: AttachmentTypeGraphic},
+	} {
+		var b []byte
+		for _, a := range s.Attachments {
+			if a.Type == v.t {
+				b = append(b, []byte(v.header+": "+a.Name+"\n")...)
+				b = append(b, ssaAttachmentEncode(a.Data)...)
+			}
 		}
-
-		// Write
-		if _, err = o.Write(b); err != nil {
-			err = fmt.Errorf("astisub: writing styles block failed: %w", err)
-			return
+		if len(b) > 0 {
+			if _, err = o.Write(append([]byte("\n["+v.sectionName+"]\n"), b...)); err != nil {
+				err = fmt.Errorf("astisub: writing %s block failed: %w", strings.ToLower(v.sectionName), err)
+				return
+			}
 		}
 	}
 
@@ -1237,7 +1973,7 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		}
 		var events []*ssaEvent
 		for _, i := range s.Items {
-			events = append(events, newSSAEventFromItem(*i))
+			events = append(events, newSSAEventFromItem(*i, v4plus))
 		}
 		format = append(format, ssaEventFormatNameText)
 		b = append(b, []byte("Format: "+strings.Join(format, ", ")+"\n")...)
@@ -1256,6 +1992,286 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 	return
 }
 
+// ssaStylesBytes returns the styles block
+func (s Subtitles) ssaStylesBytes(v4plus bool) (b []byte) {
+	// Header
+	b = []byte("\n[V4 Styles]\n")
+	if v4plus {
+		b = []byte("\n[V4+ Styles]\n")
+	}
+
+	// Format
+	var formatMap = make(map[string]bool)
+	var format = []string{ssaStyleFormatNameName}
+	var styles = make(map[string]*ssaStyle)
+	var styleNames []string
+	for _, s := range s.Styles {
+		var ss = newSSAStyleFromStyle(*s)
+		format = ss.updateFormat(formatMap, format)
+		styles[ss.name] = ss
+		styleNames = append(styleNames, ss.name)
+	}
+	b = append(b, []byte("Format: "+strings.Join(format, ", ")+"\n")...)
+
+	// Styles
+	sort.Strings(styleNames)
+	for _, n := range styleNames {
+		b = append(b, []byte("Style: "+styles[n].string(format)+"\n")...)
+	}
+	return
+}
+
+// ssaAttachment represents an SSA attachment being parsed
+type ssaAttachment struct {
+	data *strings.Builder
+	name string
+	t    string
+}
+
+// newSSAAttachmentFromHeader returns an attachment if the line is an attachment header
+func newSSAAttachmentFromHeader(line, sectionName string) *ssaAttachment {
+	// Get header
+	var header string
+	switch sectionName {
+	case ssaSectionNameFonts:
+		header = ssaAttachmentHeaderFontName
+	case ssaSectionNameGraphics:
+		header = ssaAttachmentHeaderFileName
+	}
+	if !strings.HasPrefix(strings.ToLower(line), header+":") {
+		return nil
+	}
+
+	// Create attachment
+	a := &ssaAttachment{
+		data: &strings.Builder{},
+		name: strings.TrimSpace(line[len(header)+1:]),
+		t:    AttachmentTypeFont,
+	}
+	if sectionName == ssaSectionNameGraphics {
+		a.t = AttachmentTypeGraphic
+	}
+	return a
+}
+
+// attachment decodes the attachment
+func (a ssaAttachment) attachment() (o *Attachment, err error) {
+	o = &Attachment{
+		Name: a.name,
+		Type: a.t,
+	}
+	if o.Data, err = ssaAttachmentDecode(a.data.String()); err != nil {
+		err = fmt.Errorf("astisub: decoding attachment failed: %w", err)
+		return
+	}
+	return
+}
+
+// ssaAttachmentDecode decodes SSA attachment data
+// Each group of 4 characters holds 3 bytes in 6-bit values to which 33 is added. The last group may be
+// truncated to 2 or 3 characters holding 1 or 2 bytes.
+func ssaAttachmentDecode(i string) (o []byte, err error) {
+	// Check length
+	if len(i)%4 == 1 {
+		err = fmt.Errorf("astisub: invalid length %d", len(i))
+		return
+	}
+
+	// Loop through groups
+	for idx := 0; idx < len(i); idx += 4 {
+		// Get values
+		var v uint32
+		var n int
+		for ; n < 4 && idx+n < len(i); n++ {
+			c := i[idx+n]
+			if c < 33 || c > 96 {
+				err = fmt.Errorf("astisub: invalid character %q", c)
+				return
+			}
+			v |= uint32(c-33) << (18 - 6*n)
+		}
+
+		// Append bytes
+		for b := 0; b < n-1; b++ {
+			o = append(o, byte(v>>(16-8*b)))
+		}
+	}
+	return
+}
+
+// isSSAAttachmentData checks whether the line only contains characters attachments are encoded with
+func isSSAAttachmentData(line string) bool {
+	for _, c := range []byte(line) {
+		if c < 33 || c > 96 {
+			return false
+		}
+	}
+	return true
+}
+
+// ssaAttachmentEncode encodes data to SSA attachment lines
+func ssaAttachmentEncode(i []byte) (o []byte) {
+	// Encode
+	var e []byte
+	for idx := 0; idx < len(i); idx += 3 {
+		// Get value
+		var v uint32
+		var n int
+		for ; n < 3 && idx+n < len(i); n++ {
+			v |= uint32(i[idx+n]) << (16 - 8*n)
+		}
+
+		// Append characters
+		for c := 0; c < n+1; c++ {
+			e = append(e, byte((v>>(18-6*c))&0x3f)+33)
+		}
+	}
+
+	// Split in lines
+	for len(e) > 0 {
+		l := ssaAttachmentLineLength
+		if len(e) < l {
+			l = len(e)
+		}
+		o = append(o, e[:l]...)
+		o = append(o, '\n')
+		e = e[l:]
+	}
+	return
+}
+
+// MissingFonts returns the SSA font names used by styles and line items that are not embedded in the attachments
+func (s Subtitles) MissingFonts() (fs []string) {
+	// Get embedded fonts
+	var embedded = make(map[string]bool)
+	for _, a := range s.Attachments {
+		if a.Type != AttachmentTypeFont {
+			continue
+		}
+		for _, n := range ssaFontNames(a) {
+			embedded[strings.ToLower(n)] = true
+		}
+	}
+
+	// Add font
+	var processed = make(map[string]bool)
+	add := func(sa *StyleAttributes) {
+		if sa == nil || sa.SSAFontName == "" {
+			return
+		}
+
+		// Vertical fonts are prefixed with "@"
+		n := strings.TrimPrefix(sa.SSAFontName, "@")
+		k := strings.ToLower(n)
+		if processed[k] {
+			return
+		}
+		processed[k] = true
+		if !embedded[k] {
+			fs = append(fs, n)
+		}
+	}
+
+	// Loop through styles
+	for _, st := range s.Styles {
+		add(st.InlineStyle)
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		for _, l := range i.Lines {
+			for _, li := range l.Items {
+				add(li.InlineStyle)
+			}
+		}
+	}
+
+	// Order
+	sort.Strings(fs)
+	return
+}
+
+// ssaFontNames returns the font names of a font attachment. Names are read from the font file and, in case
+// it fails, deduced from the attachment name which usually follows the "name_[B][I]encoding.ext" pattern.
+func ssaFontNames(a *Attachment) (ns []string) {
+	// Read the font file
+	ns = sfntNames(a.Data)
+
+	// Deduce from the attachment name
+	n := strings.TrimRightFunc(strings.TrimSuffix(a.Name, filepath.Ext(a.Name)), unicode.IsDigit)
+	for _, suffix := range []string{"_BI", "_B", "_I", "_"} {
+		if strings.HasSuffix(n, suffix) {
+			n = strings.TrimSuffix(n, suffix)
+			break
+		}
+	}
+	ns = append(ns, n)
+	return
+}
+
+// sfntNames returns the family and full names of a TrueType or OpenType font
+// https://docs.microsoft.com/en-us/typography/opentype/spec/name
+func sfntNames(i []byte) (ns []string) {
+	// Find the name table
+	if len(i) < 12 {
+		return
+	}
+	var table []byte
+	for idx, numTables := 0, int(binary.BigEndian.Uint16(i[4:])); idx < numTables; idx++ {
+		r := 12 + idx*16
+		if r+16 > len(i) {
+			return
+		}
+		if string(i[r:r+4]) != "name" {
+			continue
+		}
+		offset, length := int(binary.BigEndian.Uint32(i[r+8:])), int(binary.BigEndian.Uint32(i[r+12:]))
+		if offset+length > len(i) {
+			return
+		}
+		table = i[offset : offset+length]
+		break
+	}
+	if len(table) < 6 {
+		return
+	}
+
+	// Loop through name records
+	count, stringOffset := int(binary.BigEndian.Uint16(table[2:])), int(binary.BigEndian.Uint16(table[4:]))
+	for idx := 0; idx < count; idx++ {
+		r := 6 + idx*12
+		if r+12 > len(table) {
+			return
+		}
+
+		// Only family (1) and full (4) names are relevant
+		if id := binary.BigEndian.Uint16(table[r+6:]); id != 1 && id != 4 {
+			continue
+		}
+
+		// Get value
+		length, offset := int(binary.BigEndian.Uint16(table[r+8:])), stringOffset+int(binary.BigEndian.Uint16(table[r+10:]))
+		if offset+length > len(table) {
+			continue
+		}
+		v := table[offset : offset+length]
+
+		// Decode value
+		switch binary.BigEndian.Uint16(table[r:]) {
+		case 0, 3:
+			// UTF-16BE
+			var us []uint16
+			for idx := 0; idx+1 < len(v); idx += 2 {
+				us = append(us, binary.BigEndian.Uint16(v[idx:]))
+			}
+			ns = append(ns, string(utf16.Decode(us)))
+		case 1:
+			ns = append(ns, string(v))
+		}
+	}
+	return
+}
+
 // SSAOptions
 type SSAOptions struct {
 	OnUnknownSectionName func(name string)
@@ -3,11 +3,14 @@ package astisub_test
 import (
 	"bytes"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func assertSSAStyle(t *testing.T, e, a astisub.Style) {
@@ -84,7 +87,10 @@ func TestSSA(t *testing.T) {
 	// Items
 	assertSSAStyleAttributes(t, astisub.StyleAttributes{SSAEffect: "test", SSAMarked: astikit.BoolPtr(false), SSAMarginLeft: astikit.IntPtr(1234), SSAMarginRight: astikit.IntPtr(2345), SSAMarginVertical: astikit.IntPtr(3456)}, *s.Items[0].InlineStyle)
 	assert.Equal(t, s.Styles["1"], s.Items[0].Style)
-	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{SSAEffect: "{\\pos(400,570)}"}, Text: "(deep rumbling)"}}, VoiceName: "Cher"}}, s.Items[0].Lines)
+	assert.Equal(t, &astisub.SSAPosition{X: 400, Y: 570}, s.Items[0].InlineStyle.SSAPosition)
+	assert.Equal(t, &astisub.Percentages{Horizontal: 50, Vertical: 95}, s.Items[0].InlineStyle.Origin)
+	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{Speaker: s.Speakers["Cher"], Text: "(deep rumbling)"}}, VoiceName: "Cher"}}, s.Items[0].Lines)
+	assert.Equal(t, &astisub.Speaker{ID: "Cher", Name: "Cher"}, s.Speakers["Cher"])
 	assert.Equal(t, s.Styles["2"], s.Items[1].Style)
 	assert.Equal(t, s.Styles["3"], s.Items[2].Style)
 	assert.Equal(t, s.Styles["1"], s.Items[3].Style)
@@ -128,9 +134,167 @@ Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
 Dialogue: Marked=0,0:01:39.00,0:01:41.04,,Cher,1234,2345,3456,test,First item{\pos(400,570)}Second item`)))
 	assert.NoError(t, err)
 	assert.Len(t, s.Items[0].Lines[0].Items, 2)
-	assert.Equal(t, astisub.LineItem{Text: "First item"}, s.Items[0].Lines[0].Items[0])
-	assert.Equal(t, astisub.LineItem{
-		InlineStyle: &astisub.StyleAttributes{SSAEffect: "{\\pos(400,570)}"},
-		Text:        "Second item",
-	}, s.Items[0].Lines[0].Items[1])
+	assert.Equal(t, astisub.LineItem{Speaker: s.Speakers["Cher"], Text: "First item"}, s.Items[0].Lines[0].Items[0])
+	assert.Equal(t, astisub.LineItem{Speaker: s.Speakers["Cher"], Text: "Second item"}, s.Items[0].Lines[0].Items[1])
+	assert.Equal(t, &astisub.SSAPosition{X: 400, Y: 570}, s.Items[0].InlineStyle.SSAPosition)
+}
+
+func TestSSAOverrideTags(t *testing.T) {
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Script Info]
+ScriptType: v4.00+
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,,,0,0,0,,{\an8\move(10,20,30,40,100,200)\fad(300,400)}{\b1\c&H0000FF&}Bold red {\i1\blur2}italic\Nsecond{\r}\hline
+Dialogue: 0,0:00:03.00,0:00:04.00,,,0,0,0,,{\k50}Ka{\kf25}ra{\ko10}o{\a10}`)))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+
+	// Item tags
+	i := s.Items[0]
+	assert.Equal(t, astikit.IntPtr(8), i.InlineStyle.SSAAlignment)
+	assert.Equal(t, &astisub.SSAMove{End: 200 * time.Millisecond, Start: 100 * time.Millisecond, X1: 10, X2: 30, Y1: 20, Y2: 40}, i.InlineStyle.SSAMove)
+	assert.Equal(t, &astisub.SSAFade{In: 300 * time.Millisecond, Out: 400 * time.Millisecond}, i.InlineStyle.SSAFade)
+	assert.Equal(t, &astisub.JustificationCentered, i.InlineStyle.TextAlign)
+	assert.Equal(t, &astisub.VerticalAlignmentTop, i.InlineStyle.VerticalAlign)
+
+	// Inline tags
+	require.Len(t, i.Lines, 2)
+	require.Len(t, i.Lines[0].Items, 2)
+	assert.Equal(t, "Bold red ", i.Lines[0].Items[0].Text)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[0].Items[0].InlineStyle.SSABold)
+	assert.Equal(t, &astisub.Color{Red: 255}, i.Lines[0].Items[0].InlineStyle.SSAPrimaryColour)
+	assert.Equal(t, astisub.ColorRed, i.Lines[0].Items[0].InlineStyle.Color)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[0].Items[0].InlineStyle.Bold)
+	assert.Nil(t, i.Lines[0].Items[0].InlineStyle.WebVTTTags)
+	assert.Equal(t, "italic", i.Lines[0].Items[1].Text)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[0].Items[1].InlineStyle.SSABold)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[0].Items[1].InlineStyle.SSAItalic)
+	assert.Equal(t, "{\\blur2}", i.Lines[0].Items[1].InlineStyle.SSAEffect)
+	require.Len(t, i.Lines[1].Items, 2)
+	assert.Equal(t, "second", i.Lines[1].Items[0].Text)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[1].Items[0].InlineStyle.SSABold)
+	assert.Equal(t, astikit.BoolPtr(true), i.Lines[1].Items[0].InlineStyle.SSAItalic)
+	assert.Equal(t, astisub.LineItem{Text: "\u00a0line"}, i.Lines[1].Items[1])
+
+	// Karaoke
+	i = s.Items[1]
+	require.Len(t, i.Lines[0].Items, 3)
+	assert.Equal(t, &astisub.SSAKaraoke{Duration: 500 * time.Millisecond, Effect: "k"}, i.Lines[0].Items[0].InlineStyle.SSAKaraoke)
+	assert.Equal(t, &astisub.SSAKaraoke{Duration: 250 * time.Millisecond, Effect: "kf"}, i.Lines[0].Items[1].InlineStyle.SSAKaraoke)
+	assert.Equal(t, &astisub.SSAKaraoke{Duration: 100 * time.Millisecond, Effect: "ko"}, i.Lines[0].Items[2].InlineStyle.SSAKaraoke)
+	assert.Equal(t, astikit.IntPtr(5), i.InlineStyle.SSAAlignment)
+
+	// Write
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), "Dialogue: 0,00:00:01.00,00:00:02.00,,,0,0,0,,{\\an8\\move(10,20,30,40,100,200)\\fad(300,400)\\b1\\c&H0000FF&}Bold red {\\i1}{\\blur2}italic\\nsecond{\\r}\\hline\n")
+	assert.Contains(t, w.String(), "Dialogue: 0,00:00:03.00,00:00:04.00,,,0,0,0,,{\\an5\\k50}Ka{\\kf25}ra{\\ko10}o\n")
+}
+
+func TestSSAKaraoke(t *testing.T) {
+	// SSA to webvtt
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Script Info]
+ScriptType: v4.00+
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:03.00,,,0,0,0,,{\k50}Twin{\kf25}kle{\ko100}star`)))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines[0].Items, 3)
+	assert.Equal(t, time.Duration(0), s.Items[0].Lines[0].Items[0].StartAt)
+	assert.Equal(t, 1500*time.Millisecond, s.Items[0].Lines[0].Items[1].StartAt)
+	assert.Equal(t, 1750*time.Millisecond, s.Items[0].Lines[0].Items[2].StartAt)
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTT(w))
+	assert.Contains(t, w.String(), "Twin<00:00:01.500>kle<00:00:01.750>star\n")
+
+	// SSA to LRC and back
+	w = &bytes.Buffer{}
+	require.NoError(t, s.WriteToLRC(w))
+	assert.Equal(t, "[00:01.00]Twin<00:01.50>kle<00:01.75>star\n[00:03.00]\n", w.String())
+	s2, err := astisub.ReadFromLRC(w)
+	require.NoError(t, err)
+	s2.Metadata = &astisub.Metadata{SSAScriptType: "v4.00+"}
+	w = &bytes.Buffer{}
+	require.NoError(t, s2.WriteToSSA(w))
+	assert.Contains(t, w.String(), ",{\\k50}Twin{\\k25}kle{\\k125}star\n")
+
+	// Webvtt to SSA
+	s, err = astisub.ReadFromWebVTT(bytes.NewReader([]byte(`WEBVTT
+
+00:00:01.000 --> 00:00:03.000
+Twinkle <00:00:01.500>twinkle little <00:00:02.250>star`)))
+	require.NoError(t, err)
+	s.Metadata = &astisub.Metadata{SSAScriptType: "v4.00+"}
+	w = &bytes.Buffer{}
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), ",{\\k50}Twinkle {\\k75}twinkle little {\\k75}star\n")
+}
+
+func TestSSAAttachments(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Script Info]
+ScriptType: v4.00+
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize
+Style: 1,Arial,20
+Style: 2,test,20
+
+[Fonts]
+fontname: test_B0.ttf
+97*D
+91
+
+[Graphics]
+filename: logo.png
+97*D
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,1,,0,0,0,,{\fnOther}Text`)))
+	require.NoError(t, err)
+	assert.Equal(t, []*astisub.Attachment{
+		{Data: []byte("abca"), Name: "test_B0.ttf", Type: astisub.AttachmentTypeFont},
+		{Data: []byte("abc"), Name: "logo.png", Type: astisub.AttachmentTypeGraphic},
+	}, s.Attachments)
+
+	// Missing fonts
+	assert.Equal(t, []string{"Arial", "Other"}, s.MissingFonts())
+
+	// Font names are read from the font file
+	// Minimal font with a single table "name" holding a single windows family name "Other"
+	font := []byte{0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 'n', 'a', 'm', 'e', 0, 0, 0, 0, 0, 0, 0, 28, 0, 0, 0, 28}
+	font = append(font, 0, 0, 0, 1, 0, 18, 0, 3, 0, 1, 0x04, 0x09, 0, 1, 0, 10, 0, 0)
+	font = append(font, 0, 'O', 0, 't', 0, 'h', 0, 'e', 0, 'r')
+	s2 := *s
+	s2.Attachments = append(s2.Attachments, &astisub.Attachment{Data: font, Name: "font.ttf", Type: astisub.AttachmentTypeFont})
+	assert.Equal(t, []string{"Arial"}, s2.MissingFonts())
+
+	// Write
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), "\n[Fonts]\nfontname: test_B0.ttf\n97*D91\n\n[Graphics]\nfilename: logo.png\n97*D\n\n[Events]\n")
+
+	// Long attachments are split in lines
+	s.Attachments = []*astisub.Attachment{{Data: bytes.Repeat([]byte("abc"), 21), Name: "a.ttf", Type: astisub.AttachmentTypeFont}}
+	w.Reset()
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), "\nfontname: a.ttf\n"+strings.Repeat("97*D", 20)+"\n97*D\n")
+	s3, err := astisub.ReadFromSSA(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, s.Attachments, s3.Attachments)
+
+	// Encoded data looking like a section name doesn't end the attachment
+	font = make([]byte, 90)
+	font[0], font[59] = 0xe8, 0x3c
+	s.Attachments = []*astisub.Attachment{{Data: font, Name: "a.ttf", Type: astisub.AttachmentTypeFont}}
+	w.Reset()
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), "\n["+strings.Repeat("!", 78)+"]\n")
+	s3, err = astisub.ReadFromSSA(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, s.Attachments, s3.Attachments)
 }
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -131,8 +130,8 @@ const (
 
 // STL framerate mapping
 var stlFramerateMapping = astikit.NewBiMap().
-	Set("STL25.01", 25).
-	Set("STL30.01", 30)
+	Set("STL25.01", Framerate25).
+	Set("STL30.01", Framerate30)
 
 // STL justification code
 const (
@@ -272,9 +271,9 @@ func ReadFromSTL(i io.Reader, opts STLOptions) (o *Subtitles, err error) {
 
 		// Create item
 		var i = &Item{
-			EndAt:       t.timecodeOut - o.Metadata.STLTimecodeStartOfProgramme,
+			EndAt:       t.timecodeOut - o.Metadata.STLTimecodeStartOfProgramme.Duration(),
 			InlineStyle: &styleAttributes,
-			StartAt:     t.timecodeIn - o.Metadata.STLTimecodeStartOfProgramme,
+			StartAt:     t.timecodeIn - o.Metadata.STLTimecodeStartOfProgramme.Duration(),
 		}
 
 		// Loop through rows
@@ -324,7 +323,7 @@ type gsiBlock struct {
 	displayStandardCode                              string
 	editorContactDetails                             string
 	editorName                                       string
-	framerate                                        int
+	framerate                                        Framerate
 	languageCode                                     string
 	maximumNumberOfDisplayableCharactersInAnyTextRow int
 	maximumNumberOfDisplayableRows                   int
@@ -335,7 +334,7 @@ type gsiBlock struct {
 	revisionNumber                                   int
 	subtitleListReferenceCode                        string
 	timecodeFirstInCue                               time.Duration
-	timecodeStartOfProgramme                         time.Duration
+	timecodeStartOfProgramme                         Timecode
 	timecodeStatus                                   string
 	totalNumberOfDisks                               int
 	totalNumberOfSubtitleGroups                      int
@@ -358,14 +357,14 @@ func newGSIBlock(s Subtitles) (g *gsiBlock) {
 		creationDate:             Now(),
 		diskSequenceNumber:       1,
 		displayStandardCode:      stlDisplayStandardCodeLevel1Teletext,
-		framerate:                25,
+		framerate:                Framerate25,
 		languageCode:             stlLanguageCodeFrench,
 		maximumNumberOfDisplayableCharactersInAnyTextRow: 40,
 		maximumNumberOfDisplayableRows:                   23,
 		revisionDate:                                     Now(),
 		subtitleListReferenceCode:                        "",
 		timecodeStatus:                                   stlTimecodeStatusIntendedForUse,
-		timecodeStartOfProgramme:                         0,
+		timecodeStartOfProgramme:                         Timecode{Framerate: Framerate25},
 		totalNumberOfDisks:                               1,
 		totalNumberOfSubtitleGroups:                      1,
 		totalNumberOfSubtitles:                           len(s.Items),
@@ -381,7 +380,10 @@ func newGSIBlock(s Subtitles) (g *gsiBlock) {
 		g.displayStandardCode = s.Metadata.STLDisplayStandardCode
 		g.editorContactDetails = s.Metadata.STLEditorContactDetails
 		g.editorName = s.Metadata.STLEditorName
-		g.framerate = s.Metadata.Framerate
+		// Timecodes are written at the default framerate when the framerate has no disk format code
+		if _, ok := stlFramerateMapping.GetInverse(s.Metadata.Framerate); ok {
+			g.framerate = s.Metadata.Framerate
+		}
 		if v, ok := stlLanguageMapping.GetInverse(s.Metadata.Language); ok {
 			g.languageCode = v.(string)
 		}
@@ -399,7 +401,9 @@ func newGSIBlock(s Subtitles) (g *gsiBlock) {
 		}
 		g.revisionNumber = s.Metadata.STLRevisionNumber
 		g.subtitleListReferenceCode = s.Metadata.STLSubtitleListReferenceCode
-		g.timecodeStartOfProgramme = s.Metadata.STLTimecodeStartOfProgramme
+		if s.Metadata.STLTimecodeStartOfProgramme.Framerate.valid() {
+			g.timecodeStartOfProgramme = s.Metadata.STLTimecodeStartOfProgramme
+		}
 		g.translatedEpisodeTitle = s.Metadata.STLTranslatedEpisodeTitle
 		g.translatedProgramTitle = s.Metadata.STLTranslatedProgramTitle
 		g.translatorContactDetails = s.Metadata.STLTranslatorContactDetails
@@ -438,7 +442,7 @@ func parseGSIBlock(b []byte) (g *gsiBlock, err error) {
 
 	// Framerate
 	if v, ok := stlFramerateMapping.Get(string(b[3:11])); ok {
-		g.framerate = v.(int)
+		g.framerate = v.(Framerate)
 	}
 
 	// Creation date
@@ -507,7 +511,7 @@ func parseGSIBlock(b []byte) (g *gsiBlock, err error) {
 
 	// Timecode start of programme
 	if v := strings.TrimSpace(string(b[256:264])); len(v) > 0 {
-		if g.timecodeStartOfProgramme, err = parseDurationSTL(v, g.framerate); err != nil {
+		if g.timecodeStartOfProgramme, err = parseTimecodeSTL(v, g.framerate); err != nil {
 			err = fmt.Errorf("astisub: parsing of stl duration %s failed: %w", v, err)
 			return
 		}
@@ -552,104 +556,74 @@ func (b gsiBlock) bytes() (o []byte) {
 	o = append(o, astikit.BytesPad([]byte(f), ' ', 8, astikit.PadRight, astikit.PadCut)...)
 	o = append(o, astikit.BytesPad([]byte(b.displayStandardCode), ' ', 1, astikit.PadRight, astikit.PadCut)...) // Display standard code
 	binary.BigEndian.PutUint16(bs, b.characterCodeTableNumber)
-	o = append(o, astikit.BytesPad(bs[:2], ' ', 2, astikit.PadRight, astikit.PadCut)...)                                                             // Character code table number
-	o = append(o, astikit.BytesPad([]byte(b.languageCode), ' ', 2, astikit.PadRight, astikit.PadCut)...)                                             // Language code
-	o = append(o, astikit.BytesPad([]byte(b.originalProgramTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                    // Original program title
-	o = append(o, astikit.BytesPad([]byte(b.originalEpisodeTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                    // Original episode title
-	o = append(o, astikit.BytesPad([]byte(b.translatedProgramTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                  // Translated program title
-	o = append(o, astikit.BytesPad([]byte(b.translatedEpisodeTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                  // Translated episode title
-	o = append(o, astikit.BytesPad([]byte(b.translatorName), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                          // Translator's name
-	o = append(o, astikit.BytesPad([]byte(b.translatorContactDetails), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                // Translator's contact details
-	o = append(o, astikit.BytesPad([]byte(b.subtitleListReferenceCode), ' ', 16, astikit.PadRight, astikit.PadCut)...)                               // Subtitle list reference code
-	o = append(o, astikit.BytesPad([]byte(b.creationDate.Format("060102")), ' ', 6, astikit.PadRight, astikit.PadCut)...)                            // Creation date
-	o = append(o, astikit.BytesPad([]byte(b.revisionDate.Format("060102")), ' ', 6, astikit.PadRight, astikit.PadCut)...)                            // Revision date
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.revisionNumber)), '0', 2, astikit.PadCut)...)                                               // Revision number
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfTTIBlocks)), '0', 5, astikit.PadCut)...)                                       // Total number of TTI blocks
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfSubtitles)), '0', 5, astikit.PadCut)...)                                       // Total number of subtitles
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfSubtitleGroups)), '0', 3, astikit.PadCut)...)                                  // Total number of subtitle groups
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.maximumNumberOfDisplayableCharactersInAnyTextRow)), '0', 2, astikit.PadCut)...)             // Maximum number of displayable characters in any text row
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.maximumNumberOfDisplayableRows)), '0', 2, astikit.PadCut)...)                               // Maximum number of displayable rows
-	o = append(o, astikit.BytesPad([]byte(b.timecodeStatus), ' ', 1, astikit.PadRight, astikit.PadCut)...)                                           // Timecode status
-	o = append(o, astikit.BytesPad([]byte(formatDurationSTL(b.timecodeStartOfProgramme, b.framerate)), ' ', 8, astikit.PadRight, astikit.PadCut)...) // Timecode start of a programme
-	o = append(o, astikit.BytesPad([]byte(formatDurationSTL(b.timecodeFirstInCue, b.framerate)), ' ', 8, astikit.PadRight, astikit.PadCut)...)       // Timecode first in cue
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfDisks)), ' ', 1, astikit.PadRight, astikit.PadCut)...)                         // Total number of disks
-	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.diskSequenceNumber)), ' ', 1, astikit.PadRight, astikit.PadCut)...)                         // Disk sequence number
-	o = append(o, astikit.BytesPad([]byte(b.countryOfOrigin), ' ', 3, astikit.PadRight, astikit.PadCut)...)                                          // Country of origin
-	o = append(o, astikit.BytesPad([]byte(b.publisher), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                               // Publisher
-	o = append(o, astikit.BytesPad([]byte(b.editorName), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                              // Editor's name
-	o = append(o, astikit.BytesPad([]byte(b.editorContactDetails), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                    // Editor's contact details
-	o = append(o, astikit.BytesPad([]byte{}, ' ', 75+576, astikit.PadRight, astikit.PadCut)...)                                                      // Spare bytes + user defined area                                                                                           //                                                                                                                      // Editor's contact details
+	o = append(o, astikit.BytesPad(bs[:2], ' ', 2, astikit.PadRight, astikit.PadCut)...)                                                                        // Character code table number
+	o = append(o, astikit.BytesPad([]byte(b.languageCode), ' ', 2, astikit.PadRight, astikit.PadCut)...)                                                        // Language code
+	o = append(o, astikit.BytesPad([]byte(b.originalProgramTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                               // Original program title
+	o = append(o, astikit.BytesPad([]byte(b.originalEpisodeTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                               // Original episode title
+	o = append(o, astikit.BytesPad([]byte(b.translatedProgramTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                             // Translated program title
+	o = append(o, astikit.BytesPad([]byte(b.translatedEpisodeTitle), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                             // Translated episode title
+	o = append(o, astikit.BytesPad([]byte(b.translatorName), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                                     // Translator's name
+	o = append(o, astikit.BytesPad([]byte(b.translatorContactDetails), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                           // Translator's contact details
+	o = append(o, astikit.BytesPad([]byte(b.subtitleListReferenceCode), ' ', 16, astikit.PadRight, astikit.PadCut)...)                                          // Subtitle list reference code
+	o = append(o, astikit.BytesPad([]byte(b.creationDate.Format("060102")), ' ', 6, astikit.PadRight, astikit.PadCut)...)                                       // Creation date
+	o = append(o, astikit.BytesPad([]byte(b.revisionDate.Format("060102")), ' ', 6, astikit.PadRight, astikit.PadCut)...)                                       // Revision date
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.revisionNumber)), '0', 2, astikit.PadCut)...)                                                          // Revision number
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfTTIBlocks)), '0', 5, astikit.PadCut)...)                                                  // Total number of TTI blocks
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfSubtitles)), '0', 5, astikit.PadCut)...)                                                  // Total number of subtitles
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfSubtitleGroups)), '0', 3, astikit.PadCut)...)                                             // Total number of subtitle groups
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.maximumNumberOfDisplayableCharactersInAnyTextRow)), '0', 2, astikit.PadCut)...)                        // Maximum number of displayable characters in any text row
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.maximumNumberOfDisplayableRows)), '0', 2, astikit.PadCut)...)                                          // Maximum number of displayable rows
+	o = append(o, astikit.BytesPad([]byte(b.timecodeStatus), ' ', 1, astikit.PadRight, astikit.PadCut)...)                                                      // Timecode status
+	o = append(o, astikit.BytesPad([]byte(formatDurationSTL(b.timecodeStartOfProgramme.Duration(), b.framerate)), ' ', 8, astikit.PadRight, astikit.PadCut)...) // Timecode start of a programme
+	o = append(o, astikit.BytesPad([]byte(formatDurationSTL(b.timecodeFirstInCue, b.framerate)), ' ', 8, astikit.PadRight, astikit.PadCut)...)                  // Timecode first in cue
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.totalNumberOfDisks)), ' ', 1, astikit.PadRight, astikit.PadCut)...)                                    // Total number of disks
+	o = append(o, astikit.BytesPad([]byte(strconv.Itoa(b.diskSequenceNumber)), ' ', 1, astikit.PadRight, astikit.PadCut)...)                                    // Disk sequence number
+	o = append(o, astikit.BytesPad([]byte(b.countryOfOrigin), ' ', 3, astikit.PadRight, astikit.PadCut)...)                                                     // Country of origin
+	o = append(o, astikit.BytesPad([]byte(b.publisher), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                                          // Publisher
+	o = append(o, astikit.BytesPad([]byte(b.editorName), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                                         // Editor's name
+	o = append(o, astikit.BytesPad([]byte(b.editorContactDetails), ' ', 32, astikit.PadRight, astikit.PadCut)...)                                               // Editor's contact details
+	o = append(o, astikit.BytesPad([]byte{}, ' ', 75+576, astikit.PadRight, astikit.PadCut)...)                                                                 // Spare bytes + user defined area                                                                                           //                                                                                                                      // Editor's contact details
 	return
 }
 
 // parseDurationSTL parses a STL duration
-func parseDurationSTL(i string, framerate int) (d time.Duration, err error) {
-	// Parse hours
-	var hours, hoursString = 0, i[0:2]
-	if hours, err = strconv.Atoi(hoursString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", hoursString, err)
-		return
-	}
-
-	// Parse minutes
-	var minutes, minutesString = 0, i[2:4]
-	if minutes, err = strconv.Atoi(minutesString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", minutesString, err)
+func parseDurationSTL(i string, framerate Framerate) (d time.Duration, err error) {
+	var t Timecode
+	if t, err = parseTimecodeSTL(i, framerate); err != nil {
 		return
 	}
+	return t.Duration(), nil
+}
 
-	// Parse seconds
-	var seconds, secondsString = 0, i[4:6]
-	if seconds, err = strconv.Atoi(secondsString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", secondsString, err)
+// parseTimecodeSTL parses a STL timecode such as "10000000"
+func parseTimecodeSTL(i string, framerate Framerate) (t Timecode, err error) {
+	// Validate
+	if len(i) < 8 {
+		err = fmt.Errorf("astisub: invalid stl timecode %s", i)
 		return
 	}
 
-	// Parse frames
-	var frames, framesString = 0, i[6:8]
-	if frames, err = strconv.Atoi(framesString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", framesString, err)
-		return
+	// Parse hours, minutes, seconds and frames
+	var cs []int
+	for idx := 0; idx < 8; idx += 2 {
+		var c int
+		if c, err = strconv.Atoi(i[idx : idx+2]); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", i[idx:idx+2], err)
+			return
+		}
+		cs = append(cs, c)
 	}
 
-	// Set duration
-	d = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second + time.Duration(1e9*frames/framerate)*time.Nanosecond
+	// Create timecode
+	// Components are not validated as some files contain frames greater than the framerate
+	t = Timecode{Framerate: framerate, Frames: framerate.timecodeFrames(cs[0], cs[1], cs[2], cs[3], false)}
 	return
 }
 
 // formatDurationSTL formats a STL duration
-func formatDurationSTL(d time.Duration, framerate int) (o string) {
-	// Add hours
-	if d.Hours() < 10 {
-		o += "0"
-	}
-	var delta = int(math.Floor(d.Hours()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Hour
-
-	// Add minutes
-	if d.Minutes() < 10 {
-		o += "0"
-	}
-	delta = int(math.Floor(d.Minutes()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Minute
-
-	// Add seconds
-	if d.Seconds() < 10 {
-		o += "0"
-	}
-	delta = int(math.Floor(d.Seconds()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Second
-
-	// Add frames
-	var frames = int(int(d.Nanoseconds()) * framerate / 1e9)
-	if frames < 10 {
-		o += "0"
-	}
-	o += strconv.Itoa(frames)
-	return
+func formatDurationSTL(d time.Duration, framerate Framerate) string {
+	hours, minutes, seconds, frames := NewTimecodeFromDuration(d, framerate, false).Components()
+	return fmt.Sprintf("%.2d%.2d%.2d%.2d", hours, minutes, seconds, frames)
 }
 
 // ttiBlock represents a TTI block
@@ -737,7 +711,7 @@ func (li LineItem) STLString() string {
 }
 
 // parseTTIBlock parses a TTI block
-func parseTTIBlock(p []byte, framerate int) *ttiBlock {
+func parseTTIBlock(p []byte, framerate Framerate) *ttiBlock {
 	return &ttiBlock{
 		commentFlag:          p[15],
 		cumulativeStatus:     p[4],
@@ -792,31 +766,14 @@ func validateVerticalPosition(vp int, dsc string) byte {
 }
 
 // formatDurationSTLBytes formats a STL duration in bytes
-func formatDurationSTLBytes(d time.Duration, framerate int) (o []byte) {
-	// Add hours
-	var hours = int(math.Floor(d.Hours()))
-	o = append(o, byte(uint8(hours)))
-	d -= time.Duration(hours) * time.Hour
-
-	// Add minutes
-	var minutes = int(math.Floor(d.Minutes()))
-	o = append(o, byte(uint8(minutes)))
-	d -= time.Duration(minutes) * time.Minute
-
-	// Add seconds
-	var seconds = int(math.Floor(d.Seconds()))
-	o = append(o, byte(uint8(seconds)))
-	d -= time.Duration(seconds) * time.Second
-
-	// Add frames
-	var frames = int(int(d.Nanoseconds()) * framerate / 1e9)
-	o = append(o, byte(uint8(frames)))
-	return
+func formatDurationSTLBytes(d time.Duration, framerate Framerate) []byte {
+	hours, minutes, seconds, frames := NewTimecodeFromDuration(d, framerate, false).Components()
+	return []byte{byte(uint8(hours)), byte(uint8(minutes)), byte(uint8(seconds)), byte(uint8(frames))}
 }
 
 // parseDurationSTLBytes parses a STL duration in bytes
-func parseDurationSTLBytes(b []byte, framerate int) time.Duration {
-	return time.Duration(uint8(b[0]))*time.Hour + time.Duration(uint8(b[1]))*time.Minute + time.Duration(uint8(b[2]))*time.Second + time.Duration(1e9*int(uint8(b[3]))/framerate)*time.Nanosecond
+func parseDurationSTLBytes(b []byte, framerate Framerate) time.Duration {
+	return Timecode{Framerate: framerate, Frames: framerate.timecodeFrames(int(uint8(b[0])), int(uint8(b[1])), int(uint8(b[2])), int(uint8(b[3])), false)}.Duration()
 }
 
 type stlCharacterHandler struct {
@@ -918,6 +875,9 @@ func (s Subtitles) WriteToSTL(o io.Writer) (err error) {
 		return
 	}
 
+	// Colors, justifications and positions are derived from the generic style attributes when stl ones are missing
+	s = s.withGenericAttributes()
+
 	// Write GSI block
 	var g = newGSIBlock(s)
 	if _, err = o.Write(g.bytes()); err != nil {
@@ -23,7 +23,7 @@ func TestSTL(t *testing.T) {
 	assertSubtitleItems(t, s)
 	// Metadata
 	assert.Equal(t, &astisub.Metadata{
-		Framerate:       25,
+		Framerate:       astisub.Framerate25,
 		Language:        astisub.LanguageFrench,
 		STLCreationDate: &creationDate,
 		STLMaximumNumberOfDisplayableCharactersInAnyTextRow: astikit.IntPtr(40),
@@ -33,6 +33,7 @@ func TestSTL(t *testing.T) {
 		STLRevisionDate:                                     &revisionDate,
 		STLSubtitleListReferenceCode:                        "12345678",
 		STLCountryOfOrigin:                                  "FRA",
+		STLTimecodeStartOfProgramme:                         astisub.Timecode{Framerate: astisub.Framerate25},
 		Title:                                               "Title test"},
 		s.Metadata)
 
@@ -59,7 +60,7 @@ func TestOPNSTL(t *testing.T) {
 	assert.NoError(t, err)
 	// Metadata
 	assert.Equal(t, &astisub.Metadata{
-		Framerate:              25,
+		Framerate:              astisub.Framerate25,
 		Language:               astisub.LanguageEnglish,
 		STLCountryOfOrigin:     "NOR",
 		STLCreationDate:        &creationDate,
@@ -69,6 +70,7 @@ func TestOPNSTL(t *testing.T) {
 		STLPublisher:                                        "",
 		STLRevisionDate:                                     &revisionDate,
 		STLRevisionNumber:                                   1,
+		STLTimecodeStartOfProgramme:                         astisub.Timecode{Framerate: astisub.Framerate25},
 		Title:                                               ""},
 		s.Metadata)
 
@@ -96,3 +98,17 @@ func TestIgnoreTimecodeStartOfProgramme(t *testing.T) {
 	firstStart := 99 * time.Second
 	assert.Equal(t, firstStart, s.Items[0].StartAt, "first start at 0")
 }
+
+func TestSTLFramerate(t *testing.T) {
+	// Framerates without disk format code are replaced with the default framerate
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{{EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: time.Second}}
+	s.Metadata = &astisub.Metadata{Framerate: astisub.Framerate23976}
+	w := &bytes.Buffer{}
+	assert.NoError(t, s.WriteToSTL(w))
+	s2, err := astisub.ReadFromSTL(w, astisub.STLOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, astisub.Framerate25, s2.Metadata.Framerate)
+	assert.Equal(t, time.Second, s2.Items[0].StartAt)
+	assert.Equal(t, 3*time.Second, s2.Items[0].EndAt)
+}
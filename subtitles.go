@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/asticode/go-astikit"
 )
@@ -55,8 +57,10 @@ var Now = func() time.Time {
 // Options represents open or write options
 type Options struct {
 	Filename string
+	Matroska MatroskaOptions
 	Teletext TeletextOptions
 	STL      STLOptions
+	WebVTT   WebVTTOptions
 }
 
 // Open opens a subtitle reader based on options
@@ -71,6 +75,14 @@ func Open(o Options) (s *Subtitles, err error) {
 
 	// Parse the content
 	switch filepath.Ext(strings.ToLower(o.Filename)) {
+	case ".cmft", ".m4s", ".mp4":
+		s, err = ReadFromMP4(f)
+	case ".lrc":
+		s, err = ReadFromLRC(f)
+	case ".m3u8":
+		s, err = ReadFromHLSPlaylistWithOptions(o.Filename, o.WebVTT)
+	case ".mks", ".mkv", ".webm":
+		s, err = ReadFromMatroska(f, o.Matroska)
 	case ".srt":
 		s, err = ReadFromSRT(f)
 	case ".ssa", ".ass":
@@ -82,7 +94,7 @@ func Open(o Options) (s *Subtitles, err error) {
 	case ".ttml":
 		s, err = ReadFromTTML(f)
 	case ".vtt":
-		s, err = ReadFromWebVTT(f)
+		s, err = ReadFromWebVTTWithOptions(f, o.WebVTT)
 	default:
 		err = ErrInvalidExtension
 	}
@@ -96,17 +108,33 @@ func OpenFile(filename string) (*Subtitles, error) {
 
 // Subtitles represents an ordered list of items with formatting
 type Subtitles struct {
-	Items    []*Item
-	Metadata *Metadata
-	Regions  map[string]*Region
-	Styles   map[string]*Style
+	Attachments []*Attachment
+	Items       []*Item
+	Metadata    *Metadata
+	Regions     map[string]*Region
+	Speakers    map[string]*Speaker
+	Styles      map[string]*Style
+}
+
+// Attachment types
+const (
+	AttachmentTypeFont    = "font"
+	AttachmentTypeGraphic = "graphic"
+)
+
+// Attachment represents a file embedded in the subtitles such as a font or an image
+type Attachment struct {
+	Data []byte
+	Name string
+	Type string
 }
 
 // NewSubtitles creates new subtitles
 func NewSubtitles() *Subtitles {
 	return &Subtitles{
-		Regions: make(map[string]*Region),
-		Styles:  make(map[string]*Style),
+		Regions:  make(map[string]*Region),
+		Speakers: make(map[string]*Speaker),
+		Styles:   make(map[string]*Style),
 	}
 }
 
@@ -120,6 +148,7 @@ type Item struct {
 	Region      *Region
 	StartAt     time.Duration
 	Style       *Style
+	WebVTTID    string // Cue identifier, which is not necessarily a number
 }
 
 // String implements the Stringer interface
@@ -131,6 +160,25 @@ func (i Item) String() string {
 	return strings.Join(os, " - ")
 }
 
+// clone returns a copy of the item whose lines, line items and inline styles can be modified without altering the
+// original ones. Styles, regions and speakers are shared since they belong to the subtitles.
+func (i Item) clone() *Item {
+	c := i
+	c.Comments = append([]string(nil), i.Comments...)
+	c.InlineStyle = i.InlineStyle.clone()
+	c.Lines = nil
+	for _, l := range i.Lines {
+		cl := l
+		cl.Items = nil
+		for _, li := range l.Items {
+			li.InlineStyle = li.InlineStyle.clone()
+			cl.Items = append(cl.Items, li)
+		}
+		c.Lines = append(c.Lines, cl)
+	}
+	return &c
+}
+
 // Color represents a color
 type Color struct {
 	Alpha, Blue, Green, Red uint8
@@ -152,6 +200,14 @@ func newColorFromSSAString(s string, base int) (c *Color, err error) {
 	return
 }
 
+// ttmlString expresses the color as a TTML color, including the opacity if the color is not opaque
+func (c *Color) ttmlString() string {
+	if c.Alpha > 0 {
+		return fmt.Sprintf("#%s%.2x", c.TTMLString(), 255-c.Alpha)
+	}
+	return "#" + c.TTMLString()
+}
+
 // SSAString expresses the color as an SSA string
 func (c *Color) SSAString() string {
 	return fmt.Sprintf("%.8x", uint32(c.Alpha)<<24|uint32(c.Blue)<<16|uint32(c.Green)<<8|uint32(c.Red))
@@ -171,82 +227,162 @@ var (
 	JustificationRight     = Justification(4)
 )
 
+// WritingMode represents a writing mode
+type WritingMode string
+
+// Writing modes
+var (
+	WritingModeLeftRightTopBottom = WritingMode("lrtb")
+	WritingModeRightLeftTopBottom = WritingMode("rltb")
+	WritingModeTopBottomLeftRight = WritingMode("tblr")
+	WritingModeTopBottomRightLeft = WritingMode("tbrl")
+)
+
+// VerticalAlignment represents a vertical alignment
+type VerticalAlignment string
+
+// Vertical alignments
+var (
+	VerticalAlignmentBottom = VerticalAlignment("bottom")
+	VerticalAlignmentCenter = VerticalAlignment("center")
+	VerticalAlignmentTop    = VerticalAlignment("top")
+)
+
+// Percentages represents percentages of the video width and height
+type Percentages struct {
+	Horizontal, Vertical float64
+}
+
+func (p Percentages) String() string {
+	return formatPercentage(p.Horizontal) + " " + formatPercentage(p.Vertical)
+}
+
+func formatPercentage(i float64) string {
+	return strconv.FormatFloat(math.Round(i*100)/100, 'f', -1, 64) + "%"
+}
+
+func parsePercentage(i string) (float64, bool) {
+	i = strings.TrimSpace(i)
+	if !strings.HasSuffix(i, "%") {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(i, "%")), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
 // StyleAttributes represents style attributes
+// Format-neutral attributes are populated by readers based on format specific attributes. Writers use them
+// whenever format specific attributes are not set, which allows converting basic formatting between any formats.
 type StyleAttributes struct {
-	SSAAlignment         *int
-	SSAAlphaLevel        *float64
-	SSAAngle             *float64 // degrees
-	SSABackColour        *Color
-	SSABold              *bool
-	SSABorderStyle       *int
-	SSAEffect            string
-	SSAEncoding          *int
-	SSAFontName          string
-	SSAFontSize          *float64
-	SSAItalic            *bool
-	SSALayer             *int
-	SSAMarginLeft        *int // pixels
-	SSAMarginRight       *int // pixels
-	SSAMarginVertical    *int // pixels
-	SSAMarked            *bool
-	SSAOutline           *float64 // pixels
-	SSAOutlineColour     *Color
-	SSAPrimaryColour     *Color
-	SSAScaleX            *float64 // %
-	SSAScaleY            *float64 // %
-	SSASecondaryColour   *Color
-	SSAShadow            *float64 // pixels
-	SSASpacing           *float64 // pixels
-	SSAStrikeout         *bool
-	SSAUnderline         *bool
-	STLBoxing            *bool
-	STLItalics           *bool
-	STLJustification     *Justification
-	STLPosition          *STLPosition
-	STLUnderline         *bool
-	TeletextColor        *Color
-	TeletextDoubleHeight *bool
-	TeletextDoubleSize   *bool
-	TeletextDoubleWidth  *bool
-	TeletextSpacesAfter  *int
-	TeletextSpacesBefore *int
-	// TODO Use pointers with real types below
-	TTMLBackgroundColor  *string // https://htmlcolorcodes.com/fr/
-	TTMLColor            *string
-	TTMLDirection        *string
-	TTMLDisplay          *string
-	TTMLDisplayAlign     *string
-	TTMLExtent           *string
-	TTMLFontFamily       *string
-	TTMLFontSize         *string
-	TTMLFontStyle        *string
-	TTMLFontWeight       *string
-	TTMLLineHeight       *string
-	TTMLOpacity          *string
-	TTMLOrigin           *string
-	TTMLOverflow         *string
-	TTMLPadding          *string
-	TTMLShowBackground   *string
-	TTMLTextAlign        *string
-	TTMLTextDecoration   *string
-	TTMLTextOutline      *string
-	TTMLUnicodeBidi      *string
-	TTMLVisibility       *string
-	TTMLWrapOption       *string
-	TTMLWritingMode      *string
-	TTMLZIndex           *int
-	WebVTTAlign          string
-	WebVTTLine           string
-	WebVTTLines          int
-	WebVTTPosition       string
-	WebVTTRegionAnchor   string
-	WebVTTScroll         string
-	WebVTTSize           string
-	WebVTTStyles         []string
-	WebVTTTags           []WebVTTTag
-	WebVTTVertical       string
-	WebVTTViewportAnchor string
-	WebVTTWidth          string
+	BackgroundColor         *Color
+	Bold                    *bool
+	Color                   *Color // Alpha is the transparency: 0 is opaque
+	Extent                  *Percentages
+	FontFamily              string
+	FontSize                *float64 // % of the video height
+	Italic                  *bool
+	Lang                    string // BCP 47 language tag
+	Origin                  *Percentages
+	ShadowColor             *Color
+	ShadowOffset            *float64 // pixels
+	Strikeout               *bool
+	TextAlign               *Justification
+	Underline               *bool
+	VerticalAlign           *VerticalAlignment
+	WritingMode             *WritingMode
+	SRTBold                 *bool
+	SRTColor                *Color
+	SRTFontFace             string
+	SRTItalics              *bool
+	SRTPosition             *int // numpad position of {\anN} tags
+	SRTUnderline            *bool
+	SRTX1                   *int // pixels
+	SRTX2                   *int // pixels
+	SRTY1                   *int // pixels
+	SRTY2                   *int // pixels
+	SSAAlignment            *int
+	SSAAlphaLevel           *float64
+	SSAAngle                *float64 // degrees
+	SSABackColour           *Color
+	SSABold                 *bool
+	SSABorderStyle          *int
+	SSAEffect               string
+	SSAEncoding             *int
+	SSAFade                 *SSAFade
+	SSAFontName             string
+	SSAFontSize             *float64
+	SSAItalic               *bool
+	SSAKaraoke              *SSAKaraoke
+	SSALayer                *int
+	SSAMarginLeft           *int // pixels
+	SSAMarginRight          *int // pixels
+	SSAMarginVertical       *int // pixels
+	SSAMarked               *bool
+	SSAMove                 *SSAMove
+	SSAOutline              *float64 // pixels
+	SSAOutlineColour        *Color
+	SSAPosition             *SSAPosition
+	SSAPrimaryColour        *Color
+	SSAScaleX               *float64 // %
+	SSAScaleY               *float64 // %
+	SSASecondaryColour      *Color
+	SSAShadow               *float64 // pixels
+	SSASpacing              *float64 // pixels
+	SSAStrikeout            *bool
+	SSAUnderline            *bool
+	STLBoxing               *bool
+	STLItalics              *bool
+	STLJustification        *Justification
+	STLPosition             *STLPosition
+	STLUnderline            *bool
+	TeletextBackgroundColor *Color
+	TeletextColor           *Color
+	TeletextDoubleHeight    *bool
+	TeletextDoubleSize      *bool
+	TeletextDoubleWidth     *bool
+	TeletextJustification   *Justification
+	TeletextPosition        *TeletextPosition
+	TeletextSpacesAfter     *int
+	TeletextSpacesBefore    *int
+	TTMLBackgroundColor     *Color
+	TTMLColor               *Color
+	TTMLDirection           *string
+	TTMLDisplay             *string
+	TTMLDisplayAlign        *string
+	TTMLExtent              *TTMLLengthPair
+	TTMLFontFamily          *string
+	TTMLFontSize            *TTMLLengthPair
+	TTMLFontStyle           *string
+	TTMLFontWeight          *string
+	TTMLLineHeight          *TTMLLength
+	TTMLOpacity             *float64
+	TTMLOrigin              *TTMLLengthPair
+	TTMLOverflow            *string
+	TTMLPadding             *string
+	TTMLShowBackground      *string
+	TTMLTextAlign           *string
+	TTMLTextDecoration      *string
+	TTMLTextOutline         *string
+	TTMLUnicodeBidi         *string
+	TTMLVisibility          *string
+	TTMLWrapOption          *string
+	TTMLWritingMode         *string
+	TTMLZIndex              *int
+	WebVTTAlign             string
+	WebVTTLine              string
+	WebVTTLines             int
+	WebVTTPosition          string
+	WebVTTRegionAnchor      string
+	WebVTTScroll            string
+	WebVTTSize              string
+	WebVTTStyles            []string
+	WebVTTTags              []WebVTTTag
+	WebVTTVertical          string
+	WebVTTViewportAnchor    string
+	WebVTTWidth             string
 }
 
 type WebVTTTag struct {
@@ -279,87 +415,686 @@ func (t WebVTTTag) endTag() string {
 	return "</" + t.Name + ">"
 }
 
-func (sa *StyleAttributes) propagateSSAAttributes() {}
+func (sa *StyleAttributes) propagateSRTAttributes() {
+	if sa.SRTBold != nil {
+		sa.Bold = astikit.BoolPtr(*sa.SRTBold)
+	}
+	if sa.SRTItalics != nil {
+		sa.Italic = astikit.BoolPtr(*sa.SRTItalics)
+	}
+	if sa.SRTUnderline != nil {
+		sa.Underline = astikit.BoolPtr(*sa.SRTUnderline)
+	}
+	if sa.SRTColor != nil {
+		sa.Color = sa.SRTColor
+	}
+	if sa.SRTFontFace != "" {
+		sa.FontFamily = sa.SRTFontFace
+	}
+	if sa.SRTPosition != nil {
+		sa.propagateNumpadAlignment(*sa.SRTPosition)
+	}
+}
 
-func (sa *StyleAttributes) propagateSTLAttributes() {
-	if sa.STLJustification != nil {
-		switch *sa.STLJustification {
-		case JustificationCentered:
-			// default to middle anyway?
-		case JustificationRight:
-			sa.WebVTTAlign = "right"
+// propagateNumpadAlignment propagates {\anN} alignments which use the numpad layout: 1-3 at the bottom, 4-6 in the
+// middle and 7-9 at the top
+func (sa *StyleAttributes) propagateNumpadAlignment(n int) {
+	if n < 1 || n > 9 {
+		return
+	}
+	var j Justification
+	switch (n - 1) % 3 {
+	case 0:
+		j = JustificationLeft
+	case 1:
+		j = JustificationCentered
+	case 2:
+		j = JustificationRight
+	}
+	sa.TextAlign = &j
+	var v VerticalAlignment
+	switch (n - 1) / 3 {
+	case 0:
+		v = VerticalAlignmentBottom
+	case 1:
+		v = VerticalAlignmentCenter
+	case 2:
+		v = VerticalAlignmentTop
+	}
+	sa.VerticalAlign = &v
+}
+
+// numpadAlignment returns the numpad position matching the format-neutral alignments
+func (sa *StyleAttributes) numpadAlignment() (n int) {
+	n = 2
+	if sa.TextAlign != nil {
+		switch *sa.TextAlign {
 		case JustificationLeft:
-			sa.WebVTTAlign = "left"
+			n = 1
+		case JustificationRight:
+			n = 3
+		}
+	}
+	if sa.VerticalAlign != nil {
+		switch *sa.VerticalAlign {
+		case VerticalAlignmentCenter:
+			n += 3
+		case VerticalAlignmentTop:
+			n += 6
 		}
 	}
-	// converts STL vertical position (row number) to WebVTT line percentage
+	return
+}
+
+// Alignment is not propagated since styles may use legacy values whereas override tags use the numpad layout
+func (sa *StyleAttributes) propagateSSAAttributes() {
+	if sa.SSABold != nil {
+		sa.Bold = astikit.BoolPtr(*sa.SSABold)
+	}
+	if sa.SSAItalic != nil {
+		sa.Italic = astikit.BoolPtr(*sa.SSAItalic)
+	}
+	if sa.SSAUnderline != nil {
+		sa.Underline = astikit.BoolPtr(*sa.SSAUnderline)
+	}
+	if sa.SSAStrikeout != nil {
+		sa.Strikeout = astikit.BoolPtr(*sa.SSAStrikeout)
+	}
+	if sa.SSAPrimaryColour != nil {
+		sa.Color = sa.SSAPrimaryColour
+	}
+	if sa.SSAFontName != "" {
+		sa.FontFamily = sa.SSAFontName
+	}
+	if sa.SSAShadow != nil {
+		sa.ShadowOffset = astikit.Float64Ptr(*sa.SSAShadow)
+	}
+	if sa.SSABackColour != nil {
+		sa.ShadowColor = sa.SSABackColour
+	}
+}
+
+func (sa *StyleAttributes) propagateSTLAttributes() {
+	if sa.STLItalics != nil {
+		sa.Italic = astikit.BoolPtr(*sa.STLItalics)
+	}
+	if sa.STLUnderline != nil {
+		sa.Underline = astikit.BoolPtr(*sa.STLUnderline)
+	}
+	if sa.STLJustification != nil && *sa.STLJustification != JustificationUnchanged {
+		j := *sa.STLJustification
+		sa.TextAlign = &j
+	}
+	// stl rows span the whole width, therefore only the vertical position (row number) is converted
 	if sa.STLPosition != nil && sa.STLPosition.MaxRows > 0 {
 		// in-vision vertical position ranges from 0 to maxrows (maxrows <= 99)
-		sa.WebVTTLine = fmt.Sprintf("%d%%", sa.STLPosition.VerticalPosition*100/sa.STLPosition.MaxRows)
-		// teletext vertical position ranges from 1 to 23; as webvtt line percentage starts
-		// from the top at 0%, substract 1 to the stl position to get a better conversion.
-		// Especially apparent on Shaka player, where a single line at vp 22 would be half
-		// out of bounds at 95% (22*100/23), and fine at 91% (21*100/23)
+		v := sa.STLPosition.VerticalPosition * 100 / sa.STLPosition.MaxRows
+		// teletext vertical position ranges from 1 to 23; as percentages start from the top at 0%, substract 1
+		// to the stl position to get a better conversion. Especially apparent on Shaka player, where a single
+		// line at vp 22 would be half out of bounds at 95% (22*100/23), and fine at 91% (21*100/23)
 		if sa.STLPosition.MaxRows == 23 && sa.STLPosition.VerticalPosition > 0 {
-			sa.WebVTTLine = fmt.Sprintf("%d%%", (sa.STLPosition.VerticalPosition-1)*100/sa.STLPosition.MaxRows)
+			v = (sa.STLPosition.VerticalPosition - 1) * 100 / sa.STLPosition.MaxRows
 		}
+		sa.Origin = &Percentages{Vertical: float64(v)}
 	}
 }
 
 func (sa *StyleAttributes) propagateTeletextAttributes() {
 	if sa.TeletextColor != nil {
-		sa.TTMLColor = astikit.StrPtr("#" + sa.TeletextColor.TTMLString())
+		sa.Color = sa.TeletextColor
+	}
+	if sa.TeletextBackgroundColor != nil {
+		sa.BackgroundColor = sa.TeletextBackgroundColor
+	}
+	if sa.TeletextJustification != nil && *sa.TeletextJustification != JustificationUnchanged {
+		j := *sa.TeletextJustification
+		sa.TextAlign = &j
+	}
+	// converts teletext rows and columns to percentages of the 24 rows x 40 columns grid
+	// as for stl, substract 1 to the row since percentages start from the top at 0%
+	if p := sa.TeletextPosition; p != nil && p.Row > 0 {
+		sa.Extent = &Percentages{Horizontal: float64(p.Columns) * 100 / teletextColumns, Vertical: float64(p.Rows) * 100 / teletextRows}
+		sa.Origin = &Percentages{Horizontal: float64(p.Column) * 100 / teletextColumns, Vertical: float64(p.Row-1) * 100 / teletextRows}
 	}
 }
 
 // reference for migration: https://w3c.github.io/ttml-webvtt-mapping/
-func (sa *StyleAttributes) propagateTTMLAttributes() {
+func (sa *StyleAttributes) propagateTTMLAttributes(m *Metadata) {
+	if sa.TTMLFontWeight != nil {
+		sa.Bold = astikit.BoolPtr(*sa.TTMLFontWeight == "bold")
+	}
+	if sa.TTMLFontStyle != nil {
+		sa.Italic = astikit.BoolPtr(*sa.TTMLFontStyle == "italic" || *sa.TTMLFontStyle == "oblique")
+	}
+	if sa.TTMLTextDecoration != nil {
+		for _, v := range strings.Fields(*sa.TTMLTextDecoration) {
+			switch v {
+			case "lineThrough":
+				sa.Strikeout = astikit.BoolPtr(true)
+			case "noLineThrough":
+				sa.Strikeout = astikit.BoolPtr(false)
+			case "underline":
+				sa.Underline = astikit.BoolPtr(true)
+			case "noUnderline":
+				sa.Underline = astikit.BoolPtr(false)
+			case "none":
+				sa.Strikeout = astikit.BoolPtr(false)
+				sa.Underline = astikit.BoolPtr(false)
+			}
+		}
+	}
+	if sa.TTMLColor != nil {
+		sa.Color = sa.TTMLColor
+	}
+	if sa.TTMLBackgroundColor != nil {
+		sa.BackgroundColor = sa.TTMLBackgroundColor
+	}
+	if sa.TTMLFontFamily != nil {
+		sa.FontFamily = *sa.TTMLFontFamily
+	}
+	if sa.TTMLFontSize != nil {
+		sa.FontSize = ttmlFontSizePercentage(*sa.TTMLFontSize, m)
+	}
 	if sa.TTMLTextAlign != nil {
-		sa.WebVTTAlign = *sa.TTMLTextAlign
+		var j Justification
+		switch *sa.TTMLTextAlign {
+		case "center":
+			j = JustificationCentered
+		case "left", "start":
+			j = JustificationLeft
+		case "right", "end":
+			j = JustificationRight
+		}
+		if j > 0 {
+			sa.TextAlign = &j
+		}
+	}
+	if sa.TTMLDisplayAlign != nil {
+		var v VerticalAlignment
+		switch *sa.TTMLDisplayAlign {
+		case "after":
+			v = VerticalAlignmentBottom
+		case "before":
+			v = VerticalAlignmentTop
+		case "center":
+			v = VerticalAlignmentCenter
+		}
+		if v != "" {
+			sa.VerticalAlign = &v
+		}
+	}
+	if sa.TTMLOrigin != nil {
+		sa.Origin = sa.TTMLOrigin.percentages(m)
 	}
 	if sa.TTMLExtent != nil {
-		// region settings
-		lineHeight := 5 // assuming height of line as 5.33vh
-		dimensions := strings.Split(*sa.TTMLExtent, " ")
-		if len(dimensions) > 1 {
-			sa.WebVTTWidth = dimensions[0]
-			if height, err := strconv.Atoi(strings.ReplaceAll(dimensions[1], "%", "")); err == nil {
-				sa.WebVTTLines = height / lineHeight
+		sa.Extent = sa.TTMLExtent.percentages(m)
+	}
+	if sa.TTMLWritingMode != nil {
+		var m WritingMode
+		switch *sa.TTMLWritingMode {
+		case "lrtb", "lr":
+			m = WritingModeLeftRightTopBottom
+		case "rltb", "rl":
+			m = WritingModeRightLeftTopBottom
+		case "tblr":
+			m = WritingModeTopBottomLeftRight
+		case "tbrl", "tb":
+			m = WritingModeTopBottomRightLeft
+		}
+		if m != "" {
+			sa.WritingMode = &m
+		}
+	} else if sa.TTMLDirection != nil && *sa.TTMLDirection == "rtl" {
+		m := WritingModeRightLeftTopBottom
+		sa.WritingMode = &m
+	}
+}
+
+func (sa *StyleAttributes) propagateWebVTTAttributes() {
+	for _, t := range sa.WebVTTTags {
+		switch t.Name {
+		case "b":
+			sa.Bold = astikit.BoolPtr(true)
+		case "c":
+			for _, c := range t.Classes {
+				if v, ok := webVTTClassColors[c]; ok {
+					sa.Color = v
+				} else if v, ok := webVTTClassColors[strings.TrimPrefix(c, "bg_")]; ok {
+					sa.BackgroundColor = v
+				}
 			}
-			// cue settings
-			// default TTML WritingMode is lrtb i.e. left to right, top to bottom
-			sa.WebVTTSize = dimensions[1]
-			if sa.TTMLWritingMode != nil && strings.HasPrefix(*sa.TTMLWritingMode, "tb") {
-				sa.WebVTTSize = dimensions[0]
+		case "i":
+			sa.Italic = astikit.BoolPtr(true)
+		case "lang":
+			sa.Lang = t.Annotation
+		case "u":
+			sa.Underline = astikit.BoolPtr(true)
+		}
+	}
+	var j Justification
+	switch sa.WebVTTAlign {
+	case "center", "middle":
+		j = JustificationCentered
+	case "left", "start":
+		j = JustificationLeft
+	case "right", "end":
+		j = JustificationRight
+	}
+	if j > 0 {
+		sa.TextAlign = &j
+	}
+	if h, ok := parsePercentage(sa.WebVTTPosition); ok {
+		if v, ok := parsePercentage(sa.WebVTTLine); ok {
+			sa.Origin = &Percentages{Horizontal: h, Vertical: v}
+		}
+	}
+	var m WritingMode
+	switch sa.WebVTTVertical {
+	case "lr":
+		m = WritingModeTopBottomLeftRight
+	case "rl":
+		m = WritingModeTopBottomRightLeft
+	}
+	if m != "" {
+		sa.WritingMode = &m
+	}
+}
+
+// propagateGenericAttributes sets format specific attributes that are not set yet based on format-neutral
+// attributes
+func (sa *StyleAttributes) propagateGenericAttributes() {
+	if sa.Bold != nil {
+		if sa.SRTBold == nil {
+			sa.SRTBold = astikit.BoolPtr(*sa.Bold)
+		}
+		if sa.SSABold == nil {
+			sa.SSABold = astikit.BoolPtr(*sa.Bold)
+		}
+		if sa.TTMLFontWeight == nil {
+			if *sa.Bold {
+				sa.TTMLFontWeight = astikit.StrPtr("bold")
+			} else {
+				sa.TTMLFontWeight = astikit.StrPtr("normal")
 			}
 		}
 	}
-	if sa.TTMLOrigin != nil {
+	if sa.Italic != nil {
+		if sa.SRTItalics == nil {
+			sa.SRTItalics = astikit.BoolPtr(*sa.Italic)
+		}
+		if sa.SSAItalic == nil {
+			sa.SSAItalic = astikit.BoolPtr(*sa.Italic)
+		}
+		if sa.STLItalics == nil {
+			sa.STLItalics = astikit.BoolPtr(*sa.Italic)
+		}
+		if sa.TTMLFontStyle == nil {
+			if *sa.Italic {
+				sa.TTMLFontStyle = astikit.StrPtr("italic")
+			} else {
+				sa.TTMLFontStyle = astikit.StrPtr("normal")
+			}
+		}
+	}
+	if sa.Underline != nil {
+		if sa.SRTUnderline == nil {
+			sa.SRTUnderline = astikit.BoolPtr(*sa.Underline)
+		}
+		if sa.SSAUnderline == nil {
+			sa.SSAUnderline = astikit.BoolPtr(*sa.Underline)
+		}
+		if sa.STLUnderline == nil {
+			sa.STLUnderline = astikit.BoolPtr(*sa.Underline)
+		}
+	}
+	if sa.Strikeout != nil && sa.SSAStrikeout == nil {
+		sa.SSAStrikeout = astikit.BoolPtr(*sa.Strikeout)
+	}
+	if sa.TTMLTextDecoration == nil {
+		var ds []string
+		if sa.Underline != nil && *sa.Underline {
+			ds = append(ds, "underline")
+		}
+		if sa.Strikeout != nil && *sa.Strikeout {
+			ds = append(ds, "lineThrough")
+		}
+		if len(ds) > 0 {
+			sa.TTMLTextDecoration = astikit.StrPtr(strings.Join(ds, " "))
+		}
+	}
+	if sa.ShadowOffset != nil && sa.SSAShadow == nil {
+		sa.SSAShadow = astikit.Float64Ptr(*sa.ShadowOffset)
+	}
+	if sa.ShadowColor != nil && sa.SSABackColour == nil {
+		sa.SSABackColour = sa.ShadowColor
+	}
+	// webvtt tags are only propagated for styles webvtt is able to express
+	var tags []WebVTTTag
+	for _, v := range []struct {
+		name  string
+		value *bool
+	}{
+		{name: "b", value: sa.Bold},
+		{name: "i", value: sa.Italic},
+		{name: "u", value: sa.Underline},
+	} {
+		if v.value == nil || !*v.value {
+			continue
+		}
+		var found bool
+		for _, t := range sa.WebVTTTags {
+			if t.Name == v.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tags = append(tags, WebVTTTag{Name: v.name})
+		}
+	}
+	if sa.Lang != "" {
+		var found bool
+		for _, t := range sa.WebVTTTags {
+			if t.Name == "lang" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tags = append([]WebVTTTag{{Name: "lang", Annotation: sa.Lang}}, tags...)
+		}
+	}
+	if len(tags) > 0 {
+		// Make sure the original slice is not modified
+		sa.WebVTTTags = append(append([]WebVTTTag{}, sa.WebVTTTags...), tags...)
+	}
+	if sa.Color != nil {
+		if sa.SRTColor == nil {
+			sa.SRTColor = sa.Color
+		}
+		if sa.SSAPrimaryColour == nil {
+			sa.SSAPrimaryColour = sa.Color
+		}
+		if sa.TeletextColor == nil {
+			sa.TeletextColor = sa.Color
+		}
+		if sa.TTMLColor == nil {
+			sa.TTMLColor = sa.Color
+		}
+	}
+	if sa.BackgroundColor != nil {
+		if sa.TeletextBackgroundColor == nil {
+			sa.TeletextBackgroundColor = sa.BackgroundColor
+		}
+		if sa.TTMLBackgroundColor == nil {
+			sa.TTMLBackgroundColor = sa.BackgroundColor
+		}
+	}
+	if sa.FontFamily != "" {
+		if sa.SRTFontFace == "" {
+			sa.SRTFontFace = sa.FontFamily
+		}
+		if sa.SSAFontName == "" {
+			sa.SSAFontName = sa.FontFamily
+		}
+		if sa.TTMLFontFamily == nil {
+			sa.TTMLFontFamily = astikit.StrPtr(sa.FontFamily)
+		}
+	}
+	if sa.TextAlign != nil && *sa.TextAlign != JustificationUnchanged {
+		if sa.STLJustification == nil {
+			j := *sa.TextAlign
+			sa.STLJustification = &j
+		}
+		if sa.TeletextJustification == nil {
+			j := *sa.TextAlign
+			sa.TeletextJustification = &j
+		}
+		if sa.TTMLTextAlign == nil {
+			switch *sa.TextAlign {
+			case JustificationCentered:
+				sa.TTMLTextAlign = astikit.StrPtr("center")
+			case JustificationLeft:
+				sa.TTMLTextAlign = astikit.StrPtr("left")
+			case JustificationRight:
+				sa.TTMLTextAlign = astikit.StrPtr("right")
+			}
+		}
+		// Centered text is the default for webvtt, therefore only left and right alignments are propagated
+		if sa.WebVTTAlign == "" {
+			switch *sa.TextAlign {
+			case JustificationLeft:
+				sa.WebVTTAlign = "left"
+			case JustificationRight:
+				sa.WebVTTAlign = "right"
+			}
+		}
+	}
+	if sa.VerticalAlign != nil && sa.TTMLDisplayAlign == nil {
+		switch *sa.VerticalAlign {
+		case VerticalAlignmentBottom:
+			sa.TTMLDisplayAlign = astikit.StrPtr("after")
+		case VerticalAlignmentCenter:
+			sa.TTMLDisplayAlign = astikit.StrPtr("center")
+		case VerticalAlignmentTop:
+			sa.TTMLDisplayAlign = astikit.StrPtr("before")
+		}
+	}
+	// Bottom centered text is the default for numpad positions
+	if n := sa.numpadAlignment(); n != 2 {
+		if sa.SRTPosition == nil {
+			sa.SRTPosition = astikit.IntPtr(n)
+		}
+		if sa.SSAAlignment == nil {
+			sa.SSAAlignment = astikit.IntPtr(n)
+		}
+	}
+	// webvtt line is measured across the writing direction whereas position and size are measured along it
+	vertical := sa.WritingMode != nil && (*sa.WritingMode == WritingModeTopBottomLeftRight || *sa.WritingMode == WritingModeTopBottomRightLeft)
+	if sa.Origin != nil {
+		if sa.TTMLOrigin == nil {
+			sa.TTMLOrigin = newTTMLPercentagePair(*sa.Origin)
+		}
+		line, position := sa.Origin.Vertical, sa.Origin.Horizontal
+		if vertical {
+			line, position = position, line
+		}
+		if sa.WebVTTLine == "" {
+			sa.WebVTTLine = formatPercentage(line)
+		}
+		// webvtt position is where the text is aligned, which requires the extent unless text is aligned at
+		// the origin
+		if sa.WebVTTPosition == "" {
+			var size *float64
+			if sa.Extent != nil {
+				size = astikit.Float64Ptr(sa.Extent.Horizontal)
+				if vertical {
+					size = astikit.Float64Ptr(sa.Extent.Vertical)
+				}
+			}
+			switch {
+			case sa.TextAlign == nil || *sa.TextAlign == JustificationLeft || *sa.TextAlign == JustificationUnchanged:
+				sa.WebVTTPosition = formatPercentage(position)
+			case size != nil && *sa.TextAlign == JustificationCentered:
+				sa.WebVTTPosition = formatPercentage(position + *size/2)
+			case size != nil && *sa.TextAlign == JustificationRight:
+				sa.WebVTTPosition = formatPercentage(position + *size)
+			}
+		}
 		// region settings
-		sa.WebVTTRegionAnchor = "0%,0%"
-		sa.WebVTTViewportAnchor = strings.ReplaceAll(strings.TrimSpace(*sa.TTMLOrigin), " ", ",")
-		sa.WebVTTScroll = "up"
-		// cue settings
-		coordinates := strings.Split(*sa.TTMLOrigin, " ")
-		if len(coordinates) > 1 {
-			sa.WebVTTLine = coordinates[0]
-			sa.WebVTTPosition = coordinates[1]
-			if sa.TTMLWritingMode != nil && strings.HasPrefix(*sa.TTMLWritingMode, "tb") {
-				sa.WebVTTLine = coordinates[1]
-				sa.WebVTTPosition = coordinates[0]
+		if sa.WebVTTRegionAnchor == "" && sa.WebVTTViewportAnchor == "" {
+			sa.WebVTTRegionAnchor = "0%,0%"
+			sa.WebVTTViewportAnchor = formatPercentage(sa.Origin.Horizontal) + "," + formatPercentage(sa.Origin.Vertical)
+		}
+		if sa.WebVTTScroll == "" {
+			sa.WebVTTScroll = "up"
+		}
+	}
+	if sa.VerticalAlign != nil && sa.WebVTTLine == "" {
+		switch *sa.VerticalAlign {
+		case VerticalAlignmentCenter:
+			sa.WebVTTLine = "50%,center"
+		case VerticalAlignmentTop:
+			sa.WebVTTLine = "0%"
+		}
+	}
+	if sa.Extent != nil {
+		if sa.TTMLExtent == nil {
+			sa.TTMLExtent = newTTMLPercentagePair(*sa.Extent)
+		}
+		if sa.WebVTTSize == "" {
+			sa.WebVTTSize = formatPercentage(sa.Extent.Horizontal)
+			if vertical {
+				sa.WebVTTSize = formatPercentage(sa.Extent.Vertical)
 			}
 		}
+		// region settings
+		if sa.WebVTTWidth == "" {
+			sa.WebVTTWidth = formatPercentage(sa.Extent.Horizontal)
+		}
+		if sa.WebVTTLines == 0 {
+			lineHeight := 5 // assuming height of line as 5.33vh
+			sa.WebVTTLines = int(sa.Extent.Vertical) / lineHeight
+		}
 	}
+	if sa.WritingMode != nil {
+		if sa.TTMLWritingMode == nil {
+			sa.TTMLWritingMode = astikit.StrPtr(string(*sa.WritingMode))
+		}
+		if sa.TTMLDirection == nil && *sa.WritingMode == WritingModeRightLeftTopBottom {
+			sa.TTMLDirection = astikit.StrPtr("rtl")
+		}
+		if sa.WebVTTVertical == "" {
+			switch *sa.WritingMode {
+			case WritingModeTopBottomLeftRight:
+				sa.WebVTTVertical = "lr"
+			case WritingModeTopBottomRightLeft:
+				sa.WebVTTVertical = "rl"
+			}
+		}
+	}
+}
+
+// styleAttributes returns all style attributes of the subtitles
+func (s Subtitles) styleAttributes() (sas []*StyleAttributes) {
+	add := func(sa *StyleAttributes) {
+		if sa != nil {
+			sas = append(sas, sa)
+		}
+	}
+	for _, st := range s.Styles {
+		add(st.InlineStyle)
+	}
+	for _, r := range s.Regions {
+		add(r.InlineStyle)
+	}
+	for _, i := range s.Items {
+		add(i.InlineStyle)
+		for _, l := range i.Lines {
+			for _, li := range l.Items {
+				add(li.InlineStyle)
+			}
+		}
+	}
+	return
 }
 
-func (sa *StyleAttributes) propagateWebVTTAttributes() {}
+// clone returns a copy of the style attributes
+// Attribute values are replaced rather than modified in place, therefore they are shared.
+func (sa *StyleAttributes) clone() *StyleAttributes {
+	if sa == nil {
+		return nil
+	}
+	c := *sa
+	return &c
+}
+
+// withGenericAttributes returns a copy of the style attributes where format specific attributes fall back to
+// format-neutral attributes
+func (sa *StyleAttributes) withGenericAttributes() *StyleAttributes {
+	if sa == nil {
+		return nil
+	}
+	c := *sa
+	c.propagateGenericAttributes()
+	return &c
+}
+
+// withGenericAttributes returns a copy of the subtitles where format specific style attributes fall back to
+// format-neutral style attributes. Writers use it so that the input subtitles are not modified.
+func (s Subtitles) withGenericAttributes() Subtitles {
+	// Styles
+	styles := make(map[*Style]*Style)
+	var style func(i *Style) *Style
+	style = func(i *Style) *Style {
+		if i == nil {
+			return nil
+		}
+		if o, ok := styles[i]; ok {
+			return o
+		}
+		o := &Style{ID: i.ID, InlineStyle: i.InlineStyle.withGenericAttributes()}
+		styles[i] = o
+		o.Style = style(i.Style)
+		return o
+	}
+	o := s
+	o.Styles = make(map[string]*Style, len(s.Styles))
+	for k, v := range s.Styles {
+		o.Styles[k] = style(v)
+	}
+
+	// Regions
+	regions := make(map[*Region]*Region)
+	region := func(i *Region) *Region {
+		if i == nil {
+			return nil
+		}
+		if o, ok := regions[i]; ok {
+			return o
+		}
+		o := &Region{ID: i.ID, InlineStyle: i.InlineStyle.withGenericAttributes(), Style: style(i.Style)}
+		regions[i] = o
+		return o
+	}
+	o.Regions = make(map[string]*Region, len(s.Regions))
+	for k, v := range s.Regions {
+		o.Regions[k] = region(v)
+	}
+
+	// Items
+	o.Items = make([]*Item, 0, len(s.Items))
+	for _, v := range s.Items {
+		i := *v
+		i.InlineStyle = v.InlineStyle.withGenericAttributes()
+		i.Region = region(v.Region)
+		i.Style = style(v.Style)
+		i.Lines = make([]Line, 0, len(v.Lines))
+		for _, l := range v.Lines {
+			items := make([]LineItem, 0, len(l.Items))
+			for _, li := range l.Items {
+				li.InlineStyle = li.InlineStyle.withGenericAttributes()
+				li.Style = style(li.Style)
+				items = append(items, li)
+			}
+			l.Items = items
+			i.Lines = append(i.Lines, l)
+		}
+		o.Items = append(o.Items, &i)
+	}
+	return o
+}
 
 // Metadata represents metadata
 // TODO Merge attributes
 type Metadata struct {
 	Comments                                            []string
-	Framerate                                           int
+	Framerate                                           Framerate
 	Language                                            string
+	LRCAlbum                                            string
+	LRCArtist                                           string
+	LRCAuthor                                           string
+	LRCCreator                                          string
 	SSACollisions                                       string
 	SSAOriginalEditing                                  string
 	SSAOriginalScript                                   string
@@ -385,13 +1120,18 @@ type Metadata struct {
 	STLRevisionDate                                     *time.Time
 	STLRevisionNumber                                   int
 	STLSubtitleListReferenceCode                        string
-	STLTimecodeStartOfProgramme                         time.Duration
+	STLTimecodeStartOfProgramme                         Timecode
 	STLTranslatedEpisodeTitle                           string
 	STLTranslatedProgramTitle                           string
 	STLTranslatorContactDetails                         string
 	STLTranslatorName                                   string
+	TeletextLanguage                                    string
+	TeletextType                                        uint8
 	Title                                               string
+	TTMLCellResolution                                  *TTMLCellResolution
 	TTMLCopyright                                       string
+	TTMLExtent                                          *TTMLLengthPair
+	WebVTTKind                                          WebVTTKind
 }
 
 // Region represents a subtitle's region
@@ -416,21 +1156,117 @@ type Line struct {
 
 // String implement the Stringer interface
 func (l Line) String() string {
-	var texts []string
-	for _, i := range l.Items {
-		texts = append(texts, i.Text)
+	var o string
+	for idx, i := range l.Items {
+		if l.needsSpaceBefore(idx) {
+			o += " "
+		}
+		o += i.Text
+	}
+	return o
+}
+
+// needsSpaceBefore checks whether a space needs to be added before the line item at the provided index when joining
+// line items. Karaoke syllables, which have their own start time, are never separated.
+func (l Line) needsSpaceBefore(idx int) bool {
+	if idx <= 0 || idx >= len(l.Items) {
+		return false
+	}
+	if i := l.Items[idx]; i.StartAt > 0 || (i.InlineStyle != nil && i.InlineStyle.SSAKaraoke != nil) {
+		return false
+	}
+	return needsSpaceBetween(l.Items[idx-1].Text, l.Items[idx].Text)
+}
+
+// needsSpaceBetween checks whether a space needs to be added between two consecutive line item texts.
+// Scripts such as Chinese or Japanese don't separate words with spaces, which matters when a sentence has been
+// split into several line items (e.g. ruby annotations).
+func needsSpaceBetween(previous, next string) bool {
+	if previous == "" || next == "" {
+		return true
+	}
+	p, _ := utf8.DecodeLastRuneInString(previous)
+	n, _ := utf8.DecodeRuneInString(next)
+	if unicode.IsSpace(p) || unicode.IsSpace(n) {
+		return false
+	}
+	return !isCJK(p) && !isCJK(n)
+}
+
+// isCJK checks whether the rune belongs to a script that doesn't separate words with spaces
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0x3000 && r <= 0x303f) || // CJK symbols and punctuation
+		(r >= 0xff00 && r <= 0xffef) // Halfwidth and fullwidth forms
+}
+
+// trimSpace removes whitespace at the beginning and at the end of the line as well as line items left empty
+func (l *Line) trimSpace() {
+	for len(l.Items) > 0 {
+		if l.Items[0].Text = strings.TrimLeftFunc(l.Items[0].Text, unicode.IsSpace); l.Items[0].Text != "" {
+			break
+		}
+		l.Items = l.Items[1:]
+	}
+	for len(l.Items) > 0 {
+		idx := len(l.Items) - 1
+		if l.Items[idx].Text = strings.TrimRightFunc(l.Items[idx].Text, unicode.IsSpace); l.Items[idx].Text != "" {
+			break
+		}
+		l.Items = l.Items[:idx]
 	}
-	return strings.Join(texts, " ")
 }
 
 // LineItem represents a formatted line item
 type LineItem struct {
 	InlineStyle *StyleAttributes
+	RubyText    string // Ruby annotation of the text such as a reading aid for Japanese
+	Speaker     *Speaker
 	StartAt     time.Duration
 	Style       *Style
 	Text        string
 }
 
+// Speaker represents a subtitle's speaker such as a webvtt voice, an ssa name or a ttml agent
+type Speaker struct {
+	ID   string
+	Name string
+}
+
+// firstSpeaker returns the speaker of the first line item having one
+func (i Item) firstSpeaker() *Speaker {
+	for _, l := range i.Lines {
+		for _, li := range l.Items {
+			if li.Speaker != nil {
+				return li.Speaker
+			}
+		}
+	}
+	return nil
+}
+
+// registerSpeakers makes line items use the speakers of the registry, unknown speakers being added to it
+func (s *Subtitles) registerSpeakers() {
+	if s.Speakers == nil {
+		s.Speakers = make(map[string]*Speaker)
+	}
+	for _, i := range s.Items {
+		for _, l := range i.Lines {
+			for idx := range l.Items {
+				sp := l.Items[idx].Speaker
+				if sp == nil {
+					continue
+				}
+				if v, ok := s.Speakers[sp.ID]; ok {
+					l.Items[idx].Speaker = v
+				} else {
+					s.Speakers[sp.ID] = sp
+				}
+			}
+		}
+	}
+}
+
 // Add adds a duration to each time boundaries. As in the time package, duration can be negative.
 func (s *Subtitles) Add(d time.Duration) {
 	for idx := 0; idx < len(s.Items); idx++ {
@@ -488,49 +1324,77 @@ func (s *Subtitles) ForceDuration(d time.Duration, addDummyItem bool) {
 	}
 }
 
+// Segment splits subtitles into segments either of the same duration (UNIFIED) or of the specified durations
+// (SPECIFIED). Durations are in seconds. Items overlapping several segments are added to each of them.
 func (s *Subtitles) Segment(segmentationType string, segmentDuration float64, segmentDurations []float64) []*Subtitles {
 	if len(s.Items) == 0 {
 		return nil
 	}
 	s.Order()
-	var noOfSegs int
+
+	// Get segment ends
+	var ends []time.Duration
 	if segmentationType == "SPECIFIED" {
-		noOfSegs = len(segmentDurations)
+		var ds []time.Duration
+		for _, d := range segmentDurations {
+			ds = append(ds, time.Duration(d*float64(time.Second)))
+		}
+		ends = segmentEnds(0, ds, 0)
 	} else {
-		totalDurationSecs := s.Items[len(s.Items)-1].EndAt.Seconds()
-		noOfSegs = int(math.Ceil(totalDurationSecs / segmentDuration))
+		ends = segmentEnds(time.Duration(segmentDuration*float64(time.Second)), nil, s.Duration())
 	}
-	if noOfSegs == 0 {
-		return nil
+
+	// Segment
+	return s.SegmentWithTimeline(*newSegmentTimeline(ends))
+}
+
+// segmentEnds returns the end of each segment. Segments end at the provided durations if any, otherwise every
+// segment has the same duration until the total duration is reached, the last segment being clipped to it.
+func segmentEnds(segmentDuration time.Duration, segmentDurations []time.Duration, total time.Duration) (ends []time.Duration) {
+	var end time.Duration
+	if len(segmentDurations) > 0 {
+		for _, d := range segmentDurations {
+			end += d
+			ends = append(ends, end)
+		}
+		return
 	}
-	var subs []*Subtitles
-	itemIdx := 0
-	end := time.Duration(0)
-	for i := 0; i < noOfSegs; i++ {
-		sub := NewSubtitles()
-		sub.Regions = s.Regions
-		sub.Styles = s.Styles
-		sub.Metadata = s.Metadata
-		if segmentationType == "SPECIFIED" {
-			end = end + time.Duration(segmentDurations[i]*float64(time.Second))
-		} else {
-			end = time.Duration(float64(i+1) * segmentDuration * float64(time.Second))
+	if segmentDuration <= 0 {
+		return
+	}
+	for end < total {
+		if end += segmentDuration; end > total {
+			end = total
 		}
-		if end <= s.Items[itemIdx].StartAt {
-		} else {
-			for itemIdx < len(s.Items) && end > s.Items[itemIdx].StartAt {
-				sub.Items = append(sub.Items, s.Items[itemIdx])
-				if s.Items[itemIdx].EndAt <= end {
-					itemIdx++
-				} else {
-					// handle same cue in multiple segment
-					break
-				}
-			}
+		ends = append(ends, end)
+	}
+	return
+}
+
+// between returns subtitles sharing everything but items with s, items being the ones overlapping [start, end).
+// Items must be ordered.
+func (s Subtitles) between(start, end time.Duration) *Subtitles {
+	return &Subtitles{
+		Attachments: s.Attachments,
+		Items:       s.itemsBetween(start, end),
+		Metadata:    s.Metadata,
+		Regions:     s.Regions,
+		Speakers:    s.Speakers,
+		Styles:      s.Styles,
+	}
+}
+
+// itemsBetween returns items overlapping [start, end). Items must be ordered.
+func (s Subtitles) itemsBetween(start, end time.Duration) (is []*Item) {
+	for _, i := range s.Items {
+		if i.StartAt >= end {
+			break
+		}
+		if i.EndAt > start {
+			is = append(is, i)
 		}
-		subs = append(subs, sub)
 	}
-	return subs
+	return
 }
 
 func (s *Subtitles) ModifyStartTimeCode(offset float64) error {
@@ -628,6 +1492,23 @@ func (s *Subtitles) Merge(i *Subtitles) {
 			s.Styles[style.ID] = style
 		}
 	}
+
+	// Add speakers
+	s.registerSpeakers()
+
+	// Add attachments
+	for _, a := range i.Attachments {
+		var found bool
+		for _, sa := range s.Attachments {
+			if sa.Name == a.Name && sa.Type == a.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.Attachments = append(s.Attachments, a)
+		}
+	}
 }
 
 // Optimize optimizes subtitles
@@ -770,12 +1651,20 @@ func (s Subtitles) Write(dst string) (err error) {
 
 	// Write the content
 	switch filepath.Ext(strings.ToLower(dst)) {
+	case ".lrc":
+		err = s.WriteToLRC(f)
+	case ".mks", ".mkv":
+		err = s.WriteToMatroska(f, MatroskaTrack{})
+	case ".webm":
+		err = s.WriteToMatroska(f, MatroskaTrack{CodecID: MatroskaCodecIDWebMWebVTT})
 	case ".srt":
 		err = s.WriteToSRT(f)
 	case ".ssa", ".ass":
 		err = s.WriteToSSA(f)
 	case ".stl":
 		err = s.WriteToSTL(f)
+	case ".ts":
+		err = s.WriteToTeletext(f, TeletextOptions{})
 	case ".ttml":
 		err = s.WriteToTTML(f)
 	case ".vtt":
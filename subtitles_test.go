@@ -1,9 +1,11 @@
 package astisub_test
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -12,6 +14,8 @@ import (
 func TestLine_Text(t *testing.T) {
 	var l = astisub.Line{Items: []astisub.LineItem{{Text: "1"}, {Text: "2"}, {Text: "3"}}}
 	assert.Equal(t, "1 2 3", l.String())
+	l = astisub.Line{Items: []astisub.LineItem{{Text: "Twin"}, {StartAt: time.Second, Text: "kle"}, {Text: "star"}}}
+	assert.Equal(t, "Twinkle star", l.String())
 }
 
 func assertSubtitleItems(t *testing.T, i *astisub.Subtitles) {
@@ -44,6 +48,14 @@ func mockSubtitles() *astisub.Subtitles {
 	return &astisub.Subtitles{Items: []*astisub.Item{{EndAt: 3 * time.Second, StartAt: time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-1"}}}}}, {EndAt: 7 * time.Second, StartAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-2"}}}}}}}
 }
 
+func mockSubtitlesAt(ds ...time.Duration) *astisub.Subtitles {
+	s := astisub.NewSubtitles()
+	for idx := 0; idx < len(ds); idx += 2 {
+		s.Items = append(s.Items, &astisub.Item{EndAt: ds[idx+1], Index: idx/2 + 1, StartAt: ds[idx]})
+	}
+	return s
+}
+
 func TestSubtitles_Add(t *testing.T) {
 	var s = mockSubtitles()
 	s.Add(time.Second)
@@ -301,3 +313,138 @@ func TestSubtitles_ApplyLinearCorrection(t *testing.T) {
 	require.Equal(t, 11*time.Second, s.Items[2].StartAt)
 	require.Equal(t, 15500*time.Millisecond, s.Items[2].EndAt)
 }
+
+func TestSubtitles_GenericStyleAttributes(t *testing.T) {
+	// Writers use format-neutral attributes
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{{
+		EndAt: 2 * time.Second,
+		InlineStyle: &astisub.StyleAttributes{
+			Origin:    &astisub.Percentages{Horizontal: 10, Vertical: 80},
+			TextAlign: &astisub.JustificationLeft,
+		},
+		Lines: []astisub.Line{{Items: []astisub.LineItem{
+			{InlineStyle: &astisub.StyleAttributes{Bold: astikit.BoolPtr(true), Color: astisub.ColorRed}, Text: "bold"},
+			{InlineStyle: &astisub.StyleAttributes{FontFamily: "Arial", Italic: astikit.BoolPtr(true)}, Text: "italic"},
+		}}},
+		StartAt: time.Second,
+	}}
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSRT(w))
+	assert.Contains(t, w.String(), "{\\an1}<b><font color=\"#ff0000\">bold</font></b> <i><font face=\"Arial\">italic</font></i>\n")
+	w.Reset()
+	require.NoError(t, s.WriteToWebVTT(w))
+	assert.Contains(t, w.String(), "00:00:01.000 --> 00:00:02.000 align:left line:80% position:10%\n<c.red><b>bold</b></c><i>italic</i>\n")
+	w.Reset()
+	s.Metadata = &astisub.Metadata{SSAScriptType: "v4.00+"}
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), ",{\\an1\\b1\\c&H0000FF&}bold {\\r\\i1\\fnArial}italic\n")
+	w.Reset()
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `<span tts:color="red" tts:fontWeight="bold">bold </span>`)
+	assert.Contains(t, w.String(), `tts:origin="10% 80%"`)
+
+	// Input subtitles are not modified
+	assert.Nil(t, s.Items[0].InlineStyle.SRTPosition)
+	assert.Nil(t, s.Items[0].Lines[0].Items[0].InlineStyle.SRTBold)
+
+	// Readers populate format-neutral attributes
+	s, err := astisub.ReadFromSRT(bytes.NewReader([]byte("1\n00:00:01,000 --> 00:00:02,000\n<u>underline</u>\n")))
+	require.NoError(t, err)
+	assert.Equal(t, astikit.BoolPtr(true), s.Items[0].Lines[0].Items[0].InlineStyle.Underline)
+	w.Reset()
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `<span tts:textDecoration="underline">underline</span>`)
+
+	// Readers don't populate other formats' attributes, writers derive them from format-neutral attributes
+	s, err = astisub.ReadFromSSA(bytes.NewReader([]byte("[Script Info]\nScriptType: v4.00+\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\nDialogue: 0,0:00:01.00,0:00:02.00,,,0,0,0,,{\\an9\\s1\\b1}strikeout\n")))
+	require.NoError(t, err)
+	assert.Equal(t, &astisub.JustificationRight, s.Items[0].InlineStyle.TextAlign)
+	assert.Equal(t, &astisub.VerticalAlignmentTop, s.Items[0].InlineStyle.VerticalAlign)
+	assert.Nil(t, s.Items[0].InlineStyle.SRTPosition)
+	assert.Nil(t, s.Items[0].InlineStyle.TTMLDisplayAlign)
+	assert.Empty(t, s.Items[0].InlineStyle.WebVTTLine)
+	assert.Equal(t, &astisub.StyleAttributes{Bold: astikit.BoolPtr(true), SSABold: astikit.BoolPtr(true), SSAStrikeout: astikit.BoolPtr(true), Strikeout: astikit.BoolPtr(true)}, s.Items[0].Lines[0].Items[0].InlineStyle)
+	w.Reset()
+	require.NoError(t, s.WriteToSRT(w))
+	assert.Contains(t, w.String(), "{\\an9}<b>strikeout</b>\n")
+	w.Reset()
+	require.NoError(t, s.WriteToWebVTT(w))
+	assert.Contains(t, w.String(), "00:00:01.000 --> 00:00:02.000 align:right line:0%\n<b>strikeout</b>\n")
+	w.Reset()
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `tts:displayAlign="before"`)
+	assert.Contains(t, w.String(), `<span tts:fontWeight="bold" tts:textDecoration="lineThrough">strikeout</span>`)
+}
+
+func TestSubtitles_Speakers(t *testing.T) {
+	// Voices are attached to line items and registered
+	s, err := astisub.ReadFromWebVTT(bytes.NewReader([]byte(`WEBVTT
+
+00:00:01.000 --> 00:00:02.000
+<v Joe>Hello</v> <v Mary Jane>Hi <i>Joe</i>
+
+00:00:02.000 --> 00:00:03.000
+<v Joe>Bye`)))
+	require.NoError(t, err)
+	require.Len(t, s.Speakers, 2)
+	joe, mary := s.Speakers["Joe"], s.Speakers["Mary Jane"]
+	assert.Equal(t, &astisub.Speaker{ID: "Joe", Name: "Joe"}, joe)
+	assert.Equal(t, "Joe", s.Items[0].Lines[0].VoiceName)
+	assert.Equal(t, joe, s.Items[0].Lines[0].Items[0].Speaker)
+	assert.Nil(t, s.Items[0].Lines[0].Items[1].Speaker)
+	assert.Equal(t, mary, s.Items[0].Lines[0].Items[2].Speaker)
+	assert.Equal(t, mary, s.Items[0].Lines[0].Items[3].Speaker)
+	assert.Equal(t, joe, s.Items[1].Lines[0].Items[0].Speaker)
+
+	// SSA
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSSA(w))
+	assert.Contains(t, w.String(), ",Joe,0,0,0,,Bye\n")
+
+	// TTML
+	w.Reset()
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `<ttm:agent xml:id="Mary_Jane" type="person">`)
+	assert.Contains(t, w.String(), `<ttm:name type="full">Mary Jane</ttm:name>`)
+	assert.Contains(t, w.String(), `<span ttm:agent="Mary_Jane">Hi </span>`)
+	assert.Contains(t, w.String(), `<p ttm:agent="Joe" begin="00:00:02.000" end="00:00:03.000">`)
+	s2, err := astisub.ReadFromTTML(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, &astisub.Speaker{ID: "Mary_Jane", Name: "Mary Jane"}, s2.Speakers["Mary_Jane"])
+	assert.Equal(t, s2.Speakers["Mary_Jane"], s2.Items[0].Lines[0].Items[2].Speaker)
+	assert.Equal(t, s2.Speakers["Joe"], s2.Items[1].Lines[0].Items[0].Speaker)
+	s2, err = astisub.ReadFromTTML(bytes.NewReader([]byte(`<tt><body><div><p begin="00:00:01.000" end="00:00:02.000" ttm:agent="Bob">Hello</p></div></body></tt>`)))
+	require.NoError(t, err)
+	assert.Equal(t, &astisub.Speaker{ID: "Bob", Name: "Bob"}, s2.Speakers["Bob"])
+	assert.Equal(t, s2.Speakers["Bob"], s2.Items[0].Lines[0].Items[0].Speaker)
+
+	// SDH
+	w.Reset()
+	require.NoError(t, s.WriteToSDH(w))
+	assert.Contains(t, w.String(), "JOE: Hello MARY JANE: Hi <i>Joe</i>\n")
+	assert.Contains(t, w.String(), "JOE: Bye\n")
+}
+
+func TestSubtitles_Segment(t *testing.T) {
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{
+		{EndAt: 15 * time.Second, StartAt: 0},
+		{EndAt: 4 * time.Second, StartAt: 2 * time.Second},
+		{EndAt: 12 * time.Second, StartAt: 11 * time.Second},
+	}
+
+	// Items are added to every segment they overlap
+	ss := s.Segment("UNIFIED", 10, nil)
+	require.Len(t, ss, 2)
+	assert.Equal(t, []*astisub.Item{s.Items[0], s.Items[1]}, ss[0].Items)
+	assert.Equal(t, []*astisub.Item{s.Items[0], s.Items[2]}, ss[1].Items)
+
+	// Segments may be empty
+	ss = s.Segment("SPECIFIED", 0, []float64{5, 5, 10, 10})
+	require.Len(t, ss, 4)
+	assert.Equal(t, []*astisub.Item{s.Items[0], s.Items[1]}, ss[0].Items)
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, ss[1].Items)
+	assert.Equal(t, []*astisub.Item{s.Items[0], s.Items[2]}, ss[2].Items)
+	assert.Empty(t, ss[3].Items)
+}
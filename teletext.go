@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/bits"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astits"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Errors
@@ -321,6 +327,25 @@ const (
 	teletextPESDataUnitIDStuffing           = 0xff
 )
 
+// Teletext grid
+const (
+	teletextColumns = 40
+	teletextRows    = 24
+)
+
+// TeletextPosition represents the position of a teletext item on the page grid. Rows range from 1 to 24 and
+// columns from 0 to 39.
+type TeletextPosition struct {
+	Column  int
+	Columns int
+	Row     int
+	Rows    int
+}
+
+func teletextPercentage(v, total int) string {
+	return strconv.FormatFloat(math.Round(float64(v)*10000/float64(total))/100, 'f', -1, 64) + "%"
+}
+
 // TeletextOptions represents teletext options
 type TeletextOptions struct {
 	Page int
@@ -353,9 +378,119 @@ func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error)
 	b := newTeletextPageBuffer(o.Page, cd)
 
 	// Loop in data
+	var ps []*teletextPage
+	var firstTime, lastTime time.Time
+	if firstTime, lastTime, err = teletextLoop(dmx, pid, nil, func(d *astits.PESData, t time.Time) {
+		// Append pages
+		ps = append(ps, b.process(d, t)...)
+	}); err != nil {
+		return
+	}
+
+	// Dump buffer
+	ps = append(ps, b.dump(lastTime)...)
+
+	// Parse pages
+	for _, p := range ps {
+		p.parse(s, cd, firstTime)
+	}
+	return
+}
+
+// ReadAllFromTeletext parses all subtitle pages of a teletext content in one pass. Subtitles are indexed by page
+// number (e.g. 888) and hold the language and page type found in the PMT teletext descriptor, if any.
+// If the page option is indicated, only this page is parsed.
+func ReadAllFromTeletext(r io.Reader, o TeletextOptions) (ss map[int]*Subtitles, err error) {
+	// Init
+	var dmx = astits.NewDemuxer(context.Background(), r)
+
+	// Get the teletext PID
+	var pid uint16
+	if pid, err = teletextPID(dmx, o); err != nil {
+		if err != ErrNoValidTeletextPID {
+			err = fmt.Errorf("astisub: getting teletext PID failed: %w", err)
+		}
+		return
+	}
+
+	// Create page buffer getter
+	bs := make(map[int]*teletextPageBuffer)
+	var pages []int
+	buffer := func(page int) {
+		if _, ok := bs[page]; ok || (o.Page > 0 && o.Page != page) {
+			return
+		}
+		bs[page] = newTeletextPageBuffer(page, newTeletextCharacterDecoder())
+		pages = append(pages, page)
+	}
+
+	// Loop in data
+	ds := make(map[int]*astits.DescriptorTeletextItem)
+	ps := make(map[int][]*teletextPage)
 	var firstTime, lastTime time.Time
+	if firstTime, lastTime, err = teletextLoop(dmx, pid, func(d *astits.PMTData) {
+		// Loop through teletext descriptors of our PID
+		for _, es := range d.ElementaryStreams {
+			if es.ElementaryPID != pid {
+				continue
+			}
+			for _, dsc := range es.ElementaryStreamDescriptors {
+				if dsc.Teletext == nil || (dsc.Tag != astits.DescriptorTagTeletext && dsc.Tag != astits.DescriptorTagVBITeletext) {
+					continue
+				}
+				for _, itm := range dsc.Teletext.Items {
+					// Get page
+					page := teletextDescriptorPage(itm)
+					ds[page] = itm
+
+					// Only subtitle pages are buffered
+					if itm.Type == astits.TeletextTypeTeletextSubtitlePage || itm.Type == astits.TeletextTypeTeletextSubtitlePageForHearingImpairedPeople {
+						buffer(page)
+					}
+				}
+			}
+		}
+	}, func(d *astits.PESData, t time.Time) {
+		// Detect new subtitle pages
+		for _, page := range teletextSubtitlePages(d) {
+			buffer(page)
+		}
+
+		// Append pages
+		for page, b := range bs {
+			ps[page] = append(ps[page], b.process(d, t)...)
+		}
+	}); err != nil {
+		return
+	}
+
+	// Loop through pages
+	ss = make(map[int]*Subtitles)
+	for _, page := range pages {
+		// Create subtitles
+		b := bs[page]
+		s := NewSubtitles()
+		s.Metadata = &Metadata{}
+		if d, ok := ds[page]; ok {
+			s.Metadata.TeletextLanguage = string(d.Language)
+			s.Metadata.TeletextType = d.Type
+			if v, ok := languageISO6392Mapping.Get(s.Metadata.TeletextLanguage); ok {
+				s.Metadata.Language = v.(string)
+			}
+		}
+
+		// Dump buffer and parse pages
+		for _, p := range append(ps[page], b.dump(lastTime)...) {
+			p.parse(s, b.cd, firstTime)
+		}
+		ss[page] = s
+	}
+	return
+}
+
+// teletextLoop loops through the demuxer data and calls the callbacks on PMT data and on teletext PES data of the PID
+func teletextLoop(dmx *astits.Demuxer, pid uint16, fpmt func(d *astits.PMTData), fpes func(d *astits.PESData, t time.Time)) (firstTime, lastTime time.Time, err error) {
 	var d *astits.DemuxerData
-	var ps []*teletextPage
 	for {
 		// Fetch next data
 		if d, err = dmx.NextData(); err != nil {
@@ -367,6 +502,14 @@ func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error)
 			return
 		}
 
+		// PMT data
+		if d.PMT != nil {
+			if fpmt != nil {
+				fpmt(d.PMT)
+			}
+			continue
+		}
+
 		// We only parse PES data
 		if d.PES == nil {
 			continue
@@ -391,17 +534,47 @@ func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error)
 			lastTime = t
 		}
 
-		// Append pages
-		ps = append(ps, b.process(d.PES, t)...)
+		// Callback
+		fpes(d.PES, t)
 	}
+	return
+}
 
-	// Dump buffer
-	ps = append(ps, b.dump(lastTime)...)
-
-	// Parse pages
-	for _, p := range ps {
-		p.parse(s, cd, firstTime)
+// teletextDescriptorPage returns the page number of a teletext descriptor item. Magazine 0 stands for magazine 8.
+func teletextDescriptorPage(i *astits.DescriptorTeletextItem) int {
+	magazineNumber := int(i.Magazine)
+	if magazineNumber == 0 {
+		magazineNumber = 8
 	}
+	return magazineNumber*100 + int(i.Page)
+}
+
+// teletextSubtitlePages returns the page numbers of the subtitle page headers found in the PES data
+func teletextSubtitlePages(d *astits.PESData) (pages []int) {
+	teletextDataUnits(d, func(i []byte, id uint8) {
+		// Get magazine and packet numbers
+		magazineNumber, packetNumber, ok := teletextDataUnitAddress(i, id)
+		if !ok || packetNumber != 0 || len(i) < 10 {
+			return
+		}
+
+		// Page number
+		pageNumberUnits, ok := astikit.ByteHamming84Decode(i[4])
+		if !ok {
+			return
+		}
+		pageNumberTens, ok := astikit.ByteHamming84Decode(i[5])
+		if !ok || pageNumberTens > 9 || pageNumberUnits > 9 {
+			return
+		}
+
+		// C6
+		controlBits, ok := astikit.ByteHamming84Decode(i[9])
+		if !ok || controlBits&0x8 == 0 {
+			return
+		}
+		pages = append(pages, int(magazineNumber)*100+int(pageNumberTens)*10+int(pageNumberUnits))
+	})
 	return
 }
 
@@ -498,8 +671,25 @@ func (b *teletextPageBuffer) dump(lastTime time.Time) (ps []*teletextPage) {
 
 // TODO Add tests
 func (b *teletextPageBuffer) process(d *astits.PESData, t time.Time) (ps []*teletextPage) {
+	// Loop through data units
+	teletextDataUnits(d, func(i []byte, id uint8) {
+		// Parse data unit
+		b.parseDataUnit(i, id, t)
+	})
+
+	// Dump buffer
+	ps = b.donePages
+	b.donePages = []*teletextPage(nil)
+	return ps
+}
+
+// teletextDataUnits loops through the EBU data units of the PES data
+func teletextDataUnits(d *astits.PESData, fn func(i []byte, id uint8)) {
 	// Data identifier
 	var offset int
+	if len(d.Data) == 0 {
+		return
+	}
 	dataIdentifier := uint8(d.Data[offset])
 	offset += 1
 
@@ -509,7 +699,7 @@ func (b *teletextPageBuffer) process(d *astits.PESData, t time.Time) (ps []*tele
 	}
 
 	// Loop through data units
-	for offset < len(d.Data) {
+	for offset+1 < len(d.Data) {
 		// ID
 		id := uint8(d.Data[offset])
 		offset += 1
@@ -524,23 +714,30 @@ func (b *teletextPageBuffer) process(d *astits.PESData, t time.Time) (ps []*tele
 			break
 		}
 
-		// Parse data unit
-		b.parseDataUnit(d.Data[offset:offsetEnd], id, t)
+		// Callback
+		fn(d.Data[offset:offsetEnd], id)
 
 		// Seek to end of data unit
 		offset = offsetEnd
 	}
-
-	// Dump buffer
-	ps = b.donePages
-	b.donePages = []*teletextPage(nil)
-	return ps
 }
 
 // TODO Add tests
 func (b *teletextPageBuffer) parseDataUnit(i []byte, id uint8, t time.Time) {
+	// Get magazine and packet numbers
+	magazineNumber, packetNumber, ok := teletextDataUnitAddress(i, id)
+	if !ok {
+		return
+	}
+
+	// Parse packet
+	b.parsePacket(i[4:], magazineNumber, packetNumber, t)
+}
+
+// teletextDataUnitAddress returns the magazine and packet numbers of an EBU subtitle data unit
+func teletextDataUnitAddress(i []byte, id uint8) (magazineNumber, packetNumber uint8, ok bool) {
 	// Check id
-	if id != teletextPESDataUnitIDEBUSubtitleData {
+	if id != teletextPESDataUnitIDEBUSubtitleData || len(i) < 4 {
 		return
 	}
 
@@ -564,14 +761,12 @@ func (b *teletextPageBuffer) parseDataUnit(i []byte, id uint8, t time.Time) {
 		return
 	}
 	h := h2<<4 | h1
-	magazineNumber := h & 0x7
+	magazineNumber = h & 0x7
 	if magazineNumber == 0 {
 		magazineNumber = 8
 	}
-	packetNumber := h >> 3
-
-	// Parse packet
-	b.parsePacket(i[4:], magazineNumber, packetNumber, t)
+	packetNumber = h >> 3
+	return
 }
 
 // TODO Add tests
@@ -835,14 +1030,109 @@ func (p *teletextPage) parse(s *Subtitles, d *teletextCharacterDecoder, firstTim
 	}
 
 	// Loop through rows
+	var bs []teletextRowBoundaries
 	for _, idxRow := range p.rows {
 		parseTeletextRow(i, d, nil, p.data[uint8(idxRow)])
+		if b, ok := newTeletextRowBoundaries(p.data[uint8(idxRow)]); ok {
+			b.row = idxRow
+			bs = append(bs, b)
+		}
+	}
+
+	// Add position and justification
+	if len(bs) > 0 {
+		i.InlineStyle = &StyleAttributes{
+			TeletextJustification: teletextJustification(bs),
+			TeletextPosition:      teletextPosition(bs),
+		}
+		i.InlineStyle.propagateTeletextAttributes()
 	}
 
 	// Append item
 	s.Items = append(s.Items, i)
 }
 
+type teletextRowBoundaries struct {
+	doubleHeight bool
+	end          int
+	row          int
+	start        int
+}
+
+// newTeletextRowBoundaries returns the columns of the first and last characters displayed in the row
+func newTeletextRowBoundaries(row []byte) (b teletextRowBoundaries, ok bool) {
+	var started bool
+	for idx, v := range row {
+		switch v {
+		case 0xa:
+			started = false
+		case 0xb:
+			started = true
+		case 0xd, 0xf:
+			b.doubleHeight = true
+		default:
+			if started && v > 0x20 {
+				if !ok {
+					b.start = idx
+					ok = true
+				}
+				b.end = idx
+			}
+		}
+	}
+	return
+}
+
+func teletextPosition(bs []teletextRowBoundaries) *TeletextPosition {
+	// Get boundaries
+	start, end := teletextColumns, 0
+	for _, b := range bs {
+		if b.start < start {
+			start = b.start
+		}
+		if b.end > end {
+			end = b.end
+		}
+	}
+
+	// Get last row
+	last := bs[len(bs)-1].row
+	if bs[len(bs)-1].doubleHeight {
+		last++
+	}
+	return &TeletextPosition{
+		Column:  start,
+		Columns: end - start + 1,
+		Row:     bs[0].row,
+		Rows:    last - bs[0].row + 1,
+	}
+}
+
+func teletextJustification(bs []teletextRowBoundaries) *Justification {
+	// Check whether all rows are centered or share the same start or end
+	centered, left, right := true, true, true
+	for _, b := range bs {
+		if d := b.start - (teletextColumns - 1 - b.end); d < -1 || d > 1 {
+			centered = false
+		}
+		if b.start != bs[0].start {
+			left = false
+		}
+		if b.end != bs[0].end {
+			right = false
+		}
+	}
+
+	// Get justification
+	j := JustificationLeft
+	if centered {
+		j = JustificationCentered
+	} else if !left && right {
+		j = JustificationRight
+	}
+	return &j
+}
+
 type decoder interface {
 	decode(i byte) []byte
 }
@@ -861,6 +1151,7 @@ func parseTeletextRow(i *Item, d decoder, fs func() styler, row []byte) {
 	var li = LineItem{InlineStyle: &StyleAttributes{}}
 	var started bool
 	var s styler
+	var foreground = ColorWhite
 	for _, v := range row {
 		// Create specific styler
 		if fs != nil {
@@ -868,7 +1159,7 @@ func parseTeletextRow(i *Item, d decoder, fs func() styler, row []byte) {
 		}
 
 		// Get spacing attributes
-		var color *Color
+		var background, color *Color
 		var doubleHeight, doubleSize, doubleWidth *bool
 		switch v {
 		case 0x0:
@@ -901,16 +1192,25 @@ func parseTeletextRow(i *Item, d decoder, fs func() styler, row []byte) {
 			doubleWidth = astikit.BoolPtr(true)
 		case 0xf:
 			doubleSize = astikit.BoolPtr(true)
+		case 0x1c:
+			background = ColorBlack
+		case 0x1d:
+			background = foreground
 		default:
 			if s != nil {
 				s.parseSpacingAttribute(v)
 			}
 		}
 
+		// Update foreground
+		if color != nil {
+			foreground = color
+		}
+
 		// Style has been set
-		if color != nil || doubleHeight != nil || doubleSize != nil || doubleWidth != nil || (s != nil && s.hasBeenSet()) {
+		if background != nil || color != nil || doubleHeight != nil || doubleSize != nil || doubleWidth != nil || (s != nil && s.hasBeenSet()) {
 			// Style has changed
-			if color != li.InlineStyle.TeletextColor || doubleHeight != li.InlineStyle.TeletextDoubleHeight ||
+			if background != li.InlineStyle.TeletextBackgroundColor || color != li.InlineStyle.TeletextColor || doubleHeight != li.InlineStyle.TeletextDoubleHeight ||
 				doubleSize != li.InlineStyle.TeletextDoubleSize || doubleWidth != li.InlineStyle.TeletextDoubleWidth ||
 				(s != nil && s.hasChanged(li.InlineStyle)) {
 				// Line has started
@@ -925,6 +1225,9 @@ func parseTeletextRow(i *Item, d decoder, fs func() styler, row []byte) {
 				}
 
 				// Update style attributes
+				if background != nil && background != li.InlineStyle.TeletextBackgroundColor {
+					li.InlineStyle.TeletextBackgroundColor = background
+				}
 				if color != nil && color != li.InlineStyle.TeletextColor {
 					li.InlineStyle.TeletextColor = color
 				}
@@ -995,3 +1298,540 @@ func appendTeletextLineItem(l *Line, li LineItem, s styler) {
 		l.Items = append(l.Items, li)
 	}
 }
+
+// Teletext writer defaults
+const (
+	teletextDefaultPage = 888
+	teletextDefaultPID  = 0x100
+)
+
+// EN 300 472 PES layout
+const (
+	teletextPESHeaderDataLength = 0x24
+	teletextPESHeaderLength     = 9 + teletextPESHeaderDataLength
+	teletextTSPayloadSize       = 184
+)
+
+// Words with their trailing spaces
+var teletextRegexpWord = regexp.MustCompile(`\S+\s*|\s+`)
+
+// Hamming 8/4 encoding table, bytes are already reversed to match the transmission order
+var teletextHamming84Encoding = [16]byte{
+	0xa8, 0x40, 0x92, 0x7a, 0x26, 0xce, 0x1c, 0xf4, 0x0b, 0xe3, 0x31, 0xd9, 0x85, 0x6d, 0xbf, 0x57,
+}
+
+// teletextLanguageCharsetCodes maps languages to the code of the national option subset able to encode them.
+// Since no X/28 packet is written, only the national option subsets of the default group can be used.
+var teletextLanguageCharsetCodes = map[string]uint8{
+	LanguageCzech:      3,
+	LanguageEnglish:    0,
+	LanguageFinnish:    2,
+	LanguageFrench:     1,
+	LanguageGerman:     4,
+	LanguageHungarian:  2,
+	LanguageItalian:    6,
+	LanguagePortuguese: 5,
+	LanguageSlovak:     3,
+	LanguageSpanish:    5,
+	LanguageSwedish:    2,
+}
+
+// WriteToTeletext writes subtitles in EBU teletext format into a MPEG-TS stream
+// http://www.etsi.org/deliver/etsi_en/300400_300499/300472/01.03.01_60/en_300472v010301p.pdf
+// http://www.etsi.org/deliver/etsi_i_ets/300700_300799/300706/01_60/ets_300706e01p.pdf
+func (s Subtitles) WriteToTeletext(o io.Writer, opts TeletextOptions) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
+
+	// Control codes are derived from the generic style attributes when teletext ones are missing
+	s = s.withGenericAttributes()
+
+	// Default options
+	if opts.Page == 0 {
+		opts.Page = teletextDefaultPage
+	}
+	if opts.PID == 0 {
+		opts.PID = teletextDefaultPID
+	}
+
+	// Check page
+	if opts.Page < 100 || opts.Page > 899 {
+		err = fmt.Errorf("astisub: invalid teletext page %d", opts.Page)
+		return
+	}
+
+	// Create writer
+	w := newTeletextWriter(s, opts)
+
+	// Create muxer
+	m := astits.NewMuxer(context.Background(), o)
+	if err = m.AddElementaryStream(astits.PMTElementaryStream{
+		ElementaryPID: uint16(opts.PID),
+		ElementaryStreamDescriptors: []*astits.Descriptor{{
+			Tag: astits.DescriptorTagTeletext,
+			Teletext: &astits.DescriptorTeletext{Items: []*astits.DescriptorTeletextItem{{
+				Language: []byte(w.language),
+				Magazine: w.magazineNumber % 8,
+				Page:     w.pageNumber,
+				Type:     astits.TeletextTypeTeletextSubtitlePage,
+			}}},
+		}},
+		StreamType: astits.StreamTypePrivateData,
+	}); err != nil {
+		err = fmt.Errorf("astisub: adding elementary stream failed: %w", err)
+		return
+	}
+	m.SetPCRPID(uint16(opts.PID))
+	tm := newTeletextMuxer(m)
+
+	// Loop through items
+	for idx, item := range s.Items {
+		// Erase the page before the first item
+		if idx == 0 && item.StartAt > 0 {
+			if err = w.writePage(tm, nil, 0); err != nil {
+				err = fmt.Errorf("astisub: writing erase page failed: %w", err)
+				return
+			}
+		}
+
+		// Write item page
+		if err = w.writePage(tm, item, item.StartAt); err != nil {
+			err = fmt.Errorf("astisub: writing page of item #%d failed: %w", idx+1, err)
+			return
+		}
+
+		// Erase the page unless the next item starts right away
+		if idx == len(s.Items)-1 || s.Items[idx+1].StartAt > item.EndAt {
+			if err = w.writePage(tm, nil, item.EndAt); err != nil {
+				err = fmt.Errorf("astisub: writing erase page of item #%d failed: %w", idx+1, err)
+				return
+			}
+		}
+	}
+	return
+}
+
+type teletextWriter struct {
+	charsetCode    uint8
+	e              *teletextCharacterEncoder
+	language       string
+	magazineNumber uint8
+	pageNumber     uint8
+	pid            uint16
+}
+
+func newTeletextWriter(s Subtitles, o TeletextOptions) (w *teletextWriter) {
+	// Create writer
+	w = &teletextWriter{
+		language:       "und",
+		magazineNumber: uint8(o.Page / 100),
+		pageNumber:     uint8(o.Page % 100),
+		pid:            uint16(o.PID),
+	}
+
+	// Get language
+	var preferredCharsetCode *uint8
+	if s.Metadata != nil {
+		if v, ok := languageISO6392Mapping.GetInverse(s.Metadata.Language); ok {
+			w.language = v.(string)
+		}
+		if v, ok := teletextLanguageCharsetCodes[s.Metadata.Language]; ok {
+			preferredCharsetCode = astikit.UInt8Ptr(v)
+		}
+	}
+
+	// Pick the national option subset that is able to encode the most characters, which is the only criteria for
+	// languages without a national option subset. Characters that can't be encoded are written as "?".
+	var bestUnknown int
+	for code := uint8(0); code < 7; code++ {
+		e := newTeletextCharacterEncoder(code)
+		var unknown int
+		for _, item := range s.Items {
+			for _, l := range item.Lines {
+				for _, li := range l.Items {
+					_, n := e.encode(li.Text)
+					unknown += n
+				}
+			}
+		}
+		if w.e == nil || unknown < bestUnknown || (unknown == bestUnknown && preferredCharsetCode != nil && *preferredCharsetCode == code) {
+			bestUnknown = unknown
+			w.charsetCode = code
+			w.e = e
+		}
+	}
+	return
+}
+
+// writePage writes a complete page. A nil item erases the page.
+// PES packets are built by hand since EN 300 472 requires a fixed header length and packets stuffed to a whole
+// number of TS packets, which the muxer doesn't allow.
+func (w *teletextWriter) writePage(m *teletextMuxer, i *Item, t time.Duration) (err error) {
+	// Add header
+	d := []byte{0x10}
+	d = append(d, w.dataUnit(0, w.headerBytes())...)
+
+	// Add rows
+	if i != nil {
+		var rs []teletextRow
+		if rs, err = w.rows(i); err != nil {
+			err = fmt.Errorf("astisub: building rows failed: %w", err)
+			return
+		}
+		for _, r := range rs {
+			d = append(d, w.dataUnit(r.number, r.data)...)
+		}
+	}
+
+	// Build PES
+	b := []byte{0x0, 0x0, 0x1, astits.StreamIDPrivateStream1, 0x0, 0x0,
+		// Marker bits and data alignment indicator
+		0x84,
+		// PTS only
+		0x80,
+		teletextPESHeaderDataLength,
+	}
+	b = append(b, teletextPTSBytes(int64(t.Seconds()*90000))...)
+	for len(b) < teletextPESHeaderLength {
+		b = append(b, 0xff)
+	}
+	b = append(b, d...)
+
+	// Stuff PES so that it fills a whole number of TS packets
+	for len(b)%teletextTSPayloadSize != 0 {
+		b = append(b, teletextPESDataUnitIDStuffing, 0x2c)
+		for idx := 0; idx < 0x2c; idx++ {
+			b = append(b, 0xff)
+		}
+	}
+	b[4], b[5] = uint8((len(b)-6)>>8), uint8(len(b)-6)
+
+	// Write PES
+	if err = m.writePES(w.pid, b); err != nil {
+		err = fmt.Errorf("astisub: writing PES failed: %w", err)
+		return
+	}
+	return
+}
+
+// teletextMuxer writes PES packets that already fill a whole number of TS packets
+type teletextMuxer struct {
+	ccs map[uint16]uint8
+	m   *astits.Muxer
+}
+
+func newTeletextMuxer(m *astits.Muxer) *teletextMuxer {
+	return &teletextMuxer{
+		ccs: make(map[uint16]uint8),
+		m:   m,
+	}
+}
+
+func (m *teletextMuxer) writePES(pid uint16, b []byte) (err error) {
+	// Write tables so that decoding can start at any page
+	if _, err = m.m.WriteTables(); err != nil {
+		err = fmt.Errorf("astisub: writing tables failed: %w", err)
+		return
+	}
+
+	// Write TS packets
+	for idx := 0; idx < len(b); idx += teletextTSPayloadSize {
+		if _, err = m.m.WritePacket(&astits.Packet{
+			Header: &astits.PacketHeader{
+				ContinuityCounter:         m.ccs[pid],
+				HasPayload:                true,
+				PayloadUnitStartIndicator: idx == 0,
+				PID:                       pid,
+			},
+			Payload: b[idx : idx+teletextTSPayloadSize],
+		}); err != nil {
+			err = fmt.Errorf("astisub: writing packet failed: %w", err)
+			return
+		}
+		m.ccs[pid] = (m.ccs[pid] + 1) % 16
+	}
+	return
+}
+
+// teletextPTSBytes encodes a PTS preceded by the "0010" prefix and interleaved with marker bits
+func teletextPTSBytes(pts int64) []byte {
+	return []byte{
+		0x21 | uint8(pts>>29)&0xe,
+		uint8(pts >> 22),
+		0x1 | uint8(pts>>14)&0xfe,
+		uint8(pts >> 7),
+		0x1 | uint8(pts<<1)&0xfe,
+	}
+}
+
+// dataUnit builds an EBU subtitle data unit containing a single packet
+func (w *teletextWriter) dataUnit(packetNumber uint8, data []byte) []byte {
+	h := packetNumber<<3 | w.magazineNumber%8
+	b := []byte{
+		teletextPESDataUnitIDEBUSubtitleData,
+		0x2c,
+		// Reserved bits, field parity and no line offset
+		0xe0,
+		// Framing code
+		0xe4,
+		teletextHamming84Encoding[h&0xf],
+		teletextHamming84Encoding[h>>4],
+	}
+	return append(b, data...)
+}
+
+// headerBytes builds the X/0 page header
+func (w *teletextWriter) headerBytes() (b []byte) {
+	b = []byte{
+		// Page number units and tens
+		teletextHamming84Encoding[w.pageNumber%10],
+		teletextHamming84Encoding[w.pageNumber/10],
+		// S1
+		teletextHamming84Encoding[0],
+		// S2 and C4 (erase page)
+		teletextHamming84Encoding[0x8],
+		// S3
+		teletextHamming84Encoding[0],
+		// S4, C5 and C6 (subtitle)
+		teletextHamming84Encoding[0x8],
+		// C7 (suppress header) and C8 (update indicator)
+		teletextHamming84Encoding[0x3],
+		// C11 (magazine serial) and C12 --> C14 (national option character subset)
+		teletextHamming84Encoding[w.charsetCode<<1|0x1],
+	}
+	for idx := 0; idx < 32; idx++ {
+		b = append(b, teletextParityEncode(' '))
+	}
+	return
+}
+
+type teletextRow struct {
+	data   []byte
+	number uint8
+}
+
+// rows builds the item rows, aligned at the bottom of the page and centered
+// Lines that don't fit in a row are wrapped and an error is returned if rows don't fit in the page.
+func (w *teletextWriter) rows(i *Item) (rs []teletextRow, err error) {
+	// Wrap lines
+	var ls []Line
+	for _, l := range i.Lines {
+		ls = append(ls, w.wrap(l)...)
+	}
+
+	// Loop through lines in reverse order since they're aligned at the bottom
+	number := 24
+	for idx := len(ls) - 1; idx >= 0; idx-- {
+		// Build content
+		c, prefix, doubleHeight := w.rowContent(ls[idx])
+
+		// Get row number
+		if doubleHeight {
+			number -= 2
+		} else {
+			number--
+		}
+		if number < 1 {
+			err = fmt.Errorf("astisub: %d rows don't fit in the page", len(ls))
+			return
+		}
+
+		// Center displayed text
+		r := teletextRow{data: make([]byte, teletextColumns), number: uint8(number)}
+		offset := (teletextColumns-(len(c)-prefix-2))/2 - prefix
+		if offset < 0 {
+			offset = 0
+		} else if offset+len(c) > teletextColumns {
+			offset = teletextColumns - len(c)
+		}
+		for idx := range r.data {
+			v := byte(' ')
+			if idx >= offset && idx-offset < len(c) {
+				v = c[idx-offset]
+			}
+			r.data[idx] = teletextParityEncode(v)
+		}
+		rs = append([]teletextRow{r}, rs...)
+	}
+	return
+}
+
+// wrap splits the line into lines fitting in a row. Lines are broken between words unless a word doesn't fit in
+// a row on its own.
+func (w *teletextWriter) wrap(l Line) (ls []Line) {
+	// Line fits
+	if w.fits(l) {
+		return []Line{l}
+	}
+
+	// Loop through line items
+	var cur Line
+	for _, li := range l.Items {
+		// Words are kept with their trailing spaces
+		for _, word := range teletextRegexpWord.FindAllString(li.Text, -1) {
+			for word != "" {
+				// Word fits in the current row
+				n := teletextAppendWord(cur, li, word)
+				if w.fits(n) {
+					cur = n
+					break
+				}
+
+				// Word fits in a new row
+				if len(cur.Items) > 0 {
+					ls = append(ls, cur)
+					cur = Line{}
+					word = strings.TrimLeftFunc(word, unicode.IsSpace)
+					continue
+				}
+
+				// Word doesn't fit in a row, it's cut
+				rs := []rune(word)
+				idx := len(rs) - 1
+				for ; idx > 1 && !w.fits(teletextAppendWord(cur, li, string(rs[:idx]))); idx-- {
+				}
+				ls = append(ls, teletextAppendWord(cur, li, string(rs[:idx])))
+				cur = Line{}
+				word = string(rs[idx:])
+			}
+		}
+	}
+	if len(cur.Items) > 0 {
+		ls = append(ls, cur)
+	}
+
+	// Remove spaces at the end of rows
+	for idx := range ls {
+		ls[idx].trimSpace()
+	}
+	return
+}
+
+// fits checks whether the line fits in a row, ignoring trailing spaces
+func (w *teletextWriter) fits(l Line) bool {
+	l.Items = append([]LineItem{}, l.Items...)
+	l.trimSpace()
+	c, _, _ := w.rowContent(l)
+	return len(c) <= teletextColumns
+}
+
+// teletextAppendWord returns a copy of the line where the word is appended to the line item it comes from
+func teletextAppendWord(l Line, li LineItem, word string) Line {
+	o := Line{Items: append([]LineItem{}, l.Items...), VoiceName: l.VoiceName}
+	if len(o.Items) > 0 && o.Items[len(o.Items)-1].InlineStyle == li.InlineStyle {
+		o.Items[len(o.Items)-1].Text += word
+	} else {
+		li.Text = word
+		o.Items = append(o.Items, li)
+	}
+	return o
+}
+
+// rowContent returns the row content as well as the number of control bytes preceding the text
+func (w *teletextWriter) rowContent(l Line) (c []byte, prefix int, doubleHeight bool) {
+	// Double height
+	for _, li := range l.Items {
+		if li.InlineStyle != nil && ((li.InlineStyle.TeletextDoubleHeight != nil && *li.InlineStyle.TeletextDoubleHeight) ||
+			(li.InlineStyle.TeletextDoubleSize != nil && *li.InlineStyle.TeletextDoubleSize)) {
+			doubleHeight = true
+			break
+		}
+	}
+	if doubleHeight {
+		c = append(c, 0xd)
+	}
+
+	// Loop through line items
+	var color byte
+	for idx, li := range l.Items {
+		// Color
+		var cl *Color
+		if li.InlineStyle != nil {
+			cl = li.InlineStyle.TeletextColor
+		}
+		if v := teletextColorCode(cl); idx == 0 || v != color {
+			color = v
+			c = append(c, v)
+		}
+
+		// Start box
+		if idx == 0 {
+			c = append(c, 0xb, 0xb)
+			prefix = len(c)
+		}
+
+		// Text
+		b, _ := w.e.encode(li.Text)
+		c = append(c, b...)
+	}
+
+	// End box
+	c = append(c, 0xa, 0xa)
+	return
+}
+
+func teletextColorCode(c *Color) byte {
+	if c != nil {
+		for idx, v := range []*Color{ColorBlack, ColorRed, ColorGreen, ColorYellow, ColorBlue, ColorMagenta, ColorCyan} {
+			if *c == *v {
+				return byte(idx)
+			}
+		}
+	}
+	return 0x7
+}
+
+// teletextParityEncode adds the odd parity bit and reverses the byte to match the transmission order
+func teletextParityEncode(i byte) byte {
+	i &= 0x7f
+	if bits.OnesCount8(i)%2 == 0 {
+		i |= 0x80
+	}
+	return bits.Reverse8(i)
+}
+
+type teletextCharacterEncoder struct {
+	m map[rune]byte
+}
+
+func newTeletextCharacterEncoder(charsetCode uint8) *teletextCharacterEncoder {
+	// Get charset
+	d := newTeletextCharacterDecoder()
+	d.updateCharset(astikit.UInt8Ptr(charsetCode), false)
+
+	// Build mapping
+	e := &teletextCharacterEncoder{m: make(map[rune]byte)}
+	for idx, v := range d.c {
+		if r, _ := utf8.DecodeRune(v); r != utf8.RuneError {
+			if _, ok := e.m[r]; !ok {
+				e.m[r] = byte(idx + 0x20)
+			}
+		}
+	}
+	return e
+}
+
+// encode encodes the text and returns the number of characters that could not be encoded properly
+func (e *teletextCharacterEncoder) encode(i string) (o []byte, unknown int) {
+	for _, r := range i {
+		// Character is in the charset
+		if v, ok := e.m[r]; ok {
+			o = append(o, v)
+			continue
+		}
+
+		// Fallback to the character without its diacritics
+		unknown++
+		if b, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r))); b != r {
+			if v, ok := e.m[b]; ok {
+				o = append(o, v)
+				continue
+			}
+		}
+		o = append(o, '?')
+	}
+	return
+}
@@ -1,11 +1,15 @@
 package astisub
 
 import (
+	"bytes"
+	"context"
 	"testing"
 	"time"
 
 	"github.com/asticode/go-astikit"
+	"github.com/asticode/go-astits"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTeletextPESDataType(t *testing.T) {
@@ -33,6 +37,13 @@ func TestTeletextPageParse(t *testing.T) {
 	p.parse(&s, d, time.Unix(5, 0))
 	assert.Equal(t, []*Item{{
 		EndAt: 10 * time.Second,
+		InlineStyle: &StyleAttributes{
+			Extent:                &Percentages{Horizontal: 12.5, Vertical: float64(2) * 100 / 24},
+			Origin:                &Percentages{Horizontal: 2.5},
+			TextAlign:             &JustificationLeft,
+			TeletextJustification: &JustificationLeft,
+			TeletextPosition:      &TeletextPosition{Column: 1, Columns: 5, Row: 1, Rows: 2},
+		},
 		Lines: []Line{
 			{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextSpacesAfter: astikit.IntPtr(0), TeletextSpacesBefore: astikit.IntPtr(0)}, Text: "test1"}}},
 			{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextSpacesAfter: astikit.IntPtr(0), TeletextSpacesBefore: astikit.IntPtr(0)}, Text: "test2"}}},
@@ -67,6 +78,10 @@ func TestParseTeletextRow(t *testing.T) {
 	b = append(b, []byte("double size")...)
 	b = append(b, 0xc)
 	b = append(b, []byte("reset")...)
+	b = append(b, 0x1d)
+	b = append(b, []byte("new background")...)
+	b = append(b, 0x1c)
+	b = append(b, []byte("black background")...)
 	b = append(b, 0xa)
 	b = append(b, []byte("end")...)
 	i := Item{}
@@ -76,85 +91,107 @@ func TestParseTeletextRow(t *testing.T) {
 	assert.Equal(t, 1, len(i.Lines))
 	assert.Equal(t, []LineItem{
 		{Text: "black", InlineStyle: &StyleAttributes{
+			Color:                ColorBlack,
 			TeletextColor:        ColorBlack,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#000000"),
 		}},
 		{Text: "red", InlineStyle: &StyleAttributes{
+			Color:                ColorRed,
 			TeletextColor:        ColorRed,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ff0000"),
 		}},
 		{Text: "green", InlineStyle: &StyleAttributes{
+			Color:                ColorGreen,
 			TeletextColor:        ColorGreen,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#008000"),
 		}},
 		{Text: "yellow", InlineStyle: &StyleAttributes{
+			Color:                ColorYellow,
 			TeletextColor:        ColorYellow,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffff00"),
 		}},
 		{Text: "blue", InlineStyle: &StyleAttributes{
+			Color:                ColorBlue,
 			TeletextColor:        ColorBlue,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#0000ff"),
 		}},
 		{Text: "magenta", InlineStyle: &StyleAttributes{
+			Color:                ColorMagenta,
 			TeletextColor:        ColorMagenta,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ff00ff"),
 		}},
 		{Text: "cyan", InlineStyle: &StyleAttributes{
+			Color:                ColorCyan,
 			TeletextColor:        ColorCyan,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#00ffff"),
 		}},
 		{Text: "white", InlineStyle: &StyleAttributes{
+			Color:                ColorWhite,
 			TeletextColor:        ColorWhite,
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffffff"),
 		}},
 		{Text: "double height", InlineStyle: &StyleAttributes{
+			Color:                ColorWhite,
 			TeletextColor:        ColorWhite,
 			TeletextDoubleHeight: astikit.BoolPtr(true),
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffffff"),
 		}},
 		{Text: "double width", InlineStyle: &StyleAttributes{
+			Color:                ColorWhite,
 			TeletextColor:        ColorWhite,
 			TeletextDoubleHeight: astikit.BoolPtr(true),
 			TeletextDoubleWidth:  astikit.BoolPtr(true),
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffffff"),
 		}},
 		{Text: "double size", InlineStyle: &StyleAttributes{
+			Color:                ColorWhite,
 			TeletextColor:        ColorWhite,
 			TeletextDoubleHeight: astikit.BoolPtr(true),
 			TeletextDoubleWidth:  astikit.BoolPtr(true),
 			TeletextDoubleSize:   astikit.BoolPtr(true),
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffffff"),
 		}},
 		{Text: "reset", InlineStyle: &StyleAttributes{
+			Color:                ColorWhite,
 			TeletextColor:        ColorWhite,
 			TeletextDoubleHeight: astikit.BoolPtr(false),
 			TeletextDoubleWidth:  astikit.BoolPtr(false),
 			TeletextDoubleSize:   astikit.BoolPtr(false),
 			TeletextSpacesAfter:  astikit.IntPtr(0),
 			TeletextSpacesBefore: astikit.IntPtr(0),
-			TTMLColor:            astikit.StrPtr("#ffffff"),
+		}},
+		{Text: "new background", InlineStyle: &StyleAttributes{
+			BackgroundColor:         ColorWhite,
+			TeletextBackgroundColor: ColorWhite,
+			Color:                   ColorWhite,
+			TeletextColor:           ColorWhite,
+			TeletextDoubleHeight:    astikit.BoolPtr(false),
+			TeletextDoubleWidth:     astikit.BoolPtr(false),
+			TeletextDoubleSize:      astikit.BoolPtr(false),
+			TeletextSpacesAfter:     astikit.IntPtr(0),
+			TeletextSpacesBefore:    astikit.IntPtr(0),
+		}},
+		{Text: "black background", InlineStyle: &StyleAttributes{
+			BackgroundColor:         ColorBlack,
+			TeletextBackgroundColor: ColorBlack,
+			Color:                   ColorWhite,
+			TeletextColor:           ColorWhite,
+			TeletextDoubleHeight:    astikit.BoolPtr(false),
+			TeletextDoubleWidth:     astikit.BoolPtr(false),
+			TeletextDoubleSize:      astikit.BoolPtr(false),
+			TeletextSpacesAfter:     astikit.IntPtr(0),
+			TeletextSpacesBefore:    astikit.IntPtr(0),
 		}},
 	}, i.Lines[0].Items)
 }
@@ -175,3 +212,217 @@ func TestAppendTeletextLineItem(t *testing.T) {
 		TeletextSpacesBefore: astikit.IntPtr(1),
 	}, *l.Items[0].InlineStyle)
 }
+
+func TestWriteToTeletext(t *testing.T) {
+	// Write
+	s := &Subtitles{
+		Items: []*Item{
+			{
+				EndAt: 3 * time.Second,
+				Lines: []Line{
+					{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextColor: ColorYellow}, Text: "Où est-il ?"}}},
+					{Items: []LineItem{{Text: "Là-bas,"}, {InlineStyle: &StyleAttributes{TeletextColor: ColorCyan}, Text: "à côté"}}},
+				},
+				StartAt: time.Second,
+			},
+			{
+				EndAt:   5 * time.Second,
+				Lines:   []Line{{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextDoubleHeight: astikit.BoolPtr(true)}, Text: "Ç’est ça"}}}},
+				StartAt: 3 * time.Second,
+			},
+		},
+		Metadata: &Metadata{Language: LanguageFrench},
+	}
+	w := &bytes.Buffer{}
+	err := s.WriteToTeletext(w, TeletextOptions{})
+	require.NoError(t, err)
+
+	// Read
+	s2, err := ReadFromTeletext(bytes.NewReader(w.Bytes()), TeletextOptions{})
+	require.NoError(t, err)
+	require.Len(t, s2.Items, 2)
+	assert.Equal(t, time.Second, s2.Items[0].StartAt)
+	assert.Equal(t, 3*time.Second, s2.Items[0].EndAt)
+	require.Len(t, s2.Items[0].Lines, 2)
+	require.Len(t, s2.Items[0].Lines[0].Items, 1)
+	assert.Equal(t, "Où est-il ?", s2.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, ColorYellow, s2.Items[0].Lines[0].Items[0].InlineStyle.TeletextColor)
+	require.Len(t, s2.Items[0].Lines[1].Items, 2)
+	assert.Equal(t, "Là-bas,", s2.Items[0].Lines[1].Items[0].Text)
+	assert.Equal(t, ColorWhite, s2.Items[0].Lines[1].Items[0].InlineStyle.TeletextColor)
+	assert.Equal(t, "à côté", s2.Items[0].Lines[1].Items[1].Text)
+	assert.Equal(t, ColorCyan, s2.Items[0].Lines[1].Items[1].InlineStyle.TeletextColor)
+	assert.Equal(t, &JustificationCentered, s2.Items[0].InlineStyle.TeletextJustification)
+	assert.Equal(t, 22, s2.Items[0].InlineStyle.TeletextPosition.Row)
+	assert.Equal(t, 2, s2.Items[0].InlineStyle.TeletextPosition.Rows)
+	assert.Equal(t, 3*time.Second, s2.Items[1].StartAt)
+	assert.Equal(t, 5*time.Second, s2.Items[1].EndAt)
+	require.Len(t, s2.Items[1].Lines, 1)
+	// "Ç" falls back to "C" and "’" is unknown in the french charset
+	assert.Equal(t, "C?est ça", s2.Items[1].Lines[0].String())
+	assert.Equal(t, astikit.BoolPtr(true), s2.Items[1].Lines[0].Items[0].InlineStyle.TeletextDoubleHeight)
+	assert.Equal(t, &TeletextPosition{Column: 16, Columns: 8, Row: 22, Rows: 2}, s2.Items[1].InlineStyle.TeletextPosition)
+	assert.Equal(t, &Percentages{Horizontal: 40, Vertical: 87.5}, s2.Items[1].InlineStyle.Origin)
+
+	// PES packets have a fixed header length and fill whole TS packets
+	var pess int
+	for b := w.Bytes(); len(b) >= 188; b = b[188:] {
+		if pid := uint16(b[1]&0x1f)<<8 | uint16(b[2]); pid != teletextDefaultPID || b[1]&0x40 == 0 {
+			continue
+		}
+		pess++
+		assert.Equal(t, []byte{0x0, 0x0, 0x1, 0xbd}, b[4:8])
+		assert.Equal(t, uint8(0x24), b[12])
+		assert.Equal(t, 0, (int(b[8])<<8|int(b[9])+6)%184)
+	}
+	assert.Equal(t, 4, pess)
+
+	// Long lines are wrapped
+	s = &Subtitles{Items: []*Item{{
+		EndAt:   time.Second,
+		Lines:   []Line{{Items: []LineItem{{Text: "This is a very long line that doesn't fit in a single teletext row"}}}},
+		StartAt: 0,
+	}}}
+	w.Reset()
+	require.NoError(t, s.WriteToTeletext(w, TeletextOptions{}))
+	s2, err = ReadFromTeletext(bytes.NewReader(w.Bytes()), TeletextOptions{})
+	require.NoError(t, err)
+	require.Len(t, s2.Items, 1)
+	require.Len(t, s2.Items[0].Lines, 3)
+	assert.Equal(t, "This is a very long line that", s2.Items[0].Lines[0].String())
+	assert.Equal(t, "doesn't fit in a single teletext", s2.Items[0].Lines[1].String())
+	assert.Equal(t, "row", s2.Items[0].Lines[2].String())
+
+	// Rows don't fit in the page
+	s.Items[0].Lines = nil
+	for idx := 0; idx < 24; idx++ {
+		s.Items[0].Lines = append(s.Items[0].Lines, Line{Items: []LineItem{{Text: "line"}}})
+	}
+	assert.Error(t, s.WriteToTeletext(&bytes.Buffer{}, TeletextOptions{}))
+
+	// Languages without a national option subset fall back to the one encoding the most characters
+	s.Items[0].Lines = s.Items[0].Lines[:1]
+	s.Metadata = &Metadata{Language: LanguageJapanese}
+	assert.NoError(t, s.WriteToTeletext(&bytes.Buffer{}, TeletextOptions{}))
+	s.Items[0].Lines[0].Items[0].Text = "Blåbær"
+	s.Metadata = &Metadata{Language: LanguageNorwegian}
+	tw := newTeletextWriter(*s, TeletextOptions{})
+	assert.Equal(t, "nor", tw.language)
+	assert.Equal(t, uint8(2), tw.charsetCode)
+
+	// Invalid page
+	s.Metadata = nil
+	err = s.WriteToTeletext(&bytes.Buffer{}, TeletextOptions{Page: 950})
+	assert.Error(t, err)
+}
+
+func TestReadAllFromTeletext(t *testing.T) {
+	// Create writers
+	s1 := &Subtitles{
+		Items:    []*Item{{EndAt: 3 * time.Second, Lines: []Line{{Items: []LineItem{{Text: "english"}}}}, StartAt: time.Second}},
+		Metadata: &Metadata{Language: LanguageEnglish},
+	}
+	s2 := &Subtitles{Items: []*Item{{EndAt: 4 * time.Second, Lines: []Line{{Items: []LineItem{{Text: "français"}}}}, StartAt: 2 * time.Second}}}
+	w1 := newTeletextWriter(*s1, TeletextOptions{Page: 888, PID: 0x100})
+	w2 := newTeletextWriter(*s2, TeletextOptions{Page: 777, PID: 0x100})
+
+	// Create muxer, only the first page is listed in the descriptor
+	b := &bytes.Buffer{}
+	m := astits.NewMuxer(context.Background(), b)
+	err := m.AddElementaryStream(astits.PMTElementaryStream{
+		ElementaryPID: 0x100,
+		ElementaryStreamDescriptors: []*astits.Descriptor{{
+			Tag: astits.DescriptorTagTeletext,
+			Teletext: &astits.DescriptorTeletext{Items: []*astits.DescriptorTeletextItem{
+				{Language: []byte("eng"), Magazine: 0, Page: 88, Type: astits.TeletextTypeTeletextSubtitlePageForHearingImpairedPeople},
+				{Language: []byte("eng"), Magazine: 1, Page: 0, Type: astits.TeletextTypeInitialTeletextPage},
+			}},
+		}},
+		StreamType: astits.StreamTypePrivateData,
+	})
+	require.NoError(t, err)
+	m.SetPCRPID(0x100)
+	tm := newTeletextMuxer(m)
+
+	// Write pages
+	for _, v := range []struct {
+		i *Item
+		t time.Duration
+		w *teletextWriter
+	}{
+		{t: 0, w: w1},
+		{t: 0, w: w2},
+		{i: s1.Items[0], t: time.Second, w: w1},
+		{i: s2.Items[0], t: 2 * time.Second, w: w2},
+		{t: 3 * time.Second, w: w1},
+		{t: 4 * time.Second, w: w2},
+	} {
+		require.NoError(t, v.w.writePage(tm, v.i, v.t))
+	}
+
+	// Read all pages
+	ss, err := ReadAllFromTeletext(bytes.NewReader(b.Bytes()), TeletextOptions{})
+	require.NoError(t, err)
+	require.Len(t, ss, 2)
+	require.Contains(t, ss, 888)
+	assert.Equal(t, LanguageEnglish, ss[888].Metadata.Language)
+	assert.Equal(t, "eng", ss[888].Metadata.TeletextLanguage)
+	assert.Equal(t, uint8(astits.TeletextTypeTeletextSubtitlePageForHearingImpairedPeople), ss[888].Metadata.TeletextType)
+	require.Len(t, ss[888].Items, 1)
+	assert.Equal(t, time.Second, ss[888].Items[0].StartAt)
+	assert.Equal(t, 3*time.Second, ss[888].Items[0].EndAt)
+	assert.Equal(t, "english", ss[888].Items[0].String())
+	require.Contains(t, ss, 777)
+	assert.Equal(t, "", ss[777].Metadata.TeletextLanguage)
+	require.Len(t, ss[777].Items, 1)
+	assert.Equal(t, 2*time.Second, ss[777].Items[0].StartAt)
+	assert.Equal(t, 4*time.Second, ss[777].Items[0].EndAt)
+	assert.Equal(t, "français", ss[777].Items[0].String())
+
+	// Read a single page
+	ss, err = ReadAllFromTeletext(bytes.NewReader(b.Bytes()), TeletextOptions{Page: 777})
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	assert.Contains(t, ss, 777)
+}
+
+func TestTeletextLoop(t *testing.T) {
+	// Create writers on different PIDs
+	s := Subtitles{Items: []*Item{{EndAt: 3 * time.Second, Lines: []Line{{Items: []LineItem{{Text: "text"}}}}, StartAt: time.Second}}}
+	w1 := newTeletextWriter(s, TeletextOptions{Page: 888, PID: 0x100})
+	w2 := newTeletextWriter(s, TeletextOptions{Page: 888, PID: 0x101})
+
+	// Create muxer
+	b := &bytes.Buffer{}
+	m := astits.NewMuxer(context.Background(), b)
+	for _, pid := range []uint16{0x100, 0x101} {
+		require.NoError(t, m.AddElementaryStream(astits.PMTElementaryStream{ElementaryPID: pid, StreamType: astits.StreamTypePrivateData}))
+	}
+	m.SetPCRPID(0x100)
+	tm := newTeletextMuxer(m)
+
+	// Write pages
+	require.NoError(t, w1.writePage(tm, s.Items[0], time.Second))
+	require.NoError(t, w2.writePage(tm, s.Items[0], 2*time.Second))
+	require.NoError(t, w1.writePage(tm, nil, 3*time.Second))
+	require.NoError(t, w2.writePage(tm, nil, 5*time.Second))
+
+	// Loop
+	var pmts int
+	var ts []time.Time
+	firstTime, lastTime, err := teletextLoop(astits.NewDemuxer(context.Background(), bytes.NewReader(b.Bytes())), 0x100, func(d *astits.PMTData) {
+		pmts++
+	}, func(d *astits.PESData, t time.Time) {
+		ts = append(ts, t)
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, pmts)
+	require.Len(t, ts, 2)
+	assert.Equal(t, firstTime, ts[0])
+	assert.Equal(t, lastTime, ts[1])
+	assert.Equal(t, 2*time.Second, lastTime.Sub(firstTime))
+
+	// PMT callback is optional
+	_, _, err = teletextLoop(astits.NewDemuxer(context.Background(), bytes.NewReader(b.Bytes())), 0x101, nil, func(d *astits.PESData, t time.Time) {})
+	require.NoError(t, err)
+}
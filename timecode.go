@@ -0,0 +1,184 @@
+package astisub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timecode represents an SMPTE timecode such as 10:00:00:00
+// Timecodes label frames: with NTSC framerates such as 29.97, a non drop frame timecode drifts from the wall clock
+// (01:00:00:00 lasts 3603.6s) whereas a drop frame timecode (01:00:00;00) skips labels to stay in sync with it.
+type Timecode struct {
+	DropFrame bool
+	Framerate Framerate
+	Frames    int64 // Number of frames since 00:00:00:00
+}
+
+// NewTimecode creates a timecode out of its hh:mm:ss:ff components
+func NewTimecode(hours, minutes, seconds, frames int, f Framerate, dropFrame bool) (t Timecode, err error) {
+	// Validate framerate
+	if !f.valid() {
+		err = fmt.Errorf("astisub: invalid framerate %s", f)
+		return
+	}
+	if dropFrame && f.dropFrames() == 0 {
+		err = fmt.Errorf("astisub: drop frame is not supported with framerate %s", f)
+		return
+	}
+
+	// Validate components
+	if hours < 0 || minutes < 0 || minutes > 59 || seconds < 0 || seconds > 59 || frames < 0 || frames >= f.nominal() {
+		err = fmt.Errorf("astisub: invalid timecode components %d:%d:%d:%d", hours, minutes, seconds, frames)
+		return
+	}
+	if dropFrame && seconds == 0 && minutes%10 != 0 && frames < f.dropFrames() {
+		err = fmt.Errorf("astisub: timecode label %d:%d:%d;%d is dropped", hours, minutes, seconds, frames)
+		return
+	}
+
+	// Create timecode
+	t = Timecode{
+		DropFrame: dropFrame,
+		Framerate: f,
+		Frames:    f.timecodeFrames(hours, minutes, seconds, frames, dropFrame),
+	}
+	return
+}
+
+// NewTimecodeFromDuration creates the timecode of the frame being displayed at a duration
+// Drop frame is ignored if the framerate doesn't support it.
+func NewTimecodeFromDuration(d time.Duration, f Framerate, dropFrame bool) Timecode {
+	return Timecode{
+		DropFrame: dropFrame && f.dropFrames() > 0,
+		Framerate: f,
+		Frames:    f.Frames(d),
+	}
+}
+
+// ParseTimecode parses a timecode such as "10:00:00:00"
+// Drop frame timecodes use ";" or "," as their last separator such as "10:00:00;00".
+func ParseTimecode(i string, f Framerate) (t Timecode, err error) {
+	// Split
+	i = strings.TrimSpace(i)
+	ps := strings.FieldsFunc(i, func(r rune) bool { return r == ':' || r == ';' || r == ',' || r == '.' })
+	if len(ps) != 4 {
+		err = fmt.Errorf("astisub: invalid timecode %s", i)
+		return
+	}
+
+	// Parse components
+	var cs []int
+	for _, p := range ps {
+		var c int
+		if c, err = strconv.Atoi(p); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", p, err)
+			return
+		}
+		cs = append(cs, c)
+	}
+
+	// Create timecode
+	dropFrame := strings.ContainsAny(i, ";,")
+	if t, err = NewTimecode(cs[0], cs[1], cs[2], cs[3], f, dropFrame); err != nil {
+		err = fmt.Errorf("astisub: creating timecode failed: %w", err)
+		return
+	}
+	return
+}
+
+// Components returns the timecode hh:mm:ss:ff components
+func (t Timecode) Components() (hours, minutes, seconds, frames int) {
+	// Invalid framerate
+	n := t.Frames
+	nominal := int64(t.Framerate.nominal())
+	if nominal == 0 {
+		return
+	}
+
+	// Add labels skipped by drop frame timecodes
+	if d := int64(t.Framerate.dropFrames()); t.DropFrame && d > 0 {
+		framesPer10Minutes := nominal*600 - 9*d
+		framesPerMinute := nominal*60 - d
+		tens, r := n/framesPer10Minutes, n%framesPer10Minutes
+		n += 9 * d * tens
+		if r > d {
+			n += d * ((r - d) / framesPerMinute)
+		}
+	}
+
+	// Split
+	frames = int(n % nominal)
+	n /= nominal
+	seconds = int(n % 60)
+	n /= 60
+	minutes = int(n % 60)
+	hours = int(n / 60)
+	return
+}
+
+// String implements the Stringer interface
+func (t Timecode) String() string {
+	// Negative timecodes are labelled by their absolute value
+	var sign string
+	if t.Frames < 0 {
+		sign = "-"
+		t.Frames = -t.Frames
+	}
+
+	// Format
+	hours, minutes, seconds, frames := t.Components()
+	separator := ":"
+	if t.DropFrame {
+		separator = ";"
+	}
+	return fmt.Sprintf("%s%.2d:%.2d:%.2d%s%.2d", sign, hours, minutes, seconds, separator, frames)
+}
+
+// Duration returns the duration elapsed since 00:00:00:00
+func (t Timecode) Duration() time.Duration {
+	if !t.Framerate.valid() {
+		return 0
+	}
+	return t.Framerate.Duration(t.Frames)
+}
+
+// Add returns the timecode of the frame being displayed a duration later
+func (t Timecode) Add(d time.Duration) Timecode {
+	if !t.Framerate.valid() {
+		return t
+	}
+	t.Frames = t.Framerate.Frames(t.Duration() + d)
+	return t
+}
+
+// AddFrames returns the timecode a number of frames later
+func (t Timecode) AddFrames(n int64) Timecode {
+	t.Frames += n
+	return t
+}
+
+// Sub returns the duration elapsed between both timecodes
+func (t Timecode) Sub(u Timecode) time.Duration {
+	return t.Duration() - u.Duration()
+}
+
+// dropFrames returns the number of labels dropped every minute except every tenth minute by drop frame timecodes,
+// or 0 if the framerate doesn't support drop frame
+func (f Framerate) dropFrames() int {
+	if f.Den != 1001 || f.Num%30000 != 0 {
+		return 0
+	}
+	return f.nominal() / 15
+}
+
+// timecodeFrames returns the number of frames since 00:00:00:00 of timecode components
+func (f Framerate) timecodeFrames(hours, minutes, seconds, frames int, dropFrame bool) (n int64) {
+	n = ((int64(hours)*60+int64(minutes))*60+int64(seconds))*int64(f.nominal()) + int64(frames)
+	if d := int64(f.dropFrames()); dropFrame && d > 0 {
+		m := int64(hours)*60 + int64(minutes)
+		n -= d * (m - m/10)
+	}
+	return
+}
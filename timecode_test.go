@@ -0,0 +1,67 @@
+package astisub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimecode(t *testing.T) {
+	// Non drop frame
+	tc, err := astisub.ParseTimecode("10:00:00:00", astisub.Framerate25)
+	require.NoError(t, err)
+	assert.Equal(t, int64(900000), tc.Frames)
+	assert.Equal(t, 10*time.Hour, tc.Duration())
+	assert.Equal(t, "10:00:00:00", tc.String())
+	assert.Equal(t, "10:00:01:12", tc.Add(1480*time.Millisecond).String())
+	assert.Equal(t, "09:59:59:24", tc.AddFrames(-1).String())
+	assert.Equal(t, 40*time.Millisecond, tc.AddFrames(1).Sub(tc))
+
+	// Non drop frame timecodes drift from the wall clock with NTSC framerates
+	tc, err = astisub.ParseTimecode("01:00:00:00", astisub.Framerate2997)
+	require.NoError(t, err)
+	assert.Equal(t, 3603600*time.Millisecond, tc.Duration())
+
+	// Drop frame
+	tc, err = astisub.ParseTimecode("01:00:00;00", astisub.Framerate2997)
+	require.NoError(t, err)
+	assert.True(t, tc.DropFrame)
+	assert.Equal(t, int64(107892), tc.Frames)
+	assert.Equal(t, 3599996400*time.Microsecond, tc.Duration())
+	for _, v := range []struct {
+		frames int64
+		s      string
+	}{
+		{frames: 1799, s: "00:00:59;29"},
+		{frames: 1800, s: "00:01:00;02"},
+		{frames: 17982, s: "00:10:00;00"},
+		{frames: 19781, s: "00:10:59;29"},
+		{frames: 19782, s: "00:11:00;02"},
+	} {
+		tc = astisub.Timecode{DropFrame: true, Framerate: astisub.Framerate2997, Frames: v.frames}
+		assert.Equal(t, v.s, tc.String())
+		tc, err = astisub.ParseTimecode(v.s, astisub.Framerate2997)
+		require.NoError(t, err)
+		assert.Equal(t, v.frames, tc.Frames)
+	}
+	tc, err = astisub.ParseTimecode("00:00:00;00", astisub.Framerate5994)
+	require.NoError(t, err)
+	assert.Equal(t, "00:01:00;04", tc.AddFrames(3600).String())
+
+	// Durations
+	tc = astisub.NewTimecodeFromDuration(time.Hour, astisub.Framerate2997, true)
+	assert.Equal(t, "01:00:00;00", tc.String())
+	assert.Equal(t, "01:00:00;04", tc.AddFrames(4).String())
+	assert.Equal(t, "-00:00:01:00", astisub.NewTimecodeFromDuration(-time.Second, astisub.Framerate25, false).String())
+
+	// Errors
+	for _, v := range []string{"00:01:00;00", "00:00:60:00", "00:00:00:25", "00:00:00", "aa:00:00:00"} {
+		_, err = astisub.ParseTimecode(v, astisub.Framerate25)
+		assert.Error(t, err, v)
+	}
+	_, err = astisub.ParseTimecode("00:01:00;01", astisub.Framerate2997)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package astisub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SegmentTimeline represents the segment boundaries of a rendition, such as the video of an existing HLS or
+// DASH stream, which subtitles segments must line up with. The subtitles timeline starts with the timeline.
+type SegmentTimeline struct {
+	// Media sequence number (HLS) or start number (DASH) of the first segment
+	MediaSequence int
+	// Wall clock time of the timeline start, if known
+	ProgramDateTime *time.Time
+	Segments        []TimelineSegment
+}
+
+// TimelineSegment represents a segment of a timeline
+type TimelineSegment struct {
+	// Whether the segment follows a discontinuity
+	Discontinuity bool
+	Duration      time.Duration
+	StartAt       time.Duration
+	// Segment URI, only set when read from an HLS media playlist
+	URI string
+}
+
+// EndAt returns the segment end
+func (s TimelineSegment) EndAt() time.Duration {
+	return s.StartAt + s.Duration
+}
+
+// OpenSegmentTimeline opens a segment timeline out of an HLS media playlist (.m3u8) or a DASH MPD (.mpd)
+func OpenSegmentTimeline(filename string) (t *SegmentTimeline, err error) {
+	// Open the file
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		err = fmt.Errorf("astisub: opening %s failed: %w", filename, err)
+		return
+	}
+	defer f.Close()
+
+	// Parse the content
+	switch filepath.Ext(strings.ToLower(filename)) {
+	case ".m3u8":
+		t, err = ReadSegmentTimelineFromHLS(f)
+	case ".mpd":
+		t, err = ReadSegmentTimelineFromMPD(f)
+	default:
+		err = ErrInvalidExtension
+	}
+	return
+}
+
+// newSegmentTimeline creates a timeline out of contiguous segment ends
+func newSegmentTimeline(ends []time.Duration) (t *SegmentTimeline) {
+	t = &SegmentTimeline{}
+	var start time.Duration
+	for _, end := range ends {
+		t.Segments = append(t.Segments, TimelineSegment{Duration: end - start, StartAt: start})
+		start = end
+	}
+	return
+}
+
+// SegmentWithTimeline splits subtitles into segments matching the timeline's. Items overlapping several segments
+// are added to each of them.
+func (s *Subtitles) SegmentWithTimeline(t SegmentTimeline) (subs []*Subtitles) {
+	s.Order()
+	for _, seg := range t.Segments {
+		subs = append(subs, s.between(seg.StartAt, seg.EndAt()))
+	}
+	return
+}
@@ -0,0 +1,136 @@
+package astisub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSegmentTimelineFromHLS(t *testing.T) {
+	tl, err := astisub.ReadSegmentTimelineFromHLS(strings.NewReader(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:6.006,
+video10.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:06.006Z
+#EXTINF:5.005,title
+video11.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:20.000+00:00
+#EXTINF:4,
+video12.ts
+#EXT-X-ENDLIST
+`))
+	require.NoError(t, err)
+	pdt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NotNil(t, tl.ProgramDateTime)
+	assert.True(t, pdt.Equal(*tl.ProgramDateTime))
+	assert.Equal(t, 10, tl.MediaSequence)
+	assert.Equal(t, []astisub.TimelineSegment{
+		{Duration: 6006 * time.Millisecond, URI: "video10.ts"},
+		{Duration: 5005 * time.Millisecond, StartAt: 6006 * time.Millisecond, URI: "video11.ts"},
+		{Discontinuity: true, Duration: 4 * time.Second, StartAt: 20 * time.Second, URI: "video12.ts"},
+	}, tl.Segments)
+
+	// Multivariant playlist
+	_, err = astisub.ReadSegmentTimelineFromHLS(strings.NewReader("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n"))
+	assert.Error(t, err)
+}
+
+func TestReadSegmentTimelineFromMPD(t *testing.T) {
+	tl, err := astisub.ReadSegmentTimelineFromMPD(strings.NewReader(`<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static">
+  <Period start="PT0S">
+    <AdaptationSet contentType="audio">
+      <SegmentTemplate timescale="48000" startNumber="1">
+        <SegmentTimeline><S t="0" d="96000" r="10"/></SegmentTimeline>
+      </SegmentTemplate>
+    </AdaptationSet>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate timescale="90000" startNumber="5" presentationTimeOffset="90000" media="v_$Number$.m4s">
+        <SegmentTimeline>
+          <S t="90000" d="180000" r="1"/>
+          <S d="90000"/>
+          <S t="540000" d="45000" r="-1"/>
+          <S t="630000" d="90000"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="v1"/>
+    </AdaptationSet>
+  </Period>
+  <Period start="PT1M">
+    <AdaptationSet contentType="video">
+      <Representation id="v2">
+        <SegmentTemplate timescale="1000">
+          <SegmentTimeline><S d="2000"/></SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`))
+	require.NoError(t, err)
+	assert.Equal(t, 5, tl.MediaSequence)
+	assert.Equal(t, []astisub.TimelineSegment{
+		{Duration: 2 * time.Second},
+		{Duration: 2 * time.Second, StartAt: 2 * time.Second},
+		{Duration: time.Second, StartAt: 4 * time.Second},
+		{Duration: 500 * time.Millisecond, StartAt: 5 * time.Second},
+		{Duration: 500 * time.Millisecond, StartAt: 5500 * time.Millisecond},
+		{Duration: time.Second, StartAt: 6 * time.Second},
+		{Discontinuity: true, Duration: 2 * time.Second, StartAt: time.Minute},
+	}, tl.Segments)
+}
+
+func TestHLSWithTimeline(t *testing.T) {
+	s := astisub.NewSubtitles()
+	s.Items = []*astisub.Item{
+		{EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: time.Second},
+		{EndAt: 8 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: 7 * time.Second},
+	}
+	s.Speakers["Joe"] = &astisub.Speaker{ID: "Joe", Name: "Joe"}
+	pdt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tl := astisub.SegmentTimeline{
+		MediaSequence:   3,
+		ProgramDateTime: &pdt,
+		Segments: []astisub.TimelineSegment{
+			{Duration: 2 * time.Second},
+			{Duration: 2 * time.Second, StartAt: 2 * time.Second},
+			{Discontinuity: true, Duration: 2 * time.Second, StartAt: 6 * time.Second},
+		},
+	}
+
+	ss := s.SegmentWithTimeline(tl)
+	require.Len(t, ss, 3)
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, ss[1].Items)
+	assert.Equal(t, []*astisub.Item{s.Items[1]}, ss[2].Items)
+	for _, sub := range ss {
+		assert.Equal(t, s.Speakers, sub.Speakers)
+	}
+
+	r, err := s.HLSRendition(astisub.HLSOptions{SegmentDuration: time.Hour, Timeline: &tl})
+	require.NoError(t, err)
+	b := &bytes.Buffer{}
+	require.NoError(t, r.WriteMediaPlaylist(b))
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00.000Z
+#EXTINF:2.000,
+seg-003.vtt
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:02.000Z
+#EXTINF:2.000,
+seg-004.vtt
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:06.000Z
+#EXTINF:2.000,
+seg-005.vtt
+#EXT-X-ENDLIST
+`, b.String())
+}
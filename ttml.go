@@ -4,11 +4,13 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/asticode/go-astikit"
 )
@@ -40,36 +42,427 @@ var (
 	ttmlRegexpOffsetTime      = regexp.MustCompile(`^(\d+(\.\d+)?)(h|m|s|ms|f|t)$`)
 )
 
+// TTML time base and drop mode
+const (
+	ttmlDropModeNTSC  = "dropNTSC"
+	ttmlTimeBaseSMPTE = "smpte"
+)
+
+// TTML default cell resolution is 32 columns by 15 rows
+const (
+	ttmlDefaultCellColumns = 32
+	ttmlDefaultCellRows    = 15
+)
+
+// TTML named colors
+var ttmlNamedColors = map[string]*Color{
+	"aqua":        ColorCyan,
+	"black":       ColorBlack,
+	"blue":        ColorBlue,
+	"cyan":        ColorCyan,
+	"fuchsia":     ColorMagenta,
+	"gray":        ColorGray,
+	"green":       ColorGreen,
+	"lime":        ColorLime,
+	"magenta":     ColorMagenta,
+	"maroon":      ColorMaroon,
+	"navy":        ColorNavy,
+	"olive":       ColorOlive,
+	"purple":      ColorPurple,
+	"red":         ColorRed,
+	"silver":      ColorSilver,
+	"teal":        ColorTeal,
+	"transparent": {Alpha: 255},
+	"white":       ColorWhite,
+	"yellow":      ColorYellow,
+}
+
+// TTML color names used when writing. Synonyms such as "aqua" or "fuchsia" are written as "cyan" or "magenta".
+var ttmlColorNames = []string{"black", "blue", "cyan", "gray", "green", "lime", "magenta", "maroon", "navy", "olive", "purple", "red", "silver", "teal", "transparent", "white", "yellow"}
+
+// newColorFromTTMLString parses a TTML color (#rgb, #rrggbb, #rrggbbaa, rgb(), rgba() or a named color)
+func newColorFromTTMLString(i string) (c *Color, err error) {
+	// Named color
+	i = strings.TrimSpace(i)
+	if c, ok := ttmlNamedColors[strings.ToLower(i)]; ok {
+		return c, nil
+	}
+
+	// Hexadecimal color
+	if strings.HasPrefix(i, "#") {
+		h := i[1:]
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		if len(h) != 6 && len(h) != 8 {
+			err = fmt.Errorf("astisub: invalid TTML color %s", i)
+			return
+		}
+		var v uint64
+		if v, err = strconv.ParseUint(h, 16, 32); err != nil {
+			err = fmt.Errorf("astisub: parsing TTML color %s failed: %w", i, err)
+			return
+		}
+		if len(h) == 6 {
+			v = v<<8 | 0xff
+		}
+		return &Color{Alpha: 255 - uint8(v), Blue: uint8(v >> 8), Green: uint8(v >> 16), Red: uint8(v >> 24)}, nil
+	}
+
+	// Functional color
+	for _, f := range []string{"rgba", "rgb"} {
+		if !strings.HasPrefix(i, f+"(") || !strings.HasSuffix(i, ")") {
+			continue
+		}
+		ps := strings.Split(i[len(f)+1:len(i)-1], ",")
+		if len(ps) != len(f) {
+			err = fmt.Errorf("astisub: invalid TTML color %s", i)
+			return
+		}
+		var vs []uint8
+		for _, p := range ps {
+			var v uint64
+			if v, err = strconv.ParseUint(strings.TrimSpace(p), 10, 8); err != nil {
+				err = fmt.Errorf("astisub: parsing TTML color %s failed: %w", i, err)
+				return
+			}
+			vs = append(vs, uint8(v))
+		}
+		c = &Color{Blue: vs[2], Green: vs[1], Red: vs[0]}
+		if len(vs) == 4 {
+			c.Alpha = 255 - vs[3]
+		}
+		return
+	}
+	err = fmt.Errorf("astisub: invalid TTML color %s", i)
+	return
+}
+
+// formatTTMLColor expresses a color as a TTML named color if one matches, as a hexadecimal color otherwise
+func formatTTMLColor(c *Color) string {
+	for _, n := range ttmlColorNames {
+		if *ttmlNamedColors[n] == *c {
+			return n
+		}
+	}
+	return c.ttmlString()
+}
+
+// TTML length units
+const (
+	TTMLLengthUnitCell       = "c"
+	TTMLLengthUnitEm         = "em"
+	TTMLLengthUnitPercentage = "%"
+	TTMLLengthUnitPixel      = "px"
+	TTMLLengthUnitRootHeight = "rh"
+	TTMLLengthUnitRootWidth  = "rw"
+)
+
+// Units are ordered so that the "c" suffix is checked last
+var ttmlLengthUnits = []string{
+	TTMLLengthUnitPixel,
+	TTMLLengthUnitEm,
+	TTMLLengthUnitRootHeight,
+	TTMLLengthUnitRootWidth,
+	TTMLLengthUnitPercentage,
+	TTMLLengthUnitCell,
+}
+
+// TTMLLength represents a TTML length such as "10px", "1.5c" or "80%"
+type TTMLLength struct {
+	Unit  string
+	Value float64
+}
+
+func newTTMLLengthFromString(i string) (l TTMLLength, err error) {
+	i = strings.TrimSpace(i)
+	for _, u := range ttmlLengthUnits {
+		if !strings.HasSuffix(i, u) {
+			continue
+		}
+		l.Unit = u
+		if l.Value, err = strconv.ParseFloat(strings.TrimSuffix(i, u), 64); err != nil {
+			err = fmt.Errorf("astisub: parsing TTML length %s failed: %w", i, err)
+		}
+		return
+	}
+	err = fmt.Errorf("astisub: invalid TTML length %s", i)
+	return
+}
+
+func (l TTMLLength) String() string {
+	return strconv.FormatFloat(l.Value, 'f', -1, 64) + l.Unit
+}
+
+// percentage converts the length to a percentage of the root container width or height. Pixels and cells are
+// converted using the root container extent and cell resolution, whereas ems can't be converted.
+func (l TTMLLength) percentage(vertical bool, m *Metadata) (float64, bool) {
+	var w, h float64
+	if m != nil && m.TTMLExtent != nil && m.TTMLExtent.Horizontal.Unit == TTMLLengthUnitPixel &&
+		m.TTMLExtent.Vertical.Unit == TTMLLengthUnitPixel && m.TTMLExtent.Horizontal.Value > 0 && m.TTMLExtent.Vertical.Value > 0 {
+		w, h = m.TTMLExtent.Horizontal.Value, m.TTMLExtent.Vertical.Value
+	}
+	switch l.Unit {
+	case TTMLLengthUnitPercentage:
+		return l.Value, true
+	case TTMLLengthUnitCell:
+		r := m.ttmlCellResolution()
+		if vertical {
+			return l.Value * 100 / float64(r.Rows), true
+		}
+		return l.Value * 100 / float64(r.Columns), true
+	case TTMLLengthUnitPixel:
+		if w == 0 {
+			return 0, false
+		}
+		if vertical {
+			return l.Value * 100 / h, true
+		}
+		return l.Value * 100 / w, true
+	case TTMLLengthUnitRootHeight:
+		if vertical {
+			return l.Value, true
+		} else if w > 0 {
+			return l.Value * h / w, true
+		}
+	case TTMLLengthUnitRootWidth:
+		if !vertical {
+			return l.Value, true
+		} else if w > 0 {
+			return l.Value * w / h, true
+		}
+	}
+	return 0, false
+}
+
+// TTMLLengthPair represents a pair of TTML lengths such as an origin, an extent or a font size
+type TTMLLengthPair struct {
+	Horizontal, Vertical TTMLLength
+}
+
+// newTTMLLengthPairFromString parses a pair of TTML lengths. When single is true, a single length applies to
+// both dimensions.
+func newTTMLLengthPairFromString(i string, single bool) (p *TTMLLengthPair, err error) {
+	ls := strings.Fields(i)
+	if len(ls) == 1 && single {
+		ls = append(ls, ls[0])
+	}
+	if len(ls) != 2 {
+		err = fmt.Errorf("astisub: invalid TTML length pair %s", i)
+		return
+	}
+	p = &TTMLLengthPair{}
+	if p.Horizontal, err = newTTMLLengthFromString(ls[0]); err != nil {
+		return
+	}
+	if p.Vertical, err = newTTMLLengthFromString(ls[1]); err != nil {
+		return
+	}
+	return
+}
+
+func (p TTMLLengthPair) String() string {
+	return p.Horizontal.String() + " " + p.Vertical.String()
+}
+
+// percentages converts the pair to percentages of the root container and returns nil if it's not possible
+func (p TTMLLengthPair) percentages(m *Metadata) *Percentages {
+	h, ok := p.Horizontal.percentage(false, m)
+	if !ok {
+		return nil
+	}
+	v, ok := p.Vertical.percentage(true, m)
+	if !ok {
+		return nil
+	}
+	return &Percentages{Horizontal: h, Vertical: v}
+}
+
+// newTTMLPercentagePair creates a TTML length pair expressed in percentages
+func newTTMLPercentagePair(p Percentages) *TTMLLengthPair {
+	return &TTMLLengthPair{
+		Horizontal: TTMLLength{Unit: TTMLLengthUnitPercentage, Value: math.Round(p.Horizontal*100) / 100},
+		Vertical:   TTMLLength{Unit: TTMLLengthUnitPercentage, Value: math.Round(p.Vertical*100) / 100},
+	}
+}
+
+// TTMLCellResolution represents a TTML cell resolution
+type TTMLCellResolution struct {
+	Columns, Rows int
+}
+
+func newTTMLCellResolutionFromString(i string) (r *TTMLCellResolution, err error) {
+	vs := strings.Fields(i)
+	if len(vs) != 2 {
+		err = fmt.Errorf("astisub: invalid TTML cell resolution %s", i)
+		return
+	}
+	r = &TTMLCellResolution{}
+	if r.Columns, err = strconv.Atoi(vs[0]); err != nil {
+		err = fmt.Errorf("astisub: atoi %s failed: %w", vs[0], err)
+		return
+	}
+	if r.Rows, err = strconv.Atoi(vs[1]); err != nil {
+		err = fmt.Errorf("astisub: atoi %s failed: %w", vs[1], err)
+		return
+	}
+	if r.Columns <= 0 || r.Rows <= 0 {
+		err = fmt.Errorf("astisub: invalid TTML cell resolution %s", i)
+	}
+	return
+}
+
+func (r TTMLCellResolution) String() string {
+	return strconv.Itoa(r.Columns) + " " + strconv.Itoa(r.Rows)
+}
+
+// ttmlCellResolution returns the TTML cell resolution or the default one
+func (m *Metadata) ttmlCellResolution() TTMLCellResolution {
+	if m != nil && m.TTMLCellResolution != nil {
+		return *m.TTMLCellResolution
+	}
+	return TTMLCellResolution{Columns: ttmlDefaultCellColumns, Rows: ttmlDefaultCellRows}
+}
+
+// ttmlFontSizePercentage converts a TTML font size to a percentage of the video height. Percentages and ems are
+// relative to the parent font size and are therefore ignored.
+func ttmlFontSizePercentage(p TTMLLengthPair, m *Metadata) *float64 {
+	if p.Vertical.Unit == TTMLLengthUnitPercentage || p.Vertical.Unit == TTMLLengthUnitEm {
+		return nil
+	}
+	v, ok := p.Vertical.percentage(true, m)
+	if !ok {
+		return nil
+	}
+	return astikit.Float64Ptr(v)
+}
+
+// ttmlFontSizeFromPercentage converts a percentage of the video height to a TTML font size expressed in cells
+func ttmlFontSizeFromPercentage(i float64, m *Metadata) *TTMLLengthPair {
+	l := TTMLLength{Unit: TTMLLengthUnitCell, Value: math.Round(i*float64(m.ttmlCellResolution().Rows)) / 100}
+	return &TTMLLengthPair{Horizontal: l, Vertical: l}
+}
+
 // TTMLIn represents an input TTML that must be unmarshaled
 // We split it from the output TTML as we can't add strict namespace without breaking retrocompatibility
 type TTMLIn struct {
-	Framerate int              `xml:"frameRate,attr"`
-	Lang      string           `xml:"lang,attr"`
-	Metadata  TTMLInMetadata   `xml:"head>metadata"`
-	Regions   []TTMLInRegion   `xml:"head>layout>region"`
-	Styles    []TTMLInStyle    `xml:"head>styling>style"`
-	Subtitles []TTMLInSubtitle `xml:"body>div>p"`
-	Tickrate  int              `xml:"tickRate,attr"`
-	XMLName   xml.Name         `xml:"tt"`
+	CellResolution string `xml:"cellResolution,attr"`
+	DropMode       string `xml:"dropMode,attr"`
+	Extent         string `xml:"extent,attr"`
+	Framerate      int    `xml:"frameRate,attr"`
+	// Numerator and denominator applied to the framerate, e.g. "1000 1001" for 29.97 fps
+	FramerateMultiplier string           `xml:"frameRateMultiplier,attr"`
+	Lang                string           `xml:"lang,attr"`
+	Metadata            TTMLInMetadata   `xml:"head>metadata"`
+	Space               string           `xml:"space,attr"`
+	Regions             []TTMLInRegion   `xml:"head>layout>region"`
+	Styles              []TTMLInStyle    `xml:"head>styling>style"`
+	Subtitles           []TTMLInSubtitle `xml:"body>div>p"`
+	Tickrate            int              `xml:"tickRate,attr"`
+	TimeBase            string           `xml:"timeBase,attr"`
+	XMLName             xml.Name         `xml:"tt"`
+}
+
+// framerate returns the effective framerate of the TTML
+// Invalid frame rate multipliers, which are sometimes found with other separators than a space, are ignored.
+func (t TTMLIn) framerate() (f Framerate) {
+	// No framerate
+	if t.Framerate <= 0 {
+		return
+	}
+	f = Framerate{Den: 1, Num: t.Framerate}
+
+	// Apply multiplier
+	ps := strings.FieldsFunc(t.FramerateMultiplier, func(r rune) bool { return !unicode.IsDigit(r) })
+	if len(ps) != 2 {
+		return
+	}
+	numerator, errNumerator := strconv.Atoi(ps[0])
+	denominator, errDenominator := strconv.Atoi(ps[1])
+	if errNumerator != nil || errDenominator != nil || numerator <= 0 || denominator <= 0 {
+		return
+	}
+	return Framerate{Den: denominator, Num: t.Framerate * numerator}
+}
+
+// ttmlFramerate returns the frame rate and frame rate multiplier attributes of a framerate
+func ttmlFramerate(f Framerate) (rate, multiplier string) {
+	// Frame rate is the nominal framerate
+	n := f.nominal()
+	rate = strconv.Itoa(n)
+
+	// Multiplier is the ratio between the framerate and the nominal framerate
+	num, den := f.Num, f.Den*n
+	if num == den {
+		return
+	}
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	multiplier = strconv.Itoa(num/a) + " " + strconv.Itoa(den/a)
+	return
+}
+
+// dropFrame returns whether smpte timecodes are drop frame
+func (t TTMLIn) dropFrame() bool {
+	return t.DropMode == ttmlDropModeNTSC && t.framerate().dropFrames() > 0
 }
 
 // metadata returns the Metadata of the TTML
-func (t TTMLIn) metadata() (m *Metadata) {
+func (t TTMLIn) metadata() (m *Metadata, err error) {
 	m = &Metadata{
-		Framerate:     t.Framerate,
+		Framerate:     t.framerate(),
 		Title:         t.Metadata.Title,
 		TTMLCopyright: t.Metadata.Copyright,
 	}
 	if v, ok := ttmlLanguageMapping.Get(astikit.StrPad(t.Lang, ' ', 2, astikit.PadCut)); ok {
 		m.Language = v.(string)
 	}
+	if len(t.CellResolution) > 0 {
+		if m.TTMLCellResolution, err = newTTMLCellResolutionFromString(t.CellResolution); err != nil {
+			err = fmt.Errorf("astisub: parsing cell resolution failed: %w", err)
+			return
+		}
+	}
+	if len(t.Extent) > 0 && t.Extent != "auto" {
+		if m.TTMLExtent, err = newTTMLLengthPairFromString(t.Extent, false); err != nil {
+			err = fmt.Errorf("astisub: parsing extent failed: %w", err)
+			return
+		}
+	}
 	return
 }
 
 // TTMLInMetadata represents an input TTML Metadata
 type TTMLInMetadata struct {
-	Copyright string `xml:"copyright"`
-	Title     string `xml:"title"`
+	Agents    []TTMLInAgent `xml:"agent"`
+	Copyright string        `xml:"copyright"`
+	Title     string        `xml:"title"`
+}
+
+// TTMLInAgent represents an input TTML agent
+type TTMLInAgent struct {
+	ID    string            `xml:"id,attr"`
+	Names []TTMLInAgentName `xml:"name"`
+	Type  string            `xml:"type,attr"`
+}
+
+// TTMLInAgentName represents an input TTML agent name
+type TTMLInAgentName struct {
+	Text string `xml:",chardata"`
+	Type string `xml:"type,attr"`
+}
+
+// speaker converts TTMLInAgent into a Speaker, the full name being preferred
+func (a TTMLInAgent) speaker() *Speaker {
+	s := &Speaker{ID: a.ID, Name: a.ID}
+	for idx, n := range a.Names {
+		if idx == 0 || n.Type == "full" {
+			s.Name = strings.TrimSpace(n.Text)
+		}
+	}
+	return s
 }
 
 // TTMLInStyleAttributes represents input TTML style attributes
@@ -101,34 +494,70 @@ type TTMLInStyleAttributes struct {
 }
 
 // StyleAttributes converts TTMLInStyleAttributes into a StyleAttributes
-func (s TTMLInStyleAttributes) styleAttributes() (o *StyleAttributes) {
+// Invalid colors, lengths and opacities are skipped so that they don't prevent reading the rest of the document.
+func (s TTMLInStyleAttributes) styleAttributes(m *Metadata) (o *StyleAttributes) {
 	o = &StyleAttributes{
-		TTMLBackgroundColor: s.BackgroundColor,
-		TTMLColor:           s.Color,
-		TTMLDirection:       s.Direction,
-		TTMLDisplay:         s.Display,
-		TTMLDisplayAlign:    s.DisplayAlign,
-		TTMLExtent:          s.Extent,
-		TTMLFontFamily:      s.FontFamily,
-		TTMLFontSize:        s.FontSize,
-		TTMLFontStyle:       s.FontStyle,
-		TTMLFontWeight:      s.FontWeight,
-		TTMLLineHeight:      s.LineHeight,
-		TTMLOpacity:         s.Opacity,
-		TTMLOrigin:          s.Origin,
-		TTMLOverflow:        s.Overflow,
-		TTMLPadding:         s.Padding,
-		TTMLShowBackground:  s.ShowBackground,
-		TTMLTextAlign:       s.TextAlign,
-		TTMLTextDecoration:  s.TextDecoration,
-		TTMLTextOutline:     s.TextOutline,
-		TTMLUnicodeBidi:     s.UnicodeBidi,
-		TTMLVisibility:      s.Visibility,
-		TTMLWrapOption:      s.WrapOption,
-		TTMLWritingMode:     s.WritingMode,
-		TTMLZIndex:          s.ZIndex,
-	}
-	o.propagateTTMLAttributes()
+		TTMLDirection:      s.Direction,
+		TTMLDisplay:        s.Display,
+		TTMLDisplayAlign:   s.DisplayAlign,
+		TTMLFontFamily:     s.FontFamily,
+		TTMLFontStyle:      s.FontStyle,
+		TTMLFontWeight:     s.FontWeight,
+		TTMLOverflow:       s.Overflow,
+		TTMLPadding:        s.Padding,
+		TTMLShowBackground: s.ShowBackground,
+		TTMLTextAlign:      s.TextAlign,
+		TTMLTextDecoration: s.TextDecoration,
+		TTMLTextOutline:    s.TextOutline,
+		TTMLUnicodeBidi:    s.UnicodeBidi,
+		TTMLVisibility:     s.Visibility,
+		TTMLWrapOption:     s.WrapOption,
+		TTMLWritingMode:    s.WritingMode,
+		TTMLZIndex:         s.ZIndex,
+	}
+
+	// Colors
+	if s.BackgroundColor != nil {
+		if v, err := newColorFromTTMLString(*s.BackgroundColor); err == nil {
+			o.TTMLBackgroundColor = v
+		}
+	}
+	if s.Color != nil {
+		if v, err := newColorFromTTMLString(*s.Color); err == nil {
+			o.TTMLColor = v
+		}
+	}
+
+	// Lengths
+	if s.Extent != nil && strings.TrimSpace(*s.Extent) != "auto" {
+		if v, err := newTTMLLengthPairFromString(*s.Extent, false); err == nil {
+			o.TTMLExtent = v
+		}
+	}
+	if s.FontSize != nil {
+		if v, err := newTTMLLengthPairFromString(*s.FontSize, true); err == nil {
+			o.TTMLFontSize = v
+		}
+	}
+	if s.LineHeight != nil && strings.TrimSpace(*s.LineHeight) != "normal" {
+		if l, err := newTTMLLengthFromString(*s.LineHeight); err == nil {
+			o.TTMLLineHeight = &l
+		}
+	}
+	if s.Origin != nil && strings.TrimSpace(*s.Origin) != "auto" {
+		if v, err := newTTMLLengthPairFromString(*s.Origin, false); err == nil {
+			o.TTMLOrigin = v
+		}
+	}
+
+	// Opacity
+	if s.Opacity != nil {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(*s.Opacity), 64); err == nil {
+			o.TTMLOpacity = astikit.Float64Ptr(f)
+		}
+	}
+
+	o.propagateTTMLAttributes(m)
 	return
 }
 
@@ -153,11 +582,13 @@ type TTMLInStyle struct {
 
 // TTMLInSubtitle represents an input TTML subtitle
 type TTMLInSubtitle struct {
+	Agent  string          `xml:"agent,attr,omitempty"`
 	Begin  *TTMLInDuration `xml:"begin,attr,omitempty"`
 	End    *TTMLInDuration `xml:"end,attr,omitempty"`
 	ID     string          `xml:"id,attr,omitempty"`
 	Items  string          `xml:",innerxml"` // We must store inner XML here since there's no tag to describe both any tag and chardata
 	Region string          `xml:"region,attr,omitempty"`
+	Space  string          `xml:"space,attr,omitempty"`
 	Style  string          `xml:"style,attr,omitempty"`
 	TTMLInStyleAttributes
 }
@@ -187,11 +618,9 @@ func (i *TTMLInItems) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err
 				return
 			}
 			*i = append(*i, e)
-		} else if b, ok := t.(xml.CharData); ok {
-			var str = strings.TrimSpace(string(b))
-			if len(str) > 0 {
-				*i = append(*i, TTMLInItem{Text: str})
-			}
+		} else if b, ok := t.(xml.CharData); ok && len(b) > 0 {
+			// Whitespace is handled once xml:space is known
+			*i = append(*i, TTMLInItem{Text: string(b)})
 		}
 	}
 	return nil
@@ -199,17 +628,26 @@ func (i *TTMLInItems) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err
 
 // TTMLInItem represents an input TTML item
 type TTMLInItem struct {
-	Style string `xml:"style,attr,omitempty"`
-	Text  string `xml:",chardata"`
+	Agent string       `xml:"agent,attr,omitempty"`
+	Items []TTMLInItem `xml:"span"` // Only used for ruby containers
+	Lang  string       `xml:"lang,attr,omitempty"`
+	Ruby  string       `xml:"ruby,attr,omitempty"`
+	Space string       `xml:"space,attr,omitempty"`
+	Style string       `xml:"style,attr,omitempty"`
+	Text  string       `xml:",chardata"`
 	TTMLInStyleAttributes
 	XMLName xml.Name
 }
 
 // TTMLInDuration represents an input TTML duration
 type TTMLInDuration struct {
-	d                 time.Duration
-	frames, framerate int // Framerate is in frame/s
-	ticks, tickrate   int // Tickrate is in ticks/s
+	d               time.Duration
+	dropFrame       bool
+	frames          int
+	framerate       Framerate
+	smpte           bool // Whether the time base is smpte, in which case clock times with frames are timecodes
+	timecode        bool // Whether the value is a clock time with frames
+	ticks, tickrate int  // Tickrate is in ticks/s
 }
 
 // UnmarshalText implements the TextUnmarshaler interface
@@ -222,6 +660,7 @@ func (d *TTMLInDuration) UnmarshalText(i []byte) (err error) {
 	d.d = time.Duration(0)
 	d.frames = 0
 	d.ticks = 0
+	d.timecode = false
 
 	// Check offset time
 	text := string(i)
@@ -274,6 +713,7 @@ func (d *TTMLInDuration) UnmarshalText(i []byte) (err error) {
 		}
 
 		// Update text
+		d.timecode = true
 		text = text[:indexes[0]] + ".000"
 	}
 
@@ -286,9 +726,17 @@ func (d TTMLInDuration) duration() (o time.Duration) {
 	if d.ticks > 0 && d.tickrate > 0 {
 		return time.Duration(float64(d.ticks) * 1e9 / float64(d.tickrate))
 	}
+	if d.smpte && d.timecode && d.framerate.valid() && d.d%time.Second == 0 {
+		s := int(d.d / time.Second)
+		return Timecode{
+			DropFrame: d.dropFrame,
+			Framerate: d.framerate,
+			Frames:    d.framerate.timecodeFrames(s/3600, s/60%60, s%60, d.frames, d.dropFrame),
+		}.Duration()
+	}
 	o = d.d
-	if d.frames > 0 && d.framerate > 0 {
-		o += time.Duration(float64(d.frames) / float64(d.framerate) * float64(time.Second.Nanoseconds()))
+	if d.frames > 0 && d.framerate.valid() {
+		o += d.framerate.Duration(int64(d.frames))
 	}
 	return
 }
@@ -306,15 +754,37 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 	}
 
 	// Add metadata
-	o.Metadata = ttml.metadata()
+	if o.Metadata, err = ttml.metadata(); err != nil {
+		err = fmt.Errorf("astisub: building metadata failed: %w", err)
+		return
+	}
+
+	// Loop through agents
+	for _, a := range ttml.Metadata.Agents {
+		sp := a.speaker()
+		o.Speakers[sp.ID] = sp
+	}
+
+	// Agents may reference several agents, in which case only the first one is used. Agents that are not declared
+	// fall back to a speaker named after the reference.
+	var speaker = func(agent string) (sp *Speaker) {
+		fs := strings.Fields(agent)
+		if len(fs) == 0 {
+			return
+		}
+		var ok bool
+		if sp, ok = o.Speakers[fs[0]]; !ok {
+			sp = &Speaker{ID: fs[0], Name: fs[0]}
+			o.Speakers[sp.ID] = sp
+		}
+		return
+	}
 
 	// Loop through styles
 	var parentStyles = make(map[string]*Style)
 	for _, ts := range ttml.Styles {
-		var s = &Style{
-			ID:          ts.ID,
-			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(),
-		}
+		var s = &Style{ID: ts.ID}
+		s.InlineStyle = ts.TTMLInStyleAttributes.styleAttributes(o.Metadata)
 		o.Styles[s.ID] = s
 		if len(ts.Style) > 0 {
 			parentStyles[ts.Style] = s
@@ -332,10 +802,8 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 
 	// Loop through regions
 	for _, tr := range ttml.Regions {
-		var r = &Region{
-			ID:          tr.ID,
-			InlineStyle: tr.TTMLInStyleAttributes.styleAttributes(),
-		}
+		var r = &Region{ID: tr.ID}
+		r.InlineStyle = tr.TTMLInStyleAttributes.styleAttributes(o.Metadata)
 		if len(tr.Style) > 0 {
 			if _, ok := o.Styles[tr.Style]; !ok {
 				err = fmt.Errorf("astisub: Style %s requested by region %s doesn't exist", tr.Style, r.ID)
@@ -349,16 +817,20 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 	// Loop through subtitles
 	for _, ts := range ttml.Subtitles {
 		// Init item
-		ts.Begin.framerate = ttml.Framerate
+		ts.Begin.dropFrame = ttml.dropFrame()
+		ts.Begin.framerate = ttml.framerate()
+		ts.Begin.smpte = ttml.TimeBase == ttmlTimeBaseSMPTE
 		ts.Begin.tickrate = ttml.Tickrate
-		ts.End.framerate = ttml.Framerate
+		ts.End.dropFrame = ts.Begin.dropFrame
+		ts.End.framerate = ts.Begin.framerate
+		ts.End.smpte = ts.Begin.smpte
 		ts.End.tickrate = ttml.Tickrate
 
 		var s = &Item{
-			EndAt:       ts.End.duration(),
-			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(),
-			StartAt:     ts.Begin.duration(),
+			EndAt:   ts.End.duration(),
+			StartAt: ts.Begin.duration(),
 		}
+		s.InlineStyle = ts.TTMLInStyleAttributes.styleAttributes(o.Metadata)
 
 		// Add region
 		if len(ts.Region) > 0 {
@@ -378,6 +850,9 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 			s.Style = o.Styles[ts.Style]
 		}
 
+		// Add speaker
+		itemSpeaker := speaker(ts.Agent)
+
 		// Unmarshal items
 		var items = TTMLInItems{}
 		if err = xml.Unmarshal([]byte("<span>"+ts.Items+"</span>"), &items); err != nil {
@@ -387,7 +862,16 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 
 		// Loop through texts
 		var l = &Line{}
+		preserveSubtitle := ttmlPreservesSpace(ttmlPreservesSpace(false, ttml.Space), ts.Space)
 		for _, tt := range items {
+			// Whitespace is only kept as written when xml:space is "preserve"
+			preserve := ttmlPreservesSpace(preserveSubtitle, tt.Space)
+			if !preserve && tt.XMLName.Local == "" {
+				if tt.Text = strings.TrimSpace(tt.Text); tt.Text == "" {
+					continue
+				}
+			}
+
 			// New line specified with the "br" tag
 			if strings.ToLower(tt.XMLName.Local) == "br" {
 				s.Lines = append(s.Lines, *l)
@@ -395,6 +879,20 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 				continue
 			}
 
+			// Ruby containers hold both the base text and its annotation
+			var rubyText string
+			if tt.Ruby == "container" {
+				tt.Text = ""
+				for _, c := range tt.Items {
+					switch c.Ruby {
+					case "base":
+						tt.Text += c.Text
+					case "text":
+						rubyText += c.Text
+					}
+				}
+			}
+
 			// New line decoded as a line break. This can happen if there's a "br" tag within the text since
 			// since the go xml unmarshaler will unmarshal a "br" tag as a line break if the field has the
 			// chardata xml tag.
@@ -406,10 +904,12 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 				}
 
 				// Init line item
-				var t = LineItem{
-					InlineStyle: tt.TTMLInStyleAttributes.styleAttributes(),
-					Text:        strings.TrimSpace(li),
+				var t = LineItem{RubyText: strings.TrimSpace(rubyText), Text: li}
+				if !preserve {
+					t.Text = strings.TrimSpace(t.Text)
 				}
+				t.InlineStyle = tt.TTMLInStyleAttributes.styleAttributes(o.Metadata)
+				t.InlineStyle.Lang = tt.Lang
 
 				// Add style
 				if len(tt.Style) > 0 {
@@ -420,6 +920,14 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 					t.Style = o.Styles[tt.Style]
 				}
 
+				// Add speaker
+				if t.Speaker = speaker(tt.Agent); t.Speaker == nil {
+					t.Speaker = itemSpeaker
+				}
+				if t.Speaker != nil && l.VoiceName == "" {
+					l.VoiceName = t.Speaker.Name
+				}
+
 				// Append items
 				l.Items = append(l.Items, t)
 			}
@@ -433,6 +941,18 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 	return
 }
 
+// ttmlPreservesSpace returns whether whitespace is preserved given the xml:space value of an element and whether
+// its parent preserves whitespace
+func ttmlPreservesSpace(parent bool, space string) bool {
+	switch space {
+	case "preserve":
+		return true
+	case "default":
+		return false
+	}
+	return parent
+}
+
 // TTMLOut represents an output TTML that must be marshaled
 // We split it from the input TTML as this time we'll add strict namespaces
 type TTMLOut struct {
@@ -443,13 +963,74 @@ type TTMLOut struct {
 	Subtitles       []TTMLOutSubtitle `xml:"body>div>p,omitempty"`
 	XMLName         xml.Name          `xml:"http://www.w3.org/ns/ttml tt"`
 	XMLNamespaceTTM string            `xml:"xmlns:ttm,attr"`
+	XMLNamespaceTTP string            `xml:"xmlns:ttp,attr,omitempty"`
 	XMLNamespaceTTS string            `xml:"xmlns:tts,attr"`
+	CellResolution  string            `xml:"ttp:cellResolution,attr,omitempty"`
+	Extent          string            `xml:"tts:extent,attr,omitempty"`
+	// Non integer framerates are written as an integer framerate with a multiplier, e.g. "30" and "1000 1001"
+	Framerate           string `xml:"ttp:frameRate,attr,omitempty"`
+	FramerateMultiplier string `xml:"ttp:frameRateMultiplier,attr,omitempty"`
 }
 
 // TTMLOutMetadata represents an output TTML Metadata
 type TTMLOutMetadata struct {
-	Copyright string `xml:"ttm:copyright,omitempty"`
-	Title     string `xml:"ttm:title,omitempty"`
+	Copyright string         `xml:"ttm:copyright,omitempty"`
+	Title     string         `xml:"ttm:title,omitempty"`
+	Agents    []TTMLOutAgent `xml:"ttm:agent,omitempty"`
+}
+
+// TTMLOutAgent represents an output TTML agent
+type TTMLOutAgent struct {
+	ID   string           `xml:"xml:id,attr"`
+	Name TTMLOutAgentName `xml:"ttm:name"`
+	Type string           `xml:"type,attr"`
+}
+
+// TTMLOutAgentName represents an output TTML agent name
+type TTMLOutAgentName struct {
+	Text string `xml:",chardata"`
+	Type string `xml:"type,attr"`
+}
+
+// ttmlRegexpIDInvalidChars matches characters that can't be used in xml:id attributes
+var ttmlRegexpIDInvalidChars = regexp.MustCompile(`[^\w.-]`)
+
+// ttmlAgentIDs returns the xml:id of speakers, making sure they are valid and unique
+func (s Subtitles) ttmlAgentIDs() (ids map[*Speaker]string) {
+	// Get speakers
+	var sps []*Speaker
+	for _, sp := range s.Speakers {
+		sps = append(sps, sp)
+	}
+	for _, i := range s.Items {
+		for _, l := range i.Lines {
+			for _, li := range l.Items {
+				if li.Speaker != nil && s.Speakers[li.Speaker.ID] != li.Speaker {
+					sps = append(sps, li.Speaker)
+				}
+			}
+		}
+	}
+	sort.SliceStable(sps, func(i, j int) bool { return sps[i].ID < sps[j].ID })
+
+	// Build ids
+	ids = make(map[*Speaker]string)
+	used := make(map[string]bool)
+	for _, sp := range sps {
+		if _, ok := ids[sp]; ok {
+			continue
+		}
+		id := ttmlRegexpIDInvalidChars.ReplaceAllString(sp.ID, "_")
+		if id == "" || !(id[0] == '_' || (id[0] >= 'a' && id[0] <= 'z') || (id[0] >= 'A' && id[0] <= 'Z')) {
+			id = "_" + id
+		}
+		for base, idx := id, 1; used[id]; idx++ {
+			id = base + "_" + strconv.Itoa(idx)
+		}
+		used[id] = true
+		ids[sp] = id
+	}
+	return
 }
 
 // TTMLOutStyleAttributes represents output TTML style attributes
@@ -485,32 +1066,52 @@ func ttmlOutStyleAttributesFromStyleAttributes(s *StyleAttributes) TTMLOutStyleA
 	if s == nil {
 		return TTMLOutStyleAttributes{}
 	}
-	return TTMLOutStyleAttributes{
-		BackgroundColor: s.TTMLBackgroundColor,
-		Color:           s.TTMLColor,
-		Direction:       s.TTMLDirection,
-		Display:         s.TTMLDisplay,
-		DisplayAlign:    s.TTMLDisplayAlign,
-		Extent:          s.TTMLExtent,
-		FontFamily:      s.TTMLFontFamily,
-		FontSize:        s.TTMLFontSize,
-		FontStyle:       s.TTMLFontStyle,
-		FontWeight:      s.TTMLFontWeight,
-		LineHeight:      s.TTMLLineHeight,
-		Opacity:         s.TTMLOpacity,
-		Origin:          s.TTMLOrigin,
-		Overflow:        s.TTMLOverflow,
-		Padding:         s.TTMLPadding,
-		ShowBackground:  s.TTMLShowBackground,
-		TextAlign:       s.TTMLTextAlign,
-		TextDecoration:  s.TTMLTextDecoration,
-		TextOutline:     s.TTMLTextOutline,
-		UnicodeBidi:     s.TTMLUnicodeBidi,
-		Visibility:      s.TTMLVisibility,
-		WrapOption:      s.TTMLWrapOption,
-		WritingMode:     s.TTMLWritingMode,
-		ZIndex:          s.TTMLZIndex,
+	o := TTMLOutStyleAttributes{
+		Direction:      s.TTMLDirection,
+		Display:        s.TTMLDisplay,
+		DisplayAlign:   s.TTMLDisplayAlign,
+		FontFamily:     s.TTMLFontFamily,
+		FontStyle:      s.TTMLFontStyle,
+		FontWeight:     s.TTMLFontWeight,
+		Overflow:       s.TTMLOverflow,
+		Padding:        s.TTMLPadding,
+		ShowBackground: s.TTMLShowBackground,
+		TextAlign:      s.TTMLTextAlign,
+		TextDecoration: s.TTMLTextDecoration,
+		TextOutline:    s.TTMLTextOutline,
+		UnicodeBidi:    s.TTMLUnicodeBidi,
+		Visibility:     s.TTMLVisibility,
+		WrapOption:     s.TTMLWrapOption,
+		WritingMode:    s.TTMLWritingMode,
+		ZIndex:         s.TTMLZIndex,
+	}
+	if s.TTMLBackgroundColor != nil {
+		o.BackgroundColor = astikit.StrPtr(formatTTMLColor(s.TTMLBackgroundColor))
+	}
+	if s.TTMLColor != nil {
+		o.Color = astikit.StrPtr(formatTTMLColor(s.TTMLColor))
+	}
+	if s.TTMLExtent != nil {
+		o.Extent = astikit.StrPtr(s.TTMLExtent.String())
+	}
+	if s.TTMLFontSize != nil {
+		// A single value applies to both dimensions
+		if s.TTMLFontSize.Horizontal == s.TTMLFontSize.Vertical {
+			o.FontSize = astikit.StrPtr(s.TTMLFontSize.Vertical.String())
+		} else {
+			o.FontSize = astikit.StrPtr(s.TTMLFontSize.String())
+		}
+	}
+	if s.TTMLLineHeight != nil {
+		o.LineHeight = astikit.StrPtr(s.TTMLLineHeight.String())
 	}
+	if s.TTMLOpacity != nil {
+		o.Opacity = astikit.StrPtr(strconv.FormatFloat(*s.TTMLOpacity, 'f', -1, 64))
+	}
+	if s.TTMLOrigin != nil {
+		o.Origin = astikit.StrPtr(s.TTMLOrigin.String())
+	}
+	return o
 }
 
 // TTMLOutHeader represents an output TTML header
@@ -534,6 +1135,7 @@ type TTMLOutStyle struct {
 
 // TTMLOutSubtitle represents an output TTML subtitle
 type TTMLOutSubtitle struct {
+	Agent  string          `xml:"ttm:agent,attr,omitempty"`
 	Begin  TTMLOutDuration `xml:"begin,attr"`
 	End    TTMLOutDuration `xml:"end,attr"`
 	ID     string          `xml:"id,attr,omitempty"`
@@ -545,8 +1147,12 @@ type TTMLOutSubtitle struct {
 
 // TTMLOutItem represents an output TTML Item
 type TTMLOutItem struct {
-	Style string `xml:"style,attr,omitempty"`
-	Text  string `xml:",chardata"`
+	Agent string        `xml:"ttm:agent,attr,omitempty"`
+	Items []TTMLOutItem `xml:",omitempty"` // Only used for ruby containers
+	Lang  string        `xml:"xml:lang,attr,omitempty"`
+	Ruby  string        `xml:"tts:ruby,attr,omitempty"`
+	Style string        `xml:"style,attr,omitempty"`
+	Text  string        `xml:",chardata"`
 	TTMLOutStyleAttributes
 	XMLName xml.Name
 }
@@ -565,6 +1171,20 @@ func (s Subtitles) WriteToTTML(o io.Writer) (err error) {
 	if len(s.Items) == 0 {
 		return ErrNoSubtitlesToWrite
 	}
+	return s.writeToTTML(o)
+}
+
+// writeToTTML writes subtitles in .ttml format even if there are no items
+func (s Subtitles) writeToTTML(o io.Writer) (err error) {
+	// TTML styling attributes are derived from the generic style attributes when ttml ones are missing
+	s = s.withGenericAttributes()
+
+	// Font sizes are expressed in cells which depend on the cell resolution
+	for _, sa := range s.styleAttributes() {
+		if sa.FontSize != nil && sa.TTMLFontSize == nil {
+			sa.TTMLFontSize = ttmlFontSizeFromPercentage(*sa.FontSize, s.Metadata)
+		}
+	}
 
 	// Init TTML
 	var ttml = TTMLOut{
@@ -577,6 +1197,17 @@ func (s Subtitles) WriteToTTML(o io.Writer) (err error) {
 		if v, ok := ttmlLanguageMapping.GetInverse(s.Metadata.Language); ok {
 			ttml.Lang = v.(string)
 		}
+		if s.Metadata.TTMLCellResolution != nil {
+			ttml.CellResolution = s.Metadata.TTMLCellResolution.String()
+			ttml.XMLNamespaceTTP = "http://www.w3.org/ns/ttml#parameter"
+		}
+		if s.Metadata.TTMLExtent != nil {
+			ttml.Extent = s.Metadata.TTMLExtent.String()
+		}
+		if s.Metadata.Framerate.valid() {
+			ttml.Framerate, ttml.FramerateMultiplier = ttmlFramerate(s.Metadata.Framerate)
+			ttml.XMLNamespaceTTP = "http://www.w3.org/ns/ttml#parameter"
+		}
 		if len(s.Metadata.TTMLCopyright) > 0 || len(s.Metadata.Title) > 0 {
 			ttml.Metadata = &TTMLOutMetadata{
 				Copyright: s.Metadata.TTMLCopyright,
@@ -585,6 +1216,26 @@ func (s Subtitles) WriteToTTML(o io.Writer) (err error) {
 		}
 	}
 
+	// Add agents
+	var agentIDs = s.ttmlAgentIDs()
+	if len(agentIDs) > 0 {
+		if ttml.Metadata == nil {
+			ttml.Metadata = &TTMLOutMetadata{}
+		}
+		var sps []*Speaker
+		for sp := range agentIDs {
+			sps = append(sps, sp)
+		}
+		sort.Slice(sps, func(i, j int) bool { return agentIDs[sps[i]] < agentIDs[sps[j]] })
+		for _, sp := range sps {
+			ttml.Metadata.Agents = append(ttml.Metadata.Agents, TTMLOutAgent{
+				ID:   agentIDs[sp],
+				Name: TTMLOutAgentName{Text: sp.Name, Type: "full"},
+				Type: "person",
+			})
+		}
+	}
+
 	// Add regions
 	var k []string
 	for _, region := range s.Regions {
@@ -638,6 +1289,19 @@ func (s Subtitles) WriteToTTML(o io.Writer) (err error) {
 			ttmlSubtitle.Style = item.Style.ID
 		}
 
+		// Add agent on the subtitle if all line items share the same speaker, on line items otherwise
+		var speaker = item.firstSpeaker()
+		for _, line := range item.Lines {
+			for _, lineItem := range line.Items {
+				if lineItem.Speaker != speaker {
+					speaker = nil
+				}
+			}
+		}
+		if speaker != nil {
+			ttmlSubtitle.Agent = agentIDs[speaker]
+		}
+
 		// Add lines
 		for _, line := range item.Lines {
 			// Loop through line items
@@ -649,15 +1313,36 @@ func (s Subtitles) WriteToTTML(o io.Writer) (err error) {
 					XMLName:                xml.Name{Local: "span"},
 				}
 				// condition to avoid adding space as the last character.
-				if idx < len(line.Items)-1 {
+				if line.needsSpaceBefore(idx + 1) {
 					ttmlItem.Text = ttmlItem.Text + " "
 				}
 
+				// Add lang
+				if lineItem.InlineStyle != nil {
+					ttmlItem.Lang = lineItem.InlineStyle.Lang
+				}
+
+				// Add ruby. Since ruby is mostly used with scripts that don't separate words with spaces, the
+				// trailing space, if any, is dropped.
+				if lineItem.RubyText != "" {
+					ttmlItem.Items = []TTMLOutItem{
+						{Ruby: "base", Text: lineItem.Text, XMLName: xml.Name{Local: "span"}},
+						{Ruby: "text", Text: lineItem.RubyText, XMLName: xml.Name{Local: "span"}},
+					}
+					ttmlItem.Ruby = "container"
+					ttmlItem.Text = ""
+				}
+
 				// Add style
 				if lineItem.Style != nil {
 					ttmlItem.Style = lineItem.Style.ID
 				}
 
+				// Add agent
+				if speaker == nil && lineItem.Speaker != nil {
+					ttmlItem.Agent = agentIDs[lineItem.Speaker]
+				}
+
 				// Add ttml item
 				ttmlSubtitle.Items = append(ttmlSubtitle.Items, ttmlItem)
 			}
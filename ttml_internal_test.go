@@ -26,7 +26,7 @@ func TestTTMLDuration(t *testing.T) {
 	assert.Equal(t, 2, d.frames)
 
 	// Duration
-	d.framerate = 8
+	d.framerate = Framerate{Den: 1, Num: 8}
 	assert.Equal(t, 12*time.Hour+34*time.Minute+56*time.Second+250*time.Millisecond, d.duration())
 
 	// Unmarshal offset time
@@ -62,7 +62,7 @@ func TestTTMLDuration(t *testing.T) {
 	assert.Equal(t, 123*time.Millisecond+4*time.Millisecond/10, d.duration())
 	assert.NoError(t, err)
 
-	d.framerate = 25
+	d.framerate = Framerate25
 	err = d.UnmarshalText([]byte("100f"))
 	assert.Equal(t, 4*time.Second, d.duration())
 	assert.NoError(t, err)
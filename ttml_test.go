@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"github.com/asticode/go-astikit"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTTML(t *testing.T) {
@@ -16,23 +19,23 @@ func TestTTML(t *testing.T) {
 	assert.NoError(t, err)
 	assertSubtitleItems(t, s)
 	// Metadata
-	assert.Equal(t, &astisub.Metadata{Framerate: 25, Language: astisub.LanguageFrench, Title: "Title test", TTMLCopyright: "Copyright test"}, s.Metadata)
+	assert.Equal(t, &astisub.Metadata{Framerate: astisub.Framerate25, Language: astisub.LanguageFrench, Title: "Title test", TTMLCopyright: "Copyright test"}, s.Metadata)
 	// Styles
 	assert.Equal(t, 3, len(s.Styles))
-	assert.Equal(t, astisub.Style{ID: "style_0", InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("white"), TTMLExtent: astikit.StrPtr("100% 10%"), TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: astikit.StrPtr("0% 90%"), TTMLTextAlign: astikit.StrPtr("center"), WebVTTAlign: "center", WebVTTLine: "0%", WebVTTLines: 2, WebVTTPosition: "90%", WebVTTRegionAnchor: "0%,0%", WebVTTScroll: "up", WebVTTSize: "10%", WebVTTViewportAnchor: "0%,90%", WebVTTWidth: "100%"}, Style: s.Styles["style_2"]}, *s.Styles["style_0"])
-	assert.Equal(t, astisub.Style{ID: "style_1", InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("white"), TTMLExtent: astikit.StrPtr("100% 13%"), TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: astikit.StrPtr("0% 87%"), TTMLTextAlign: astikit.StrPtr("center"), WebVTTAlign: "center", WebVTTLine: "0%", WebVTTLines: 2, WebVTTPosition: "87%", WebVTTRegionAnchor: "0%,0%", WebVTTScroll: "up", WebVTTSize: "13%", WebVTTViewportAnchor: "0%,87%", WebVTTWidth: "100%"}}, *s.Styles["style_1"])
-	assert.Equal(t, astisub.Style{ID: "style_2", InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("white"), TTMLExtent: astikit.StrPtr("100% 20%"), TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: astikit.StrPtr("0% 80%"), TTMLTextAlign: astikit.StrPtr("center"), WebVTTAlign: "center", WebVTTLine: "0%", WebVTTLines: 4, WebVTTPosition: "80%", WebVTTRegionAnchor: "0%,0%", WebVTTScroll: "up", WebVTTSize: "20%", WebVTTViewportAnchor: "0%,80%", WebVTTWidth: "100%"}}, *s.Styles["style_2"])
+	assert.Equal(t, astisub.Style{ID: "style_0", InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorWhite, Extent: &astisub.Percentages{Horizontal: 100, Vertical: 10}, FontFamily: "sansSerif", Italic: astikit.BoolPtr(false), Origin: &astisub.Percentages{Vertical: 90}, TextAlign: &astisub.JustificationCentered, TTMLColor: astisub.ColorWhite, TTMLExtent: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 100}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 10}}, TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 90}}, TTMLTextAlign: astikit.StrPtr("center")}, Style: s.Styles["style_2"]}, *s.Styles["style_0"])
+	assert.Equal(t, astisub.Style{ID: "style_1", InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorWhite, Extent: &astisub.Percentages{Horizontal: 100, Vertical: 13}, FontFamily: "sansSerif", Italic: astikit.BoolPtr(false), Origin: &astisub.Percentages{Vertical: 87}, TextAlign: &astisub.JustificationCentered, TTMLColor: astisub.ColorWhite, TTMLExtent: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 100}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 13}}, TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 87}}, TTMLTextAlign: astikit.StrPtr("center")}}, *s.Styles["style_1"])
+	assert.Equal(t, astisub.Style{ID: "style_2", InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorWhite, Extent: &astisub.Percentages{Horizontal: 100, Vertical: 20}, FontFamily: "sansSerif", Italic: astikit.BoolPtr(false), Origin: &astisub.Percentages{Vertical: 80}, TextAlign: &astisub.JustificationCentered, TTMLColor: astisub.ColorWhite, TTMLExtent: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 100}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 20}}, TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 80}}, TTMLTextAlign: astikit.StrPtr("center")}}, *s.Styles["style_2"])
 	// Regions
 	assert.Equal(t, 3, len(s.Regions))
-	assert.Equal(t, astisub.Region{ID: "region_0", Style: s.Styles["style_0"], InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("blue")}}, *s.Regions["region_0"])
+	assert.Equal(t, astisub.Region{ID: "region_0", Style: s.Styles["style_0"], InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorBlue, TTMLColor: astisub.ColorBlue}}, *s.Regions["region_0"])
 	assert.Equal(t, astisub.Region{ID: "region_1", Style: s.Styles["style_1"], InlineStyle: &astisub.StyleAttributes{}}, *s.Regions["region_1"])
 	assert.Equal(t, astisub.Region{ID: "region_2", Style: s.Styles["style_2"], InlineStyle: &astisub.StyleAttributes{}}, *s.Regions["region_2"])
 	// Items
 	assert.Equal(t, s.Regions["region_1"], s.Items[0].Region)
 	assert.Equal(t, s.Styles["style_1"], s.Items[0].Style)
-	assert.Equal(t, &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("red")}, s.Items[0].InlineStyle)
-	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{Style: s.Styles["style_1"], InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("black")}, Text: "(deep rumbling)"}}}}, s.Items[0].Lines)
-	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Text: "MAN:"}}}, {Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Text: "How did we"}, {InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("green")}, Style: s.Styles["style_1"], Text: "end up"}, {InlineStyle: &astisub.StyleAttributes{}, Text: "here?"}}}}, s.Items[1].Lines)
+	assert.Equal(t, &astisub.StyleAttributes{Color: astisub.ColorRed, TTMLColor: astisub.ColorRed}, s.Items[0].InlineStyle)
+	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{Style: s.Styles["style_1"], InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorBlack, TTMLColor: astisub.ColorBlack}, Text: "(deep rumbling)"}}}}, s.Items[0].Lines)
+	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Text: "MAN:"}}}, {Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Text: "How did we"}, {InlineStyle: &astisub.StyleAttributes{Color: astisub.ColorGreen, TTMLColor: astisub.ColorGreen}, Style: s.Styles["style_1"], Text: "end up"}, {InlineStyle: &astisub.StyleAttributes{}, Text: "here?"}}}}, s.Items[1].Lines)
 	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Style: s.Styles["style_1"], Text: "This place is horrible."}}}}, s.Items[2].Lines)
 	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Style: s.Styles["style_1"], Text: "Smells like balls."}}}}, s.Items[3].Lines)
 	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Style: s.Styles["style_2"], Text: "We don't belong"}}}, {Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{}, Style: s.Styles["style_1"], Text: "in this shithole."}}}}, s.Items[4].Lines)
@@ -50,3 +53,94 @@ func TestTTML(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, string(c), w.String())
 }
+
+func TestTTMLStyleAttributes(t *testing.T) {
+	// Lengths are converted using the root extent and cell resolution
+	s, err := astisub.ReadFromTTML(bytes.NewReader([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" ttp:cellResolution="40 20" tts:extent="1280px 720px">
+<head><layout><region xml:id="r" tts:extent="80% 2c" tts:origin="128px 72px"/></layout></head>
+<body><div><p begin="00:00:01.000" end="00:00:02.000" region="r"><span tts:color="#ff000080" tts:fontSize="1c" tts:lineHeight="120%" tts:opacity="0.5">text</span></p></div></body>
+</tt>`)))
+	assert.NoError(t, err)
+	assert.Equal(t, &astisub.TTMLCellResolution{Columns: 40, Rows: 20}, s.Metadata.TTMLCellResolution)
+	assert.Equal(t, &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPixel, Value: 1280}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPixel, Value: 720}}, s.Metadata.TTMLExtent)
+	r := s.Regions["r"].InlineStyle
+	assert.Equal(t, &astisub.TTMLLengthPair{Horizontal: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPixel, Value: 128}, Vertical: astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPixel, Value: 72}}, r.TTMLOrigin)
+	assert.Equal(t, &astisub.Percentages{Horizontal: 10, Vertical: 10}, r.Origin)
+	assert.Equal(t, &astisub.Percentages{Horizontal: 80, Vertical: 10}, r.Extent)
+	li := s.Items[0].Lines[0].Items[0].InlineStyle
+	assert.Equal(t, &astisub.Color{Alpha: 127, Red: 255}, li.TTMLColor)
+	assert.Equal(t, astikit.Float64Ptr(5), li.FontSize)
+	assert.Equal(t, &astisub.TTMLLength{Unit: astisub.TTMLLengthUnitPercentage, Value: 120}, li.TTMLLineHeight)
+	assert.Equal(t, astikit.Float64Ptr(0.5), li.TTMLOpacity)
+
+	// Typed attributes are serialized
+	w := &bytes.Buffer{}
+	assert.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `ttp:cellResolution="40 20" tts:extent="1280px 720px"`)
+	assert.Contains(t, w.String(), `tts:extent="80% 2c" tts:origin="128px 72px"`)
+	assert.Contains(t, w.String(), `tts:color="#ff000080" tts:fontSize="1c" tts:lineHeight="120%" tts:opacity="0.5"`)
+
+	// Invalid attributes are skipped
+	s, err = astisub.ReadFromTTML(bytes.NewReader([]byte(`<tt><head><layout><region xml:id="r" tts:origin="10%" tts:extent="80% 10%"/></layout></head><body><div><p begin="00:00:01.000" end="00:00:02.000" region="r" tts:color="#ff00" tts:opacity="0.5">Text</p></div></body></tt>`)))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Nil(t, s.Items[0].InlineStyle.TTMLColor)
+	assert.Equal(t, astikit.Float64Ptr(0.5), s.Items[0].InlineStyle.TTMLOpacity)
+	require.NotNil(t, s.Regions["r"])
+	assert.Nil(t, s.Regions["r"].InlineStyle.TTMLOrigin)
+	assert.NotNil(t, s.Regions["r"].InlineStyle.TTMLExtent)
+}
+
+func TestTTMLFramerateMultiplier(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="30" ttp:frameRateMultiplier="1000 1001">
+<body><div><p begin="00:00:01:15" end="30f">Text</p></div></body>
+</tt>`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Second+astisub.Framerate2997.Duration(15), s.Items[0].StartAt)
+	assert.Equal(t, 1001*time.Millisecond, s.Items[0].EndAt)
+	assert.Equal(t, astisub.Framerate2997, s.Metadata.Framerate)
+
+	// Non integer framerates are kept when writing
+	s.Metadata.Framerate = astisub.Framerate23976
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), ` ttp:frameRate="24" ttp:frameRateMultiplier="1000 1001">`)
+	s2, err := astisub.ReadFromTTML(w)
+	require.NoError(t, err)
+	assert.Equal(t, astisub.Framerate23976, s2.Metadata.Framerate)
+}
+
+func TestTTMLSMPTETimeBase(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:timeBase="smpte" ttp:frameRate="30" ttp:frameRateMultiplier="1000 1001" ttp:dropMode="dropNTSC">
+<body><div><p begin="00:01:00:02" end="01:00:00:00">Text</p></div></body>
+</tt>`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, 60060*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 3599996400*time.Microsecond, s.Items[0].EndAt)
+	assert.Equal(t, astisub.Framerate2997, s.Metadata.Framerate)
+}
+
+func TestTTMLSpace(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt xmlns="http://www.w3.org/ns/ttml">
+<body><div>
+<p begin="00:00:01.000" end="00:00:02.000"><span>How did </span><span>we</span></p>
+<p begin="00:00:02.000" end="00:00:03.000" xml:space="preserve"><span>How did </span><span>we</span><span xml:space="default"> end up</span></p>
+</div></body>
+</tt>`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+
+	// Whitespace is trimmed by default
+	require.Len(t, s.Items[0].Lines[0].Items, 2)
+	assert.Equal(t, "How did", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "How did we", s.Items[0].Lines[0].String())
+
+	// Whitespace is kept as written when preserved
+	require.Len(t, s.Items[1].Lines[0].Items, 3)
+	assert.Equal(t, "How did ", s.Items[1].Lines[0].Items[0].Text)
+	assert.Equal(t, "end up", s.Items[1].Lines[0].Items[2].Text)
+	assert.Equal(t, "How did we end up", s.Items[1].Lines[0].String())
+}
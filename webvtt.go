@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"math"
 	"os"
 	"regexp"
 	"sort"
@@ -13,7 +15,7 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/net/html"
+	"github.com/asticode/go-astikit"
 )
 
 // https://www.w3.org/TR/webvtt1/
@@ -29,15 +31,40 @@ const (
 	webvttTimestampMap            = "X-TIMESTAMP-MAP"
 )
 
+// WebVTTKind represents the kind of a WebVTT text track
+// https://html.spec.whatwg.org/multipage/media.html#attr-track-kind
+type WebVTTKind string
+
+// WebVTT kinds
+const (
+	WebVTTKindCaptions     WebVTTKind = "captions"
+	WebVTTKindChapters     WebVTTKind = "chapters"
+	WebVTTKindDescriptions WebVTTKind = "descriptions"
+	WebVTTKindMetadata     WebVTTKind = "metadata"
+	WebVTTKindSubtitles    WebVTTKind = "subtitles"
+)
+
+// hasRawPayloads checks whether cue payloads of the kind are not cue text and must be kept verbatim
+func (k WebVTTKind) hasRawPayloads() bool {
+	return k == WebVTTKindChapters || k == WebVTTKindMetadata
+}
+
+// WebVTTOptions represents WebVTT options
+type WebVTTOptions struct {
+	// If provided, X-TIMESTAMP-MAP MPEGTS values are read relative to this PTS instead of PTS 0, which allows
+	// reassembling segments recorded across a 33-bit PTS wrap
+	BasePTS *PTS
+	// Cue payloads of chapters and metadata tracks (e.g. chapter titles or JSON) are kept verbatim, one line
+	// item per payload line, instead of being parsed as cue text. Defaults to subtitles.
+	Kind WebVTTKind
+}
+
 // Vars
 var (
 	bytesWebVTTItalicEndTag            = []byte("</i>")
 	bytesWebVTTItalicStartTag          = []byte("<i>")
 	bytesWebVTTTimeBoundariesSeparator = []byte(webvttTimeBoundariesSeparator)
-	webVTTRegexpInlineTimestamp        = regexp.MustCompile(`<((?:\d{2,}:)?\d{2}:\d{2}\.\d{3})>`)
-	webVTTRegexpTag                    = regexp.MustCompile(`(</*\s*([^\.\s]+)(\.[^\s/]*)*\s*([^/]*)\s*/*>)`)
 	webVTTEscaper                      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\xa0", "&nbsp")
-	webVTTUnescaper                    = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp", "\xa0")
 )
 
 // parseDurationWebVTT parses a .vtt duration
@@ -49,7 +76,10 @@ func parseDurationWebVTT(i string) (time.Duration, error) {
 // Eg., `X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000` => 10s
 //
 //	`X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:180000` => 2s
-func parseTimestampMapWebVTT(line string) (timeOffset time.Duration, err error) {
+//
+// MPEGTS is a 33-bit timestamp: if a base PTS is provided, the offset is relative to it, taking rollover into
+// account, otherwise it is relative to PTS 0.
+func parseTimestampMapWebVTT(line string, base *PTS) (timeOffset time.Duration, err error) {
 	splits := strings.Split(line, "=")
 	if len(splits) <= 1 {
 		err = fmt.Errorf("astisub: invalid X-TIMESTAMP-MAP, no '=' found")
@@ -58,7 +88,7 @@ func parseTimestampMapWebVTT(line string) (timeOffset time.Duration, err error)
 	right := splits[1]
 
 	var local time.Duration
-	var mpegts int64
+	var mpegts PTS
 	for _, split := range strings.Split(right, ",") {
 		splits := strings.SplitN(split, ":", 2)
 		if len(splits) <= 1 {
@@ -74,24 +104,37 @@ func parseTimestampMapWebVTT(line string) (timeOffset time.Duration, err error)
 				return
 			}
 		case "mpegts":
-			mpegts, err = strconv.ParseInt(splits[1], 10, 0)
+			var i int64
+			i, err = strconv.ParseInt(splits[1], 10, 0)
 			if err != nil {
 				err = fmt.Errorf("astisub: parsing int %s failed: %w", splits[1], err)
 				return
 			}
+			mpegts = PTS(i)
 		}
 	}
 
-	timeOffset = time.Duration(mpegts)*time.Second/90000 - local
+	if base != nil {
+		timeOffset = mpegts.Sub(*base) - local
+	} else {
+		timeOffset = mpegts.Duration() - local
+	}
 	return
 }
 
 // ReadFromWebVTT parses a .vtt content
-// TODO Tags (u, i, b)
-// TODO Class
+// ::cue rules found in STYLE blocks are added as styles keyed by their selector
 func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
+	return ReadFromWebVTTWithOptions(i, WebVTTOptions{})
+}
+
+// ReadFromWebVTTWithOptions parses a .vtt content with options
+func ReadFromWebVTTWithOptions(i io.Reader, opts WebVTTOptions) (o *Subtitles, err error) {
 	// Init
 	o = NewSubtitles()
+	if opts.Kind != "" && opts.Kind != WebVTTKindSubtitles {
+		o.Metadata = &Metadata{WebVTTKind: opts.Kind}
+	}
 	var scanner = bufio.NewScanner(i)
 	var line string
 	var lineNum int
@@ -110,7 +153,7 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 	var item = &Item{}
 	var blockName string
 	var comments []string
-	var index int
+	var id string
 	var timeOffset time.Duration
 	var webVTTStyles *StyleAttributes
 
@@ -119,6 +162,12 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 		line = strings.TrimSpace(scanner.Text())
 		lineNum++
 
+		// Payloads that are not cue text are kept verbatim until the end of the cue
+		if blockName == webvttBlockNameText && len(line) > 0 && opts.Kind.hasRawPayloads() {
+			item.Lines = append(item.Lines, Line{Items: []LineItem{{Text: scanner.Text()}}})
+			continue
+		}
+
 		switch {
 		// Comment
 		case strings.HasPrefix(line, "NOTE "):
@@ -189,12 +238,13 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 			// Init new item
 			item = &Item{
 				Comments:    comments,
-				Index:       index,
 				InlineStyle: &StyleAttributes{},
+				WebVTTID:    id,
 			}
+			item.Index, _ = strconv.Atoi(id)
 
-			// Reset index
-			index = 0
+			// Reset id
+			id = ""
 
 			// Split line on time boundaries
 			var left = strings.Split(line, webvttTimeBoundariesSeparator)
@@ -214,39 +264,9 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 
 			// Parse style
 			if len(right) > 1 {
-				// Add styles
-				for index := 1; index < len(right); index++ {
-					// Empty
-					if right[index] == "" {
-						continue
-					}
-
-					// Split line on ":"
-					var split = strings.Split(right[index], ":")
-					if len(split) <= 1 {
-						err = fmt.Errorf("astisub: line %d: Invalid inline style '%s'", lineNum, right[index])
-						return
-					}
-
-					// Switch on key
-					switch split[0] {
-					case "align":
-						item.InlineStyle.WebVTTAlign = split[1]
-					case "line":
-						item.InlineStyle.WebVTTLine = split[1]
-					case "position":
-						item.InlineStyle.WebVTTPosition = split[1]
-					case "region":
-						if _, ok := o.Regions[split[1]]; !ok {
-							err = fmt.Errorf("astisub: line %d: Unknown region %s", lineNum, split[1])
-							return
-						}
-						item.Region = o.Regions[split[1]]
-					case "size":
-						item.InlineStyle.WebVTTSize = split[1]
-					case "vertical":
-						item.InlineStyle.WebVTTVertical = split[1]
-					}
+				if err = parseWebVTTCueSettings(item, right[1:], o.Regions); err != nil {
+					err = fmt.Errorf("astisub: line %d: %w", lineNum, err)
+					return
 				}
 			}
 			item.InlineStyle.propagateWebVTTAttributes()
@@ -263,7 +283,7 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 				return
 			}
 
-			timeOffset, err = parseTimestampMapWebVTT(line)
+			timeOffset, err = parseTimestampMapWebVTT(line, opts.BasePTS)
 			if err != nil {
 				err = fmt.Errorf("astisub: parsing webvtt timestamp map failed: %w", err)
 				return
@@ -284,81 +304,320 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 				}
 			default:
 				// This is the ID
-				index, _ = strconv.Atoi(line)
+				id = line
 			}
 		}
 	}
 
-	if timeOffset > 0 {
+	// Add speakers
+	o.registerSpeakers()
+
+	// Resolve CSS
+	if webVTTStyles != nil {
+		o.resolveWebVTTCSS(strings.Join(webVTTStyles.WebVTTStyles, "\n"))
+	}
+
+	if timeOffset != 0 {
 		o.Add(timeOffset)
 	}
 	return
 }
 
+// parseWebVTTCueSettings parses cue settings such as "align:left" into the item
+func parseWebVTTCueSettings(item *Item, settings []string, regions map[string]*Region) error {
+	// Loop through settings
+	for _, setting := range settings {
+		// Empty
+		if setting == "" {
+			continue
+		}
+
+		// Split setting on ":"
+		var split = strings.Split(setting, ":")
+		if len(split) <= 1 {
+			return fmt.Errorf("Invalid inline style '%s'", setting)
+		}
+
+		// Switch on key
+		switch split[0] {
+		case "align":
+			item.InlineStyle.WebVTTAlign = split[1]
+		case "line":
+			item.InlineStyle.WebVTTLine = split[1]
+		case "position":
+			item.InlineStyle.WebVTTPosition = split[1]
+		case "region":
+			if _, ok := regions[split[1]]; !ok {
+				return fmt.Errorf("Unknown region %s", split[1])
+			}
+			item.Region = regions[split[1]]
+		case "size":
+			item.InlineStyle.WebVTTSize = split[1]
+		case "vertical":
+			item.InlineStyle.WebVTTVertical = split[1]
+		}
+	}
+	return nil
+}
+
 func escapeWebVTT(i string) string {
 	return webVTTEscaper.Replace(i)
 }
 
-func unescapeWebVTT(i string) string {
-	return webVTTUnescaper.Replace(i)
+// webVTTTokenType represents a cue text token type
+type webVTTTokenType int
+
+// Cue text token types
+const (
+	webVTTTokenTypeString webVTTTokenType = iota
+	webVTTTokenTypeStartTag
+	webVTTTokenTypeEndTag
+	webVTTTokenTypeTimestamp
+)
+
+// webVTTToken represents a cue text token
+type webVTTToken struct {
+	annotation string
+	classes    []string
+	t          webVTTTokenType
+	value      string // Text, tag name or timestamp
 }
 
-// parseTextWebVTT parses the input line to fill the Line
-func parseTextWebVTT(i string) (o Line) {
-	// Create tokenizer
-	tr := html.NewTokenizer(strings.NewReader(i))
+// webVTTTokenizerState represents a cue text tokenizer state
+type webVTTTokenizerState int
 
-	webVTTTagStack := make([]WebVTTTag, 0, 16)
+// Cue text tokenizer states
+const (
+	webVTTTokenizerStateData webVTTTokenizerState = iota
+	webVTTTokenizerStateTag
+	webVTTTokenizerStateStartTag
+	webVTTTokenizerStateStartTagClass
+	webVTTTokenizerStateStartTagAnnotation
+	webVTTTokenizerStateEndTag
+	webVTTTokenizerStateTimestampTag
+)
 
-	// Loop
-	for {
-		// Get next tag
-		t := tr.Next()
-		// Process error
-		if err := tr.Err(); err != nil {
-			break
+// tokenizeWebVTTCueText splits cue text into tokens
+// https://www.w3.org/TR/webvtt1/#webvtt-cue-text-tokenizer
+func tokenizeWebVTTCueText(i string) (ts []webVTTToken) {
+	var buffer, result []rune
+	var classes []string
+	state := webVTTTokenizerStateData
+	emit := func(t webVTTToken) {
+		ts = append(ts, t)
+		buffer, classes, result = nil, nil, nil
+		state = webVTTTokenizerStateData
+	}
+	emitStartTag := func() {
+		emit(webVTTToken{
+			annotation: strings.Join(strings.Fields(html.UnescapeString(string(buffer))), " "),
+			classes:    classes,
+			t:          webVTTTokenTypeStartTag,
+			value:      string(result),
+		})
+	}
+	pushClass := func() {
+		if len(buffer) > 0 {
+			classes = append(classes, string(buffer))
+		}
+		buffer = nil
+	}
+	for _, c := range i {
+		switch state {
+		case webVTTTokenizerStateData:
+			if c == '<' {
+				if len(result) > 0 {
+					emit(webVTTToken{t: webVTTTokenTypeString, value: html.UnescapeString(string(result))})
+				}
+				state = webVTTTokenizerStateTag
+			} else {
+				result = append(result, c)
+			}
+		case webVTTTokenizerStateTag:
+			switch {
+			case c == '\t' || c == '\n' || c == '\f' || c == ' ':
+				state = webVTTTokenizerStateStartTagAnnotation
+			case c == '.':
+				state = webVTTTokenizerStateStartTagClass
+			case c == '/':
+				state = webVTTTokenizerStateEndTag
+			case c >= '0' && c <= '9':
+				result = []rune{c}
+				state = webVTTTokenizerStateTimestampTag
+			case c == '>':
+				emitStartTag()
+			default:
+				result = []rune{c}
+				state = webVTTTokenizerStateStartTag
+			}
+		case webVTTTokenizerStateStartTag:
+			switch c {
+			case '\t', '\f', ' ':
+				state = webVTTTokenizerStateStartTagAnnotation
+			case '\n':
+				buffer = []rune{c}
+				state = webVTTTokenizerStateStartTagAnnotation
+			case '.':
+				state = webVTTTokenizerStateStartTagClass
+			case '>':
+				emitStartTag()
+			default:
+				result = append(result, c)
+			}
+		case webVTTTokenizerStateStartTagClass:
+			switch c {
+			case '\t', '\f', ' ':
+				pushClass()
+				state = webVTTTokenizerStateStartTagAnnotation
+			case '\n':
+				pushClass()
+				buffer = []rune{c}
+				state = webVTTTokenizerStateStartTagAnnotation
+			case '.':
+				pushClass()
+			case '>':
+				pushClass()
+				emitStartTag()
+			default:
+				buffer = append(buffer, c)
+			}
+		case webVTTTokenizerStateStartTagAnnotation:
+			if c == '>' {
+				emitStartTag()
+			} else {
+				buffer = append(buffer, c)
+			}
+		case webVTTTokenizerStateEndTag:
+			if c == '>' {
+				emit(webVTTToken{t: webVTTTokenTypeEndTag, value: string(result)})
+			} else {
+				result = append(result, c)
+			}
+		case webVTTTokenizerStateTimestampTag:
+			if c == '>' {
+				emit(webVTTToken{t: webVTTTokenTypeTimestamp, value: string(result)})
+			} else {
+				result = append(result, c)
+			}
 		}
+	}
 
-		switch t {
-		case html.EndTagToken:
-			// Pop the top of stack if we meet end tag
-			if len(webVTTTagStack) > 0 {
-				webVTTTagStack = webVTTTagStack[:len(webVTTTagStack)-1]
+	// Tokens are ended by the end of the input as well
+	switch state {
+	case webVTTTokenizerStateData:
+		if len(result) > 0 {
+			emit(webVTTToken{t: webVTTTokenTypeString, value: html.UnescapeString(string(result))})
+		}
+	case webVTTTokenizerStateTag, webVTTTokenizerStateStartTag, webVTTTokenizerStateStartTagAnnotation:
+		emitStartTag()
+	case webVTTTokenizerStateStartTagClass:
+		pushClass()
+		emitStartTag()
+	case webVTTTokenizerStateEndTag:
+		emit(webVTTToken{t: webVTTTokenTypeEndTag, value: string(result)})
+	case webVTTTokenizerStateTimestampTag:
+		emit(webVTTToken{t: webVTTTokenTypeTimestamp, value: string(result)})
+	}
+	return
+}
+
+// parseTextWebVTT parses the input line to fill the Line
+// https://www.w3.org/TR/webvtt1/#cue-text-parsing-rules
+func parseTextWebVTT(i string) (o Line) {
+	// Tags styling the text. Voice and ruby spans are not in the stack since they are stored in dedicated
+	// attributes.
+	webVTTTagStack := make([]WebVTTTag, 0, 16)
+
+	// Voice spans last until their end tag or the end of the line
+	var speaker *Speaker
+
+	// Ruby annotations apply to the base text items added since the ruby span started or since the previous
+	// annotation
+	var inRuby, inRubyText bool
+	var rubyBaseIdx int
+	var rubyText string
+	endRubyText := func() {
+		if t := strings.TrimSpace(rubyText); t != "" && len(o.Items) > rubyBaseIdx {
+			// Base text split into several items is merged so that the annotation applies to all of it
+			base := o.Items[rubyBaseIdx]
+			for _, li := range o.Items[rubyBaseIdx+1:] {
+				base.Text += li.Text
 			}
-		case html.StartTagToken:
-			if matches := webVTTRegexpTag.FindStringSubmatch(string(tr.Raw())); len(matches) > 4 {
-				tagName := matches[2]
+			base.RubyText = t
+			o.Items = append(o.Items[:rubyBaseIdx], base)
+		}
+		inRubyText, rubyText = false, ""
+		rubyBaseIdx = len(o.Items)
+	}
 
-				var classes []string
-				if matches[3] != "" {
-					classes = strings.Split(strings.Trim(matches[3], "."), ".")
+	// Timestamps apply to the following text
+	var startAt time.Duration
+
+	// Loop through tokens
+	for _, t := range tokenizeWebVTTCueText(i) {
+		switch t.t {
+		case webVTTTokenTypeEndTag:
+			switch t.value {
+			case "v":
+				speaker = nil
+			case "rt":
+				if inRubyText {
+					endRubyText()
 				}
-
-				annotation := ""
-				if matches[4] != "" {
-					annotation = strings.TrimSpace(matches[4])
+			case "ruby":
+				if inRubyText {
+					endRubyText()
 				}
-
-				if tagName == "v" {
-					if o.VoiceName == "" {
-						// Only get voicename of the first <v> appears in the line
-						o.VoiceName = annotation
-					} else {
-						// TODO: do something with other <v> instead of ignoring
-						log.Printf("astisub: found another voice name %q in %q. Ignore", annotation, i)
-					}
-					continue
+				inRuby = false
+			default:
+				// End tags that don't match the current tag are ignored
+				if len(webVTTTagStack) > 0 && webVTTTagStack[len(webVTTTagStack)-1].Name == t.value {
+					webVTTTagStack = webVTTTagStack[:len(webVTTTagStack)-1]
 				}
-
-				// Push the tag to stack
+			}
+		case webVTTTokenTypeStartTag:
+			switch t.value {
+			case "":
+				// Tags without name are ignored
+			case "v":
+				// The line voice name is the one of the first <v> appearing in the line
+				if o.VoiceName == "" {
+					o.VoiceName = t.annotation
+				}
+				speaker = &Speaker{ID: t.annotation, Name: t.annotation}
+			case "ruby":
+				inRuby = true
+				rubyBaseIdx = len(o.Items)
+			case "rt":
+				if inRuby {
+					inRubyText = true
+				}
+			default:
 				webVTTTagStack = append(webVTTTagStack, WebVTTTag{
-					Name:       tagName,
-					Classes:    classes,
-					Annotation: annotation,
+					Name:       t.value,
+					Classes:    t.classes,
+					Annotation: t.annotation,
 				})
 			}
+		case webVTTTokenTypeTimestamp:
+			d, err := parseDurationWebVTT(t.value)
+			if err != nil {
+				log.Printf("astisub: parsing webvtt duration %s failed, ignoring: %v", t.value, err)
+				continue
+			}
+			startAt = d
+		case webVTTTokenTypeString:
+			// Ruby annotation
+			if inRubyText {
+				rubyText += t.value
+				continue
+			}
+
+			// Text nodes are kept as written, whitespace included
+			if t.value == "" {
+				continue
+			}
 
-		case html.TextToken:
 			// Get style attribute
 			var sa *StyleAttributes
 			if len(webVTTTagStack) > 0 {
@@ -370,59 +629,16 @@ func parseTextWebVTT(i string) (o Line) {
 				sa.propagateWebVTTAttributes()
 			}
 
-			// Append items
-			o.Items = append(o.Items, parseTextWebVTTTextToken(sa, string(tr.Raw()))...)
-		}
-	}
-	return
-}
-
-func parseTextWebVTTTextToken(sa *StyleAttributes, line string) (ret []LineItem) {
-	// split the line by inline timestamps
-	indexes := webVTTRegexpInlineTimestamp.FindAllStringSubmatchIndex(line, -1)
-
-	if len(indexes) == 0 {
-		if s := strings.TrimSpace(line); s != "" {
-			return []LineItem{{
+			// Append item
+			o.Items = append(o.Items, LineItem{
 				InlineStyle: sa,
-				Text:        unescapeWebVTT(s),
-			}}
-		}
-		return
-	}
-
-	// get the text before the first timestamp
-	if s := strings.TrimSpace(line[:indexes[0][0]]); s != "" {
-		ret = append(ret, LineItem{
-			InlineStyle: sa,
-			Text:        unescapeWebVTT(s),
-		})
-	}
-
-	for i, match := range indexes {
-		// get the text between the timestamps
-		endIndex := len(line)
-		if i+1 < len(indexes) {
-			endIndex = indexes[i+1][0]
-		}
-		s := strings.TrimSpace(line[match[1]:endIndex])
-		if s == "" {
-			continue
+				Speaker:     speaker,
+				StartAt:     startAt,
+				Text:        t.value,
+			})
+			startAt = 0
 		}
-
-		// Parse timestamp
-		t, err := parseDurationWebVTT(line[match[2]:match[3]])
-		if err != nil {
-			log.Printf("astisub: parsing webvtt duration %s failed, ignoring: %v", line[match[2]:match[3]], err)
-		}
-
-		ret = append(ret, LineItem{
-			InlineStyle: sa,
-			StartAt:     t,
-			Text:        unescapeWebVTT(s),
-		})
 	}
-
 	return
 }
 
@@ -442,23 +658,99 @@ func (s Subtitles) WriteToWebVTTFile(dst string, offset float64) error {
 }
 
 // WriteToWebVTT writes subtitles in .vtt format
+// It returns ErrNoSubtitlesToWrite when there are no items, use WriteToWebVTTWithSync to write a header only file
 func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 	// Do not write anything if no subtitles
-	// if len(s.Items) == 0 {
-	// 	err = ErrNoSubtitlesToWrite
-	// 	return
-	// }
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
 	return s.WriteToWebVTTWithSync(o, 0)
 }
 
 // WriteToWebVTTWithSync writes subtitles in .vtt format
 func (s Subtitles) WriteToWebVTTWithSync(o io.Writer, offset float64) (err error) {
+	var timestampMap string
+	if offset != 0 {
+		timestampMap = fmt.Sprintf("MPEGTS:%d,LOCAL:00:00:00.000", NewPTS(time.Duration(offset*float64(time.Second))))
+	}
+	return s.writeToWebVTT(o, timestampMap)
+}
+
+// writeToWebVTT writes subtitles in .vtt format with an optional X-TIMESTAMP-MAP value
+func (s Subtitles) writeToWebVTT(o io.Writer, timestampMap string) (err error) {
+	// Tags and cue settings are derived from the generic style attributes when webvtt ones are missing
+	s = s.withGenericAttributes()
+
 	// Add header
-	var c []byte
-	if offset == 0 {
+	var c = s.webVTTHeaderBytes(timestampMap)
+	var classes = s.webVTTStyleClasses()
+
+	// Identifiers that are not numbers are kept as long as they're unique, others are replaced with the item
+	// position so that they can't collide
+	var ids = make(map[string]int)
+	for _, item := range s.Items {
+		if _, err := strconv.Atoi(item.WebVTTID); err != nil && item.WebVTTID != "" {
+			ids[item.WebVTTID]++
+		}
+	}
+
+	// Loop through subtitles
+	for index, item := range s.Items {
+		// Add comments
+		if len(item.Comments) > 0 {
+			c = append(c, []byte("NOTE ")...)
+			for _, comment := range item.Comments {
+				c = append(c, []byte(comment)...)
+				c = append(c, bytesLineSeparator...)
+			}
+			c = append(c, bytesLineSeparator...)
+		}
+
+		// Add identifier, which ::cue(#id) rules may refer to
+		if ids[item.WebVTTID] == 1 {
+			c = append(c, []byte(item.WebVTTID)...)
+		} else {
+			c = append(c, []byte(strconv.Itoa(index+1))...)
+		}
+		c = append(c, bytesLineSeparator...)
+
+		// Add time boundaries
+		c = append(c, []byte(formatDurationWebVTT(item.StartAt))...)
+		c = append(c, bytesWebVTTTimeBoundariesSeparator...)
+		c = append(c, []byte(formatDurationWebVTT(item.EndAt))...)
+
+		// Add styles
+		c = append(c, item.webVTTCueSettingsBytes()...)
+
+		// Add new line
+		c = append(c, bytesLineSeparator...)
+
+		// Add lines
+		c = append(c, s.webVTTPayloadBytes(*item, classes)...)
+
+		// Add new line
+		c = append(c, bytesLineSeparator...)
+	}
+
+	// Remove last new line
+	c = c[:len(c)-1]
+
+	// Write
+	if _, err = o.Write(c); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
+
+// webVTTHeaderBytes returns the header as well as the style and region blocks
+func (s Subtitles) webVTTHeaderBytes(timestampMap string) (c []byte) {
+	// Add header
+	if timestampMap == "" {
 		c = append(c, []byte("WEBVTT\n\n")...)
 	} else {
-		c = append(c, []byte(fmt.Sprintf("WEBVTT\n%s=MPEGTS:%d,LOCAL:00:00:00.000\n\n", webvttTimestampMap, int(offset*90000)))...)
+		c = append(c, []byte(fmt.Sprintf("WEBVTT\n%s=%s\n\n", webvttTimestampMap, timestampMap))...)
 	}
 	var style []string
 	for _, s := range s.Styles {
@@ -467,6 +759,26 @@ func (s Subtitles) WriteToWebVTTWithSync(o io.Writer, offset float64) (err error
 		}
 	}
 
+	// Add rules for other styles. Styles created from ::cue rules are only added if the CSS they come from is
+	// not available.
+	var rules []string
+	classes := s.webVTTStyleClasses()
+	for _, st := range s.Styles {
+		var selector string
+		if c, ok := classes[st]; ok {
+			selector = "::cue(." + c + ")"
+		} else if len(style) == 0 && strings.HasPrefix(st.ID, "::cue") {
+			selector = st.ID
+		} else {
+			continue
+		}
+		if ds := st.InlineStyle.webVTTCSSDeclarations(); len(ds) > 0 {
+			rules = append(rules, selector+" {\n"+strings.Join(ds, ";\n")+";\n}")
+		}
+	}
+	sort.Strings(rules)
+	style = append(style, rules...)
+
 	if len(style) > 0 {
 		c = append(c, []byte(fmt.Sprintf("STYLE\n%s\n\n", strings.Join(style, "\n")))...)
 	}
@@ -520,117 +832,141 @@ func (s Subtitles) WriteToWebVTTWithSync(o io.Writer, offset float64) (err error
 	if len(s.Regions) > 0 {
 		c = append(c, bytesLineSeparator...)
 	}
+	return
+}
 
-	// Loop through subtitles
-	for index, item := range s.Items {
-		// Add comments
-		if len(item.Comments) > 0 {
-			c = append(c, []byte("NOTE ")...)
-			for _, comment := range item.Comments {
-				c = append(c, []byte(comment)...)
-				c = append(c, bytesLineSeparator...)
-			}
-			c = append(c, bytesLineSeparator...)
+// webVTTCueSettingsBytes returns the cue settings of the item, each of them preceded by a space
+func (i Item) webVTTCueSettingsBytes() (c []byte) {
+	if i.InlineStyle != nil {
+		if i.InlineStyle.WebVTTAlign != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("align:"+i.InlineStyle.WebVTTAlign)...)
+		} else if i.Style != nil && i.Style.InlineStyle != nil && i.Style.InlineStyle.WebVTTAlign != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("align:"+i.Style.InlineStyle.WebVTTAlign)...)
 		}
-
-		// Add time boundaries
-		c = append(c, []byte(strconv.Itoa(index+1))...)
-		c = append(c, bytesLineSeparator...)
-		c = append(c, []byte(formatDurationWebVTT(item.StartAt))...)
-		c = append(c, bytesWebVTTTimeBoundariesSeparator...)
-		c = append(c, []byte(formatDurationWebVTT(item.EndAt))...)
-
-		// Add styles
-		if item.InlineStyle != nil {
-			if item.InlineStyle.WebVTTAlign != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("align:"+item.InlineStyle.WebVTTAlign)...)
-			} else if item.Style != nil && item.Style.InlineStyle != nil && item.Style.InlineStyle.WebVTTAlign != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("align:"+item.Style.InlineStyle.WebVTTAlign)...)
-			}
-			if item.InlineStyle.WebVTTLine != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("line:"+item.InlineStyle.WebVTTLine)...)
-			} else if item.Style != nil && item.Style.InlineStyle != nil && item.Style.InlineStyle.WebVTTLine != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("line:"+item.Style.InlineStyle.WebVTTLine)...)
-			}
-			if item.InlineStyle.WebVTTPosition != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("position:"+item.InlineStyle.WebVTTPosition)...)
-			} else if item.Style != nil && item.Style.InlineStyle != nil && item.Style.InlineStyle.WebVTTPosition != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("position:"+item.Style.InlineStyle.WebVTTPosition)...)
-			}
-			if item.Region != nil {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("region:"+item.Region.ID)...)
-			}
-			if item.InlineStyle.WebVTTSize != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("size:"+item.InlineStyle.WebVTTSize)...)
-			} else if item.Style != nil && item.Style.InlineStyle != nil && item.Style.InlineStyle.WebVTTSize != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("size:"+item.Style.InlineStyle.WebVTTSize)...)
-			}
-			if item.InlineStyle.WebVTTVertical != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("vertical:"+item.InlineStyle.WebVTTVertical)...)
-			} else if item.Style != nil && item.Style.InlineStyle != nil && item.Style.InlineStyle.WebVTTVertical != "" {
-				c = append(c, bytesSpace...)
-				c = append(c, []byte("vertical:"+item.Style.InlineStyle.WebVTTVertical)...)
-			}
+		if i.InlineStyle.WebVTTLine != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("line:"+i.InlineStyle.WebVTTLine)...)
+		} else if i.Style != nil && i.Style.InlineStyle != nil && i.Style.InlineStyle.WebVTTLine != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("line:"+i.Style.InlineStyle.WebVTTLine)...)
 		}
-
-		// Add new line
-		c = append(c, bytesLineSeparator...)
-
-		// Loop through lines
-		for _, l := range item.Lines {
-			c = append(c, l.webVTTBytes()...)
+		if i.InlineStyle.WebVTTPosition != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("position:"+i.InlineStyle.WebVTTPosition)...)
+		} else if i.Style != nil && i.Style.InlineStyle != nil && i.Style.InlineStyle.WebVTTPosition != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("position:"+i.Style.InlineStyle.WebVTTPosition)...)
 		}
+		if i.Region != nil {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("region:"+i.Region.ID)...)
+		}
+		if i.InlineStyle.WebVTTSize != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("size:"+i.InlineStyle.WebVTTSize)...)
+		} else if i.Style != nil && i.Style.InlineStyle != nil && i.Style.InlineStyle.WebVTTSize != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("size:"+i.Style.InlineStyle.WebVTTSize)...)
+		}
+		if i.InlineStyle.WebVTTVertical != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("vertical:"+i.InlineStyle.WebVTTVertical)...)
+		} else if i.Style != nil && i.Style.InlineStyle != nil && i.Style.InlineStyle.WebVTTVertical != "" {
+			c = append(c, bytesSpace...)
+			c = append(c, []byte("vertical:"+i.Style.InlineStyle.WebVTTVertical)...)
+		}
+	}
+	return
+}
 
-		// Add new line
+// webVTTPayloadBytes returns the cue payload of the item, lines being written verbatim for chapters and metadata
+// tracks
+func (s Subtitles) webVTTPayloadBytes(i Item, classes map[*Style]string) (c []byte) {
+	if s.Metadata == nil || !s.Metadata.WebVTTKind.hasRawPayloads() {
+		return i.webVTTLinesBytes(classes)
+	}
+	for _, l := range i.Lines {
+		c = append(c, []byte(l.String())...)
 		c = append(c, bytesLineSeparator...)
 	}
+	return
+}
 
-	// Remove last new line
-	c = c[:len(c)-1]
-
-	// Write
-	if _, err = o.Write(c); err != nil {
-		err = fmt.Errorf("astisub: writing failed: %w", err)
-		return
+// webVTTLinesBytes returns the lines of the item, text using styles expressed as CSS rules being wrapped in
+// the matching class
+func (i Item) webVTTLinesBytes(classes map[*Style]string) (c []byte) {
+	for _, l := range i.Lines {
+		c = append(c, l.webVTTBytes(classes[i.Style], classes)...)
 	}
 	return
 }
 
-func (l Line) webVTTBytes() (c []byte) {
-	if l.VoiceName != "" {
+func (l Line) webVTTBytes(class string, classes map[*Style]string) (c []byte) {
+	// Voices are either expressed per line item or for the whole line
+	var perItem bool
+	for _, li := range l.Items {
+		if li.Speaker != nil {
+			perItem = true
+			break
+		}
+	}
+	if !perItem && l.VoiceName != "" {
 		c = append(c, []byte("<v "+l.VoiceName+">")...)
 	}
-	for idx, li := range l.Items {
-		c = append(c, li.webVTTBytes()...)
-		// condition to avoid adding space as the last character.
-		if idx < len(l.Items)-1 {
-			c = append(c, []byte(" ")...)
+	if class != "" {
+		c = append(c, []byte("<c."+class+">")...)
+	}
+	var speaker *Speaker
+	for _, li := range l.Items {
+		// Voice span changes. The last voice span is not closed since it ends with the line.
+		if perItem && li.Speaker != speaker {
+			if speaker != nil {
+				c = append(c, []byte("</v>")...)
+			}
+			if li.Speaker != nil {
+				c = append(c, []byte("<v "+li.Speaker.Name+">")...)
+			}
+			speaker = li.Speaker
 		}
+		c = append(c, li.webVTTBytes(class, classes)...)
+	}
+	if class != "" {
+		c = append(c, []byte("</c>")...)
 	}
 	c = append(c, bytesLineSeparator...)
 	return
 }
 
-func (li LineItem) webVTTBytes() (c []byte) {
+func (li LineItem) webVTTBytes(lineClass string, classes map[*Style]string) (c []byte) {
 	// Add timestamp
 	if li.StartAt > 0 {
 		c = append(c, []byte("<"+formatDurationWebVTT(li.StartAt)+">")...)
 	}
 
+	// Get class
+	class := classes[li.Style]
+	if class == lineClass {
+		class = ""
+	}
+	if class != "" {
+		c = append(c, []byte("<c."+class+">")...)
+	}
+
 	// Get color
 	var color string
 	if li.InlineStyle != nil && li.InlineStyle.TTMLColor != nil {
-		color = cssColor(*li.InlineStyle.TTMLColor)
+		color = cssColor(li.InlineStyle.TTMLColor)
+
+		// Color may already be expressed by a tag
+		for _, t := range li.InlineStyle.WebVTTTags {
+			for _, c := range t.Classes {
+				if t.Name == "c" && c == color {
+					color = ""
+				}
+			}
+		}
 	}
 
 	// Append
@@ -642,7 +978,11 @@ func (li LineItem) webVTTBytes() (c []byte) {
 			c = append(c, []byte(tag.startTag())...)
 		}
 	}
-	c = append(c, []byte(escapeWebVTT(li.Text))...)
+	if li.RubyText != "" {
+		c = append(c, []byte("<ruby>"+escapeWebVTT(li.Text)+"<rt>"+escapeWebVTT(li.RubyText)+"</rt></ruby>")...)
+	} else {
+		c = append(c, []byte(escapeWebVTT(li.Text))...)
+	}
 	if li.InlineStyle != nil {
 		noTags := len(li.InlineStyle.WebVTTTags)
 		for i := noTags - 1; i >= 0; i-- {
@@ -652,16 +992,429 @@ func (li LineItem) webVTTBytes() (c []byte) {
 	if color != "" {
 		c = append(c, []byte("</c>")...)
 	}
+	if class != "" {
+		c = append(c, []byte("</c>")...)
+	}
+	return
+}
+
+// WebVTT default color classes
+// https://www.w3.org/TR/webvtt1/#default-text-color
+var webVTTClassColors = map[string]*Color{
+	"black":   ColorBlack,
+	"blue":    ColorBlue,
+	"cyan":    ColorCyan,
+	"lime":    ColorLime,
+	"magenta": ColorMagenta,
+	"red":     ColorRed,
+	"white":   ColorWhite,
+	"yellow":  ColorYellow,
+}
+
+func cssColor(c *Color) string {
+	colors := map[Color]string{
+		*ColorCyan:    "cyan",    // narrator, thought
+		*ColorYellow:  "yellow",  // out of vision
+		*ColorRed:     "red",     // noises
+		*ColorMagenta: "magenta", // song
+		*ColorLime:    "lime",    // foreign speak
+	}
+	return colors[*c] // returning the empty string is ok
+}
+
+// webVTTCSSSelector represents a ::cue selector such as "::cue", "::cue(.class)", "::cue(v[voice="x"])" or
+// "::cue(#id)"
+type webVTTCSSSelector struct {
+	classes []string
+	id      string
+	tag     string
+	voice   string
+}
+
+// webVTTRegexpCSSSelectorPart matches parts of a ::cue selector argument
+var webVTTRegexpCSSSelectorPart = regexp.MustCompile(`^(?:([.#])((?:\\[0-9a-fA-F]{1,6} ?|\\.|[\w-])+)|\[\s*voice\s*=\s*"([^"]*)"\s*\]|([a-zA-Z][\w-]*))`)
+
+// newWebVTTCSSSelector parses a ::cue selector and returns false if it's not supported
+func newWebVTTCSSSelector(i string) (s webVTTCSSSelector, ok bool) {
+	i = strings.TrimSpace(i)
+	if i == "::cue" {
+		return s, true
+	}
+	if !strings.HasPrefix(i, "::cue(") || !strings.HasSuffix(i, ")") {
+		return
+	}
+	i = strings.TrimSpace(i[len("::cue(") : len(i)-1])
+	for len(i) > 0 {
+		m := webVTTRegexpCSSSelectorPart.FindStringSubmatch(i)
+		if m == nil {
+			return
+		}
+		switch {
+		case m[1] == ".":
+			s.classes = append(s.classes, unescapeCSS(m[2]))
+		case m[1] == "#":
+			s.id = unescapeCSS(m[2])
+		case m[4] != "":
+			// The tag must come first
+			if s.tag != "" || s.id != "" || s.voice != "" || len(s.classes) > 0 {
+				return
+			}
+			s.tag = m[4]
+		default:
+			s.voice = m[3]
+		}
+		i = i[len(m[0]):]
+	}
+	return s, true
+}
+
+// specificity returns the selector specificity following CSS rules
+func (s webVTTCSSSelector) specificity() (o int) {
+	if s.id != "" {
+		o += 100
+	}
+	o += 10 * len(s.classes)
+	if s.voice != "" {
+		o += 10
+	}
+	if s.tag != "" {
+		o++
+	}
+	return
+}
+
+// matchesTags checks whether the selector matches a text wrapped in the provided tags and spoken by the
+// provided speaker
+func (s webVTTCSSSelector) matchesTags(tags []WebVTTTag, speaker *Speaker) bool {
+	// Voices are not kept in the tag stack
+	if s.tag == "v" || s.voice != "" {
+		if speaker == nil || (s.voice != "" && s.voice != speaker.Name && s.voice != speaker.ID) {
+			return false
+		}
+		return len(s.classes) == 0
+	}
+	for _, t := range tags {
+		if s.tag != "" && s.tag != t.Name {
+			continue
+		}
+		found := 0
+		for _, c := range s.classes {
+			for _, tc := range t.Classes {
+				if c == tc {
+					found++
+					break
+				}
+			}
+		}
+		if found == len(s.classes) {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeCSS unescapes CSS identifiers such as "\31 23"
+func unescapeCSS(i string) string {
+	if !strings.Contains(i, "\\") {
+		return i
+	}
+	var b strings.Builder
+	for idx := 0; idx < len(i); idx++ {
+		if i[idx] != '\\' || idx == len(i)-1 {
+			b.WriteByte(i[idx])
+			continue
+		}
+		var j = idx + 1
+		for j < len(i) && j-idx <= 6 && strings.ContainsRune("0123456789abcdefABCDEF", rune(i[j])) {
+			j++
+		}
+		if j == idx+1 {
+			b.WriteByte(i[j])
+			idx = j
+			continue
+		}
+		v, _ := strconv.ParseUint(i[idx+1:j], 16, 32)
+		b.WriteRune(rune(v))
+		if j < len(i) && i[j] == ' ' {
+			j++
+		}
+		idx = j - 1
+	}
+	return b.String()
+}
+
+// webVTTCSSRule represents a CSS rule found in a STYLE block
+type webVTTCSSRule struct {
+	declarations [][2]string
+	selector     webVTTCSSSelector
+	selectorText string
+}
+
+// webVTTRegexpCSSComment matches CSS comments
+var webVTTRegexpCSSComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// parseWebVTTCSS parses the CSS of STYLE blocks. Rules whose selector is not a supported ::cue selector are
+// ignored.
+func parseWebVTTCSS(i string) (rs []webVTTCSSRule) {
+	i = webVTTRegexpCSSComment.ReplaceAllString(i, "")
+	for _, block := range strings.Split(i, "}") {
+		idx := strings.Index(block, "{")
+		if idx < 0 {
+			continue
+		}
+		var ds [][2]string
+		for _, d := range strings.Split(block[idx+1:], ";") {
+			ps := strings.SplitN(d, ":", 2)
+			if len(ps) != 2 {
+				continue
+			}
+			ds = append(ds, [2]string{strings.ToLower(strings.TrimSpace(ps[0])), strings.TrimSpace(ps[1])})
+		}
+		for _, st := range strings.Split(block[:idx], ",") {
+			st = strings.TrimSpace(st)
+			s, ok := newWebVTTCSSSelector(st)
+			if !ok {
+				continue
+			}
+			rs = append(rs, webVTTCSSRule{
+				declarations: ds,
+				selector:     s,
+				selectorText: st,
+			})
+		}
+	}
 	return
 }
 
-func cssColor(rgb string) string {
-	colors := map[string]string{
-		"#00ffff": "cyan",    // narrator, thought
-		"#ffff00": "yellow",  // out of vision
-		"#ff0000": "red",     // noises
-		"#ff00ff": "magenta", // song
-		"#00ff00": "lime",    // foreign speak
+// newColorFromCSSString parses a CSS color and returns nil if it's not supported
+func newColorFromCSSString(i string) *Color {
+	// CSS alpha values are between 0 and 1 whereas TTML ones are between 0 and 255
+	if strings.HasPrefix(i, "rgba(") && strings.HasSuffix(i, ")") {
+		ps := strings.Split(i[len("rgba("):len(i)-1], ",")
+		if len(ps) != 4 {
+			return nil
+		}
+		a, err := strconv.ParseFloat(strings.TrimSpace(ps[3]), 64)
+		if err != nil || a < 0 || a > 1 {
+			return nil
+		}
+		c, err := newColorFromTTMLString("rgb(" + strings.Join(ps[:3], ",") + ")")
+		if err != nil {
+			return nil
+		}
+		c = &Color{Blue: c.Blue, Green: c.Green, Red: c.Red, Alpha: 255 - uint8(math.Round(a*255))}
+		return c
+	}
+	c, err := newColorFromTTMLString(i)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// cssString expresses the color as a CSS color
+func (c *Color) cssString() string {
+	if c.Alpha > 0 {
+		return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.Red, c.Green, c.Blue, strconv.FormatFloat(math.Round(float64(255-c.Alpha)/255*100)/100, 'f', -1, 64))
+	}
+	return "#" + c.TTMLString()
+}
+
+// applyWebVTTCSSDeclaration sets the style attributes matching a CSS declaration. Unsupported properties and
+// values are ignored.
+func (sa *StyleAttributes) applyWebVTTCSSDeclaration(property, value string) {
+	switch property {
+	case "background-color":
+		if c := newColorFromCSSString(value); c != nil {
+			sa.BackgroundColor = c
+		}
+	case "color":
+		if c := newColorFromCSSString(value); c != nil {
+			sa.Color = c
+		}
+	case "font-family":
+		if f := strings.Trim(strings.TrimSpace(strings.Split(value, ",")[0]), `"'`); f != "" {
+			sa.FontFamily = f
+		}
+	case "font-size":
+		if strings.HasSuffix(value, "vh") {
+			if f, err := strconv.ParseFloat(strings.TrimSuffix(value, "vh"), 64); err == nil {
+				sa.FontSize = astikit.Float64Ptr(f)
+			}
+		}
+	case "font-style":
+		sa.Italic = astikit.BoolPtr(value == "italic" || value == "oblique")
+	case "font-weight":
+		if w, err := strconv.Atoi(value); err == nil {
+			sa.Bold = astikit.BoolPtr(w >= 600)
+		} else {
+			sa.Bold = astikit.BoolPtr(value == "bold" || value == "bolder")
+		}
+	case "text-decoration", "text-decoration-line":
+		for _, v := range strings.Fields(value) {
+			switch v {
+			case "line-through":
+				sa.Strikeout = astikit.BoolPtr(true)
+			case "none":
+				sa.Strikeout = astikit.BoolPtr(false)
+				sa.Underline = astikit.BoolPtr(false)
+			case "underline":
+				sa.Underline = astikit.BoolPtr(true)
+			}
+		}
+	case "text-shadow":
+		// Only the first shadow is used, its offset being mapped to a shadow depth
+		var offset *float64
+		var color *Color
+		for _, v := range strings.Fields(strings.Split(value, ",")[0]) {
+			if strings.HasSuffix(v, "px") {
+				if f, err := strconv.ParseFloat(strings.TrimSuffix(v, "px"), 64); err == nil && offset == nil {
+					offset = astikit.Float64Ptr(math.Abs(f))
+				}
+			} else if c := newColorFromCSSString(v); c != nil {
+				color = c
+			}
+		}
+		if offset != nil {
+			sa.ShadowOffset = offset
+		}
+		if color != nil {
+			sa.ShadowColor = color
+		}
+	}
+}
+
+// webVTTCSSDeclarations returns the CSS declarations matching the style attributes
+func (sa *StyleAttributes) webVTTCSSDeclarations() (ds []string) {
+	if sa == nil {
+		return
+	}
+	if sa.BackgroundColor != nil {
+		ds = append(ds, "background-color: "+sa.BackgroundColor.cssString())
+	}
+	if sa.Color != nil {
+		ds = append(ds, "color: "+sa.Color.cssString())
+	}
+	if sa.FontFamily != "" {
+		ds = append(ds, "font-family: "+strconv.Quote(sa.FontFamily))
+	}
+	if sa.FontSize != nil {
+		ds = append(ds, "font-size: "+strconv.FormatFloat(math.Round(*sa.FontSize*100)/100, 'f', -1, 64)+"vh")
+	}
+	if sa.Italic != nil {
+		if *sa.Italic {
+			ds = append(ds, "font-style: italic")
+		} else {
+			ds = append(ds, "font-style: normal")
+		}
+	}
+	if sa.Bold != nil {
+		if *sa.Bold {
+			ds = append(ds, "font-weight: bold")
+		} else {
+			ds = append(ds, "font-weight: normal")
+		}
+	}
+	var decorations []string
+	if sa.Underline != nil && *sa.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if sa.Strikeout != nil && *sa.Strikeout {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		ds = append(ds, "text-decoration: "+strings.Join(decorations, " "))
+	}
+	if sa.ShadowOffset != nil && *sa.ShadowOffset > 0 {
+		d := "text-shadow: " + strconv.FormatFloat(*sa.ShadowOffset, 'f', -1, 64) + "px " + strconv.FormatFloat(*sa.ShadowOffset, 'f', -1, 64) + "px"
+		if sa.ShadowColor != nil {
+			d += " " + sa.ShadowColor.cssString()
+		}
+		ds = append(ds, d)
+	}
+	return
+}
+
+// webVTTRegexpCSSClassInvalidChars matches characters that can't be used in class names
+var webVTTRegexpCSSClassInvalidChars = regexp.MustCompile(`[^\w-]`)
+
+// webVTTStyleClasses returns the class of styles that must be expressed as CSS rules. Styles created from
+// ::cue rules are expressed through their selector instead.
+func (s Subtitles) webVTTStyleClasses() (o map[*Style]string) {
+	o = make(map[*Style]string)
+	for _, st := range s.Styles {
+		if strings.HasPrefix(st.ID, "::cue") || len(st.InlineStyle.webVTTCSSDeclarations()) == 0 {
+			continue
+		}
+		c := webVTTRegexpCSSClassInvalidChars.ReplaceAllString(st.ID, "_")
+		if c == "" || (c[0] >= '0' && c[0] <= '9') || c[0] == '-' {
+			c = "_" + c
+		}
+		o[st] = c
+	}
+	return
+}
+
+// resolveWebVTTCSS adds a style for each ::cue rule and makes items and line items matching those rules
+// use them
+func (s *Subtitles) resolveWebVTTCSS(css string) {
+	// Add styles
+	var rules = parseWebVTTCSS(css)
+	var styles = make(map[string]*Style)
+	for _, r := range rules {
+		st, ok := styles[r.selectorText]
+		if !ok {
+			st = &Style{ID: r.selectorText, InlineStyle: &StyleAttributes{}}
+			styles[r.selectorText] = st
+			s.Styles[st.ID] = st
+		}
+		for _, d := range r.declarations {
+			st.InlineStyle.applyWebVTTCSSDeclaration(d[0], d[1])
+		}
+	}
+
+	// Rules matching every cue are the parent of other rules
+	root := styles["::cue"]
+	if root != nil {
+		for _, st := range styles {
+			if st != root {
+				st.Style = root
+			}
+		}
+	}
+
+	// The most specific rule wins, the last one if specificities are equal
+	var match = func(fn func(sel webVTTCSSSelector) bool) (o *Style) {
+		var specificity = -1
+		for _, r := range rules {
+			if r.selector.specificity() >= specificity && fn(r.selector) {
+				o = styles[r.selectorText]
+				specificity = r.selector.specificity()
+			}
+		}
+		return
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		if st := match(func(sel webVTTCSSSelector) bool {
+			return sel.tag == "" && sel.voice == "" && len(sel.classes) == 0 && (sel.id == "" || sel.id == i.WebVTTID)
+		}); st != nil && i.Style == nil {
+			i.Style = st
+		}
+		for _, l := range i.Lines {
+			for idx := range l.Items {
+				li := &l.Items[idx]
+				var tags []WebVTTTag
+				if li.InlineStyle != nil {
+					tags = li.InlineStyle.WebVTTTags
+				}
+				if st := match(func(sel webVTTCSSSelector) bool {
+					return sel.id == "" && (sel.tag != "" || sel.voice != "" || len(sel.classes) > 0) && sel.matchesTags(tags, li.Speaker)
+				}); st != nil && li.Style == nil {
+					li.Style = st
+				}
+			}
+		}
 	}
-	return colors[strings.ToLower(rgb)] // returning the empty string is ok
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/asticode/go-astikit"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,7 +26,7 @@ func TestParseTextWebVTT(t *testing.T) {
 		s := parseTextWebVTT(testData)
 		assert.Equal(t, "Bob", s.VoiceName)
 		assert.Equal(t, 1, len(s.Items))
-		assert.Equal(t, "Text without end tag", s.Items[0].Text)
+		assert.Equal(t, " Text without end tag", s.Items[0].Text)
 	})
 
 	t.Run("When the end tag is correct", func(t *testing.T) {
@@ -42,7 +43,7 @@ func TestParseTextWebVTT(t *testing.T) {
 
 		s := parseTextWebVTT(testData)
 		assert.Equal(t, 2, len(s.Items))
-		assert.Equal(t, "With inline", s.Items[0].Text)
+		assert.Equal(t, "With inline ", s.Items[0].Text)
 		assert.Equal(t, time.Minute+time.Second, s.Items[0].StartAt)
 		assert.Equal(t, "timestamps", s.Items[1].Text)
 		assert.Equal(t, time.Minute+2*time.Second, s.Items[1].StartAt)
@@ -65,10 +66,54 @@ func TestParseTextWebVTT(t *testing.T) {
 		assert.Equal(t, "With end timestamp", s.Items[0].Text)
 		assert.Equal(t, time.Duration(0), s.Items[0].StartAt)
 	})
+
+	t.Run("When there are character references", func(t *testing.T) {
+		testData := `a &amp; b &lt;c&gt; &lrm;d&nbsp;e &#x263A; &unknown;`
+
+		s := parseTextWebVTT(testData)
+		assert.Equal(t, 1, len(s.Items))
+		assert.Equal(t, "a & b <c> \u200ed\u00a0e \u263a &unknown;", s.Items[0].Text)
+	})
+
+	t.Run("When spans are nested", func(t *testing.T) {
+		testData := `<c.yellow><b>bold <i>italic</i></b> yellow</c> <lang en-GB>British</lang></u>`
+
+		s := parseTextWebVTT(testData)
+		assert.Equal(t, 5, len(s.Items))
+		assert.Equal(t, "bold ", s.Items[0].Text)
+		assert.Equal(t, []WebVTTTag{{Name: "c", Classes: []string{"yellow"}}, {Name: "b"}}, s.Items[0].InlineStyle.WebVTTTags)
+		assert.Equal(t, &StyleAttributes{Bold: astikit.BoolPtr(true), Color: ColorYellow, WebVTTTags: s.Items[0].InlineStyle.WebVTTTags}, s.Items[0].InlineStyle)
+		assert.Equal(t, "italic", s.Items[1].Text)
+		assert.Equal(t, &StyleAttributes{Bold: astikit.BoolPtr(true), Color: ColorYellow, Italic: astikit.BoolPtr(true), WebVTTTags: s.Items[1].InlineStyle.WebVTTTags}, s.Items[1].InlineStyle)
+		assert.Equal(t, " yellow", s.Items[2].Text)
+		assert.Equal(t, []WebVTTTag{{Name: "c", Classes: []string{"yellow"}}}, s.Items[2].InlineStyle.WebVTTTags)
+		assert.Equal(t, " ", s.Items[3].Text)
+		assert.Nil(t, s.Items[3].InlineStyle)
+		assert.Equal(t, "British", s.Items[4].Text)
+		assert.Equal(t, &StyleAttributes{Lang: "en-GB", WebVTTTags: []WebVTTTag{{Name: "lang", Annotation: "en-GB"}}}, s.Items[4].InlineStyle)
+		assert.Equal(t, "bold italic yellow British", s.String())
+	})
+
+	t.Run("When there are ruby annotations", func(t *testing.T) {
+		testData := `<ruby>漢<rt>かん</rt>字<rt>じ</rt></ruby>を<ruby><b>読</b>む<rt>よ</ruby>`
+
+		s := parseTextWebVTT(testData)
+		assert.Equal(t, 4, len(s.Items))
+		assert.Equal(t, "漢", s.Items[0].Text)
+		assert.Equal(t, "かん", s.Items[0].RubyText)
+		assert.Equal(t, "字", s.Items[1].Text)
+		assert.Equal(t, "じ", s.Items[1].RubyText)
+		assert.Equal(t, "を", s.Items[2].Text)
+		assert.Equal(t, "", s.Items[2].RubyText)
+		assert.Equal(t, "読む", s.Items[3].Text)
+		assert.Equal(t, "よ", s.Items[3].RubyText)
+		assert.Equal(t, "漢字を読む", s.String())
+	})
 }
 
 func TestTimestampMap(t *testing.T) {
 	for i, c := range []struct {
+		base           *PTS
 		line           string
 		expectedOffset time.Duration
 		expectError    bool
@@ -89,6 +134,24 @@ func TestTimestampMap(t *testing.T) {
 			line:           "X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:324090000",
 			expectedOffset: time.Hour + time.Second,
 		},
+		{
+			line:           "X-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:10.000",
+			expectedOffset: -10 * time.Second,
+		},
+		{
+			line:           "X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:8590114592",
+			expectedOffset: 2 * time.Second,
+		},
+		{
+			base:           ptsPtr(PTSRollover - 180000),
+			line:           "X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:180000",
+			expectedOffset: 4 * time.Second,
+		},
+		{
+			base:           ptsPtr(180000),
+			line:           "X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:8589754592",
+			expectedOffset: -4 * time.Second,
+		},
 		{
 			line:        "X-TIMESTAMP-MAP=MPEGTS:foo, LOCAL:00:00:00.000",
 			expectError: true,
@@ -107,7 +170,7 @@ func TestTimestampMap(t *testing.T) {
 		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			offset, err := parseTimestampMapWebVTT(c.line)
+			offset, err := parseTimestampMapWebVTT(c.line, c.base)
 			assert.Equal(t, c.expectedOffset, offset)
 			if c.expectError {
 				assert.Error(t, err)
@@ -118,7 +181,11 @@ func TestTimestampMap(t *testing.T) {
 	}
 }
 
-func TestCueVoiceSpanRegex(t *testing.T) {
+func ptsPtr(p PTS) *PTS {
+	return &p
+}
+
+func TestCueVoiceSpanAnnotation(t *testing.T) {
 	tests := []struct {
 		give string
 		want string
@@ -155,9 +222,11 @@ func TestCueVoiceSpanRegex(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.want, func(t *testing.T) {
-			results := webVTTRegexpTag.FindStringSubmatch(tt.give)
-			assert.True(t, len(results) == 5)
-			assert.Equal(t, tt.want, results[4])
+			tokens := tokenizeWebVTTCueText(tt.give)
+			assert.True(t, len(tokens) > 1)
+			assert.Equal(t, webVTTTokenTypeStartTag, tokens[0].t)
+			assert.Equal(t, "v", tokens[0].value)
+			assert.Equal(t, tt.want, tokens[0].annotation)
 		})
 	}
 }
@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,12 +28,15 @@ func TestWebVTT(t *testing.T) {
 	assert.Equal(t, s.Regions["bill"], s.Items[0].Region)
 	assert.Equal(t, s.Regions["fred"], s.Items[1].Region)
 	// Styles
-	assert.Equal(t, astisub.StyleAttributes{WebVTTAlign: "left", WebVTTPosition: "10%,start", WebVTTSize: "35%"}, *s.Items[1].InlineStyle)
+	assert.Equal(t, astisub.StyleAttributes{TextAlign: &astisub.JustificationLeft, WebVTTAlign: "left", WebVTTPosition: "10%,start", WebVTTSize: "35%"}, *s.Items[1].InlineStyle)
 
 	// No subtitles to write
 	w := &bytes.Buffer{}
 	err = astisub.Subtitles{}.WriteToWebVTT(w)
 	assert.EqualError(t, err, astisub.ErrNoSubtitlesToWrite.Error())
+	require.NoError(t, astisub.Subtitles{}.WriteToWebVTTWithSync(w, 0))
+	assert.Equal(t, "WEBVTT\n", w.String())
+	w.Reset()
 
 	// Write
 	c, err := ioutil.ReadFile("./testdata/example-out.vtt")
@@ -86,11 +91,11 @@ NOTE this a example with voicename
 
 1
 00:02:34.000 --> 00:02:35.000
-<v Roger Bingham>I'm the fist speaker
+<v Roger Bingham> I'm the fist speaker
 
 2
 00:02:34.000 --> 00:02:35.000
-<v Bingham>I'm the second speaker
+<v Bingham> I'm the second speaker
 
 3
 00:00:04.000 --> 00:00:08.000
@@ -212,10 +217,242 @@ func TestWebVTTTags(t *testing.T) {
 
 5
 00:05:00.000 --> 00:06:00.000
-<v Joe>Joe says something Bob says something
+<v Joe>Joe says something</v> <v Bob>Bob says something
 
 6
 00:06:00.000 --> 00:07:00.000
 Text with a <00:06:30.000>timestamp in the middle
 `, b.String())
 }
+
+func TestWebVTTText(t *testing.T) {
+	// Tags in the middle of words and next to punctuation
+	testData := `WEBVTT
+
+1
+00:01:00.000 --> 00:02:00.000
+Hel<b>lo</b> world, <i>it's</i>! "<i>quoted</i>"
+`
+
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(testData))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 1)
+	require.Len(t, s.Items[0].Lines[0].Items, 7)
+	assert.Equal(t, "Hel", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "lo", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, " world, ", s.Items[0].Lines[0].Items[2].Text)
+
+	b := &bytes.Buffer{}
+	err = s.WriteToWebVTT(b)
+	require.NoError(t, err)
+	assert.Equal(t, testData, b.String())
+}
+
+func TestWebVTTCSS(t *testing.T) {
+	// CSS is parsed into styles which are resolved onto items and line items
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(`WEBVTT
+
+STYLE
+::cue {
+  color: white;
+}
+/* comment */
+::cue(.yellow), ::cue(b.yellow) {
+  color: #ff0;
+  font-weight: bold;
+}
+::cue(v[voice="Bob"]) {
+  font-style: italic;
+  text-shadow: 2px 2px black;
+}
+::cue(#2) {
+  background-color: rgba(0, 0, 0, 0.5);
+}
+::cue(#intro) {
+  text-decoration: underline;
+}
+
+1
+00:00:01.000 --> 00:00:02.000
+<c.yellow>Yellow</c> white
+
+2
+00:00:02.000 --> 00:00:03.000
+<v Bob>Bob</v>
+
+3
+00:00:03.000 --> 00:00:04.000
+<v Alice>Hi</v> <v Bob>Yo</v>
+
+intro
+00:00:04.000 --> 00:00:05.000
+Intro`))
+	require.NoError(t, err)
+	require.Contains(t, s.Styles, "::cue")
+	require.Contains(t, s.Styles, "::cue(.yellow)")
+	require.Contains(t, s.Styles, "::cue(v[voice=\"Bob\"])")
+	require.Contains(t, s.Styles, "::cue(#2)")
+	assert.Equal(t, &astisub.StyleAttributes{Color: astisub.ColorWhite}, s.Styles["::cue"].InlineStyle)
+	assert.Equal(t, &astisub.StyleAttributes{Bold: astikit.BoolPtr(true), Color: astisub.ColorYellow}, s.Styles["::cue(.yellow)"].InlineStyle)
+	assert.Equal(t, &astisub.StyleAttributes{Italic: astikit.BoolPtr(true), ShadowColor: astisub.ColorBlack, ShadowOffset: astikit.Float64Ptr(2)}, s.Styles["::cue(v[voice=\"Bob\"])"].InlineStyle)
+	assert.Equal(t, &astisub.StyleAttributes{BackgroundColor: &astisub.Color{Alpha: 127}}, s.Styles["::cue(#2)"].InlineStyle)
+	assert.Equal(t, s.Styles["::cue"], s.Styles["::cue(.yellow)"].Style)
+	assert.Equal(t, s.Styles["::cue"], s.Items[0].Style)
+	assert.Equal(t, s.Styles["::cue(.yellow)"], s.Items[0].Lines[0].Items[0].Style)
+	assert.Nil(t, s.Items[0].Lines[0].Items[1].Style)
+	assert.Equal(t, s.Styles["::cue(#2)"], s.Items[1].Style)
+	assert.Equal(t, s.Styles["::cue(v[voice=\"Bob\"])"], s.Items[1].Lines[0].Items[0].Style)
+
+	// Voices are matched against the speaker of each line item
+	require.Len(t, s.Items[2].Lines[0].Items, 3)
+	assert.Nil(t, s.Items[2].Lines[0].Items[0].Style)
+	assert.Nil(t, s.Items[2].Lines[0].Items[1].Style)
+	assert.Equal(t, s.Styles["::cue(v[voice=\"Bob\"])"], s.Items[2].Lines[0].Items[2].Style)
+
+	// Identifiers are kept as written and matched as strings
+	require.Contains(t, s.Styles, "::cue(#intro)")
+	assert.Equal(t, "2", s.Items[1].WebVTTID)
+	assert.Equal(t, "intro", s.Items[3].WebVTTID)
+	assert.Equal(t, 0, s.Items[3].Index)
+	assert.Equal(t, s.Styles["::cue(#intro)"], s.Items[3].Style)
+	b := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Contains(t, b.String(), "\n\nintro\n00:00:04.000 --> 00:00:05.000\n")
+
+	// Styles coming from other formats are written as CSS rules
+	s = astisub.NewSubtitles()
+	s.Styles["Default"] = &astisub.Style{ID: "Default", InlineStyle: &astisub.StyleAttributes{Bold: astikit.BoolPtr(true), Color: astisub.ColorRed, FontFamily: "Arial"}}
+	s.Items = []*astisub.Item{{
+		EndAt:   2 * time.Second,
+		Lines:   []astisub.Line{{Items: []astisub.LineItem{{Text: "text"}}}},
+		StartAt: time.Second,
+		Style:   s.Styles["Default"],
+	}}
+	b.Reset()
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Equal(t, `WEBVTT
+
+STYLE
+::cue(.Default) {
+color: #ff0000;
+font-family: "Arial";
+font-weight: bold;
+}
+
+1
+00:00:01.000 --> 00:00:02.000
+<c.Default>text</c>
+`, b.String())
+}
+
+func TestWebVTTRuby(t *testing.T) {
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(`WEBVTT
+
+00:00:01.000 --> 00:00:02.000
+<ruby>漢<rt>かん</rt>字<rt>じ</rt></ruby>を<lang en>read</lang>`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 1)
+	require.Len(t, s.Items[0].Lines[0].Items, 4)
+	assert.Equal(t, "漢字をread", s.Items[0].String())
+
+	// WebVTT
+	b := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Equal(t, `WEBVTT
+
+1
+00:00:01.000 --> 00:00:02.000
+<ruby>漢<rt>かん</rt></ruby><ruby>字<rt>じ</rt></ruby>を<lang en>read</lang>
+`, b.String())
+
+	// TTML
+	b.Reset()
+	require.NoError(t, s.WriteToTTML(b))
+	assert.Contains(t, b.String(), `<span tts:ruby="container">`)
+	assert.Contains(t, b.String(), `<span tts:ruby="base">漢</span>`)
+	assert.Contains(t, b.String(), `<span tts:ruby="text">かん</span>`)
+	assert.Contains(t, b.String(), `<span xml:lang="en">read</span>`)
+	s2, err := astisub.ReadFromTTML(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, s2.Items, 1)
+	require.Len(t, s2.Items[0].Lines, 1)
+	require.Len(t, s2.Items[0].Lines[0].Items, 4)
+	assert.Equal(t, "漢", s2.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "かん", s2.Items[0].Lines[0].Items[0].RubyText)
+	assert.Equal(t, "en", s2.Items[0].Lines[0].Items[3].InlineStyle.Lang)
+
+	// SSA
+	b.Reset()
+	require.NoError(t, s.WriteToSSA(b))
+	assert.Contains(t, b.String(), "漢(かん)字(じ)を")
+}
+
+func TestWebVTTMetadata(t *testing.T) {
+	// Payloads are kept verbatim
+	c := `WEBVTT
+
+1
+00:00:01.000 --> 00:00:02.000
+{
+  "id": "ad-1",
+  "note": "a < b && NOTE --> not a cue"
+}
+
+2
+00:00:02.000 --> 00:00:03.000
+<b>not a tag</b>
+`
+	s, err := astisub.ReadFromWebVTTWithOptions(strings.NewReader(c), astisub.WebVTTOptions{Kind: astisub.WebVTTKindMetadata})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	require.Len(t, s.Items[0].Lines, 4)
+	assert.Equal(t, `  "id": "ad-1",`, s.Items[0].Lines[1].String())
+	assert.Equal(t, "<b>not a tag</b>", s.Items[1].String())
+	assert.Equal(t, astisub.WebVTTKindMetadata, s.Metadata.WebVTTKind)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Equal(t, c, b.String())
+
+	// Containers keep payloads verbatim as well
+	b.Reset()
+	require.NoError(t, s.WriteToMatroska(b, astisub.MatroskaTrack{CodecID: astisub.MatroskaCodecIDWebVTT}))
+	assert.Contains(t, b.String(), "<b>not a tag</b>")
+	b.Reset()
+	require.NoError(t, s.WriteToMP4Segment(b, astisub.MP4Options{}))
+	assert.Contains(t, b.String(), `"note": "a < b && NOTE --> not a cue"`)
+}
+
+func TestWebVTTPTSRollover(t *testing.T) {
+	// Segment recorded after the PTS wrapped, read back relative to a base PTS recorded before the wrap
+	base := astisub.PTSRollover - astisub.NewPTS(10*time.Second)
+	s, err := astisub.ReadFromWebVTTWithOptions(strings.NewReader(`WEBVTT
+X-TIMESTAMP-MAP=MPEGTS:180000,LOCAL:00:00:00.000
+
+00:00:01.000 --> 00:00:02.000
+After wrap
+`), astisub.WebVTTOptions{BasePTS: &base})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, 13*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 14*time.Second, s.Items[0].EndAt)
+
+	// Negative offsets are applied
+	s, err = astisub.ReadFromWebVTT(strings.NewReader(`WEBVTT
+X-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:10.000
+
+00:00:11.000 --> 00:00:12.000
+Negative
+`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+
+	// Written MPEGTS values wrap
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToWebVTTWithSync(w, -2))
+	assert.Contains(t, w.String(), "X-TIMESTAMP-MAP=MPEGTS:8589754592,LOCAL:00:00:00.000\n")
+	assert.Equal(t, 2*time.Second, astisub.NewPTS(time.Second).Sub(astisub.PTSRollover-astisub.NewPTS(time.Second)))
+}